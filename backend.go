@@ -28,3 +28,14 @@ type Backend interface {
 	// SendEvent sends event to the backend.
 	SendEvent(context.Context, *Event) error
 }
+
+const (
+	// BackendFailureDrop drops metrics which every backend failed to send.
+	BackendFailureDrop = "drop"
+	// BackendFailureRetry sends metrics which every backend failed to send again in the next flush, and drops them if
+	// that fails too.
+	BackendFailureRetry = "retry"
+	// BackendFailureBlock sends metrics which every backend failed to send again in every flush, until a backend
+	// succeeds.
+	BackendFailureBlock = "block"
+)
@@ -0,0 +1,52 @@
+package gostatsd
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNothingToSend is passed to the SendCallback by a Backend which had nothing to send, such as when every metric
+// was filtered out.  It is neither a success nor a failure, so the backend is not counted as either.
+var ErrNothingToSend = errors.New("nothing to send")
+
+// PermanentError is returned by a Backend when sending failed in a way which will fail again if the same data is
+// sent again, such as the request being rejected as unauthorized or malformed.  Any other error is assumed to be
+// temporary, such as a network error or a server error, and sending again may succeed.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err in a PermanentError, or returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent returns true if err is, or wraps, a PermanentError.
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+// IsNothingToSend returns true if errs is only ErrNothingToSend, which a Backend passes to its SendCallback when it
+// had nothing to send.
+func IsNothingToSend(errs []error) bool {
+	return len(errs) == 1 && errors.Is(errs[0], ErrNothingToSend)
+}
+
+// IsPermanentStatus returns true if a request which failed with the HTTP status code will fail again if it is sent
+// again, which is any 4xx client error except 408 Request Timeout and 429 Too Many Requests.
+func IsPermanentStatus(code int) bool {
+	return code >= http.StatusBadRequest && code < http.StatusInternalServerError &&
+		code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
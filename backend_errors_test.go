@@ -0,0 +1,40 @@
+package gostatsd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermanent(t *testing.T) {
+	t.Parallel()
+	err := errors.New("unauthorized")
+	assert.Nil(t, Permanent(nil))
+	assert.False(t, IsPermanent(nil))
+	assert.False(t, IsPermanent(err))
+	assert.True(t, IsPermanent(Permanent(err)))
+	assert.True(t, IsPermanent(fmt.Errorf("[backend] %w", Permanent(err))))
+	assert.True(t, errors.Is(Permanent(err), err))
+	assert.Equal(t, "unauthorized", Permanent(err).Error())
+}
+
+func TestIsNothingToSend(t *testing.T) {
+	t.Parallel()
+	assert.True(t, IsNothingToSend([]error{ErrNothingToSend}))
+	assert.False(t, IsNothingToSend(nil))
+	assert.False(t, IsNothingToSend([]error{nil}))
+	assert.False(t, IsNothingToSend([]error{errors.New("down")}))
+}
+
+func TestIsPermanentStatus(t *testing.T) {
+	t.Parallel()
+	for _, code := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge} {
+		assert.True(t, IsPermanentStatus(code), code)
+	}
+	for _, code := range []int{http.StatusOK, http.StatusMovedPermanently, http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		assert.False(t, IsPermanentStatus(code), code)
+	}
+}
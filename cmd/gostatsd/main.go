@@ -9,7 +9,9 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -24,6 +26,7 @@ import (
 	"github.com/atlassian/gostatsd/pkg/cachedinstances"
 	"github.com/atlassian/gostatsd/pkg/cachedinstances/cloudprovider"
 	"github.com/atlassian/gostatsd/pkg/cloudproviders"
+	"github.com/atlassian/gostatsd/pkg/enrichers"
 	"github.com/atlassian/gostatsd/pkg/statsd"
 	"github.com/atlassian/gostatsd/pkg/transport"
 )
@@ -39,8 +42,31 @@ const (
 	ParamConfigPath = "config-path"
 	// ParamVersion makes program output its version.
 	ParamVersion = "version"
+	// ParamStrictConfig makes unknown keys in the configuration file an error rather than a warning.
+	ParamStrictConfig = "strict-config"
 )
 
+// configSections are the top level keys of the configuration file which are not a flag, backend, cloud provider, or
+// enricher.
+var configSections = []string{
+	"disabled-sub-metrics",
+	"downsample",
+	"downsamples",
+	"filter",
+	"filters",
+	"http",
+	"http-servers",
+	"http-transport",
+	"sample-expression",
+	"sample-rate",
+	"sample-rates",
+	"source-rate-override",
+	"source-rate-overrides",
+	"transport",
+	"value-transform",
+	"value-transforms",
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 	v, version, err := setupConfiguration()
@@ -105,7 +131,11 @@ func constructServer(v *viper.Viper) (*statsd.Server, error) {
 		case cachedinstances.ErrUnknownProvider:
 			// See if requested cloud provider is a CloudProvider implementation
 			cloudProvider, err := cloudproviders.Get(logger, cloudProviderName, v, Version)
-			if err != nil {
+			if err == cloudproviders.ErrUnknownProvider {
+				available := append(cachedinstances.Names(), cloudproviders.Names()...)
+				sort.Strings(available)
+				return nil, fmt.Errorf("unknown cloud provider %q, available: %v", cloudProviderName, available)
+			} else if err != nil {
 				return nil, err
 			}
 			runnables = gostatsd.MaybeAppendRunnable(runnables, cloudProvider)
@@ -126,11 +156,60 @@ func constructServer(v *viper.Viper) (*statsd.Server, error) {
 		backendsList = append(backendsList, backend)
 		runnables = gostatsd.MaybeAppendRunnable(runnables, backend)
 	}
+	// Enrichers
+	enricherNames := v.GetStringSlice(gostatsd.ParamEnrichers)
+	enrichersList := make([]gostatsd.Enricher, 0, len(enricherNames))
+	for _, enricherName := range enricherNames {
+		enricher, err := enrichers.Get(logger, enricherName, v)
+		if err == enrichers.ErrUnknownEnricher {
+			return nil, fmt.Errorf("unknown enricher %q, available: %v", enricherName, enrichers.Names())
+		} else if err != nil {
+			return nil, err
+		}
+		enrichersList = append(enrichersList, enricher)
+		runnables = gostatsd.MaybeAppendRunnable(runnables, enricher)
+	}
 	// Percentiles
 	pt, err := getPercentiles(v.GetStringSlice(gostatsd.ParamPercentThreshold))
 	if err != nil {
 		return nil, err
 	}
+	interpolation := v.GetString(gostatsd.ParamPercentileInterpolation)
+	if interpolation != gostatsd.PercentileNearestRank && interpolation != gostatsd.PercentileLinear {
+		return nil, fmt.Errorf("%s must be %s or %s", gostatsd.ParamPercentileInterpolation, gostatsd.PercentileNearestRank, gostatsd.PercentileLinear)
+	}
+	percentileNames, err := gostatsd.PercentileNameTemplate(v.GetString(gostatsd.ParamPercentileNames))
+	if err != nil {
+		return nil, err
+	}
+	unknownType, err := gostatsd.ParseUnknownMetricType(v.GetString(gostatsd.ParamUnknownMetricType))
+	if err != nil {
+		return nil, err
+	}
+	counterOverflow := v.GetString(gostatsd.ParamCounterOverflow)
+	if counterOverflow != gostatsd.CounterOverflowSaturate && counterOverflow != gostatsd.CounterOverflowDrop {
+		return nil, fmt.Errorf("%s must be %s or %s", gostatsd.ParamCounterOverflow, gostatsd.CounterOverflowSaturate, gostatsd.CounterOverflowDrop)
+	}
+	backendFailure := v.GetString(gostatsd.ParamBackendFailure)
+	if backendFailure != gostatsd.BackendFailureDrop && backendFailure != gostatsd.BackendFailureRetry && backendFailure != gostatsd.BackendFailureBlock {
+		return nil, fmt.Errorf("%s must be %s, %s, or %s", gostatsd.ParamBackendFailure, gostatsd.BackendFailureDrop, gostatsd.BackendFailureRetry, gostatsd.BackendFailureBlock)
+	}
+	percentileSampleRate := v.GetFloat64(gostatsd.ParamPercentileSampleRate)
+	if percentileSampleRate <= 0 || percentileSampleRate > 1 {
+		return nil, fmt.Errorf("%s must be greater than 0 and at most 1", gostatsd.ParamPercentileSampleRate)
+	}
+	flushWarmup := v.GetDuration(gostatsd.ParamFlushWarmup)
+	if flushWarmup < 0 {
+		return nil, fmt.Errorf("%s must not be negative", gostatsd.ParamFlushWarmup)
+	}
+	counterPeakRateWindow := v.GetDuration(gostatsd.ParamCounterPeakRateWindow)
+	if counterPeakRateWindow <= 0 {
+		return nil, fmt.Errorf("%s must be positive", gostatsd.ParamCounterPeakRateWindow)
+	}
+	rollupIntervals, err := getRollupIntervals(v.GetStringSlice(gostatsd.ParamRollupIntervals))
+	if err != nil {
+		return nil, err
+	}
 
 	// Set defaults for expiry from the main expiry setting
 	v.SetDefault(gostatsd.ParamExpiryIntervalCounter, v.GetDuration(gostatsd.ParamExpiryInterval))
@@ -154,6 +233,7 @@ func constructServer(v *viper.Viper) (*statsd.Server, error) {
 		FlushInterval:         v.GetDuration(gostatsd.ParamFlushInterval),
 		FlushOffset:           v.GetDuration(gostatsd.ParamFlushOffset),
 		FlushAligned:          v.GetBool(gostatsd.ParamFlushAligned),
+		DryRun:                v.GetBool(gostatsd.ParamDryRun),
 		IgnoreHost:            v.GetBool(gostatsd.ParamIgnoreHost),
 		MaxReaders:            v.GetInt(gostatsd.ParamMaxReaders),
 		MaxParsers:            v.GetInt(gostatsd.ParamMaxParsers),
@@ -168,6 +248,7 @@ func constructServer(v *viper.Viper) (*statsd.Server, error) {
 		HeartbeatEnabled:      v.GetBool(gostatsd.ParamHeartbeatEnabled),
 		ReceiveBatchSize:      v.GetInt(gostatsd.ParamReceiveBatchSize),
 		ConnPerReader:         v.GetBool(gostatsd.ParamConnPerReader),
+		ReusePort:             v.GetBool(gostatsd.ParamReusePort),
 		ServerMode:            v.GetString(gostatsd.ParamServerMode),
 		LogRawMetric:          v.GetBool(gostatsd.ParamLogRawMetric),
 		HeartbeatTags: gostatsd.Tags{
@@ -177,8 +258,64 @@ func constructServer(v *viper.Viper) (*statsd.Server, error) {
 		DisabledSubTypes:          gostatsd.DisabledSubMetrics(v),
 		BadLineRateLimitPerSecond: rate.Limit(v.GetFloat64(gostatsd.ParamBadLinesPerMinute) / 60.0),
 		HistogramLimit:            v.GetUint32(gostatsd.ParamTimerHistogramLimit),
+		CardinalityWarnThreshold:  v.GetUint32(gostatsd.ParamCardinalityWarnThreshold),
+		DisablePerSecond:          v.GetBool(gostatsd.ParamDisablePerSecond),
 		Viper:                     v,
+		BackendTimeout:            v.GetDuration(gostatsd.ParamBackendTimeout),
+		BackendCircuitFailures:    v.GetUint(gostatsd.ParamBackendCircuitFailures),
+		BackendCircuitCooldown:    v.GetDuration(gostatsd.ParamBackendCircuitCooldown),
+		NormalizeTags:             v.GetBool(gostatsd.ParamNormalizeTags),
+		FlushMaxMetrics:           v.GetUint64(gostatsd.ParamFlushMaxMetrics),
+		CounterEvents:             v.GetBool(gostatsd.ParamCounterEvents),
+		LinearPercentiles:         interpolation == gostatsd.PercentileLinear,
+		PassthroughGauges:         v.GetStringSlice(gostatsd.ParamPassthroughGauges),
+		CumulativeCounters:        v.GetStringSlice(gostatsd.ParamCumulativeCounters),
+		PercentileNames:           percentileNames,
+		TagPrecedence:             v.GetStringSlice(gostatsd.ParamTagPrecedence),
+		PauseMaxSeries:            v.GetUint64(gostatsd.ParamPauseMaxSeries),
+		TagAllowlist:              v.GetStringSlice(gostatsd.ParamTagAllowlist),
+		AggregatorHostTag:         v.GetBool(gostatsd.ParamAggregatorHostTag),
+		ChangedGaugesOnly:         v.GetBool(gostatsd.ParamChangedGaugesOnly),
+		UnknownMetricType:         unknownType,
+		PercentileMinSamples:      v.GetUint32(gostatsd.ParamTimerMinSamplesForPercentiles),
+		SetSuffix:                 v.GetString(gostatsd.ParamSetSuffix),
+		ApproximateSets:           v.GetStringSlice(gostatsd.ParamApproximateSets),
+		PauseExpiry:               v.GetBool(gostatsd.ParamPauseExpiry),
+		RollupIntervals:           rollupIntervals,
+		DeadletterFile:            v.GetString(gostatsd.ParamDeadletterFile),
+		DeadletterMaxSize:         v.GetInt64(gostatsd.ParamDeadletterMaxSizeMB) * 1024 * 1024,
+		DeadletterRate:            rate.Limit(v.GetFloat64(gostatsd.ParamDeadletterLinesPerMinute) / 60.0),
+		DropCounterOverflows:      counterOverflow == gostatsd.CounterOverflowDrop,
+		IntegerCounters:           v.GetBool(gostatsd.ParamIntegerCounters),
+		TeeAddr:                   v.GetString(gostatsd.ParamTeeAddr),
+		FlushOnShutdownOnly:       v.GetBool(gostatsd.ParamFlushOnShutdownOnly),
+		BackendFailure:            backendFailure,
+		BackendFailureMaxSeries:   v.GetUint64(gostatsd.ParamBackendFailureMaxSeries),
+		Enrichers:                 enrichersList,
+		CounterTotals:             v.GetStringSlice(gostatsd.ParamCounterTotals),
+		BackendMaxConcurrent:      v.GetUint(gostatsd.ParamBackendMaxConcurrent),
+		PercentileTags:            v.GetBool(gostatsd.ParamPercentileTags),
+		MetricTypeTags:            v.GetBool(gostatsd.ParamMetricTypeTags),
+		AverageGauges:             v.GetStringSlice(gostatsd.ParamAverageGauges),
+		NamePrefixTemplate:        v.GetString(gostatsd.ParamNamePrefixTemplate),
+		AdditionalNamespaces:      v.GetStringSlice(gostatsd.ParamAdditionalNamespaces),
+		PercentileSampleRate:      percentileSampleRate,
+		UntaggedMetrics:           v.GetStringSlice(gostatsd.ParamUntaggedMetrics),
+		CounterPeakRates:          v.GetStringSlice(gostatsd.ParamCounterPeakRates),
+		CounterPeakRateWindow:     counterPeakRateWindow,
+		GaugeStateFile:            v.GetString(gostatsd.ParamGaugeStateFile),
+		FlushWarmup:               flushWarmup,
+		FlushWarmupDiscard:        v.GetBool(gostatsd.ParamFlushWarmupDiscard),
 		TransportPool:             pool,
+		MetricLimits: statsd.MetricLimits{
+			MaxNameLength: v.GetInt(gostatsd.ParamMaxNameLength),
+			MaxTags:       v.GetInt(gostatsd.ParamMaxTags),
+			MaxTagLength:  v.GetInt(gostatsd.ParamMaxTagLength),
+		},
+		SourceRateLimit: statsd.SourceRateLimit{
+			Limit: rate.Limit(v.GetFloat64(gostatsd.ParamSourceRateLimit)),
+			Burst: v.GetInt(gostatsd.ParamSourceRateBurst),
+		},
 	}, nil
 }
 
@@ -194,6 +331,18 @@ func getPercentiles(s []string) ([]float64, error) {
 	return percentThresholds, nil
 }
 
+func getRollupIntervals(s []string) ([]time.Duration, error) {
+	rollupIntervals := make([]time.Duration, len(s))
+	for i, sRollupInterval := range s {
+		interval, err := time.ParseDuration(sRollupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", gostatsd.ParamRollupIntervals, err)
+		}
+		rollupIntervals[i] = interval
+	}
+	return rollupIntervals, nil
+}
+
 // cancelOnInterrupt calls f when os.Interrupt or SIGTERM is received.
 func cancelOnInterrupt(ctx context.Context, f context.CancelFunc) {
 	c := make(chan os.Signal, 1)
@@ -220,7 +369,8 @@ func setupConfiguration() (*viper.Viper, bool, error) {
 	cmd.Bool(ParamVerbose, false, "Verbose")
 	cmd.Bool(ParamJSON, false, "Log in JSON format")
 	cmd.String(ParamProfile, "", "Enable profiler endpoint on the specified address and port")
-	cmd.String(ParamConfigPath, "", "Path to the configuration file")
+	cmd.String(ParamConfigPath, "", "Path to the configuration file, or a comma separated list of files where later files override earlier ones")
+	cmd.Bool(ParamStrictConfig, false, "Fail to start if the configuration file has unknown keys, rather than logging a warning")
 
 	gostatsd.AddFlags(cmd)
 
@@ -236,15 +386,65 @@ func setupConfiguration() (*viper.Viper, bool, error) {
 
 	configPath := v.GetString(ParamConfigPath)
 	if configPath != "" {
-		v.SetConfigFile(configPath)
-		if err := v.ReadInConfig(); err != nil {
+		if err := readConfigFiles(v, configPath); err != nil {
 			return nil, false, err
 		}
+		if unknown := unknownConfigKeys(v, cmd); len(unknown) > 0 {
+			if v.GetBool(ParamStrictConfig) {
+				return nil, false, fmt.Errorf("unknown keys in configuration file %s: %s", configPath, strings.Join(unknown, ", "))
+			}
+			logrus.Warnf("Unknown keys in configuration file %s: %s", configPath, strings.Join(unknown, ", "))
+		}
 	}
 
 	return v, version, nil
 }
 
+// readConfigFiles reads the comma separated list of configuration files in paths into v in order, so that a key in a
+// later file overrides the same key in an earlier one.  Sections are merged key by key, rather than replaced.
+func readConfigFiles(v *viper.Viper, paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return fmt.Errorf("empty path in configuration file list %q", paths)
+		}
+		v.SetConfigFile(path)
+		if err := v.MergeInConfig(); err != nil {
+			return fmt.Errorf("failed to read configuration file %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// unknownConfigKeys returns the sorted top level keys in v which are not a flag in fs, a backend, a cloud provider,
+// an enricher, or one of the configSections.  Keys nested in a section are not checked, as they are validated by their owner.
+func unknownConfigKeys(v *viper.Viper, fs *pflag.FlagSet) []string {
+	known := map[string]struct{}{}
+	fs.VisitAll(func(flag *pflag.Flag) {
+		known[flag.Name] = struct{}{}
+	})
+	for _, names := range [][]string{backends.Names(), cloudproviders.Names(), cachedinstances.Names(), enrichers.Names(), configSections} {
+		for _, name := range names {
+			known[name] = struct{}{}
+		}
+	}
+
+	unknown := map[string]struct{}{}
+	for _, key := range v.AllKeys() {
+		key = strings.SplitN(key, ".", 2)[0]
+		if _, ok := known[key]; !ok {
+			unknown[key] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(unknown))
+	for key := range unknown {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func setupLogger(v *viper.Viper) {
 	if v.GetBool(ParamVerbose) {
 		logrus.SetLevel(logrus.DebugLevel)
@@ -1,9 +1,19 @@
 package gostatsd
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
 // Counter is used for storing aggregated values for counters.
 type Counter struct {
 	PerSecond float64  // The calculated per second rate
 	Value     int64    // The numeric value of the metric
+	Fraction  float64  // The fraction of the value which is not a whole number, between -1 and 1
+	Events    int64    // The number of times the metric was received
 	Timestamp Nanotime // Last time value was updated
 	Source    Source   // Source of the metric
 	Tags      Tags     // The tags for the counter
@@ -14,6 +24,59 @@ func NewCounter(timestamp Nanotime, value int64, source Source, tags Tags) Count
 	return Counter{Value: value, Timestamp: timestamp, Source: source, Tags: tags.Copy()}
 }
 
+// Total returns the value of the counter including its fraction.
+func (c Counter) Total() float64 {
+	return float64(c.Value) + c.Fraction
+}
+
+// FormatValue formats the value of the counter including its fraction.  A value without a fraction is formatted as an
+// integer, so that large values keep all their precision.
+func (c Counter) FormatValue() string {
+	if c.Fraction == 0 {
+		return strconv.FormatInt(c.Value, 10)
+	}
+	return strconv.FormatFloat(c.Total(), 'f', -1, 64)
+}
+
+// AddFraction adds a fraction to the counter, carrying any whole part of the total fraction to the Value.
+func (c *Counter) AddFraction(fraction float64) {
+	whole, fraction := math.Modf(c.Fraction + fraction)
+	c.Value = AddCounterValues(c.Value, int64(whole))
+	c.Fraction = fraction
+}
+
+// Overflowed returns true if the value of the counter has saturated at the largest or smallest int64.
+func (c Counter) Overflowed() bool {
+	return c.Value == math.MaxInt64 || c.Value == math.MinInt64
+}
+
+// AddCounterValues adds two counter values, saturating at the largest or smallest int64 rather than wrapping.
+func AddCounterValues(a, b int64) int64 {
+	sum := a + b
+	if b > 0 && sum < a {
+		return math.MaxInt64
+	}
+	if b < 0 && sum > a {
+		return math.MinInt64
+	}
+	return sum
+}
+
+// counterValue splits a received value in to the whole part of a counter value, saturating at the largest or smallest
+// int64, and its fraction.
+func counterValue(value float64) (int64, float64) {
+	switch {
+	case math.IsNaN(value):
+		return 0, 0
+	case value >= math.MaxInt64:
+		return math.MaxInt64, 0
+	case value <= math.MinInt64:
+		return math.MinInt64, 0
+	}
+	whole, fraction := math.Modf(value)
+	return int64(whole), fraction
+}
+
 func (c *Counter) AddTagsSetSource(additionalTags Tags, newSource Source) {
 	c.Tags = c.Tags.Concat(additionalTags)
 	c.Source = newSource
@@ -50,3 +113,63 @@ func (c Counters) Each(f func(metricName string, tagsKey string, c Counter)) {
 		}
 	}
 }
+
+const (
+	// CounterOverflowSaturate sends counters which overflow as the largest or smallest int64.
+	CounterOverflowSaturate = "saturate"
+	// CounterOverflowDrop drops counters which overflow, rather than sending a value which is known to be wrong.
+	CounterOverflowDrop = "drop"
+)
+
+// CounterMode selects which values of a counter a backend sends.
+type CounterMode int
+
+const (
+	// CounterModeBoth sends both the count and the per second rate.
+	CounterModeBoth CounterMode = iota
+	// CounterModeCount sends only the count.
+	CounterModeCount
+	// CounterModeRate sends only the per second rate.
+	CounterModeRate
+)
+
+// ParamCounterMode is the name of the backend parameter selecting the CounterMode, in backends with dashed keys.
+const ParamCounterMode = "counter-mode"
+
+// ParamCounterModeUnderscore is the name of the backend parameter selecting the CounterMode, in backends with
+// underscored keys.
+const ParamCounterModeUnderscore = "counter_mode"
+
+// Count returns true if the count of a counter should be sent.
+func (cm CounterMode) Count() bool {
+	return cm != CounterModeRate
+}
+
+// Rate returns true if the per second rate of a counter should be sent.
+func (cm CounterMode) Rate() bool {
+	return cm != CounterModeCount
+}
+
+// ParseCounterMode parses a counter mode of rate, count, or both.
+func ParseCounterMode(s string) (CounterMode, error) {
+	switch s {
+	case "both":
+		return CounterModeBoth, nil
+	case "count":
+		return CounterModeCount, nil
+	case "rate":
+		return CounterModeRate, nil
+	}
+	return CounterModeBoth, fmt.Errorf("invalid counter mode %q, must be rate, count, or both", s)
+}
+
+// CounterModeFromViper returns the CounterMode configured in the param key for a backend, given the backends
+// sub-viper.  It defaults to sending both.
+func CounterModeFromViper(v *viper.Viper, param string) (CounterMode, error) {
+	v.SetDefault(param, "both")
+	mode, err := ParseCounterMode(v.GetString(param))
+	if err != nil {
+		return mode, fmt.Errorf("%s: %v", param, err)
+	}
+	return mode, nil
+}
@@ -0,0 +1,120 @@
+package gostatsd
+
+import (
+	"math"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterMode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input string
+		mode  CounterMode
+		count bool
+		rate  bool
+	}{
+		{"both", CounterModeBoth, true, true},
+		{"count", CounterModeCount, true, false},
+		{"rate", CounterModeRate, false, true},
+	}
+	for _, test := range tests {
+		mode, err := ParseCounterMode(test.input)
+		require.NoError(t, err)
+		assert.Equal(t, test.mode, mode, test.input)
+		assert.Equal(t, test.count, mode.Count(), test.input)
+		assert.Equal(t, test.rate, mode.Rate(), test.input)
+	}
+
+	_, err := ParseCounterMode("delta")
+	assert.Error(t, err)
+}
+
+func TestCounterModeFromViper(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	mode, err := CounterModeFromViper(v, ParamCounterMode)
+	require.NoError(t, err)
+	assert.Equal(t, CounterModeBoth, mode)
+
+	v.Set(ParamCounterMode, "rate")
+	mode, err = CounterModeFromViper(v, ParamCounterMode)
+	require.NoError(t, err)
+	assert.Equal(t, CounterModeRate, mode)
+
+	v.Set(ParamCounterModeUnderscore, "count")
+	mode, err = CounterModeFromViper(v, ParamCounterModeUnderscore)
+	require.NoError(t, err)
+	assert.Equal(t, CounterModeCount, mode)
+
+	v.Set(ParamCounterModeUnderscore, "delta")
+	_, err = CounterModeFromViper(v, ParamCounterModeUnderscore)
+	assert.EqualError(t, err, `counter_mode: invalid counter mode "delta", must be rate, count, or both`)
+}
+
+func TestAddCounterValues(t *testing.T) {
+	t.Parallel()
+	assert.EqualValues(t, 3, AddCounterValues(1, 2))
+	assert.EqualValues(t, -1, AddCounterValues(1, -2))
+	assert.EqualValues(t, math.MaxInt64, AddCounterValues(math.MaxInt64-1, 1))
+	assert.EqualValues(t, math.MaxInt64, AddCounterValues(math.MaxInt64-1, 2))
+	assert.EqualValues(t, math.MaxInt64, AddCounterValues(math.MaxInt64, math.MaxInt64))
+	assert.EqualValues(t, math.MinInt64, AddCounterValues(math.MinInt64+1, -2))
+	assert.EqualValues(t, math.MinInt64, AddCounterValues(math.MinInt64, math.MinInt64))
+	assert.EqualValues(t, -1, AddCounterValues(math.MaxInt64, math.MinInt64))
+}
+
+func TestReceiveCounterOverflow(t *testing.T) {
+	t.Parallel()
+	mm := NewMetricMap()
+	mm.Receive(&Metric{Name: "big", Value: 9e18, Rate: 1, Type: COUNTER})
+	mm.Receive(&Metric{Name: "big", Value: 9e18, Rate: 1, Type: COUNTER})
+	mm.Receive(&Metric{Name: "sampled", Value: 1e18, Rate: 0.01, Type: COUNTER})
+	mm.Receive(&Metric{Name: "negative", Value: -1e19, Rate: 1, Type: COUNTER})
+	assert.EqualValues(t, math.MaxInt64, mm.Counters["big"][""].Value)
+	assert.True(t, mm.Counters["big"][""].Overflowed())
+	assert.EqualValues(t, math.MaxInt64, mm.Counters["sampled"][""].Value)
+	assert.EqualValues(t, math.MinInt64, mm.Counters["negative"][""].Value)
+
+	merged := NewMetricMap()
+	merged.Merge(mm)
+	merged.Merge(mm)
+	assert.EqualValues(t, math.MaxInt64, merged.Counters["big"][""].Value)
+	assert.EqualValues(t, math.MinInt64, merged.Counters["negative"][""].Value)
+}
+
+func TestCounterFractions(t *testing.T) {
+	t.Parallel()
+	mm := NewMetricMap()
+	for i := 0; i < 10; i++ {
+		mm.Receive(&Metric{Name: "half", Value: 0.5, Rate: 1, Type: COUNTER})
+	}
+	for i := 0; i < 3; i++ {
+		mm.Receive(&Metric{Name: "quarter", Value: 0.25, Rate: 1, Type: COUNTER})
+	}
+	mm.Receive(&Metric{Name: "mixed", Value: 2, Rate: 1, Type: COUNTER})
+	mm.Receive(&Metric{Name: "mixed", Value: -0.5, Rate: 1, Type: COUNTER})
+
+	half := mm.Counters["half"][""]
+	assert.EqualValues(t, 5, half.Value)
+	assert.Zero(t, half.Fraction)
+	assert.Equal(t, 5.0, half.Total())
+	assert.Equal(t, "5", half.FormatValue())
+	quarter := mm.Counters["quarter"][""]
+	assert.EqualValues(t, 0, quarter.Value)
+	assert.Equal(t, 0.75, quarter.Total())
+	assert.Equal(t, "0.75", quarter.FormatValue())
+	assert.Equal(t, 1.5, mm.Counters["mixed"][""].Total())
+
+	// Fractions are carried when maps are merged
+	merged := NewMetricMap()
+	merged.Merge(mm)
+	merged.Merge(mm)
+	assert.EqualValues(t, 10, merged.Counters["half"][""].Value)
+	assert.EqualValues(t, 1, merged.Counters["quarter"][""].Value)
+	assert.Equal(t, 0.5, merged.Counters["quarter"][""].Fraction)
+	assert.Equal(t, "1.5", merged.Counters["quarter"][""].FormatValue())
+}
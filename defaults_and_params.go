@@ -57,6 +57,8 @@ const (
 	DefaultFlushOffset = 0
 	// DefaultFlushOffset is the default for whether metric flushing should be aligned
 	DefaultFlushAligned = false
+	// DefaultDryRun is the default for whether metrics should be aggregated without being sent to backends
+	DefaultDryRun = false
 	// DefaultIgnoreHost is the default value for whether the source should be used as the host
 	DefaultIgnoreHost = false
 	// DefaultMetricsAddr is the default address on which to listen for metrics.
@@ -93,6 +95,114 @@ const (
 	DefaultTimerHistogramLimit = math.MaxUint32
 	// DefaultLogRawMetric is the default value for whether to log the metrics received from network
 	DefaultLogRawMetric = false
+	// DefaultCardinalityWarnThreshold is the default number of tag sets a single metric name may have before a warning
+	// is logged, 0 to disable
+	DefaultCardinalityWarnThreshold = 0
+	// DefaultDisablePerSecond is the default for whether calculating per second rates for counters and timers is disabled
+	DefaultDisablePerSecond = false
+	// DefaultBackendTimeout is the default timeout for sending a batch of metrics to a backend, 0 to disable
+	DefaultBackendTimeout = time.Duration(0)
+	// DefaultBackendCircuitFailures is the default number of consecutive failures before a backend's circuit breaker opens, 0 to disable
+	DefaultBackendCircuitFailures = 0
+	// DefaultBackendCircuitCooldown is the default time a backend's circuit breaker stays open before sending is retried
+	DefaultBackendCircuitCooldown = 30 * time.Second
+	// DefaultNormalizeTags is the default for whether tags are normalized
+	DefaultNormalizeTags = false
+	// DefaultFlushMaxMetrics is the default number of metrics received before an early flush is triggered, 0 to disable
+	DefaultFlushMaxMetrics = 0
+	// DefaultCounterEvents is the default for whether the number of times each counter was received is emitted
+	DefaultCounterEvents = false
+	// DefaultMaxNameLength is the default maximum length of a metric name, 0 to disable
+	DefaultMaxNameLength = 0
+	// DefaultMaxTags is the default maximum number of tags on a metric, 0 to disable
+	DefaultMaxTags = 0
+	// DefaultMaxTagLength is the default maximum length of a single tag, 0 to disable
+	DefaultMaxTagLength = 0
+	// DefaultPercentileInterpolation is the default method for calculating percentile thresholds
+	DefaultPercentileInterpolation = PercentileNearestRank
+	// DefaultPassthroughGauges is the default list of gauges sent directly to the backends without aggregation
+	DefaultPassthroughGauges = ""
+	// DefaultCumulativeCounters is the default list of counters which are not reset after each flush
+	DefaultCumulativeCounters = ""
+	// DefaultPercentileNames is the default template for naming percentile thresholds
+	DefaultPercentileNames = "etsy"
+	// DefaultTagPrecedence is the default order in which tags with the same key take precedence, empty to allow duplicate keys
+	DefaultTagPrecedence = ""
+	// DefaultSourceRateLimit is the default number of metrics per second allowed from each source ip, 0 to disable
+	DefaultSourceRateLimit = 0
+	// DefaultSourceRateBurst is the default number of metrics each source ip may burst, 0 for one second of metrics
+	DefaultSourceRateBurst = 0
+	// DefaultPauseMaxSeries is the default number of series buffered while flushing is paused which forces a flush
+	DefaultPauseMaxSeries = 1000000
+	// DefaultReusePort is the default for whether to set SO_REUSEPORT on the metrics socket
+	DefaultReusePort = false
+	// DefaultTagAllowlist is the default list of tag keys which are kept on metrics, empty to keep every tag
+	DefaultTagAllowlist = ""
+	// DefaultAggregatorHostTag is the default for whether to tag metrics with the hostname of the aggregating server
+	DefaultAggregatorHostTag = false
+	// DefaultChangedGaugesOnly is the default for whether to only send gauges when their value changes
+	DefaultChangedGaugesOnly = false
+	// DefaultUnknownMetricType is the default handling of metrics with an unknown type, which is to drop them
+	DefaultUnknownMetricType = "drop"
+	// DefaultTimerMinSamplesForPercentiles is the default minimum number of values a timer must have for percentiles
+	// to be calculated
+	DefaultTimerMinSamplesForPercentiles = 1
+	// DefaultSetSuffix is the default suffix appended to the name of sets, which is none
+	DefaultSetSuffix = ""
+	// DefaultApproximateSets is the default list of sets which are counted approximately, which is none
+	DefaultApproximateSets = ""
+	// DefaultPauseExpiry is the default for whether to stop expiring metrics while flushing is paused or failing
+	DefaultPauseExpiry = false
+	// DefaultRollupIntervals is the default list of rollup intervals, which is none
+	DefaultRollupIntervals = ""
+	// DefaultDeadletterFile is the default file to write dropped lines to, which is none
+	DefaultDeadletterFile = ""
+	// DefaultDeadletterMaxSizeMB is the default size of the deadletter file before it is rotated
+	DefaultDeadletterMaxSizeMB = 100
+	// DefaultDeadletterLinesPerMinute is the default number of lines to write to the deadletter file per minute
+	DefaultDeadletterLinesPerMinute = 600
+	// DefaultCounterOverflow is the default handling of counters which overflow int64
+	DefaultCounterOverflow = CounterOverflowSaturate
+	// DefaultIntegerCounters is the default for whether to send counters without the fraction of their value
+	DefaultIntegerCounters = false
+	// DefaultTeeAddr is the default address to send a copy of received datagrams to, which is none
+	DefaultTeeAddr = ""
+	// DefaultFlushOnShutdownOnly is the default for whether to only flush when the server is shut down
+	DefaultFlushOnShutdownOnly = false
+	// DefaultBackendFailure is the default handling of metrics which every backend failed to send
+	DefaultBackendFailure = BackendFailureDrop
+	// DefaultBackendFailureMaxSeries is the default number of series kept to send again after every backend fails
+	DefaultBackendFailureMaxSeries = 1000000
+	// DefaultEnrichers is the default list of enrichers, which is none
+	DefaultEnrichers = ""
+	// DefaultCounterTotals is the default list of counters which also send their lifetime total, which is none
+	DefaultCounterTotals = ""
+	// DefaultBackendMaxConcurrent is the default number of sends to each backend which can be in flight at once, 0 is unlimited
+	DefaultBackendMaxConcurrent = 0
+	// DefaultPercentileTags is the default of sending timer percentiles with their name as a suffix rather than as tags
+	DefaultPercentileTags = false
+	// DefaultMetricTypeTags is the default of not tagging metrics with their type
+	DefaultMetricTypeTags = false
+	// DefaultAverageGauges is the default list of gauges which send the mean of their values, which is none
+	DefaultAverageGauges = ""
+	// DefaultNamePrefixTemplate is the default template to prefix metric names with, which is none
+	DefaultNamePrefixTemplate = ""
+	// DefaultAdditionalNamespaces is the default list of namespaces metrics are also sent under, which is none
+	DefaultAdditionalNamespaces = ""
+	// DefaultPercentileSampleRate is the default probability of a flush calculating timer percentiles, which is every flush
+	DefaultPercentileSampleRate = 1.0
+	// DefaultUntaggedMetrics is the default list of metrics which are aggregated without their tags, which is none
+	DefaultUntaggedMetrics = ""
+	// DefaultCounterPeakRates is the default list of counters which send their peak rate, which is none
+	DefaultCounterPeakRates = ""
+	// DefaultCounterPeakRateWindow is the default sub-window the peak rate of counters is measured over
+	DefaultCounterPeakRateWindow = 1 * time.Second
+	// DefaultGaugeStateFile is the default file to persist gauges to, which is none
+	DefaultGaugeStateFile = ""
+	// DefaultFlushWarmup is the default time after startup before the first periodic flush, which is none
+	DefaultFlushWarmup = 0
+	// DefaultFlushWarmupDiscard is the default for whether metrics received during the flush-warmup are discarded
+	DefaultFlushWarmupDiscard = false
 )
 
 const (
@@ -126,6 +236,8 @@ const (
 	ParamFlushOffset = "flush-offset"
 	// ParamFlushInterval is the name of parameter with metrics flush interval alignment enable state.
 	ParamFlushAligned = "flush-aligned"
+	// ParamDryRun is the name of parameter indicating if metrics should be aggregated without being sent to backends
+	ParamDryRun = "dry-run"
 	// ParamIgnoreHost is the name of parameter indicating if the source should be used as the host
 	ParamIgnoreHost = "ignore-host"
 	// ParamMaxReaders is the name of parameter with number of socket readers.
@@ -172,6 +284,114 @@ const (
 	ParamTimerHistogramLimit = "timer-histogram-limit"
 	// ParamLogRawMetric enables custom metrics to be printed to stdout
 	ParamLogRawMetric = "log-raw-metric"
+	// ParamCardinalityWarnThreshold is the name of parameter with the number of tag sets a single metric name may
+	// have before a warning is logged
+	ParamCardinalityWarnThreshold = "cardinality-warn-threshold"
+	// ParamDisablePerSecond is the name of parameter to disable calculating per second rates for counters and timers
+	ParamDisablePerSecond = "disable-per-second"
+	// ParamBackendTimeout is the name of parameter with the timeout for sending a batch of metrics to a backend
+	ParamBackendTimeout = "backend-timeout"
+	// ParamBackendCircuitFailures is the name of parameter with the number of consecutive failures before a backend's circuit breaker opens
+	ParamBackendCircuitFailures = "backend-circuit-failures"
+	// ParamBackendCircuitCooldown is the name of parameter with the time a backend's circuit breaker stays open before sending is retried
+	ParamBackendCircuitCooldown = "backend-circuit-cooldown"
+	// ParamNormalizeTags is the name of parameter indicating if tags should be lowercased and have whitespace cleaned up
+	ParamNormalizeTags = "normalize-tags"
+	// ParamFlushMaxMetrics is the name of parameter with the number of metrics received before an early flush is triggered
+	ParamFlushMaxMetrics = "flush-max-metrics"
+	// ParamCounterEvents is the name of parameter to emit the number of times each counter was received as <name>.events
+	ParamCounterEvents = "counter-events"
+	// ParamMaxNameLength is the name of parameter with the maximum length of a metric name
+	ParamMaxNameLength = "max-name-length"
+	// ParamMaxTags is the name of parameter with the maximum number of tags on a metric
+	ParamMaxTags = "max-tags"
+	// ParamMaxTagLength is the name of parameter with the maximum length of a single tag
+	ParamMaxTagLength = "max-tag-length"
+	// ParamPercentileInterpolation is the name of parameter with the method for calculating percentile thresholds
+	ParamPercentileInterpolation = "percentile-interpolation"
+	// ParamPassthroughGauges is the name of parameter with the list of gauges sent directly to the backends without aggregation
+	ParamPassthroughGauges = "passthrough-gauges"
+	// ParamCumulativeCounters is the name of parameter with the list of counters which are not reset after each flush
+	ParamCumulativeCounters = "cumulative-counters"
+	// ParamPercentileNames is the name of parameter with the template for naming percentile thresholds
+	ParamPercentileNames = "percentile-names"
+	// ParamTagPrecedence is the name of parameter with the order in which tags with the same key take precedence
+	ParamTagPrecedence = "tag-precedence"
+	// ParamSourceRateLimit is the name of parameter with the number of metrics per second allowed from each source ip
+	ParamSourceRateLimit = "source-rate-limit"
+	// ParamSourceRateBurst is the name of parameter with the number of metrics each source ip may burst
+	ParamSourceRateBurst = "source-rate-burst"
+	// ParamPauseMaxSeries is the name of parameter with the number of series buffered while flushing is paused which forces a flush
+	ParamPauseMaxSeries = "pause-max-series"
+	// ParamReusePort is the name of the parameter indicating whether to set SO_REUSEPORT on the metrics socket
+	ParamReusePort = "reuse-port"
+	// ParamTagAllowlist is the name of parameter with the list of tag keys which are kept on metrics
+	ParamTagAllowlist = "tag-allowlist"
+	// ParamAggregatorHostTag is the name of parameter indicating whether to tag metrics with the hostname of the aggregating server
+	ParamAggregatorHostTag = "aggregator-host-tag"
+	// ParamChangedGaugesOnly is the name of parameter indicating whether to only send gauges when their value changes
+	ParamChangedGaugesOnly = "changed-gauges-only"
+	// ParamUnknownMetricType is the name of parameter with the handling of metrics with an unknown type
+	ParamUnknownMetricType = "unknown-metric-type"
+	// ParamTimerMinSamplesForPercentiles is the name of parameter with the minimum number of values a timer must have
+	// for percentiles to be calculated
+	ParamTimerMinSamplesForPercentiles = "timer-min-samples-for-percentiles"
+	// ParamSetSuffix is the name of parameter with the suffix appended to the name of sets
+	ParamSetSuffix = "set-suffix"
+	// ParamApproximateSets is the name of parameter with the list of sets which are counted approximately
+	ParamApproximateSets = "approximate-sets"
+	// ParamPauseExpiry is the name of parameter indicating whether to stop expiring metrics while flushing is paused or failing
+	ParamPauseExpiry = "pause-expiry"
+	// ParamRollupIntervals is the name of parameter with the list of intervals to also aggregate metrics over
+	ParamRollupIntervals = "rollup-intervals"
+	// ParamDeadletterFile is the name of parameter with the file to write dropped lines to
+	ParamDeadletterFile = "deadletter-file"
+	// ParamDeadletterMaxSizeMB is the name of parameter with the size of the deadletter file before it is rotated
+	ParamDeadletterMaxSizeMB = "deadletter-max-size-mb"
+	// ParamDeadletterLinesPerMinute is the name of parameter with the number of lines to write to the deadletter file per minute
+	ParamDeadletterLinesPerMinute = "deadletter-lines-per-minute"
+	// ParamCounterOverflow is the name of parameter with the handling of counters which overflow int64
+	ParamCounterOverflow = "counter-overflow"
+	// ParamIntegerCounters is the name of parameter indicating whether to send counters without the fraction of their value
+	ParamIntegerCounters = "integer-counters"
+	// ParamTeeAddr is the name of parameter with the address to send a copy of received datagrams to
+	ParamTeeAddr = "tee-addr"
+	// ParamFlushOnShutdownOnly is the name of parameter with whether to only flush when the server is shut down
+	ParamFlushOnShutdownOnly = "flush-on-shutdown-only"
+	// ParamBackendFailure is the name of parameter with the handling of metrics which every backend failed to send
+	ParamBackendFailure = "backend-failure"
+	// ParamBackendFailureMaxSeries is the name of parameter with the number of series kept to send again after every backend fails
+	ParamBackendFailureMaxSeries = "backend-failure-max-series"
+	// ParamEnrichers is the name of parameter with the list of enrichers
+	ParamEnrichers = "enrichers"
+	// ParamCounterTotals is the name of parameter with the list of counters which also send their lifetime total
+	ParamCounterTotals = "counter-totals"
+	// ParamBackendMaxConcurrent is the name of parameter with the number of sends to each backend which can be in flight at once
+	ParamBackendMaxConcurrent = "backend-max-concurrent-sends"
+	// ParamPercentileTags is the name of parameter which sends timer percentiles as a <name>.percentile gauge with tags
+	ParamPercentileTags = "percentile-tags"
+	// ParamMetricTypeTags is the name of parameter which tags every metric sent with metric_type:<type>
+	ParamMetricTypeTags = "metric-type-tags"
+	// ParamAverageGauges is the name of parameter with the list of gauges which send the mean of their values in each flush
+	ParamAverageGauges = "average-gauges"
+	// ParamNamePrefixTemplate is the name of parameter with the template to prefix metric names with, using their tags
+	ParamNamePrefixTemplate = "name-prefix-template"
+	// ParamAdditionalNamespaces is the name of parameter with the list of namespaces metrics are also sent under
+	ParamAdditionalNamespaces = "additional-namespaces"
+	// ParamPercentileSampleRate is the name of parameter with the probability of a flush calculating timer percentiles
+	ParamPercentileSampleRate = "percentile-sample-rate"
+	// ParamUntaggedMetrics is the name of parameter with the list of metrics which are aggregated without their tags
+	ParamUntaggedMetrics = "untagged-metrics"
+	// ParamCounterPeakRates is the name of parameter with the list of counters which also send their peak per second rate
+	ParamCounterPeakRates = "counter-peak-rates"
+	// ParamCounterPeakRateWindow is the name of parameter with the sub-window the peak rate of counters is measured over
+	ParamCounterPeakRateWindow = "counter-peak-rate-window"
+	// ParamGaugeStateFile is the name of parameter with the file to persist gauges to across restarts
+	ParamGaugeStateFile = "gauge-state-file"
+	// ParamFlushWarmup is the name of parameter with the time after startup before the first periodic flush
+	ParamFlushWarmup = "flush-warmup"
+	// ParamFlushWarmupDiscard is the name of parameter to discard the metrics received during the flush-warmup
+	ParamFlushWarmupDiscard = "flush-warmup-discard"
 )
 
 // AddFlags adds flags to the specified FlagSet.
@@ -185,6 +405,7 @@ func AddFlags(fs *pflag.FlagSet) {
 	fs.Duration(ParamFlushInterval, DefaultFlushInterval, "How often to flush metrics to the backends")
 	fs.Duration(ParamFlushOffset, DefaultFlushOffset, "Flush offset to use when flush alignment is enabled")
 	fs.Bool(ParamFlushAligned, DefaultFlushAligned, "Enable aligned flush interval")
+	fs.Bool(ParamDryRun, DefaultDryRun, "Aggregate metrics and log a summary of each flush, without sending anything to the backends")
 	fs.Bool(ParamIgnoreHost, DefaultIgnoreHost, "Ignore the source for populating the hostname field of metrics")
 	fs.Int(ParamMaxReaders, DefaultMaxReaders, "Maximum number of socket readers")
 	fs.Int(ParamMaxParsers, DefaultMaxParsers, "Maximum number of workers to parse datagrams into metrics")
@@ -213,6 +434,59 @@ func AddFlags(fs *pflag.FlagSet) {
 	fs.String(ParamHostname, getHost(), "overrides the hostname of the server")
 	fs.Uint32(ParamTimerHistogramLimit, DefaultTimerHistogramLimit, "upper limit of timer histogram buckets (MaxUint32 by default)")
 	fs.Bool(ParamLogRawMetric, DefaultLogRawMetric, "Print metrics received from network to stdout in JSON format")
+	fs.Bool(ParamDisablePerSecond, DefaultDisablePerSecond, "Disable calculating per second rates, only raw counts will be reported")
+	fs.Uint32(ParamCardinalityWarnThreshold, DefaultCardinalityWarnThreshold, "Number of tag sets a single metric name may have before a warning is logged, 0 to disable")
+	fs.Duration(ParamBackendTimeout, DefaultBackendTimeout, "Timeout for sending a batch of metrics to a backend, 0 to disable")
+	fs.Uint(ParamBackendCircuitFailures, DefaultBackendCircuitFailures, "Number of consecutive failed sends before metrics are no longer sent to a backend, 0 to disable")
+	fs.Duration(ParamBackendCircuitCooldown, DefaultBackendCircuitCooldown, "How long to wait before retrying a backend after its circuit breaker opens")
+	fs.Bool(ParamNormalizeTags, DefaultNormalizeTags, "Lowercase tags, and trim or replace whitespace, so inconsistently formatted tags are aggregated together")
+	fs.Uint64(ParamFlushMaxMetrics, DefaultFlushMaxMetrics, "Number of metrics received since the last flush which triggers an early flush, 0 to disable")
+	fs.Bool(ParamCounterEvents, DefaultCounterEvents, "Emit the number of times each counter was received as <name>.events")
+	fs.Int(ParamMaxNameLength, DefaultMaxNameLength, "Maximum length of a metric name, longer metrics are dropped, 0 to disable")
+	fs.Int(ParamMaxTags, DefaultMaxTags, "Maximum number of tags on a metric, metrics with more are dropped, 0 to disable")
+	fs.Int(ParamMaxTagLength, DefaultMaxTagLength, "Maximum length of a single tag, metrics with longer tags are dropped, 0 to disable")
+	fs.String(ParamPercentileInterpolation, DefaultPercentileInterpolation, "Method for calculating the upper and lower percentile thresholds of timers, "+PercentileNearestRank+" or "+PercentileLinear)
+	fs.String(ParamPassthroughGauges, DefaultPassthroughGauges, "Space separated list of gauge names, which may end in *, to send directly to the backends without aggregation")
+	fs.String(ParamCumulativeCounters, DefaultCumulativeCounters, "Space separated list of counter names, which may end in *, to accumulate across flushes rather than reset")
+	fs.String(ParamPercentileNames, DefaultPercentileNames, "Template for naming the upper and lower percentile thresholds of timers, a preset (etsy or datadog) or a template containing {pct} and optionally {stat}")
+	fs.String(ParamTagPrecedence, DefaultTagPrecedence, "Space separated order of wire, cloud, and default, in which tags with the same key take precedence.  Empty to keep all tags")
+	fs.Float64(ParamSourceRateLimit, DefaultSourceRateLimit, "Number of metrics per second allowed from each source ip, excess metrics are dropped, 0 to disable")
+	fs.Int(ParamSourceRateBurst, DefaultSourceRateBurst, "Number of metrics each source ip may burst above source-rate-limit, 0 for one second of metrics")
+	fs.Uint64(ParamPauseMaxSeries, DefaultPauseMaxSeries, "Number of series buffered while flushing to backends is paused which forces a flush, 0 to disable")
+	fs.Bool(ParamReusePort, DefaultReusePort, "Set SO_REUSEPORT on the metrics socket, so multiple processes can bind the same address")
+	fs.String(ParamTagAllowlist, DefaultTagAllowlist, "Space separated list of tag keys to keep on metrics, other tags are stripped.  Empty to keep every tag")
+	fs.Bool(ParamAggregatorHostTag, DefaultAggregatorHostTag, "Tag all metrics with aggregator_host:<hostname> in standalone mode")
+	fs.Bool(ParamChangedGaugesOnly, DefaultChangedGaugesOnly, "Only send gauges to the backends when their value has changed since it was last sent")
+	fs.String(ParamUnknownMetricType, DefaultUnknownMetricType, "How to handle metrics with an unknown type, drop to drop them, or counter, gauge, timer, or set to treat them as that type")
+	fs.Uint32(ParamTimerMinSamplesForPercentiles, DefaultTimerMinSamplesForPercentiles, "Minimum number of values a timer must have in a flush for its percentiles to be sent")
+	fs.String(ParamSetSuffix, DefaultSetSuffix, "Suffix appended to the name of sets sent to the backends, such as .count")
+	fs.String(ParamApproximateSets, DefaultApproximateSets, "Space separated list of set names, which may end in *, to count with a HyperLogLog estimate rather than exactly")
+	fs.Bool(ParamPauseExpiry, DefaultPauseExpiry, "Don't expire metrics while flushing is paused, or after the last send to the backends failed")
+	fs.String(ParamRollupIntervals, DefaultRollupIntervals, "Space separated list of intervals, multiples of flush-interval, to also aggregate metrics over and send tagged with rollup:<interval>")
+	fs.String(ParamDeadletterFile, DefaultDeadletterFile, "File to write bad, oversized, rate limited, and filtered lines to, with the reason and source ip.  Empty to disable")
+	fs.Int64(ParamDeadletterMaxSizeMB, DefaultDeadletterMaxSizeMB, "Size in megabytes of the deadletter file before it is rotated, keeping one previous file.  0 to never rotate")
+	fs.Float64(ParamDeadletterLinesPerMinute, DefaultDeadletterLinesPerMinute, "Number of lines to write to the deadletter file per minute, excess lines are not written.  0 to write every line")
+	fs.String(ParamCounterOverflow, DefaultCounterOverflow, "How to handle counters which overflow int64, "+CounterOverflowSaturate+" to send the largest or smallest int64, or "+CounterOverflowDrop+" to drop them")
+	fs.Bool(ParamIntegerCounters, DefaultIntegerCounters, "Send counters as integers, truncating any fraction of their value, for strict statsd compatibility")
+	fs.String(ParamTeeAddr, DefaultTeeAddr, "UDP address to send a copy of every datagram received to, best effort.  Empty to disable")
+	fs.Bool(ParamFlushOnShutdownOnly, DefaultFlushOnShutdownOnly, "Don't flush periodically, aggregate everything received and flush once when the server is shut down")
+	fs.String(ParamBackendFailure, DefaultBackendFailure, "How to handle metrics which every backend failed to send, "+BackendFailureDrop+" to drop them, "+BackendFailureRetry+" to send them again in the next flush, or "+BackendFailureBlock+" to send them again until a backend succeeds")
+	fs.Uint64(ParamBackendFailureMaxSeries, DefaultBackendFailureMaxSeries, "Number of series kept to send again by backend-failure, the oldest are dropped beyond it, 0 for no limit")
+	fs.String(ParamEnrichers, DefaultEnrichers, "Space separated list of enrichers to add or modify the tags of metrics as they are received")
+	fs.String(ParamCounterTotals, DefaultCounterTotals, "Space separated list of counter names, which may end in *, to also send their lifetime total as a <name>.total gauge")
+	fs.Uint(ParamBackendMaxConcurrent, DefaultBackendMaxConcurrent, "Maximum number of sends to each backend in flight at once, 0 for unlimited")
+	fs.Bool(ParamPercentileTags, DefaultPercentileTags, "Send timer percentiles as a <name>.percentile gauge tagged with percentile and stat, rather than with the name as a suffix")
+	fs.Bool(ParamMetricTypeTags, DefaultMetricTypeTags, "Tag every metric sent with metric_type:<type>, which is counter, timer, gauge or set")
+	fs.String(ParamAverageGauges, DefaultAverageGauges, "Space separated list of gauge names, which may end in *, to send the mean of the values received in each flush rather than the last")
+	fs.String(ParamNamePrefixTemplate, DefaultNamePrefixTemplate, "Prefix for the name of every metric, where {<tag>} is replaced by the value of the tag, metrics without the tags are not prefixed")
+	fs.String(ParamAdditionalNamespaces, DefaultAdditionalNamespaces, "Space separated list of namespaces to also send metrics in the namespace under, replacing the namespace")
+	fs.Float64(ParamPercentileSampleRate, DefaultPercentileSampleRate, "Probability greater than 0 and at most 1 of a flush calculating timer percentiles, other flushes only send the aggregates which are cheaper to calculate")
+	fs.String(ParamUntaggedMetrics, DefaultUntaggedMetrics, "Space separated list of metric names, which may end in *, which are aggregated into a single series without their tags")
+	fs.String(ParamCounterPeakRates, DefaultCounterPeakRates, "Space separated list of counter names, which may end in *, which also send the highest rate of any counter-peak-rate-window in the flush as <name>.peak_per_second")
+	fs.Duration(ParamCounterPeakRateWindow, DefaultCounterPeakRateWindow, "The sub-window the peak rate of counter-peak-rates is measured over")
+	fs.String(ParamGaugeStateFile, DefaultGaugeStateFile, "File to write the value of every gauge to after each flush, and restore them from on startup.  Empty to disable")
+	fs.Duration(ParamFlushWarmup, DefaultFlushWarmup, "Time after startup during which periodic flushes are skipped, so the first flush covers a full interval")
+	fs.Bool(ParamFlushWarmupDiscard, DefaultFlushWarmupDiscard, "Discard the metrics received during the flush-warmup, rather than including them in the first flush")
 }
 
 func minInt(a, b int) int {
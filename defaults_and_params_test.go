@@ -1,9 +1,12 @@
 package gostatsd
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,3 +16,46 @@ func TestAddFlags(t *testing.T) {
 		AddFlags(fs)
 	})
 }
+
+// newViperWithFlags creates a viper with the flags bound, in the same way as cmd/gostatsd.
+func newViperWithFlags(t *testing.T, args ...string) *viper.Viper {
+	v := viper.New()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(fs)
+	fs.VisitAll(func(flag *pflag.Flag) {
+		require.NoError(t, v.BindPFlag(flag.Name, flag))
+	})
+	require.NoError(t, fs.Parse(args))
+	return v
+}
+
+func TestListParamsFromConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		configType string
+		config     string
+	}{
+		{"yaml", "percent-threshold: [50, 90, 99.9]\ndefault-tags: ['env:prod', 'team:statsd']\n"},
+		{"json", `{"percent-threshold": [50, 90, 99.9], "default-tags": ["env:prod", "team:statsd"]}`},
+		{"toml", "percent-threshold=[50.0, 90.0, 99.9]\ndefault-tags=['env:prod', 'team:statsd']\n"},
+		{"toml", "percent-threshold='50 90 99.9'\ndefault-tags='env:prod team:statsd'\n"}, // Space separated like the flags
+	}
+	for _, test := range tests {
+		v := newViperWithFlags(t)
+		v.SetConfigType(test.configType)
+		require.NoError(t, v.ReadConfig(bytes.NewBufferString(test.config)))
+		assert.Equal(t, []string{"50", "90", "99.9"}, v.GetStringSlice(ParamPercentThreshold), test.config)
+		assert.Equal(t, []string{"env:prod", "team:statsd"}, v.GetStringSlice(ParamDefaultTags), test.config)
+	}
+
+	// The defaults are used if the file doesn't set them
+	v := newViperWithFlags(t)
+	assert.Equal(t, []string{"90"}, v.GetStringSlice(ParamPercentThreshold))
+	assert.Empty(t, v.GetStringSlice(ParamDefaultTags))
+
+	// A flag given on the command line replaces the list in the file
+	v = newViperWithFlags(t, "--default-tags=env:dev")
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(bytes.NewBufferString("default-tags: ['env:prod', 'team:statsd']\n")))
+	assert.Equal(t, []string{"env:dev"}, v.GetStringSlice(ParamDefaultTags))
+}
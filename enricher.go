@@ -0,0 +1,21 @@
+package gostatsd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// EnricherFactory is a function that returns an Enricher.
+type EnricherFactory func(v *viper.Viper, logger logrus.FieldLogger) (Enricher, error)
+
+// Enricher adds context to metrics as they are received, by adding or modifying their tags.
+// If Enricher implements the Runner interface, it's started in a new goroutine at creation.
+type Enricher interface {
+	// Name returns the name of the enricher.
+	Name() string
+	// Enrich returns the tags of the metric with the name from the source, with any tags added or modified.  The
+	// tags may be modified in place, or a new slice returned.  It is called concurrently, and must not block.
+	Enrich(name string, source Source, tags Tags) Tags
+	// EstimatedTags returns a guess of how many tags are likely to be added by the Enricher
+	EstimatedTags() int
+}
@@ -3,6 +3,8 @@ package gostatsd
 // Gauge is used for storing aggregated values for gauges.
 type Gauge struct {
 	Value     float64  // The numeric value of the metric
+	Sum       float64  // The sum of the values received, so they can be averaged
+	Count     uint64   // The number of values received, 0 if only the last value is known
 	Timestamp Nanotime // Last time value was updated
 	Source    Source   // Source of the metric
 	Tags      Tags     // The tags for the gauge
@@ -10,7 +12,15 @@ type Gauge struct {
 
 // NewGauge initialises a new gauge.
 func NewGauge(timestamp Nanotime, value float64, source Source, tags Tags) Gauge {
-	return Gauge{Value: value, Timestamp: timestamp, Source: source, Tags: tags.Copy()}
+	return Gauge{Value: value, Sum: value, Count: 1, Timestamp: timestamp, Source: source, Tags: tags.Copy()}
+}
+
+// Mean returns the mean of the values received, or the last value if the number received is not known.
+func (g *Gauge) Mean() float64 {
+	if g.Count == 0 {
+		return g.Value
+	}
+	return g.Sum / float64(g.Count)
 }
 
 func (g *Gauge) AddTagsSetSource(additionalTags Tags, newSource Source) {
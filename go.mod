@@ -3,6 +3,7 @@ module github.com/atlassian/gostatsd
 go 1.13
 
 require (
+	github.com/antonmedv/expr v1.12.5
 	github.com/ash2k/stager v0.0.0-20170622123058-6e9c7b0eacd4
 	github.com/aws/aws-sdk-go v1.28.13
 	github.com/cenkalti/backoff v2.2.1+incompatible
@@ -24,10 +25,10 @@ require (
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.6.2
 	github.com/stephens2424/writerset v1.0.2 // indirect
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.8.0
 	github.com/tilinna/clock v1.0.2
 	golang.org/x/net v0.0.0-20200202094626-16171245cfb2
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
 	golang.org/x/tools v0.0.0-20200207224406-61798d64f025
 	k8s.io/api v0.17.3
@@ -0,0 +1,75 @@
+package gostatsd
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	hllPrecision = 12                // Number of bits of the hash used to pick a register
+	hllRegisters = 1 << hllPrecision // 4KiB of registers, for a standard error of about 1.6%
+)
+
+// HyperLogLog estimates the number of distinct strings added to it, in a fixed amount of memory.
+type HyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+// NewHyperLogLog creates an empty HyperLogLog.
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// Add adds a string to the HyperLogLog.
+func (h *HyperLogLog) Add(value string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	// The position of the first set bit in the remaining bits, which is capped by the bit set below them.
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge adds all the strings which have been added to other.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct strings added.
+func (h *HyperLogLog) Estimate() uint64 {
+	const m = float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 is the finalizer of MurmurHash3, which spreads the bits of the FNV hash of short strings across all 64 bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
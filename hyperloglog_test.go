@@ -0,0 +1,51 @@
+package gostatsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	t.Parallel()
+	h := NewHyperLogLog()
+	assert.EqualValues(t, 0, h.Estimate())
+
+	for i := 0; i < 10; i++ {
+		h.Add(strconv.Itoa(i))
+		h.Add(strconv.Itoa(i)) // Duplicates are not counted
+	}
+	assert.EqualValues(t, 10, h.Estimate())
+
+	for _, n := range []int{1000, 100000} {
+		h := NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add("value." + strconv.Itoa(i))
+		}
+		assert.InEpsilon(t, n, h.Estimate(), 0.05, n)
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	t.Parallel()
+	a := NewHyperLogLog()
+	b := NewHyperLogLog()
+	for i := 0; i < 2000; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 1000))
+	}
+	a.Merge(b)
+	assert.InEpsilon(t, 3000, a.Estimate(), 0.05)
+}
+
+func TestSetCount(t *testing.T) {
+	t.Parallel()
+	s := NewSet(0, map[string]struct{}{"a": {}, "b": {}}, "", nil)
+	assert.Equal(t, 2, s.Count())
+
+	s.Estimator = NewHyperLogLog()
+	s.Estimator.Add("a")
+	s.Estimator.Add("c")
+	assert.Equal(t, 3, s.Count()) // Both the Estimator and Values are counted
+}
@@ -24,18 +24,27 @@ type Lexer struct {
 	namespace     string
 	err           error
 	sampling      float64
+	sampled       bool
 
 	MetricPool *pool.MetricPool
+	// DefaultSampleRate is optional, it provides the sample rate for a metric which is received without one.
+	DefaultSampleRate func(name string) float64
+	// UnknownType is optional, it is the type of a metric which is received with an unknown type.  If it is not
+	// set, the metric is rejected with ErrInvalidType.
+	UnknownType gostatsd.MetricType
 }
 
 // assumes we don't have \x00 bytes in input.
 const eof byte = 0
 
+// ErrInvalidType is returned for a metric with an unknown type, or a malformed event.
+var ErrInvalidType = errors.New("invalid type")
+
 var (
 	errMissingKeySep         = errors.New("missing key separator")
 	errEmptyKey              = errors.New("key zero len")
 	errMissingValueSep       = errors.New("missing value separator")
-	errInvalidType           = errors.New("invalid type")
+	errEmptyValue            = errors.New("value zero len")
 	errInvalidFormat         = errors.New("invalid format")
 	errInvalidSamplingOrTags = errors.New("invalid sampling or tags")
 	errInvalidAttributes     = errors.New("invalid event attributes")
@@ -78,6 +87,7 @@ func (l *Lexer) reset() {
 	l.e = nil
 	l.tags = nil
 	l.err = nil
+	l.sampled = false
 }
 
 func (l *Lexer) Run(input []byte, namespace string) (*gostatsd.Metric, *gostatsd.Event, error) {
@@ -94,6 +104,9 @@ func (l *Lexer) Run(input []byte, namespace string) (*gostatsd.Metric, *gostatsd
 		return nil, nil, l.err
 	}
 	if l.m != nil {
+		if !l.sampled && l.DefaultSampleRate != nil {
+			l.sampling = l.DefaultSampleRate(l.m.Name)
+		}
 		l.m.Rate = l.sampling
 		if l.m.Type != gostatsd.SET {
 			v, err := strconv.ParseFloat(l.m.StringValue, 64)
@@ -121,7 +134,7 @@ func lexSpecial(l *Lexer) stateFn {
 	case '_':
 		return lexDatadogSpecial
 	case eof:
-		l.err = errInvalidType
+		l.err = ErrInvalidType
 		return nil
 	default:
 		l.pos--
@@ -171,7 +184,7 @@ func lexDatadogSpecial(l *Lexer) stateFn {
 					lexUint32(&l.eventTextLen,
 						lexAssert('}', lexAssert(':', lexEventBody))))))
 	default:
-		l.err = errInvalidType
+		l.err = ErrInvalidType
 		return nil
 	}
 }
@@ -366,6 +379,10 @@ func lexValueSep(l *Lexer) stateFn {
 
 // lex the value.
 func lexValue(l *Lexer) stateFn {
+	if l.start == l.pos-1 {
+		l.err = errEmptyValue
+		return nil
+	}
 	l.m.StringValue = string(l.input[l.start : l.pos-1])
 	l.start = l.pos
 	return lexType
@@ -385,8 +402,8 @@ func lexType(l *Lexer) stateFn {
 		return lexTypeSep
 	case 'm':
 		if b := l.next(); b != 's' {
-			l.err = errInvalidType
-			return nil
+			l.pos = l.start
+			return lexUnknownType
 		}
 		l.start = l.pos
 		l.m.Type = gostatsd.TIMER
@@ -399,10 +416,12 @@ func lexType(l *Lexer) stateFn {
 		l.m.Type = gostatsd.SET
 		l.start = l.pos
 		return lexTypeSep
-	default:
-		l.err = errInvalidType
+	case eof, '|':
+		l.err = ErrInvalidType
 		return nil
-
+	default:
+		l.pos = l.start
+		return lexUnknownType
 	}
 }
 
@@ -416,8 +435,25 @@ func lexTypeSep(l *Lexer) stateFn {
 		l.start = l.pos
 		return lexSampleRateOrTags
 	}
-	l.err = errInvalidType
-	return nil
+	return lexUnknownType
+}
+
+// lex the remainder of an unknown type, treating the metric as the UnknownType if one is set.
+func lexUnknownType(l *Lexer) stateFn {
+	if l.UnknownType == 0 {
+		l.err = ErrInvalidType
+		return nil
+	}
+	l.m.Type = l.UnknownType
+	for {
+		switch l.next() {
+		case eof:
+			return nil
+		case '|':
+			l.start = l.pos
+			return lexSampleRateOrTags
+		}
+	}
 }
 
 // lex the sample rate or the tags.
@@ -451,7 +487,13 @@ func lexSampleRate(l *Lexer) stateFn {
 		return nil
 	}
 	l.sampling = v
-	if l.pos >= l.len {
+	l.sampled = true
+	if l.pos > l.len {
+		return nil
+	}
+	if l.pos == l.len {
+		// A trailing separator with nothing after it
+		l.err = errInvalidSamplingOrTags
 		return nil
 	}
 	return lexAssert('#', lexTags)
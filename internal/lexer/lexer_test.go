@@ -39,6 +39,10 @@ func TestMetricsLexer(t *testing.T) {
 		"a:1|g|#":                       {Name: "a", Value: 1, Type: gostatsd.GAUGE, Rate: 1.0},
 		"a:1|g|#,":                      {Name: "a", Value: 1, Type: gostatsd.GAUGE, Rate: 1.0},
 		"a:1|g|#,,":                     {Name: "a", Value: 1, Type: gostatsd.GAUGE, Rate: 1.0},
+		"neg.c:-3|c":                    {Name: "neg.c", Value: -3, Type: gostatsd.COUNTER, Rate: 1.0},
+		"neg.c:-3|c|@0.5":               {Name: "neg.c", Value: -3, Type: gostatsd.COUNTER, Rate: 0.5},
+		"neg.g:-2.5|g":                  {Name: "neg.g", Value: -2.5, Type: gostatsd.GAUGE, Rate: 1.0},
+		"neg.g:-2.5|g|#foo":             {Name: "neg.g", Value: -2.5, Type: gostatsd.GAUGE, Rate: 1.0, Tags: gostatsd.Tags{"foo"}},
 	}
 
 	compareMetric(t, tests, "")
@@ -66,6 +70,35 @@ func TestInvalidMetricsLexer(t *testing.T) {
 	compareMetric(t, tests, "stats")
 }
 
+func TestMalformedMetricsLexer(t *testing.T) {
+	t.Parallel()
+	failing := map[string]error{
+		"foo:|c":        errEmptyValue,
+		"foo:|s":        errEmptyValue,
+		"foo:|":         errEmptyValue,
+		"foo:":          errMissingValueSep,
+		"foo:1":         errMissingValueSep,
+		"foo:1|":        ErrInvalidType,
+		"foo||c":        errMissingKeySep,
+		"foo1|c":        errMissingKeySep,
+		":1|c":          errEmptyKey,
+		"foo:1|c|":      errInvalidSamplingOrTags,
+		"foo:1|c||":     errInvalidSamplingOrTags,
+		"foo:1|c|@0.5|": errInvalidSamplingOrTags,
+	}
+	for input, expectedErr := range failing {
+		input := input
+		expectedErr := expectedErr
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+			m, e, err := parseLine([]byte(input), "")
+			assert.Equal(t, expectedErr, err)
+			assert.Nil(t, m)
+			assert.Nil(t, e)
+		})
+	}
+}
+
 func TestEventsLexer(t *testing.T) {
 	t.Parallel()
 	//_e{title.length,text.length}:title|text|d:date_happened|h:hostname|p:priority|t:alert_type|#tag1,tag2
@@ -111,7 +144,7 @@ func TestEventsLexer(t *testing.T) {
 func TestInvalidEventsLexer(t *testing.T) {
 	t.Parallel()
 	failing := map[string]error{
-		"_x{1,1}:a|b":                        errInvalidType,
+		"_x{1,1}:a|b":                        ErrInvalidType,
 		"_e{2,1}:a|b":                        errNotEnoughData,
 		"_e{1,2}:a|b":                        errNotEnoughData,
 		"_e{2,2}:a|b":                        errNotEnoughData,
@@ -141,6 +174,34 @@ func TestInvalidEventsLexer(t *testing.T) {
 	}
 }
 
+func TestUnknownTypeLexer(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"a:1|x", "a:1|mx", "a:1|cx", "a:1|", "a:1||#t:1"} {
+		_, _, err := parseLine([]byte(input), "")
+		assert.Equal(t, ErrInvalidType, err, input)
+	}
+
+	l := Lexer{
+		MetricPool:  pool.NewMetricPool(0),
+		UnknownType: gostatsd.GAUGE,
+	}
+	tests := map[string]gostatsd.Metric{
+		"a:1|x":            {Name: "a", Value: 1, Rate: 1, Type: gostatsd.GAUGE},
+		"a:1|mx|@0.5":      {Name: "a", Value: 1, Rate: 0.5, Type: gostatsd.GAUGE},
+		"a:1|cx|#t:1":      {Name: "a", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"t:1"}},
+		"a:1|unknown|#t:1": {Name: "a", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"t:1"}},
+		"a:1|c":            {Name: "a", Value: 1, Rate: 1, Type: gostatsd.COUNTER},
+	}
+	for input, expected := range tests {
+		result, _, err := l.Run([]byte(input), "")
+		require.NoError(t, err, input)
+		result.DoneFunc = nil
+		assert.Equal(t, &expected, result, input)
+	}
+	_, _, err := l.Run([]byte("a:1|"), "")
+	assert.Equal(t, ErrInvalidType, err) // An empty type is still invalid
+}
+
 func parseLine(input []byte, namespace string) (*gostatsd.Metric, *gostatsd.Event, error) {
 	l := Lexer{
 		MetricPool: pool.NewMetricPool(0),
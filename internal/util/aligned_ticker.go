@@ -17,12 +17,17 @@ import (
 // [r+1*interval, r+interval*2, r+3*interval, ...]
 //
 // The time.Time sent to the channel is guaranteed to be r+offset+n*interval, rather than the actual time of firing.
+//
+// The time to the next tick is recalculated from the clock after every tick, so ticks remain aligned if the wall
+// clock jumps or drifts.  If the clock jumps forward, the ticks in between are skipped.  If it jumps backwards, the
+// time sent is the previous tick plus interval until the clock catches up, so the times sent always increase.
 type AlignedTicker struct {
 	C          <-chan time.Time
 	chInternal chan time.Time
 	chStop     chan struct{}
 	interval   time.Duration
 	offset     time.Duration
+	last       time.Time // The time of the last tick, only accessed by the ticker goroutine
 }
 
 func NewAlignedTicker(interval, offset time.Duration) *AlignedTicker {
@@ -46,37 +51,27 @@ func roundup(t time.Time, i time.Duration) time.Time {
 	return t.Truncate(i).Add(i)
 }
 
+// untilNext returns the duration from now until the next aligned tick.
+func (at *AlignedTicker) untilNext(now time.Time) time.Duration {
+	return roundup(now.Add(-at.offset), at.interval).Add(at.offset).Sub(now)
+}
+
 func (at *AlignedTicker) start(ctx context.Context) {
 	clck := clock.FromContext(ctx)
-	now := clck.Now()
-	initialWait := roundup(now.Add(-at.offset), at.interval).Add(at.offset).Sub(now)
-	tmr := clck.NewTimer(initialWait)
-	var tckr *clock.Ticker
-
-	// Phase 1: wait for the next interval
-	select {
-	case now := <-tmr.C:
-		// Start the repeating timer as soon as possible
-		tckr = clck.NewTicker(at.interval)
-		defer tckr.Stop()
-		if !at.sendTick(now) {
-			tmr.Stop()
-			return
-		}
-	case <-at.chStop:
-		tmr.Stop()
-		return
-	}
+	tmr := clck.NewTimer(at.untilNext(clck.Now()))
+	defer tmr.Stop()
 
-	// Phase 2: process the ticker
 	for {
 		select {
-		case now := <-tckr.C:
+		case <-tmr.C:
+			// Start waiting for the next interval as soon as possible.  The current time is used rather than the
+			// time the timer was due, which differs if the clock jumped while waiting.
+			now := clck.Now()
+			tmr.Reset(at.untilNext(now))
 			if !at.sendTick(now) {
 				return
 			}
 		case <-at.chStop:
-			tckr.Stop()
 			return
 		}
 	}
@@ -84,6 +79,11 @@ func (at *AlignedTicker) start(ctx context.Context) {
 
 func (at *AlignedTicker) sendTick(t time.Time) bool {
 	rounded := t.Add(-at.offset).Truncate(at.interval).Add(at.offset)
+	if !at.last.IsZero() && !rounded.After(at.last) {
+		// The clock has gone backwards
+		rounded = at.last.Add(at.interval)
+	}
+	at.last = rounded
 	select {
 	case at.chInternal <- rounded:
 		return true
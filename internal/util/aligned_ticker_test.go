@@ -89,3 +89,46 @@ func TestAlignedTickerInitialRoundOffset(t *testing.T) {
 
 	tckr.Stop()
 }
+
+func TestAlignedTickerClockJumpForward(t *testing.T) {
+	clck := clock.NewMock(time.Unix(1, 0))
+	ctx, cancel := context.WithTimeout(clock.Context(context.Background(), clck), 100*time.Millisecond)
+	defer cancel()
+	tckr := NewAlignedTickerWithContext(ctx, 1000*time.Millisecond, 0*time.Millisecond)
+
+	fixtures.NextStep(ctx, clck)
+	checkTime(t, ctx, tckr.C, time.Unix(2, 0))
+
+	// The clock jumps from 2s to 10.5s, the missed ticks are skipped
+	clck.Set(time.Unix(10, 500*ms))
+	checkTime(t, ctx, tckr.C, time.Unix(10, 0))
+
+	// And the next tick is aligned to the new time
+	fixtures.NextStep(ctx, clck)
+	checkTime(t, ctx, tckr.C, time.Unix(11, 0))
+	require.Equal(t, time.Unix(11, 0).UnixNano(), clck.Now().UnixNano())
+
+	tckr.Stop()
+}
+
+func TestAlignedTickerClockJumpBackward(t *testing.T) {
+	ch := make(chan time.Time, 1)
+	at := &AlignedTicker{
+		C:          ch,
+		chInternal: ch,
+		chStop:     make(chan struct{}),
+		interval:   1000 * time.Millisecond,
+	}
+	for _, tick := range []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{time.Unix(5, 0), time.Unix(5, 0)},
+		{time.Unix(3, 200*ms), time.Unix(6, 0)}, // The clock went backwards
+		{time.Unix(4, 0), time.Unix(7, 0)},
+		{time.Unix(8, 100*ms), time.Unix(8, 0)}, // And has caught up
+	} {
+		require.True(t, at.sendTick(tick.now))
+		require.Equal(t, tick.expected.UnixNano(), (<-at.C).UnixNano())
+	}
+}
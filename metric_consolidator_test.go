@@ -52,6 +52,7 @@ func TestConsolidation(t *testing.T) {
 		"": {
 			PerSecond: 0,
 			Value:     1,
+			Events:    1,
 			Timestamp: 10,
 			Source:    "",
 			Tags:      nil,
@@ -61,6 +62,7 @@ func TestConsolidation(t *testing.T) {
 		"": {
 			PerSecond: 0,
 			Value:     30,
+			Events:    1,
 			Timestamp: 20,
 			Source:    "",
 			Tags:      nil,
@@ -68,7 +68,9 @@ func (mm *MetricMap) MergeCounter(metricName string, tagsKey string, counterFrom
 			if counterInto.Timestamp < counterFrom.Timestamp {
 				counterInto.Timestamp = counterFrom.Timestamp
 			}
-			counterInto.Value += counterFrom.Value
+			counterInto.Value = AddCounterValues(counterInto.Value, counterFrom.Value)
+			counterInto.AddFraction(counterFrom.Fraction)
+			counterInto.Events += counterFrom.Events
 		} else {
 			counterInto = counterFrom
 		}
@@ -89,6 +91,8 @@ func (mm *MetricMap) MergeGauge(metricName string, tagsKey string, gaugeFrom Gau
 				gaugeInto.Timestamp = gaugeFrom.Timestamp
 				gaugeInto.Value = gaugeFrom.Value
 			}
+			gaugeInto.Sum += gaugeFrom.Sum
+			gaugeInto.Count += gaugeFrom.Count
 		} else {
 			gaugeInto = gaugeFrom
 		}
@@ -268,22 +272,29 @@ func (mm *MetricMap) SplitByTags(tagNames []string) map[string]*MetricMap {
 }
 
 func (mm *MetricMap) receiveCounter(m *Metric, tagsKey string) {
-	value := int64(m.Value / m.Rate)
+	value, fraction := counterValue(m.Value / m.Rate)
 	v, ok := mm.Counters[m.Name]
 	if ok {
 		c, ok := v[tagsKey]
 		if ok {
-			c.Value += value
+			c.Value = AddCounterValues(c.Value, value)
+			c.AddFraction(fraction)
+			c.Events++
 			if m.Timestamp > c.Timestamp {
 				c.Timestamp = m.Timestamp
 			}
 		} else {
 			c = NewCounter(m.Timestamp, value, m.Source, m.Tags)
+			c.Fraction = fraction
+			c.Events = 1
 		}
 		v[tagsKey] = c
 	} else {
+		c := NewCounter(m.Timestamp, value, m.Source, m.Tags)
+		c.Fraction = fraction
+		c.Events = 1
 		mm.Counters[m.Name] = map[string]Counter{
-			tagsKey: NewCounter(m.Timestamp, value, m.Source, m.Tags),
+			tagsKey: c,
 		}
 	}
 }
@@ -293,10 +304,13 @@ func (mm *MetricMap) receiveGauge(m *Metric, tagsKey string) {
 	if ok {
 		g, ok := v[tagsKey]
 		if ok {
-			if m.Timestamp > g.Timestamp {
+			// Metrics parsed from the same datagram share a timestamp, so the last one received is kept
+			if m.Timestamp >= g.Timestamp {
 				g.Value = m.Value
 				g.Timestamp = m.Timestamp
 			}
+			g.Sum += m.Value
+			g.Count++
 		} else {
 			g = NewGauge(m.Timestamp, m.Value, m.Source, m.Tags)
 		}
@@ -367,7 +381,7 @@ func (mm *MetricMap) String() string {
 		_, _ = fmt.Fprintf(buf, "stats.gauge.%s: %f tags=%s\n", k, gauge.Value, tags)
 	})
 	mm.Sets.Each(func(k, tags string, set Set) {
-		_, _ = fmt.Fprintf(buf, "stats.set.%s: %d tags=%s\n", k, len(set.Values), tags)
+		_, _ = fmt.Fprintf(buf, "stats.set.%s: %d tags=%s\n", k, set.Count(), tags)
 	})
 	return buf.String()
 }
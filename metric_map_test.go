@@ -51,22 +51,22 @@ func TestReceive(t *testing.T) {
 
 	expectedCounters := Counters{
 		"foo.bar.baz": map[string]Counter{
-			"": {Value: 2, Timestamp: 10},
+			"": {Value: 2, Events: 1, Timestamp: 10},
 		},
 		"smp.rte": map[string]Counter{
-			"":            {Value: 50, Timestamp: 10},
-			"baz,foo:bar": {Value: 55, Timestamp: 10, Tags: Tags{"baz", "foo:bar"}},
+			"":            {Value: 50, Events: 1, Timestamp: 10},
+			"baz,foo:bar": {Value: 55, Events: 2, Timestamp: 10, Tags: Tags{"baz", "foo:bar"}},
 		},
 		"counter_sampling": map[string]Counter{
-			"": {Value: 28, Timestamp: 10},
+			"": {Value: 28, Events: 2, Timestamp: 10},
 		},
 	}
 	assrt.Equal(expectedCounters, mm.Counters)
 
 	expectedGauges := Gauges{
 		"abc.def.g": map[string]Gauge{
-			"":            {Value: 3, Timestamp: 10},
-			"baz,foo:bar": {Value: 8, Timestamp: 10, Tags: Tags{"baz", "foo:bar"}},
+			"":            {Value: 3, Sum: 3, Count: 1, Timestamp: 10},
+			"baz,foo:bar": {Value: 8, Sum: 8, Count: 1, Timestamp: 10, Tags: Tags{"baz", "foo:bar"}},
 		},
 	}
 	assrt.Equal(expectedGauges, mm.Gauges)
@@ -104,6 +104,22 @@ func TestReceive(t *testing.T) {
 	assrt.Equal(expectedSets, mm.Sets)
 }
 
+func TestReceiveGaugeTimestamps(t *testing.T) {
+	t.Parallel()
+	mm := NewMetricMap()
+	mm.Receive(&Metric{Name: "g", Value: 1, Type: GAUGE, Timestamp: 10})
+	mm.Receive(&Metric{Name: "g", Value: 2, Type: GAUGE, Timestamp: 10})
+	assert.Equal(t, 2.0, mm.Gauges["g"][""].Value) // Equal timestamps keep the last value received
+	mm.Receive(&Metric{Name: "g", Value: 3, Type: GAUGE, Timestamp: 5})
+	assert.Equal(t, 2.0, mm.Gauges["g"][""].Value) // Older values are ignored
+	mm.Receive(&Metric{Name: "g", Value: 4, Type: GAUGE, Timestamp: 11})
+	assert.Equal(t, Gauge{Value: 4, Sum: 10, Count: 4, Timestamp: 11}, mm.Gauges["g"][""])
+
+	// Merging a MetricMap still keeps the existing value for an equal timestamp
+	mm.MergeGauge("g", "", Gauge{Value: 5, Sum: 5, Count: 1, Timestamp: 11})
+	assert.Equal(t, 4.0, mm.Gauges["g"][""].Value)
+}
+
 func benchmarkReceive(metric Metric, b *testing.B) {
 	ma := NewMetricMap()
 	b.ReportAllocs()
@@ -227,6 +243,7 @@ func TestMetricMapMerge(t *testing.T) {
 		"TestMetricMapMerge.counter": map[string]Counter{
 			"": {
 				Value:     10 + (20 / 0.1),
+				Events:    2,
 				Timestamp: 20,
 			},
 		},
@@ -244,6 +261,8 @@ func TestMetricMapMerge(t *testing.T) {
 		"TestMetricMapMerge.gauge": map[string]Gauge{
 			"": {
 				Value:     20, // most recent value wins
+				Sum:       30,
+				Count:     2,
 				Timestamp: 20,
 			},
 		},
@@ -403,3 +422,17 @@ func TestMetricMapSplitByTags(t *testing.T) {
 	mms = mmOriginal.SplitByTags([]string{"t:", "v:"})
 	require.Equal(t, len(mms), 4)
 }
+
+func TestReceiveNegative(t *testing.T) {
+	t.Parallel()
+	mm := NewMetricMap()
+
+	mm.Receive(&Metric{Name: "c", Value: 2, Rate: 1, Type: COUNTER, Timestamp: 10})
+	mm.Receive(&Metric{Name: "c", Value: -3, Rate: 1, Type: COUNTER, Timestamp: 10})
+	mm.Receive(&Metric{Name: "c", Value: -1, Rate: 0.5, Type: COUNTER, Timestamp: 10})
+	mm.Receive(&Metric{Name: "g", Value: 5, Rate: 1, Type: GAUGE, Timestamp: 10})
+	mm.Receive(&Metric{Name: "g", Value: -7.5, Rate: 1, Type: GAUGE, Timestamp: 11})
+
+	assert.Equal(t, Counters{"c": {"": {Value: -3, Events: 3, Timestamp: 10}}}, mm.Counters)
+	assert.Equal(t, Gauges{"g": {"": {Value: -7.5, Sum: -2.5, Count: 2, Timestamp: 11}}}, mm.Gauges)
+}
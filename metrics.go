@@ -3,6 +3,7 @@ package gostatsd
 import (
 	"fmt"
 	"hash/adler32"
+	"math"
 )
 
 // MetricType is an enumeration of all the possible types of Metric.
@@ -34,6 +35,24 @@ func (m MetricType) String() string {
 	return "unknown"
 }
 
+// ParseUnknownMetricType parses the handling of metrics with an unknown type, which is either drop, or the name of
+// the type to treat them as.  It returns 0 for drop.
+func ParseUnknownMetricType(s string) (MetricType, error) {
+	switch s {
+	case "drop":
+		return 0, nil
+	case "counter":
+		return COUNTER, nil
+	case "gauge":
+		return GAUGE, nil
+	case "timer":
+		return TIMER, nil
+	case "set":
+		return SET, nil
+	}
+	return 0, fmt.Errorf("invalid %s %q, must be drop, counter, gauge, timer, or set", ParamUnknownMetricType, s)
+}
+
 // Metric represents a single data collected datapoint.
 type Metric struct {
 	Name        string  // The name of the metric
@@ -111,3 +130,16 @@ type AggregatedMetrics interface {
 	DeleteChild(string, string)
 	HasChildren(string) bool
 }
+
+// CoerceToNumeric will convert non-numeric NaN and Inf values to a numeric value.  NaN is converted to -1, +Inf to
+// the maximum float64, and -Inf to the minimum float64.  If v is a numeric, the same value is returned.
+func CoerceToNumeric(v float64) float64 {
+	if math.IsNaN(v) {
+		return -1
+	} else if math.IsInf(v, 1) {
+		return math.MaxFloat64
+	} else if math.IsInf(v, -1) {
+		return -math.MaxFloat64
+	}
+	return v
+}
@@ -1,6 +1,7 @@
 package gostatsd
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -53,3 +54,39 @@ func TestAddTagsSetSource(t *testing.T) {
 	mTimer.AddTagsSetSource(Tags{"foo"}, "source")
 	require.Equal(t, Tags{"foo"}, mTimer.Tags)
 }
+
+func TestCoerceToNumeric(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		arg  float64
+		want float64
+	}{
+		{"NaN should return -1", math.NaN(), -1},
+		{"+Inf should return maximum float value", math.Inf(+1), math.MaxFloat64},
+		{"-Inf should return minimum float value", math.Inf(-1), -math.MaxFloat64},
+		{"Zero value should return unchanged", 0, 0},
+		{"Positive value within float64 range should return unchanged", 12_345, 12_345},
+		{"Negative value within float64 should return unchanged", -12_345, -12_345},
+		{"Maximum float64 value should return unchanged", math.MaxFloat64, math.MaxFloat64},
+		{"Minimum float64 value should return unchanged", -math.MaxFloat64, -math.MaxFloat64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CoerceToNumeric(tt.arg); got != tt.want {
+				t.Errorf("CoerceToNumeric() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnknownMetricType(t *testing.T) {
+	t.Parallel()
+	for input, expected := range map[string]MetricType{"drop": 0, "counter": COUNTER, "gauge": GAUGE, "timer": TIMER, "set": SET} {
+		mt, err := ParseUnknownMetricType(input)
+		require.NoError(t, err)
+		require.Equal(t, expected, mt, input)
+	}
+	_, err := ParseUnknownMetricType("histogram")
+	require.Error(t, err)
+}
@@ -6,6 +6,36 @@ import (
 	"strings"
 )
 
+const (
+	// PercentileNearestRank uses the value at the rank of the percentile, without interpolation.
+	PercentileNearestRank = "nearest-rank"
+	// PercentileLinear linearly interpolates between the two values closest to the percentile.
+	PercentileLinear = "linear"
+)
+
+// PercentileNameTemplates are the preset templates for naming the upper and lower percentile thresholds of timers.
+var PercentileNameTemplates = map[string]string{
+	"etsy":    "{stat}_{pct}",    // upper_90, lower_-90
+	"datadog": "{pct}percentile", // 90percentile, -90percentile
+}
+
+// PercentileNameTemplate returns the template for naming percentile thresholds.  s may be the name of a preset
+// from PercentileNameTemplates, or a template containing {pct}, and optionally {stat}.
+func PercentileNameTemplate(s string) (string, error) {
+	if template, ok := PercentileNameTemplates[s]; ok {
+		return template, nil
+	}
+	if !strings.Contains(s, "{pct}") {
+		return "", fmt.Errorf("percentile name template %q must be a preset or contain {pct}", s)
+	}
+	return s, nil
+}
+
+// PercentileName applies a template to name a percentile threshold.  stat is upper or lower, and pct is the threshold.
+func PercentileName(template, stat, pct string) string {
+	return strings.NewReplacer("{stat}", stat, "{pct}", pct).Replace(template)
+}
+
 // Percentile is used to store the aggregation for a percentile.
 type Percentile struct {
 	Float float64
@@ -0,0 +1,31 @@
+package gostatsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentileNameTemplate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input string
+		upper string
+		lower string
+	}{
+		{"etsy", "upper_90", "lower_-90"},
+		{"datadog", "90percentile", "-90percentile"},
+		{"p{pct}", "p90", "p-90"},
+		{"{stat}.p{pct}", "upper.p90", "lower.p-90"},
+	}
+	for _, test := range tests {
+		template, err := PercentileNameTemplate(test.input)
+		require.NoError(t, err)
+		assert.Equal(t, test.upper, PercentileName(template, "upper", "90"), test.input)
+		assert.Equal(t, test.lower, PercentileName(template, "lower", "-90"), test.input)
+	}
+
+	_, err := PercentileNameTemplate("upper")
+	assert.Error(t, err)
+}
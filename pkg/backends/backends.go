@@ -2,6 +2,7 @@ package backends
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -9,10 +10,12 @@ import (
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/pkg/backends/cloudwatch"
 	"github.com/atlassian/gostatsd/pkg/backends/datadog"
+	"github.com/atlassian/gostatsd/pkg/backends/dogstatsd"
 	"github.com/atlassian/gostatsd/pkg/backends/graphite"
 	"github.com/atlassian/gostatsd/pkg/backends/influxdb"
 	"github.com/atlassian/gostatsd/pkg/backends/newrelic"
 	"github.com/atlassian/gostatsd/pkg/backends/null"
+	"github.com/atlassian/gostatsd/pkg/backends/pushgateway"
 	"github.com/atlassian/gostatsd/pkg/backends/statsdaemon"
 	"github.com/atlassian/gostatsd/pkg/backends/stdout"
 	"github.com/atlassian/gostatsd/pkg/transport"
@@ -21,6 +24,7 @@ import (
 // All known backends.
 var backends = map[string]gostatsd.BackendFactory{
 	datadog.BackendName:     datadog.NewClientFromViper,
+	dogstatsd.BackendName:   dogstatsd.NewClientFromViper,
 	graphite.BackendName:    graphite.NewClientFromViper,
 	influxdb.BackendName:    influxdb.NewClientFromViper,
 	null.BackendName:        null.NewClientFromViper,
@@ -28,6 +32,17 @@ var backends = map[string]gostatsd.BackendFactory{
 	stdout.BackendName:      stdout.NewClientFromViper,
 	cloudwatch.BackendName:  cloudwatch.NewClientFromViper,
 	newrelic.BackendName:    newrelic.NewClientFromViper,
+	pushgateway.BackendName: pushgateway.NewClientFromViper,
+}
+
+// Names returns the sorted names of all known backends.
+func Names() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // GetBackend creates an instance of the named backend, or nil if
@@ -41,7 +56,8 @@ func GetBackend(name string, v *viper.Viper, logger logrus.FieldLogger, pool *tr
 	return f(v, logger, pool)
 }
 
-// InitBackend creates an instance of the named backend.
+// InitBackend creates an instance of the named backend.  If the backend has an include-metrics or exclude-metrics
+// list, it is wrapped in a FilteredBackend.
 func InitBackend(name string, v *viper.Viper, logger logrus.FieldLogger, pool *transport.TransportPool) (gostatsd.Backend, error) {
 	if name == "" {
 		logger.Info("No backend specified")
@@ -55,8 +71,9 @@ func InitBackend(name string, v *viper.Viper, logger logrus.FieldLogger, pool *t
 		return nil, fmt.Errorf("could not init backend %q: %v", name, err)
 	}
 	if backend == nil {
-		return nil, fmt.Errorf("unknown backend %q", name)
+		return nil, fmt.Errorf("unknown backend %q, available: %v", name, Names())
 	}
+	backend = maybeFilterFromViper(name, backend, v)
 	logger.Info("Initialised backend")
 
 	return backend, nil
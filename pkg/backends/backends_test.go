@@ -0,0 +1,20 @@
+package backends
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd/pkg/transport"
+)
+
+func TestInitBackendUnknown(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	_, err := InitBackend("foo", v, logrus.New(), transport.NewTransportPool(logrus.New(), v))
+	require.Error(t, err)
+	assert.Equal(t, `unknown backend "foo", available: [cloudwatch datadog dogstatsd graphite influxdb newrelic null pushgateway statsdaemon stdout]`, err.Error())
+}
@@ -2,12 +2,16 @@ package cloudwatch
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
@@ -34,6 +38,7 @@ type Client struct {
 	namespace  string
 
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 }
 
 // NewClientFromViper constructs a Cloudwatch backend.
@@ -41,24 +46,34 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 	g := util.GetSubViper(v, "cloudwatch")
 	g.SetDefault("namespace", "StatsD")
 	g.SetDefault("transport", "default")
+	counterMode, err := gostatsd.CounterModeFromViper(g, gostatsd.ParamCounterMode)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 
 	return NewClient(
 		g.GetString("namespace"),
 		g.GetString("transport"),
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 		logger,
 		pool,
 	)
 }
 
 // NewClient constructs a AWS Cloudwatch backend.
-func NewClient(namespace, transport string, disabled gostatsd.TimerSubtypes, logger logrus.FieldLogger, pool *transport.TransportPool) (*Client, error) {
+func NewClient(namespace, transport string, disabled gostatsd.TimerSubtypes, counterMode gostatsd.CounterMode, logger logrus.FieldLogger, pool *transport.TransportPool) (*Client, error) {
 	httpClient, err := pool.Get(transport)
 	if err != nil {
 		return nil, err
 	}
+	// The SDK can only load a custom CA bundle into an http.Transport, so its requests are not counted
+	// in the connection stats of the client.
 	sess, err := session.NewSession(&aws.Config{
-		HTTPClient: httpClient.Client,
+		HTTPClient: &http.Client{
+			Transport: httpClient.Transport,
+			Timeout:   httpClient.Client.Timeout,
+		},
 	})
 	if err != nil {
 		return nil, err
@@ -71,6 +86,7 @@ func NewClient(namespace, transport string, disabled gostatsd.TimerSubtypes, log
 		namespace:  namespace,
 
 		disabledSubtypes: disabled,
+		counterMode:      counterMode,
 	}, nil
 }
 
@@ -128,8 +144,12 @@ func (client *Client) buildMetricData(metrics *gostatsd.MetricMap) (metricData [
 
 	prefix = "stats.counter."
 	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-		addMetricData(key+".count", "Count", float64(counter.Value), counter.Tags)
-		addMetricData(key+".per_second", "Count/Second", counter.PerSecond, counter.Tags)
+		if client.counterMode.Count() {
+			addMetricData(key+".count", "Count", counter.Total(), counter.Tags)
+		}
+		if client.counterMode.Rate() {
+			addMetricData(key+".per_second", "Count/Second", counter.PerSecond, counter.Tags)
+		}
 	})
 
 	prefix = "stats.timers."
@@ -184,7 +204,7 @@ func (client *Client) buildMetricData(metrics *gostatsd.MetricMap) (metricData [
 
 	prefix = "stats.set."
 	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
-		addMetricData(key, "None", float64(len(set.Values)), set.Tags)
+		addMetricData(key, "None", float64(set.Count()), set.Tags)
 	})
 
 	return metricData
@@ -229,13 +249,23 @@ func (client *Client) SendMetricsAsync(ctx context.Context, metrics *gostatsd.Me
 				Namespace:  &client.namespace,
 			})
 
-			errors = append(errors, err)
+			errors = append(errors, classifyError(err))
 		}
 
 		cb(errors)
 	}()
 }
 
+// classifyError returns err as a gostatsd.PermanentError if CloudWatch rejected the request with a client error,
+// other than throttling, which the SDK has already retried.
+func classifyError(err error) error {
+	if rf, ok := err.(awserr.RequestFailure); ok && gostatsd.IsPermanentStatus(rf.StatusCode()) &&
+		!request.IsErrorThrottle(err) && !request.IsErrorRetryable(err) {
+		return gostatsd.Permanent(err)
+	}
+	return err
+}
+
 // Events currently not supported.
 func (client *Client) SendEvent(ctx context.Context, e *gostatsd.Event) (retErr error) {
 	return nil
@@ -2,9 +2,11 @@ package cloudwatch
 
 import (
 	"context"
+	"errors"
 	"math"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
 	"github.com/sirupsen/logrus"
@@ -30,7 +32,7 @@ func TestSendMetrics(t *testing.T) {
 	t.Parallel()
 
 	p := transport.NewTransportPool(logrus.New(), viper.New())
-	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, logrus.New(), p)
+	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 
 	expected := []struct {
@@ -87,7 +89,7 @@ func TestSendMetricDimensions(t *testing.T) {
 	t.Parallel()
 
 	p := transport.NewTransportPool(logrus.New(), viper.New())
-	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, logrus.New(), p)
+	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 
 	metricMap := &gostatsd.MetricMap{
@@ -193,7 +195,7 @@ func TestSendHistogram(t *testing.T) {
 	t.Parallel()
 
 	p := transport.NewTransportPool(logrus.New(), viper.New())
-	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, logrus.New(), p)
+	cli, err := NewClient("ns", "default", gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 
 	metricMap := &gostatsd.MetricMap{
@@ -240,6 +242,19 @@ func TestSendHistogram(t *testing.T) {
 	}
 }
 
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+	invalid := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "bad", nil), 400, "")
+	throttled := awserr.NewRequestFailure(awserr.New("Throttling", "slow down", nil), 400, "")
+	unavailable := awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "down", nil), 503, "")
+
+	assert.Nil(t, classifyError(nil))
+	assert.True(t, gostatsd.IsPermanent(classifyError(invalid)))
+	assert.False(t, gostatsd.IsPermanent(classifyError(throttled)))
+	assert.False(t, gostatsd.IsPermanent(classifyError(unavailable)))
+	assert.False(t, gostatsd.IsPermanent(classifyError(errors.New("connection refused"))))
+}
+
 func findMetricDatum(input *cloudwatch.PutMetricDataInput, name string, dimenensionName string, dimensionValue string) *cloudwatch.MetricDatum {
 	for _, data := range input.MetricData {
 		MetricName := *data.MetricName
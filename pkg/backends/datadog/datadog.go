@@ -60,6 +60,7 @@ type Client struct {
 	batchesDropped uint64            // Accumulated number of batches aborted (data loss)
 	batchesSent    uint64            // Accumulated number of batches successfully sent
 	seriesSent     uint64            // Accumulated number of series successfully sent
+	bytesSent      uint64            // Accumulated number of payload bytes successfully sent
 	batchesRetried stats.ChangeGauge // Accumulated number of batches retried (first send is not a retry)
 
 	logger                logrus.FieldLogger
@@ -74,6 +75,7 @@ type Client struct {
 	compressPayload       bool
 
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 	flushInterval    time.Duration
 }
 
@@ -152,6 +154,7 @@ func (d *Client) Run(ctx context.Context) {
 			statser.Gauge("backend.dropped", float64(atomic.LoadUint64(&d.batchesDropped)), nil)
 			statser.Gauge("backend.sent", float64(atomic.LoadUint64(&d.batchesSent)), nil)
 			statser.Gauge("backend.series.sent", float64(atomic.LoadUint64(&d.seriesSent)), nil)
+			statser.Gauge("backend.payload_bytes", float64(atomic.LoadUint64(&d.bytesSent)), nil)
 		}
 	}
 }
@@ -168,8 +171,12 @@ func (d *Client) processMetrics(now float64, metrics *gostatsd.MetricMap, cb fun
 	}
 
 	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-		fl.addMetric(rate, counter.PerSecond, counter.Source, counter.Tags, key)
-		fl.addMetricf(gauge, float64(counter.Value), counter.Source, counter.Tags, "%s.count", key)
+		if d.counterMode.Rate() {
+			fl.addMetric(rate, counter.PerSecond, counter.Source, counter.Tags, key)
+		}
+		if d.counterMode.Count() {
+			fl.addMetricf(gauge, counter.Total(), counter.Source, counter.Tags, "%s.count", key)
+		}
 		fl.maybeFlush()
 	})
 
@@ -225,7 +232,7 @@ func (d *Client) processMetrics(now float64, metrics *gostatsd.MetricMap, cb fun
 	})
 
 	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
-		fl.addMetric(gauge, float64(len(set.Values)), set.Source, set.Tags, key)
+		fl.addMetric(gauge, float64(set.Count()), set.Source, set.Tags, key)
 		fl.maybeFlush()
 	})
 
@@ -284,13 +291,14 @@ func (d *Client) post(ctx context.Context, buffer *bytes.Buffer, path, typeOfPos
 	for {
 		if err = post(); err == nil {
 			atomic.AddUint64(&d.batchesSent, 1)
+			atomic.AddUint64(&d.bytesSent, uint64(buffer.Len()))
 			return nil
 		}
 
 		next := b.NextBackOff()
-		if next == backoff.Stop {
+		if next == backoff.Stop || gostatsd.IsPermanent(err) {
 			atomic.AddUint64(&d.batchesDropped, 1)
-			return fmt.Errorf("[%s] %v", BackendName, err)
+			return fmt.Errorf("[%s] %w", BackendName, err)
 		}
 
 		d.logger.WithFields(logrus.Fields{
@@ -329,7 +337,7 @@ func (d *Client) constructPost(ctx context.Context, buffer *bytes.Buffer, path,
 		err = marshal(buffer)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("[%s] unable to marshal %s: %v", BackendName, typeOfPost, err)
+		return nil, gostatsd.Permanent(fmt.Errorf("[%s] unable to marshal %s: %v", BackendName, typeOfPost, err))
 	}
 	body := buffer.Bytes()
 
@@ -344,7 +352,7 @@ func (d *Client) constructPost(ctx context.Context, buffer *bytes.Buffer, path,
 		}
 		req, err := http.NewRequest("POST", authenticatedURL, bytes.NewReader(body))
 		if err != nil {
-			return fmt.Errorf("unable to create http.Request: %v", err)
+			return gostatsd.Permanent(fmt.Errorf("unable to create http.Request: %v", err))
 		}
 		req = req.WithContext(ctx)
 		for header, v := range headers {
@@ -362,7 +370,11 @@ func (d *Client) constructPost(ctx context.Context, buffer *bytes.Buffer, path,
 				"status": resp.StatusCode,
 				"body":   string(b),
 			}).Info("request failed")
-			return fmt.Errorf("received bad status code %d", resp.StatusCode)
+			err := fmt.Errorf("received bad status code %d", resp.StatusCode)
+			if gostatsd.IsPermanentStatus(resp.StatusCode) {
+				return gostatsd.Permanent(err)
+			}
+			return err
 		}
 		_, _ = io.Copy(ioutil.Discard, body)
 		return nil
@@ -386,6 +398,10 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 	dd.SetDefault("max_requests", defaultMaxRequests)
 	dd.SetDefault("user-agent", defaultUserAgent)
 	dd.SetDefault("transport", "default")
+	counterMode, err := gostatsd.CounterModeFromViper(dd, gostatsd.ParamCounterModeUnderscore)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 
 	return NewClient(
 		dd.GetString("api_endpoint"),
@@ -398,6 +414,7 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 		dd.GetDuration("max_request_elapsed_time"),
 		v.GetDuration("flush-interval"), // Main viper, not sub-viper
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 		logger,
 		pool,
 	)
@@ -415,6 +432,7 @@ func NewClient(
 	maxRequestElapsedTime,
 	flushInterval time.Duration,
 	disabled gostatsd.TimerSubtypes,
+	counterMode gostatsd.CounterMode,
 	logger logrus.FieldLogger,
 	pool *transport.TransportPool,
 ) (*Client, error) {
@@ -467,6 +485,7 @@ func NewClient(
 		compressPayload:       compressPayload,
 		flushInterval:         flushInterval,
 		disabledSubtypes:      disabled,
+		counterMode:           counterMode,
 	}, nil
 }
 
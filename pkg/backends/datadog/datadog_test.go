@@ -48,7 +48,7 @@ func TestRetries(t *testing.T) {
 		assert.NotEmpty(t, data)
 		if n == 1 {
 			// Return error on first request to trigger a retry
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	})
 	ts := httptest.NewServer(mux)
@@ -57,7 +57,7 @@ func TestRetries(t *testing.T) {
 	v := viper.New()
 	v.Set("transport.default.client-timeout", 1*time.Second)
 	p := transport.NewTransportPool(logrus.New(), v)
-	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", defaultMetricsPerBatch, defaultMaxRequests, true, 2*time.Second, 1*time.Second, gostatsd.TimerSubtypes{}, logrus.New(), p)
+	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", defaultMetricsPerBatch, defaultMaxRequests, true, 2*time.Second, 1*time.Second, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 	res := make(chan []error, 1)
 	clck := clock.NewMock(time.Unix(0, 0))
@@ -75,9 +75,38 @@ func TestRetries(t *testing.T) {
 	ch <- struct{}{}
 }
 
+func TestNoRetriesOnPermanentError(t *testing.T) {
+	t.Parallel()
+	var requestNum uint32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/series", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		atomic.AddUint32(&requestNum, 1)
+		w.WriteHeader(http.StatusForbidden)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	v := viper.New()
+	v.Set("transport.default.client-timeout", 1*time.Second)
+	p := transport.NewTransportPool(logrus.New(), v)
+	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", defaultMetricsPerBatch, defaultMaxRequests, true, 2*time.Second, 1*time.Second, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
+	require.NoError(t, err)
+	res := make(chan []error, 1)
+	client.SendMetricsAsync(context.Background(), twoCounters(), func(errs []error) {
+		res <- errs
+	})
+	errs := <-res
+	require.Len(t, errs, 1)
+	assert.True(t, gostatsd.IsPermanent(errs[0]))
+	assert.EqualValues(t, 1, requestNum)
+	assert.EqualValues(t, 1, client.batchesDropped)
+}
+
 func TestSendMetricsInMultipleBatches(t *testing.T) {
 	t.Parallel()
 	var requestNum uint32
+	var bytesReceived uint64
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v1/series", func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -87,6 +116,7 @@ func TestSendMetricsInMultipleBatches(t *testing.T) {
 			return
 		}
 		assert.NotEmpty(t, data)
+		atomic.AddUint64(&bytesReceived, uint64(len(data)))
 	})
 	ts := httptest.NewServer(mux)
 	defer ts.Close()
@@ -94,7 +124,7 @@ func TestSendMetricsInMultipleBatches(t *testing.T) {
 	v := viper.New()
 	v.Set("transport.default.client-timeout", 1*time.Second)
 	p := transport.NewTransportPool(logrus.New(), v)
-	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1, defaultMaxRequests, true, 2*time.Second, 1*time.Second, gostatsd.TimerSubtypes{}, logrus.New(), p)
+	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1, defaultMaxRequests, true, 2*time.Second, 1*time.Second, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 	res := make(chan []error, 1)
 	client.SendMetricsAsync(context.Background(), twoCounters(), func(errs []error) {
@@ -105,6 +135,7 @@ func TestSendMetricsInMultipleBatches(t *testing.T) {
 		assert.NoError(t, err)
 	}
 	assert.EqualValues(t, 2, requestNum)
+	assert.EqualValues(t, bytesReceived, atomic.LoadUint64(&client.bytesSent))
 }
 
 func TestSendMetrics(t *testing.T) {
@@ -147,7 +178,7 @@ func TestSendMetrics(t *testing.T) {
 	v := viper.New()
 	v.Set("transport.default.client-timeout", 1*time.Second)
 	p := transport.NewTransportPool(logrus.New(), v)
-	cli, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1000, defaultMaxRequests, true, 2*time.Second, 1100*time.Millisecond, gostatsd.TimerSubtypes{}, logrus.New(), p)
+	cli, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1000, defaultMaxRequests, true, 2*time.Second, 1100*time.Millisecond, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 
 	c := clock.NewMock(time.Unix(100, 0))
@@ -265,7 +296,7 @@ func TestSendHistogram(t *testing.T) {
 	v := viper.New()
 	v.Set("transport.default.client-timeout", 1*time.Second)
 	p := transport.NewTransportPool(logrus.New(), v)
-	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1000, defaultMaxRequests, true, 2*time.Second, 1100*time.Millisecond, gostatsd.TimerSubtypes{}, logrus.New(), p)
+	client, err := NewClient(ts.URL, "apiKey123", "agent", "default", 1000, defaultMaxRequests, true, 2*time.Second, 1100*time.Millisecond, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
 	require.NoError(t, err)
 	ctx := clock.Context(context.Background(), clock.NewMock(time.Unix(100, 0)))
 	res := make(chan []error, 1)
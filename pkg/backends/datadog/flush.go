@@ -2,7 +2,6 @@ package datadog
 
 import (
 	"fmt"
-	"math"
 
 	"github.com/atlassian/gostatsd"
 )
@@ -57,25 +56,12 @@ func (f *flush) addMetric(metricType metricType, value float64, source gostatsd.
 		Host:     string(source),
 		Interval: f.flushIntervalSec,
 		Metric:   name,
-		Points:   [1]point{{f.timestamp, coerceToNumeric(value)}},
+		Points:   [1]point{{f.timestamp, gostatsd.CoerceToNumeric(value)}},
 		Tags:     tags,
 		Type:     metricType,
 	})
 }
 
-// coerceToNumeric will convert non-numeric NaN and Inf values to a numeric value.
-// If v is a numeric, the same value is returned.
-func coerceToNumeric(v float64) float64 {
-	if math.IsNaN(v) {
-		return -1
-	} else if math.IsInf(v, 1) {
-		return math.MaxFloat64
-	} else if math.IsInf(v, -1) {
-		return -math.MaxFloat64
-	}
-	return v
-}
-
 func (f *flush) maybeFlush() {
 	if uint(len(f.ts.Series))+20 >= f.metricsPerBatch { // flush before it reaches max size and grows the slice
 		f.cb(f.ts)
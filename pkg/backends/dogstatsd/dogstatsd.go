@@ -0,0 +1,303 @@
+package dogstatsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
+	"github.com/atlassian/gostatsd/pkg/backends/sender"
+	"github.com/atlassian/gostatsd/pkg/transport"
+)
+
+const (
+	// BackendName is the name of this backend.
+	BackendName      = "dogstatsd"
+	maxUDPPacketSize = 1472
+	// DefaultAddress is the default address of the Datadog agent.
+	DefaultAddress = "localhost:8125"
+	// DefaultDialTimeout is the default net.Dial timeout.
+	DefaultDialTimeout = 5 * time.Second
+	// DefaultWriteTimeout is the default socket write timeout.
+	DefaultWriteTimeout = 30 * time.Second
+	// sendChannelSize specifies the size of the buffer of a channel between caller goroutine, producing buffers, and the
+	// goroutine that writes them to the socket.
+	sendChannelSize = 1000
+	// maxConcurrentSends is the number of max concurrent SendMetricsAsync calls that can actually make progress.
+	// More calls will block.
+	maxConcurrentSends = 10
+)
+
+// Client sends aggregated metrics to a Datadog agent using the dogstatsd UDP protocol.
+type Client struct {
+	disabledSubtypes gostatsd.TimerSubtypes
+	sender           sender.Sender
+}
+
+// overflowHandler is invoked when accumulated packed size has reached it's limit.
+// This function should return a new buffer to be used for the rest of the work (may be the same buffer
+// if contents are processed somehow and are no longer needed).
+type overflowHandler func(*bytes.Buffer) (buf *bytes.Buffer, stop bool)
+
+func (client *Client) Run(ctx context.Context) {
+	client.sender.Run(ctx)
+}
+
+// SendMetricsAsync flushes the metrics to the agent, preparing payload synchronously but doing the send asynchronously.
+func (client *Client) SendMetricsAsync(ctx context.Context, metrics *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	sink := make(chan *bytes.Buffer, sendChannelSize)
+	select {
+	case <-ctx.Done():
+		cb([]error{ctx.Err()})
+		return
+	case client.sender.Sink <- sender.Stream{Ctx: ctx, Cb: cb, Buf: sink}:
+	}
+	defer close(sink)
+	client.processMetrics(metrics, func(buf *bytes.Buffer) (*bytes.Buffer, bool) {
+		select {
+		case <-ctx.Done():
+			return nil, true
+		case sink <- buf:
+			return client.sender.GetBuffer(), false
+		}
+	})
+}
+
+// processMetrics serializes the metrics as dogstatsd lines.  Timers have already been aggregated, so their values are
+// sent as gauges, which the agent will not aggregate again.
+func (client *Client) processMetrics(metrics *gostatsd.MetricMap, handler overflowHandler) {
+	type stopProcessing struct {
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(stopProcessing); !ok {
+				panic(r)
+			}
+		}
+	}()
+	buf := client.sender.GetBuffer()
+	defer func() {
+		// Have to use a closure because buf pointer might change its value later
+		client.sender.PutBuffer(buf)
+	}()
+	line := new(bytes.Buffer)
+	writeLine := func(name, value, metricType string, source gostatsd.Source, tags gostatsd.Tags) {
+		line.Reset()
+		line.WriteString(name)
+		line.WriteByte(':')
+		line.WriteString(value)
+		line.WriteByte('|')
+		line.WriteString(metricType)
+		if source != "" {
+			tags = tags.Concat(gostatsd.Tags{"host:" + string(source)})
+		}
+		if len(tags) > 0 {
+			line.WriteString("|#")
+			line.WriteString(strings.Join(tags, ","))
+		}
+		line.WriteByte('\n')
+		// Make sure we don't go over max udp datagram size
+		if buf.Len()+line.Len() > maxUDPPacketSize {
+			b, stop := handler(buf)
+			if stop {
+				panic(stopProcessing{})
+			}
+			buf = b
+		}
+		buf.Write(line.Bytes())
+	}
+	writeGauge := func(name string, value float64, source gostatsd.Source, tags gostatsd.Tags) {
+		// The agent can not parse NaN or ±Inf
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		writeLine(name, strconv.FormatFloat(value, 'f', -1, 64), "g", source, tags)
+	}
+
+	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+		writeLine(key, counter.FormatValue(), "c", counter.Source, counter.Tags)
+	})
+	metrics.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		if timer.Histogram != nil {
+			for histogramThreshold, count := range timer.Histogram {
+				bucketTag := "le:+Inf"
+				if !math.IsInf(float64(histogramThreshold), 1) {
+					bucketTag = "le:" + strconv.FormatFloat(float64(histogramThreshold), 'f', -1, 64)
+				}
+				writeLine(key+".histogram", strconv.Itoa(count), "c", timer.Source, timer.Tags.Concat(gostatsd.Tags{bucketTag}))
+			}
+			return
+		}
+		if !client.disabledSubtypes.Lower {
+			writeGauge(key+".lower", timer.Min, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.Upper {
+			writeGauge(key+".upper", timer.Max, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.Count {
+			writeGauge(key+".count", float64(timer.Count), timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.CountPerSecond {
+			writeGauge(key+".count_ps", timer.PerSecond, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.Mean {
+			writeGauge(key+".mean", timer.Mean, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.Median {
+			writeGauge(key+".median", timer.Median, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.StdDev {
+			writeGauge(key+".std", timer.StdDev, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.Sum {
+			writeGauge(key+".sum", timer.Sum, timer.Source, timer.Tags)
+		}
+		if !client.disabledSubtypes.SumSquares {
+			writeGauge(key+".sum_squares", timer.SumSquares, timer.Source, timer.Tags)
+		}
+		for _, pct := range timer.Percentiles {
+			writeGauge(key+"."+pct.Str, pct.Float, timer.Source, timer.Tags)
+		}
+	})
+	metrics.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		writeGauge(key, gauge.Value, gauge.Source, gauge.Tags)
+	})
+	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
+		writeGauge(key, float64(set.Count()), set.Source, set.Tags)
+	})
+	if buf.Len() > 0 {
+		b, stop := handler(buf) // Process what's left in the buffer
+		if !stop {
+			buf = b
+		}
+	}
+}
+
+// SendEvent sends an event to the agent.
+func (client *Client) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	conn, err := client.sender.ConnFactory()
+	if err != nil {
+		return fmt.Errorf("error connecting to dogstatsd backend: %s", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(EventMessage(e).Bytes())
+
+	return err
+}
+
+// EventMessage serializes an event in the dogstatsd event format.
+func EventMessage(e *gostatsd.Event) *bytes.Buffer {
+	text := strings.Replace(e.Text, "\n", "\\n", -1)
+
+	var buf bytes.Buffer
+	buf.WriteString("_e{")
+	buf.WriteString(strconv.Itoa(len(e.Title)))
+	buf.WriteByte(',')
+	buf.WriteString(strconv.Itoa(len(text)))
+	buf.WriteString("}:")
+	buf.WriteString(e.Title)
+	buf.WriteByte('|')
+	buf.WriteString(text)
+
+	if e.DateHappened != 0 {
+		buf.WriteString("|d:")
+		buf.WriteString(strconv.FormatInt(e.DateHappened, 10))
+	}
+	if e.Source != "" {
+		buf.WriteString("|h:")
+		buf.WriteString(string(e.Source))
+	}
+	if e.AggregationKey != "" {
+		buf.WriteString("|k:")
+		buf.WriteString(e.AggregationKey)
+	}
+	if e.SourceTypeName != "" {
+		buf.WriteString("|s:")
+		buf.WriteString(e.SourceTypeName)
+	}
+	if e.Priority != gostatsd.PriNormal {
+		buf.WriteString("|p:")
+		buf.WriteString(e.Priority.String())
+	}
+	if e.AlertType != gostatsd.AlertInfo {
+		buf.WriteString("|t:")
+		buf.WriteString(e.AlertType.String())
+	}
+	if len(e.Tags) > 0 {
+		buf.WriteString("|#")
+		buf.WriteString(e.Tags[0])
+		for _, tag := range e.Tags[1:] {
+			buf.WriteByte(',')
+			buf.WriteString(tag)
+		}
+	}
+	return &buf
+}
+
+// NewClient constructs a new dogstatsd backend client.
+func NewClient(address string, dialTimeout, writeTimeout time.Duration, disabled gostatsd.TimerSubtypes, logger logrus.FieldLogger) (*Client, error) {
+	if address == "" {
+		return nil, fmt.Errorf("[%s] address is required", BackendName)
+	}
+	if dialTimeout <= 0 {
+		return nil, fmt.Errorf("[%s] dialTimeout should be positive", BackendName)
+	}
+	if writeTimeout < 0 {
+		return nil, fmt.Errorf("[%s] writeTimeout should be non-negative", BackendName)
+	}
+	logger.WithFields(logrus.Fields{
+		"address":       address,
+		"dial-timeout":  dialTimeout,
+		"write-timeout": writeTimeout,
+	}).Info("created backend")
+
+	return &Client{
+		disabledSubtypes: disabled,
+		sender: sender.Sender{
+			Logger: logger,
+			ConnFactory: func() (net.Conn, error) {
+				return net.DialTimeout("udp", address, dialTimeout)
+			},
+			Sink: make(chan sender.Stream, maxConcurrentSends),
+			BufPool: sync.Pool{
+				New: func() interface{} {
+					buf := new(bytes.Buffer)
+					buf.Grow(maxUDPPacketSize)
+					return buf
+				},
+			},
+			WriteTimeout: writeTimeout,
+		},
+	}, nil
+}
+
+// NewClientFromViper constructs a dogstatsd client from the [dogstatsd] configuration.
+func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transport.TransportPool) (gostatsd.Backend, error) {
+	g := util.GetSubViper(v, "dogstatsd")
+	g.SetDefault("address", DefaultAddress)
+	g.SetDefault("dial_timeout", DefaultDialTimeout)
+	g.SetDefault("write_timeout", DefaultWriteTimeout)
+	return NewClient(
+		g.GetString("address"),
+		g.GetDuration("dial_timeout"),
+		g.GetDuration("write_timeout"),
+		gostatsd.DisabledSubMetrics(v),
+		logger,
+	)
+}
+
+// Name returns the name of the backend.
+func (client *Client) Name() string {
+	return BackendName
+}
@@ -0,0 +1,100 @@
+package dogstatsd
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func processLines(t *testing.T, c *Client, mm *gostatsd.MetricMap) []string {
+	var lines []string
+	c.processMetrics(mm, func(buf *bytes.Buffer) (*bytes.Buffer, bool) {
+		assert.LessOrEqual(t, buf.Len(), maxUDPPacketSize)
+		lines = append(lines, strings.Split(strings.TrimSpace(buf.String()), "\n")...)
+		return new(bytes.Buffer), false
+	})
+	return lines
+}
+
+func TestProcessMetrics(t *testing.T) {
+	t.Parallel()
+	mm := gostatsd.NewMetricMap()
+	mm.Counters["c"] = map[string]gostatsd.Counter{
+		"tag1": {Value: 5, Tags: gostatsd.Tags{"tag1"}, Source: "host1"},
+	}
+	mm.Gauges["g"] = map[string]gostatsd.Gauge{
+		"":     {Value: 1.5},
+		"tag2": {Value: math.NaN(), Tags: gostatsd.Tags{"tag2"}},
+	}
+	mm.Sets["s"] = map[string]gostatsd.Set{
+		"": {Values: map[string]struct{}{"a": {}, "b": {}}},
+	}
+	mm.Timers["t"] = map[string]gostatsd.Timer{
+		"a:b": {
+			Count:       2,
+			PerSecond:   0.2,
+			Min:         1,
+			Max:         3,
+			Mean:        2,
+			Median:      2,
+			Sum:         4,
+			SumSquares:  10,
+			Tags:        gostatsd.Tags{"a:b"},
+			Percentiles: gostatsd.Percentiles{{Float: 3, Str: "upper_90"}},
+		},
+	}
+	mm.Timers["h"] = map[string]gostatsd.Timer{
+		"": {Histogram: map[gostatsd.HistogramThreshold]int{10: 1, gostatsd.HistogramThreshold(math.Inf(1)): 2}},
+	}
+
+	c, err := NewClient(DefaultAddress, time.Second, time.Second, gostatsd.TimerSubtypes{StdDev: true}, logrus.New())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"c:5|c|#tag1,host:host1",
+		"g:1.5|g",
+		"s:2|g",
+		"t.lower:1|g|#a:b",
+		"t.upper:3|g|#a:b",
+		"t.count:2|g|#a:b",
+		"t.count_ps:0.2|g|#a:b",
+		"t.mean:2|g|#a:b",
+		"t.median:2|g|#a:b",
+		"t.sum:4|g|#a:b",
+		"t.sum_squares:10|g|#a:b",
+		"t.upper_90:3|g|#a:b",
+		"h.histogram:1|c|#le:10",
+		"h.histogram:2|c|#le:+Inf",
+	}, processLines(t, c, mm))
+}
+
+func TestProcessMetricsSplitsPackets(t *testing.T) {
+	t.Parallel()
+	mm := gostatsd.NewMetricMap()
+	for i := 0; i < 200; i++ {
+		mm.Receive(&gostatsd.Metric{Name: "counter" + strings.Repeat("x", i%20), Value: 1, Tags: gostatsd.Tags{"tag:" + strings.Repeat("y", i)}, Type: gostatsd.COUNTER})
+	}
+	c, err := NewClient(DefaultAddress, time.Second, time.Second, gostatsd.TimerSubtypes{}, logrus.New())
+	require.NoError(t, err)
+	assert.Len(t, processLines(t, c, mm), 200)
+}
+
+func TestEventMessage(t *testing.T) {
+	t.Parallel()
+	e := &gostatsd.Event{
+		Title:     "title",
+		Text:      "line1\nline2",
+		Source:    "host1",
+		Priority:  gostatsd.PriLow,
+		AlertType: gostatsd.AlertError,
+		Tags:      gostatsd.Tags{"a", "b:c"},
+	}
+	assert.Equal(t, "_e{5,12}:title|line1\\nline2|h:host1|p:low|t:error|#a,b:c", EventMessage(e).String())
+}
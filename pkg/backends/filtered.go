@@ -0,0 +1,109 @@
+package backends
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
+)
+
+const (
+	// ParamIncludeMetrics is the name of the backend parameter with the metric names to send to the backend.
+	ParamIncludeMetrics = "include-metrics"
+	// ParamExcludeMetrics is the name of the backend parameter with the metric names not to send to the backend.
+	ParamExcludeMetrics = "exclude-metrics"
+)
+
+// FilteredBackend wraps a Backend so that it is only sent the metrics with matching names.  A metric is sent if it
+// matches any of the include list, or the include list is empty, and does not match any of the exclude list.
+// Events are always sent.
+type FilteredBackend struct {
+	backend gostatsd.Backend
+	include gostatsd.StringMatchList
+	exclude gostatsd.StringMatchList
+}
+
+// NewFilteredBackend creates a new FilteredBackend wrapping the provided Backend.  Names are matched in the same way
+// as filters, and may end in * to match a prefix.
+func NewFilteredBackend(backend gostatsd.Backend, include, exclude []string) *FilteredBackend {
+	return &FilteredBackend{
+		backend: backend,
+		include: toStringMatch(include),
+		exclude: toStringMatch(exclude),
+	}
+}
+
+// maybeFilterFromViper wraps the backend in a FilteredBackend if the backend has an include or exclude list
+// configured in its section.
+func maybeFilterFromViper(name string, backend gostatsd.Backend, v *viper.Viper) gostatsd.Backend {
+	sub := util.GetSubViper(v, name)
+	include := sub.GetStringSlice(ParamIncludeMetrics)
+	exclude := sub.GetStringSlice(ParamExcludeMetrics)
+	if len(include) == 0 && len(exclude) == 0 {
+		return backend
+	}
+	return NewFilteredBackend(backend, include, exclude)
+}
+
+func toStringMatch(tests []string) gostatsd.StringMatchList {
+	matches := make(gostatsd.StringMatchList, 0, len(tests))
+	for _, test := range tests {
+		matches = append(matches, gostatsd.NewStringMatch(test))
+	}
+	return matches
+}
+
+// Name returns the name of the wrapped backend.
+func (fb *FilteredBackend) Name() string {
+	return fb.backend.Name()
+}
+
+// Run runs the wrapped backend, if it needs to be run.
+func (fb *FilteredBackend) Run(ctx context.Context) {
+	if r, ok := fb.backend.(gostatsd.Runner); ok {
+		r.Run(ctx)
+	}
+}
+
+// SendEvent sends the event to the wrapped backend.
+func (fb *FilteredBackend) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	return fb.backend.SendEvent(ctx, e)
+}
+
+// SendMetricsAsync sends the matching metrics to the wrapped backend.  The MetricMap is shared with other
+// backends, so it is not modified.  If no metrics match the callback is passed gostatsd.ErrNothingToSend, so the
+// backend is not counted as having sent them successfully.
+func (fb *FilteredBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	filtered := gostatsd.NewMetricMap()
+	for name, counters := range mm.Counters {
+		if fb.allowed(name) {
+			filtered.Counters[name] = counters
+		}
+	}
+	for name, timers := range mm.Timers {
+		if fb.allowed(name) {
+			filtered.Timers[name] = timers
+		}
+	}
+	for name, gauges := range mm.Gauges {
+		if fb.allowed(name) {
+			filtered.Gauges[name] = gauges
+		}
+	}
+	for name, sets := range mm.Sets {
+		if fb.allowed(name) {
+			filtered.Sets[name] = sets
+		}
+	}
+	if filtered.IsEmpty() {
+		cb([]error{gostatsd.ErrNothingToSend})
+		return
+	}
+	fb.backend.SendMetricsAsync(ctx, filtered, cb)
+}
+
+func (fb *FilteredBackend) allowed(name string) bool {
+	return (len(fb.include) == 0 || fb.include.MatchAny(name)) && !fb.exclude.MatchAny(name)
+}
@@ -0,0 +1,75 @@
+package backends
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/backends/null"
+	"github.com/atlassian/gostatsd/pkg/transport"
+)
+
+type recordingBackend struct {
+	null.Client
+	sent []*gostatsd.MetricMap
+}
+
+func (rb *recordingBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	rb.sent = append(rb.sent, mm)
+	cb(nil)
+}
+
+func TestFilteredBackend(t *testing.T) {
+	t.Parallel()
+	mm := gostatsd.NewMetricMap()
+	for _, name := range []string{"cheap.a", "cheap.debug.b", "expensive.c"} {
+		mm.Receive(&gostatsd.Metric{Name: name, Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+		mm.Receive(&gostatsd.Metric{Name: name, Value: 1, Rate: 1, Type: gostatsd.TIMER})
+		mm.Receive(&gostatsd.Metric{Name: name, Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+		mm.Receive(&gostatsd.Metric{Name: name, StringValue: "x", Rate: 1, Type: gostatsd.SET})
+	}
+
+	rb := &recordingBackend{}
+	fb := NewFilteredBackend(rb, []string{"cheap.*"}, []string{"cheap.debug.*"})
+	fb.SendMetricsAsync(context.Background(), mm, func(errs []error) {})
+	require.Len(t, rb.sent, 1)
+	sent := rb.sent[0]
+	assert.Len(t, sent.Counters, 1)
+	assert.Contains(t, sent.Counters, "cheap.a")
+	assert.Len(t, sent.Timers, 1)
+	assert.Contains(t, sent.Timers, "cheap.a")
+	assert.Len(t, sent.Gauges, 1)
+	assert.Contains(t, sent.Gauges, "cheap.a")
+	assert.Len(t, sent.Sets, 1)
+	assert.Contains(t, sent.Sets, "cheap.a")
+	assert.Len(t, mm.Counters, 3) // The original is not modified
+
+	// Nothing is sent if every metric is filtered, which is not reported as a success
+	called := false
+	NewFilteredBackend(rb, nil, []string{"cheap.*", "expensive.*"}).SendMetricsAsync(context.Background(), mm, func(errs []error) {
+		called = true
+		assert.True(t, gostatsd.IsNothingToSend(errs))
+	})
+	assert.True(t, called)
+	assert.Len(t, rb.sent, 1)
+}
+
+func TestInitBackendFiltered(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	pool := transport.NewTransportPool(logrus.New(), v)
+	backend, err := InitBackend(null.BackendName, v, logrus.New(), pool)
+	require.NoError(t, err)
+	assert.IsType(t, &null.Client{}, backend)
+
+	v.Set(null.BackendName+"."+ParamExcludeMetrics, []string{"debug.*"})
+	backend, err = InitBackend(null.BackendName, v, logrus.New(), pool)
+	require.NoError(t, err)
+	assert.IsType(t, &FilteredBackend{}, backend)
+	assert.Equal(t, null.BackendName, backend.Name())
+}
@@ -44,6 +44,10 @@ const (
 	DefaultGlobalSuffix = ""
 	// DefaultMode controls whether to use legacy namespace, no tags, or tags
 	DefaultMode = "tags"
+	// DefaultSignificantDigits is the default number of significant digits to round floats to, 0 to not round.
+	DefaultSignificantDigits = 0
+	// DefaultGaugeTimestamps is the default for sending gauges with the time they were last updated.
+	DefaultGaugeTimestamps = false
 )
 
 const (
@@ -60,15 +64,18 @@ var (
 
 // Client is an object that is used to send messages to a Graphite server's TCP interface.
 type Client struct {
-	sender           sender.Sender
-	counterNamespace string // all strings have . stripped off start and end, and are normalized.
-	timerNamespace   string
-	gaugesNamespace  string
-	setsNamespace    string
-	globalSuffix     string
-	legacyNamespace  bool
-	enableTags       bool
-	disabledSubtypes gostatsd.TimerSubtypes
+	sender            sender.Sender
+	counterNamespace  string // all strings have . stripped off start and end, and are normalized.
+	timerNamespace    string
+	gaugesNamespace   string
+	setsNamespace     string
+	globalSuffix      string
+	legacyNamespace   bool
+	enableTags        bool
+	disabledSubtypes  gostatsd.TimerSubtypes
+	counterMode       gostatsd.CounterMode
+	significantDigits int  // Number of significant digits to round floats to, or 0 to write 6 decimal places
+	gaugeTimestamps   bool // Send gauges with the time they were last updated, rather than the flush time
 }
 
 func (client *Client) Run(ctx context.Context) {
@@ -109,6 +116,16 @@ func asGraphiteTag(tag string) string {
 	return "unnamed=" + tag
 }
 
+// formatFloat will format a float with 6 decimal places, or rounded to the configured number of significant digits
+// without trailing zeros.
+func (client *Client) formatFloat(f float64) string {
+	if client.significantDigits <= 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'f', 6, 64)
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', client.significantDigits, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
 // prepareName will create a metric name, handling correct prefix, suffixes, and tags, with an optional host tag if
 // not overridden by a tag on the metric.
 func (client *Client) prepareName(namespace, name, suffix string, source gostatsd.Source, tags gostatsd.Tags) string {
@@ -151,13 +168,21 @@ func (client *Client) preparePayload(metrics *gostatsd.MetricMap, ts time.Time)
 	now := ts.Unix()
 	if client.legacyNamespace {
 		metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-			_, _ = fmt.Fprintf(buf, "%s %d %d\n", client.prepareName("stats_counts", key, "", counter.Source, counter.Tags), counter.Value, now)
-			_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.counterNamespace, key, "", counter.Source, counter.Tags), counter.PerSecond, now)
+			if client.counterMode.Count() {
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName("stats_counts", key, "", counter.Source, counter.Tags), counter.FormatValue(), now)
+			}
+			if client.counterMode.Rate() {
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.counterNamespace, key, "", counter.Source, counter.Tags), client.formatFloat(counter.PerSecond), now)
+			}
 		})
 	} else {
 		metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-			_, _ = fmt.Fprintf(buf, "%s %d %d\n", client.prepareName(client.counterNamespace, key, "count", counter.Source, counter.Tags), counter.Value, now)
-			_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.counterNamespace, key, "rate", counter.Source, counter.Tags), counter.PerSecond, now)
+			if client.counterMode.Count() {
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.counterNamespace, key, "count", counter.Source, counter.Tags), counter.FormatValue(), now)
+			}
+			if client.counterMode.Rate() {
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.counterNamespace, key, "rate", counter.Source, counter.Tags), client.formatFloat(counter.PerSecond), now)
+			}
 		})
 	}
 	metrics.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
@@ -172,42 +197,46 @@ func (client *Client) preparePayload(metrics *gostatsd.MetricMap, ts time.Time)
 			}
 		} else {
 			if !client.disabledSubtypes.Lower {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "lower", timer.Source, timer.Tags), timer.Min, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "lower", timer.Source, timer.Tags), client.formatFloat(timer.Min), now)
 			}
 			if !client.disabledSubtypes.Upper {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "upper", timer.Source, timer.Tags), timer.Max, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "upper", timer.Source, timer.Tags), client.formatFloat(timer.Max), now)
 			}
 			if !client.disabledSubtypes.Count {
 				_, _ = fmt.Fprintf(buf, "%s %d %d\n", client.prepareName(client.timerNamespace, key, "count", timer.Source, timer.Tags), timer.Count, now)
 			}
 			if !client.disabledSubtypes.CountPerSecond {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "count_ps", timer.Source, timer.Tags), timer.PerSecond, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "count_ps", timer.Source, timer.Tags), client.formatFloat(timer.PerSecond), now)
 			}
 			if !client.disabledSubtypes.Mean {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "mean", timer.Source, timer.Tags), timer.Mean, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "mean", timer.Source, timer.Tags), client.formatFloat(timer.Mean), now)
 			}
 			if !client.disabledSubtypes.Median {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "median", timer.Source, timer.Tags), timer.Median, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "median", timer.Source, timer.Tags), client.formatFloat(timer.Median), now)
 			}
 			if !client.disabledSubtypes.StdDev {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "std", timer.Source, timer.Tags), timer.StdDev, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "std", timer.Source, timer.Tags), client.formatFloat(timer.StdDev), now)
 			}
 			if !client.disabledSubtypes.Sum {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "sum", timer.Source, timer.Tags), timer.Sum, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "sum", timer.Source, timer.Tags), client.formatFloat(timer.Sum), now)
 			}
 			if !client.disabledSubtypes.SumSquares {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, "sum_squares", timer.Source, timer.Tags), timer.SumSquares, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, "sum_squares", timer.Source, timer.Tags), client.formatFloat(timer.SumSquares), now)
 			}
 			for _, pct := range timer.Percentiles {
-				_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.timerNamespace, key, pct.Str, timer.Source, timer.Tags), pct.Float, now)
+				_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.timerNamespace, key, pct.Str, timer.Source, timer.Tags), client.formatFloat(pct.Float), now)
 			}
 		}
 	})
 	metrics.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
-		_, _ = fmt.Fprintf(buf, "%s %f %d\n", client.prepareName(client.gaugesNamespace, key, "", gauge.Source, gauge.Tags), gauge.Value, now)
+		timestamp := now
+		if client.gaugeTimestamps && gauge.Timestamp > 0 {
+			timestamp = time.Unix(0, int64(gauge.Timestamp)).Unix()
+		}
+		_, _ = fmt.Fprintf(buf, "%s %s %d\n", client.prepareName(client.gaugesNamespace, key, "", gauge.Source, gauge.Tags), client.formatFloat(gauge.Value), timestamp)
 	})
 	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
-		_, _ = fmt.Fprintf(buf, "%s %d %d\n", client.prepareName(client.setsNamespace, key, "", set.Source, set.Tags), len(set.Values), now)
+		_, _ = fmt.Fprintf(buf, "%s %d %d\n", client.prepareName(client.setsNamespace, key, "", set.Source, set.Tags), set.Count(), now)
 	})
 	return buf
 }
@@ -235,6 +264,12 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 	g.SetDefault("prefix_set", DefaultPrefixSet)
 	g.SetDefault("global_suffix", DefaultGlobalSuffix)
 	g.SetDefault("mode", DefaultMode)
+	g.SetDefault("significant_digits", DefaultSignificantDigits)
+	g.SetDefault("gauge_timestamps", DefaultGaugeTimestamps)
+	counterMode, err := gostatsd.CounterModeFromViper(g, gostatsd.ParamCounterModeUnderscore)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 	return NewClient(
 		g.GetString("address"),
 		g.GetDuration("dial_timeout"),
@@ -246,7 +281,10 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 		g.GetString("prefix_set"),
 		g.GetString("global_suffix"),
 		g.GetString("mode"),
+		g.GetInt("significant_digits"),
+		g.GetBool("gauge_timestamps"),
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 		logger,
 	)
 }
@@ -263,7 +301,10 @@ func NewClient(
 	prefixSet string,
 	globalSuffix string,
 	mode string,
+	significantDigits int,
+	gaugeTimestamps bool,
 	disabled gostatsd.TimerSubtypes,
+	counterMode gostatsd.CounterMode,
 	logger logrus.FieldLogger,
 ) (*Client, error) {
 	if address == "" {
@@ -275,6 +316,9 @@ func NewClient(
 	if writeTimeout < 0 {
 		return nil, fmt.Errorf("[%s] writeTimeout should be non-negative", BackendName)
 	}
+	if significantDigits < 0 {
+		return nil, fmt.Errorf("[%s] significantDigits should be non-negative", BackendName)
+	}
 	globalSuffix = strings.Trim(globalSuffix, ".")
 
 	var legacyNamespace, enableTags bool
@@ -314,15 +358,17 @@ func NewClient(
 	globalSuffix = normalizeMetricName(globalSuffix)
 
 	logger.WithFields(logrus.Fields{
-		"address":           address,
-		"dial-timeout":      dialTimeout,
-		"write-timeout":     writeTimeout,
-		"counter-namespace": counterNamespace,
-		"timer-namespace":   timerNamespace,
-		"gauges-namespace":  gaugesNamespace,
-		"sets-namespace":    setsNamespace,
-		"global-suffix":     globalSuffix,
-		"mode":              mode,
+		"address":            address,
+		"dial-timeout":       dialTimeout,
+		"write-timeout":      writeTimeout,
+		"counter-namespace":  counterNamespace,
+		"timer-namespace":    timerNamespace,
+		"gauges-namespace":   gaugesNamespace,
+		"sets-namespace":     setsNamespace,
+		"global-suffix":      globalSuffix,
+		"mode":               mode,
+		"significant-digits": significantDigits,
+		"gauge-timestamps":   gaugeTimestamps,
 	}).Info("created backend")
 
 	return &Client{
@@ -341,14 +387,17 @@ func NewClient(
 			},
 			WriteTimeout: writeTimeout,
 		},
-		counterNamespace: counterNamespace,
-		timerNamespace:   timerNamespace,
-		gaugesNamespace:  gaugesNamespace,
-		setsNamespace:    setsNamespace,
-		globalSuffix:     globalSuffix,
-		legacyNamespace:  legacyNamespace,
-		enableTags:       enableTags,
-		disabledSubtypes: disabled,
+		counterNamespace:  counterNamespace,
+		timerNamespace:    timerNamespace,
+		gaugesNamespace:   gaugesNamespace,
+		setsNamespace:     setsNamespace,
+		globalSuffix:      globalSuffix,
+		legacyNamespace:   legacyNamespace,
+		enableTags:        enableTags,
+		disabledSubtypes:  disabled,
+		counterMode:       counterMode,
+		significantDigits: significantDigits,
+		gaugeTimestamps:   gaugeTimestamps,
 	}, nil
 }
 
@@ -42,7 +42,7 @@ func TestPreparePayloadLegacy(t *testing.T) {
 		"stats.timers.t1.count_90.gs 90.000000 1234\n" +
 		"stats.gauges.g1.gs 3.000000 1234\n" +
 		"stats.sets.users.gs 3 1234\n"
-	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "ignored1", "ignored2", "ignored3", "ignored4", "ignored5", "gs", "legacy", gostatsd.TimerSubtypes{}, logrus.New())
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "ignored1", "ignored2", "ignored3", "ignored4", "ignored5", "gs", "legacy", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New())
 	require.NoError(t, err)
 	b := cl.preparePayload(metrics, time.Unix(1234, 0))
 	expected = sortLines(expected)
@@ -73,7 +73,7 @@ func TestPreparePayloadBasic(t *testing.T) {
 		"gp.pt.t1.count_90.gs 90.000000 1234\n" +
 		"gp.pg.g1.gs 3.000000 1234\n" +
 		"gp.ps.users.gs 3 1234\n"
-	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "basic", gostatsd.TimerSubtypes{}, logrus.New())
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "basic", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New())
 	require.NoError(t, err)
 	b := cl.preparePayload(metrics, time.Unix(1234, 0))
 	expected = sortLines(expected)
@@ -104,7 +104,7 @@ func TestPreparePayloadTags(t *testing.T) {
 		"gp.pt.t1.count_90.gs 90.000000 1234\n" +
 		"gp.pg.g1.gs 3.000000 1234\n" +
 		"gp.ps.users.gs 3 1234\n"
-	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", gostatsd.TimerSubtypes{}, logrus.New())
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New())
 	require.NoError(t, err)
 	b := cl.preparePayload(metrics, time.Unix(1234, 0))
 	expected = sortLines(expected)
@@ -112,6 +112,58 @@ func TestPreparePayloadTags(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestPreparePayloadCounterMode(t *testing.T) {
+	t.Parallel()
+	metrics := gostatsd.NewMetricMap()
+	metrics.Counters["stat1"] = map[string]gostatsd.Counter{
+		"": {PerSecond: 1.1, Value: 5},
+	}
+	for mode, expected := range map[gostatsd.CounterMode]string{
+		gostatsd.CounterModeCount: "gp.pc.stat1.count.gs 5 1234\n",
+		gostatsd.CounterModeRate:  "gp.pc.stat1.rate.gs 1.100000 1234\n",
+	} {
+		cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", 0, false, gostatsd.TimerSubtypes{}, mode, logrus.New())
+		require.NoError(t, err)
+		assert.Equal(t, expected, cl.preparePayload(metrics, time.Unix(1234, 0)).String())
+	}
+}
+
+func TestPreparePayloadCounterFraction(t *testing.T) {
+	t.Parallel()
+	metrics := gostatsd.NewMetricMap()
+	metrics.Counters["stat1"] = map[string]gostatsd.Counter{
+		"": {PerSecond: 0.55, Value: 5, Fraction: 0.5},
+	}
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeCount, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, "gp.pc.stat1.count.gs 5.5 1234\n", cl.preparePayload(metrics, time.Unix(1234, 0)).String())
+}
+
+func TestPreparePayloadSignificantDigits(t *testing.T) {
+	t.Parallel()
+	metrics := gostatsd.NewMetricMap()
+	metrics.Counters["stat1"] = map[string]gostatsd.Counter{
+		"": {PerSecond: 1.0 / 3, Value: 5},
+	}
+	metrics.Timers["t1"] = map[string]gostatsd.Timer{
+		"": {Mean: 1234567.891, Percentiles: gostatsd.Percentiles{{Float: 0.000123456789, Str: "upper_90"}}},
+	}
+	metrics.Gauges["g1"] = map[string]gostatsd.Gauge{
+		"": {Value: 3},
+	}
+	expected := "gp.pc.stat1.rate.gs 0.333333 1234\n" +
+		"gp.pt.t1.mean.gs 1234570 1234\n" +
+		"gp.pt.t1.upper_90.gs 0.000123457 1234\n" +
+		"gp.pg.g1.gs 3 1234\n"
+	disabled := gostatsd.TimerSubtypes{Lower: true, Upper: true, Count: true, CountPerSecond: true, Median: true, StdDev: true, Sum: true, SumSquares: true}
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "basic", 6, false, disabled, gostatsd.CounterModeRate, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, expected, cl.preparePayload(metrics, time.Unix(1234, 0)).String())
+
+	_, err = NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "basic", -1, false, disabled, gostatsd.CounterModeRate, logrus.New())
+	require.Error(t, err)
+}
+
 func TestPreparePayloadHistogram(t *testing.T) {
 	t.Parallel()
 	metrics := metricsWithHistogram()
@@ -123,7 +175,7 @@ func TestPreparePayloadHistogram(t *testing.T) {
 			"gp.pc.t1.histogram.gs;le=60 19 1234\n" +
 			"gp.pc.t1.histogram.gs;le=+Inf 19 1234\n"
 
-	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", gostatsd.TimerSubtypes{}, logrus.New())
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "gs", "tags", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New())
 	require.NoError(t, err)
 	b := cl.preparePayload(metrics, time.Unix(1234, 0))
 	expected = sortLines(expected)
@@ -131,6 +183,28 @@ func TestPreparePayloadHistogram(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
+func TestPreparePayloadGaugeTimestamps(t *testing.T) {
+	t.Parallel()
+	metrics := gostatsd.NewMetricMap()
+	metrics.Gauges["updated"] = map[string]gostatsd.Gauge{
+		"": {Value: 1, Timestamp: gostatsd.Nanotime(time.Unix(1200, 500).UnixNano())},
+	}
+	metrics.Gauges["unknown"] = map[string]gostatsd.Gauge{
+		"": {Value: 2},
+	}
+	metrics.Counters["c"] = map[string]gostatsd.Counter{
+		"": {Value: 3, Timestamp: gostatsd.Nanotime(time.Unix(1200, 0).UnixNano())},
+	}
+
+	cl, err := NewClient("127.0.0.1:9", 1*time.Second, 1*time.Second, "gp", "pc", "pt", "pg", "ps", "", "basic", 0, true, gostatsd.TimerSubtypes{}, gostatsd.CounterModeCount, logrus.New())
+	require.NoError(t, err)
+	b := cl.preparePayload(metrics, time.Unix(1234, 0))
+	expected := "gp.pc.c.count 3 1234\n" + // Only gauges use their own timestamp
+		"gp.pg.unknown 2.000000 1234\n" +
+		"gp.pg.updated 1.000000 1200\n"
+	require.Equal(t, sortLines(expected), sortLines(b.String()))
+}
+
 func sortLines(s string) string {
 	lines := strings.Split(s, "\n")
 	sort.Strings(lines)
@@ -143,7 +217,7 @@ func TestSendMetricsAsync(t *testing.T) {
 	require.NoError(t, err)
 	defer l.Close()
 	addr := l.Addr().String()
-	c, err := NewClient(addr, 1*time.Second, 10*time.Second, "", "", "", "", "", "", "basic", gostatsd.TimerSubtypes{}, logrus.New())
+	c, err := NewClient(addr, 1*time.Second, 10*time.Second, "", "", "", "", "", "", "basic", 0, false, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New())
 	require.NoError(t, err)
 
 	var acceptWg sync.WaitGroup
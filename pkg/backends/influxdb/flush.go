@@ -22,6 +22,7 @@ type flush struct {
 	timestampSeconds int64
 	flushIntervalSec float64
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 	errorCounter     *uint64
 	cb               func(buf *bytes.Buffer, seriesCount uint64)
 	getBuffer        func() (*bytes.Buffer, io.WriteCloser)
@@ -144,9 +145,18 @@ func writeName(w io.Writer, name string, tags gostatsd.Tags) {
 	_, _ = w.Write([]byte(formatNameTags(name, tags)))
 }
 
-func (f *flush) addCounter(name string, tags gostatsd.Tags, count int64, rate float64) {
+func (f *flush) addCounter(name string, tags gostatsd.Tags, count string, rate float64) {
 	writeName(f.writer, name, tags)
-	_, _ = f.writer.Write([]byte(fmt.Sprintf("count=%d,rate=%g %d\n", count, rate, f.timestampSeconds)))
+	var fields string
+	switch {
+	case !f.counterMode.Rate():
+		fields = fmt.Sprintf("count=%s", count)
+	case !f.counterMode.Count():
+		fields = fmt.Sprintf("rate=%g", rate)
+	default:
+		fields = fmt.Sprintf("count=%s,rate=%g", count, rate)
+	}
+	_, _ = f.writer.Write([]byte(fmt.Sprintf("%s %d\n", fields, f.timestampSeconds)))
 	f.metricCount++
 	f.maybeFlush()
 }
@@ -68,6 +68,7 @@ type Client struct {
 	batchesCreateFailed uint64            // Accumulated number of batches which failed to serialize (data loss, no retry is possible)
 	batchesSent         uint64            // Accumulated number of batches successfully sent
 	seriesSent          uint64            // Accumulated number of series successfully sent
+	bytesSent           uint64            // Accumulated number of payload bytes successfully sent
 	batchesRetried      stats.ChangeGauge // Accumulated number of batches retried (first send is not a retry)
 
 	logger logrus.FieldLogger
@@ -82,6 +83,7 @@ type Client struct {
 	compressPayload       bool
 
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 	flushInterval    time.Duration
 }
 
@@ -104,6 +106,10 @@ func NewClientFromViper(
 	if err != nil {
 		return nil, err
 	}
+	counterMode, err := gostatsd.CounterModeFromViper(influxViper, gostatsd.ParamCounterMode)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 
 	return NewClient(
 		influxViper.GetString(paramApiEndpoint),
@@ -115,6 +121,7 @@ func NewClientFromViper(
 		influxViper.GetString(paramTransport),
 		cfg,
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 		logger,
 		pool,
 	)
@@ -131,6 +138,7 @@ func NewClient(
 	transport string,
 	cfg config,
 	disabled gostatsd.TimerSubtypes,
+	counterMode gostatsd.CounterMode,
 	logger logrus.FieldLogger,
 	pool *transport.TransportPool,
 ) (*Client, error) {
@@ -197,6 +205,7 @@ func NewClient(
 		client:                httpClient.Client,
 		reqBufferSem:          reqBufferSem,
 		disabledSubtypes:      disabled,
+		counterMode:           counterMode,
 	}, nil
 }
 
@@ -271,6 +280,7 @@ func (idb *Client) Run(ctx context.Context) {
 			statser.Gauge("backend.dropped", float64(atomic.LoadUint64(&idb.batchesDropped)), nil)
 			statser.Gauge("backend.sent", float64(atomic.LoadUint64(&idb.batchesSent)), nil)
 			statser.Gauge("backend.series.sent", float64(atomic.LoadUint64(&idb.seriesSent)), nil)
+			statser.Gauge("backend.payload_bytes", float64(atomic.LoadUint64(&idb.bytesSent)), nil)
 		}
 	}
 }
@@ -281,6 +291,7 @@ func (idb *Client) processMetrics(ctx context.Context, nowSeconds int64, metrics
 		flushIntervalSec: idb.flushInterval.Seconds(),
 		metricsPerBatch:  idb.metricsPerBatch,
 		disabledSubtypes: idb.disabledSubtypes,
+		counterMode:      idb.counterMode,
 		errorCounter:     &idb.batchesCreateFailed,
 		cb:               cb,
 		getBuffer: func() (*bytes.Buffer, io.WriteCloser) {
@@ -295,7 +306,7 @@ func (idb *Client) processMetrics(ctx context.Context, nowSeconds int64, metrics
 		if fl.buffer == nil {
 			return
 		}
-		fl.addCounter(metricName, counter.Tags, counter.Value, counter.PerSecond)
+		fl.addCounter(metricName, counter.Tags, counter.FormatValue(), counter.PerSecond)
 	})
 
 	metrics.Timers.Each(func(metricName, tagsKey string, timer gostatsd.Timer) {
@@ -320,7 +331,7 @@ func (idb *Client) processMetrics(ctx context.Context, nowSeconds int64, metrics
 		if fl.buffer == nil {
 			return
 		}
-		fl.addSet(metricName, set.Tags, uint64(len(set.Values)))
+		fl.addSet(metricName, set.Tags, uint64(set.Count()))
 	})
 
 	if fl.metricCount == 0 {
@@ -433,13 +444,14 @@ func (idb *Client) post(ctx context.Context, buffer *bytes.Buffer) error {
 	for {
 		if err = post(); err == nil {
 			atomic.AddUint64(&idb.batchesSent, 1)
+			atomic.AddUint64(&idb.bytesSent, uint64(buffer.Len()))
 			return nil
 		}
 
 		next := bo.NextBackOff()
-		if next == backoff.Stop {
+		if next == backoff.Stop || gostatsd.IsPermanent(err) {
 			atomic.AddUint64(&idb.batchesDropped, 1)
-			return fmt.Errorf("[%s] %v", BackendName, err)
+			return fmt.Errorf("[%s] %w", BackendName, err)
 		}
 
 		idb.logger.WithFields(logrus.Fields{
@@ -477,7 +489,7 @@ func (idb *Client) constructPost(ctx context.Context, buffer *bytes.Buffer) (fun
 
 		req, err := http.NewRequestWithContext(ctx, "POST", idb.url, bytes.NewReader(body))
 		if err != nil {
-			return fmt.Errorf("unable to create http.Request: %v", err)
+			return gostatsd.Permanent(fmt.Errorf("unable to create http.Request: %v", err))
 		}
 		for header, v := range headers {
 			req.Header.Set(header, v)
@@ -494,7 +506,11 @@ func (idb *Client) constructPost(ctx context.Context, buffer *bytes.Buffer) (fun
 				"status": resp.StatusCode,
 				"body":   string(b),
 			}).Info("request failed")
-			return fmt.Errorf("received bad status code %d", resp.StatusCode)
+			err := fmt.Errorf("received bad status code %d", resp.StatusCode)
+			if gostatsd.IsPermanentStatus(resp.StatusCode) {
+				return gostatsd.Permanent(err)
+			}
+			return err
 		}
 		_, _ = io.Copy(ioutil.Discard, body)
 		return nil
@@ -86,7 +86,7 @@ func TestRetries(t *testing.T) {
 		assert.NotEmpty(t, data)
 		if n == 1 {
 			// Return error on first request to trigger a retry
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
 	})
 	ts := httptest.NewServer(mux)
@@ -108,6 +108,7 @@ func TestRetries(t *testing.T) {
 			org:    "org",
 		},
 		gostatsd.TimerSubtypes{},
+		gostatsd.CounterModeBoth,
 		logrus.New(),
 		p,
 	)
@@ -161,6 +162,7 @@ func TestSendMetricsInMultipleBatches(t *testing.T) {
 			consistency:     "consistency",
 		},
 		gostatsd.TimerSubtypes{},
+		gostatsd.CounterModeBoth,
 		logrus.New(),
 		p,
 	)
@@ -228,6 +230,7 @@ func TestSendMetrics(t *testing.T) {
 			consistency:     "consistency",
 		},
 		gostatsd.TimerSubtypes{},
+		gostatsd.CounterModeBoth,
 		logrus.New(),
 		p,
 	)
@@ -366,6 +369,7 @@ func TestSendHistogram(t *testing.T) {
 			consistency:     "consistency",
 		},
 		gostatsd.TimerSubtypes{},
+		gostatsd.CounterModeBoth,
 		logrus.New(),
 		p,
 	)
@@ -465,6 +469,7 @@ func TestSendEvent(t *testing.T) {
 			consistency:     "consistency",
 		},
 		gostatsd.TimerSubtypes{},
+		gostatsd.CounterModeBoth,
 		logrus.New(),
 		p,
 	)
@@ -26,16 +26,23 @@ type timeSeries struct {
 func (f *flush) addMetric(n *Client, metricType string, value float64, persecond float64, tags gostatsd.Tags, name string) {
 	if n.flushType == flushTypeMetrics {
 		metricName := name
-		if metricType == "counter" {
+		if metricType == "counter" && n.counterMode.Rate() {
 			perSecondMetric := newDimensionalMetricSet(n, f, metricName+".per_second", "gauge", persecond, tags)
 			f.ts.Metrics = append(f.ts.Metrics, perSecondMetric)
 		}
-		standardMetric := newDimensionalMetricSet(n, f, name, metricType, value, tags)
-		f.ts.Metrics = append(f.ts.Metrics, standardMetric)
+		if metricType != "counter" || n.counterMode.Count() {
+			standardMetric := newDimensionalMetricSet(n, f, name, metricType, value, tags)
+			f.ts.Metrics = append(f.ts.Metrics, standardMetric)
+		}
 	} else {
 		standardMetric := newMetricSet(n, f, name, metricType, value, tags)
 		if metricType == "counter" {
-			standardMetric[n.metricPerSecond] = persecond
+			if n.counterMode.Rate() {
+				standardMetric[n.metricPerSecond] = persecond
+			}
+			if !n.counterMode.Count() {
+				delete(standardMetric, n.metricValue)
+			}
 		}
 		f.ts.Metrics = append(f.ts.Metrics, standardMetric)
 	}
@@ -81,6 +81,7 @@ type Client struct {
 	batchesDropped uint64            // Accumulated number of batches aborted (data loss)
 	batchesSent    uint64            // Accumulated number of batches successfully sent
 	seriesSent     uint64            // Accumulated number of series successfully sent
+	bytesSent      uint64            // Accumulated number of payload bytes successfully sent
 	batchesRetried stats.ChangeGauge // Accumulated number of batches retried (first send is not a retry)
 
 	userAgent             string
@@ -90,6 +91,7 @@ type Client struct {
 	metricsBufferSem      chan *bytes.Buffer // Two in one - a semaphore and a buffer pool
 
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 	flushInterval    time.Duration
 }
 
@@ -194,6 +196,7 @@ func (n *Client) Run(ctx context.Context) {
 			statser.Gauge("backend.dropped", float64(atomic.LoadUint64(&n.batchesDropped)), nil)
 			statser.Gauge("backend.sent", float64(atomic.LoadUint64(&n.batchesSent)), nil)
 			statser.Gauge("backend.series.sent", float64(atomic.LoadUint64(&n.seriesSent)), nil)
+			statser.Gauge("backend.payload_bytes", float64(atomic.LoadUint64(&n.bytesSent)), nil)
 		}
 	}
 }
@@ -215,12 +218,12 @@ func (n *Client) processMetrics(now float64, metrics *gostatsd.MetricMap, cb fun
 	})
 
 	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-		fl.addMetric(n, "counter", float64(counter.Value), counter.PerSecond, counter.Tags, key)
+		fl.addMetric(n, "counter", counter.Total(), counter.PerSecond, counter.Tags, key)
 		fl.maybeFlush()
 	})
 
 	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
-		fl.addMetric(n, "set", float64(len(set.Values)), 0, set.Tags, key)
+		fl.addMetric(n, "set", float64(set.Count()), 0, set.Tags, key)
 		fl.maybeFlush()
 	})
 
@@ -314,9 +317,9 @@ func (n *Client) post(ctx context.Context, buffer *bytes.Buffer, data interface{
 		}
 
 		next := b.NextBackOff()
-		if next == backoff.Stop {
+		if next == backoff.Stop || gostatsd.IsPermanent(err) {
 			atomic.AddUint64(&n.batchesDropped, 1)
-			return fmt.Errorf("[%s] %v", BackendName, err)
+			return fmt.Errorf("[%s] %w", BackendName, err)
 		}
 
 		n.logger.WithFields(logrus.Fields{
@@ -352,7 +355,7 @@ func (n *Client) constructPost(ctx context.Context, buffer *bytes.Buffer, data i
 	}
 
 	if mErr != nil {
-		return nil, fmt.Errorf("[%s] unable to marshal: %v", BackendName, mErr)
+		return nil, gostatsd.Permanent(fmt.Errorf("[%s] unable to marshal: %v", BackendName, mErr))
 	}
 
 	return n.postWrapper(ctx, mJSON, "metrics")
@@ -397,7 +400,7 @@ func (n *Client) postWrapper(ctx context.Context, json []byte, dataType string)
 
 		req, err := http.NewRequest("POST", address, bytes.NewBuffer(json))
 		if err != nil {
-			return fmt.Errorf("unable to create http.Request: %v", err)
+			return gostatsd.Permanent(fmt.Errorf("unable to create http.Request: %v", err))
 		}
 		req = req.WithContext(ctx)
 		for header, v := range headers {
@@ -415,9 +418,14 @@ func (n *Client) postWrapper(ctx context.Context, json []byte, dataType string)
 				"status": resp.StatusCode,
 				"body":   string(b),
 			}).Info("request failed")
-			return fmt.Errorf("received bad status code %d", resp.StatusCode)
+			err := fmt.Errorf("received bad status code %d", resp.StatusCode)
+			if gostatsd.IsPermanentStatus(resp.StatusCode) {
+				return gostatsd.Permanent(err)
+			}
+			return err
 		}
 		_, _ = io.Copy(ioutil.Discard, body)
+		atomic.AddUint64(&n.bytesSent, uint64(len(json)))
 		return nil
 	}, nil
 
@@ -464,6 +472,10 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 	if v.GetString("statser-type") == "null" {
 		logger.Info("internal metrics OFF, to enable set 'statser-type' to 'logging' or 'internal'")
 	}
+	counterMode, err := gostatsd.CounterModeFromViper(nr, gostatsd.ParamCounterMode)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 
 	return NewClient(
 		nr.GetString("transport"),
@@ -491,6 +503,7 @@ func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transpo
 		nr.GetDuration("max-request-elapsed-time"),
 		v.GetDuration("flush-interval"), // Main viper, not sub-viper
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 		logger,
 		pool,
 	)
@@ -502,7 +515,7 @@ func NewClient(transport, address, addressMetrics, eventType, flushType, apiKey,
 	timerMin, timerMax, timerCount, timerMean, timerMedian, timerStdDev, timerSum, timerSumSquares,
 	userAgent string, metricsPerBatch int, maxRequests uint,
 	maxRequestElapsedTime, flushInterval time.Duration,
-	disabled gostatsd.TimerSubtypes, logger logrus.FieldLogger, pool *transport.TransportPool) (*Client, error) {
+	disabled gostatsd.TimerSubtypes, counterMode gostatsd.CounterMode, logger logrus.FieldLogger, pool *transport.TransportPool) (*Client, error) {
 
 	if metricsPerBatch <= 0 {
 		return nil, fmt.Errorf("[%s] metricsPerBatch must be positive", BackendName)
@@ -568,6 +581,7 @@ func NewClient(transport, address, addressMetrics, eventType, flushType, apiKey,
 		metricsBufferSem:      metricsBufferSem,
 		flushInterval:         flushInterval,
 		disabledSubtypes:      disabled,
+		counterMode:           counterMode,
 	}, nil
 }
 
@@ -0,0 +1,466 @@
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
+	"github.com/atlassian/gostatsd/pkg/stats"
+	"github.com/atlassian/gostatsd/pkg/transport"
+)
+
+const (
+	// BackendName is the name of this backend.
+	BackendName = "pushgateway"
+	// DefaultAddress is the default address of the Pushgateway.
+	DefaultAddress = "http://localhost:9091"
+	// DefaultJob is the default job the metrics are pushed as.
+	DefaultJob       = "gostatsd"
+	defaultUserAgent = "gostatsd"
+	// defaultMaxRequests is the default number of parallel pushes to the Pushgateway.
+	defaultMaxRequests = 10
+	// maxResponseSize is the maximum response size we are willing to read.
+	maxResponseSize = 1024
+	// instanceLabel is the grouping label the source of the metrics is pushed with.
+	instanceLabel = "instance"
+	contentType   = "text/plain; version=0.0.4"
+)
+
+// Client pushes metrics to a Prometheus Pushgateway, in the text exposition format.
+//
+// Metrics are pushed with POST to the group of the job and grouping key, so each push only replaces the metrics with
+// the same names in the group.  The metrics of each source are pushed to their own group, with the source as the
+// instance label, as the metrics of a flush are sent by several aggregators which each have only some of the sources
+// of a metric name.  Every metric is sent as a gauge, without a timestamp, which the Pushgateway rejects.
+type Client struct {
+	batchesSent     uint64 // Accumulated number of pushes which succeeded
+	batchesDropped  uint64 // Accumulated number of pushes which failed (data loss)
+	seriesSent      uint64 // Accumulated number of series successfully pushed
+	seriesDuplicate uint64 // Accumulated number of series not pushed as another metric has the same name and labels
+
+	logger      logrus.FieldLogger
+	address     string
+	job         string
+	groupingKey map[string]string
+	userAgent   string
+	client      *http.Client
+	requestSem  chan struct{}
+
+	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
+}
+
+// group is the metrics of a single source, in the text exposition format.
+type group struct {
+	families map[string]*bytes.Buffer // The samples of each metric name
+	seen     map[string]struct{}      // The name and labels of each sample, to skip duplicates
+	series   int
+}
+
+// Run emits internal metrics about the pushes until the context is closed.
+func (c *Client) Run(ctx context.Context) {
+	statser := stats.FromContext(ctx).WithTags(gostatsd.Tags{"backend:" + BackendName})
+
+	flushed, unregister := statser.RegisterFlush()
+	defer unregister()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushed:
+			statser.Gauge("backend.dropped", float64(atomic.LoadUint64(&c.batchesDropped)), nil)
+			statser.Gauge("backend.sent", float64(atomic.LoadUint64(&c.batchesSent)), nil)
+			statser.Gauge("backend.series.sent", float64(atomic.LoadUint64(&c.seriesSent)), nil)
+			statser.Gauge("backend.series.duplicate", float64(atomic.LoadUint64(&c.seriesDuplicate)), nil)
+		}
+	}
+}
+
+// SendMetricsAsync pushes the metrics to the Pushgateway, preparing the payload synchronously but doing the pushes
+// asynchronously.  An empty MetricMap is not pushed, as pushing an empty group with PUT deletes it, and with POST
+// changes nothing.
+func (c *Client) SendMetricsAsync(ctx context.Context, metrics *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	groups := c.processMetrics(metrics)
+	if len(groups) == 0 {
+		cb(nil)
+		return
+	}
+
+	results := make(chan error, len(groups))
+	for source, g := range groups {
+		source, g := source, g
+		go func() {
+			select {
+			case <-ctx.Done():
+				results <- ctx.Err()
+			case c.requestSem <- struct{}{}:
+				results <- c.push(ctx, source, g)
+				<-c.requestSem
+			}
+		}()
+	}
+	go func() {
+		errs := make([]error, 0, len(groups))
+		for range groups {
+			errs = append(errs, <-results)
+		}
+		cb(errs)
+	}()
+}
+
+// processMetrics converts the metrics to the Prometheus conventions, grouped by source.  The Pushgateway rejects a
+// push with two samples of the same name and labels, such as the count of a counter and of a timer with the same
+// name, so only the first is kept, in the order counters, timers, gauges, then sets.
+func (c *Client) processMetrics(metrics *gostatsd.MetricMap) map[gostatsd.Source]*group {
+	groups := map[gostatsd.Source]*group{}
+	var series bytes.Buffer
+	add := func(name string, value float64, source gostatsd.Source, tags gostatsd.Tags, labels ...string) {
+		g, ok := groups[source]
+		if !ok {
+			g = &group{families: map[string]*bytes.Buffer{}, seen: map[string]struct{}{}}
+			groups[source] = g
+		}
+		name = metricName(name)
+		series.Reset()
+		series.WriteString(name)
+		writeLabels(&series, tags, labels...)
+		if _, ok := g.seen[series.String()]; ok {
+			atomic.AddUint64(&c.seriesDuplicate, 1)
+			return
+		}
+		g.seen[series.String()] = struct{}{}
+		buf, ok := g.families[name]
+		if !ok {
+			buf = &bytes.Buffer{}
+			g.families[name] = buf
+		}
+		buf.Write(series.Bytes())
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		buf.WriteByte('\n')
+		g.series++
+	}
+
+	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+		if c.counterMode.Rate() {
+			add(key, counter.PerSecond, counter.Source, counter.Tags)
+		}
+		if c.counterMode.Count() {
+			add(key+".count", counter.Total(), counter.Source, counter.Tags)
+		}
+	})
+	metrics.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		if timer.Histogram != nil {
+			for histogramThreshold, count := range timer.Histogram {
+				le := "+Inf"
+				if !math.IsInf(float64(histogramThreshold), 1) {
+					le = strconv.FormatFloat(float64(histogramThreshold), 'f', -1, 64)
+				}
+				add(key+".histogram", float64(count), timer.Source, timer.Tags, "le", le)
+			}
+			return
+		}
+		if !c.disabledSubtypes.Lower {
+			add(key+".lower", timer.Min, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.Upper {
+			add(key+".upper", timer.Max, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.Count {
+			add(key+".count", float64(timer.Count), timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.CountPerSecond {
+			add(key+".count_ps", timer.PerSecond, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.Mean {
+			add(key+".mean", timer.Mean, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.Median {
+			add(key+".median", timer.Median, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.StdDev {
+			add(key+".std", timer.StdDev, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.Sum {
+			add(key+".sum", timer.Sum, timer.Source, timer.Tags)
+		}
+		if !c.disabledSubtypes.SumSquares {
+			add(key+".sum_squares", timer.SumSquares, timer.Source, timer.Tags)
+		}
+		for _, pct := range timer.Percentiles {
+			add(key+"."+pct.Str, pct.Float, timer.Source, timer.Tags)
+		}
+	})
+	metrics.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		add(key, gauge.Value, gauge.Source, gauge.Tags)
+	})
+	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
+		add(key, float64(set.Count()), set.Source, set.Tags)
+	})
+	return groups
+}
+
+// payload returns the metrics of the group in the text exposition format, with the samples of each name together.
+func (g *group) payload() []byte {
+	names := make([]string, 0, len(g.families))
+	for name := range g.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString("# TYPE ")
+		buf.WriteString(name)
+		buf.WriteString(" gauge\n")
+		buf.Write(g.families[name].Bytes())
+	}
+	return buf.Bytes()
+}
+
+// push pushes the group of the source, returning an error if the Pushgateway doesn't accept it.
+func (c *Client) push(ctx context.Context, source gostatsd.Source, g *group) error {
+	req, err := http.NewRequest("POST", c.groupURL(source), bytes.NewReader(g.payload()))
+	if err != nil {
+		atomic.AddUint64(&c.batchesDropped, 1)
+		return gostatsd.Permanent(fmt.Errorf("[%s] unable to create http.Request: %v", BackendName, err))
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		atomic.AddUint64(&c.batchesDropped, 1)
+		return fmt.Errorf("[%s] error pushing: %v", BackendName, err)
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, maxResponseSize)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		b, _ := ioutil.ReadAll(body)
+		c.logger.WithFields(logrus.Fields{
+			"status": resp.StatusCode,
+			"body":   string(b),
+		}).Info("push failed")
+		atomic.AddUint64(&c.batchesDropped, 1)
+		err := fmt.Errorf("[%s] received bad status code %d", BackendName, resp.StatusCode)
+		if gostatsd.IsPermanentStatus(resp.StatusCode) {
+			return gostatsd.Permanent(err)
+		}
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, body)
+	atomic.AddUint64(&c.batchesSent, 1)
+	atomic.AddUint64(&c.seriesSent, uint64(g.series))
+	return nil
+}
+
+// groupURL returns the URL of the group for the job, grouping key, and source.
+func (c *Client) groupURL(source gostatsd.Source) string {
+	groupingKey := c.groupingKey
+	if source != "" {
+		groupingKey = make(map[string]string, len(c.groupingKey)+1)
+		for name, value := range c.groupingKey {
+			groupingKey[name] = value
+		}
+		groupingKey[instanceLabel] = string(source)
+	}
+	names := make([]string, 0, len(groupingKey))
+	for name := range groupingKey {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(c.address, "/"))
+	sb.WriteString("/metrics/")
+	sb.WriteString(pathLabel("job", c.job))
+	for _, name := range names {
+		sb.WriteByte('/')
+		sb.WriteString(pathLabel(name, groupingKey[name]))
+	}
+	return sb.String()
+}
+
+// pathLabel formats a label of the grouping key as URL path segments.  Values which can't be a path segment are base64
+// encoded, as the Pushgateway supports.
+func pathLabel(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+		if encoded == "" {
+			encoded = "=" // An empty value must still be a path segment
+		}
+		return name + "@base64/" + encoded
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// writeLabels writes the tags, and any extra label name and value pairs, as Prometheus labels.  A tag of key:value is
+// the label key="value", and a tag without a value is the label unnamed="tag", as in the graphite backend.  If a
+// label name is repeated the last value is used.
+func writeLabels(buf *bytes.Buffer, tags gostatsd.Tags, extra ...string) {
+	if len(tags) == 0 && len(extra) == 0 {
+		return
+	}
+	labels := make(map[string]string, len(tags)+len(extra)/2)
+	for _, tag := range tags {
+		if idx := strings.IndexByte(tag, ':'); idx != -1 {
+			labels[labelName(tag[:idx])] = tag[idx+1:]
+		} else {
+			labels["unnamed"] = tag
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(name)
+		buf.WriteString(`="`)
+		buf.WriteString(labelValueEscaper.Replace(labels[name]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName converts a statsd name to a valid Prometheus metric name, replacing any invalid characters, such as the
+// dots between the parts of the name, with underscores.
+func metricName(s string) string {
+	return sanitize(s, true)
+}
+
+// labelName converts a tag key to a valid Prometheus label name, replacing any invalid characters with underscores.
+func labelName(s string) string {
+	return sanitize(s, false)
+}
+
+func sanitize(s string, allowColon bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		valid := c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			(allowColon && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || ('0' <= b[0] && b[0] <= '9') {
+		return "_" + string(b) // Names can't be empty or start with a digit
+	}
+	return string(b)
+}
+
+// SendEvent discards events, the Pushgateway only accepts metrics.
+func (c *Client) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	return nil
+}
+
+// Name returns the name of the backend.
+func (c *Client) Name() string {
+	return BackendName
+}
+
+// NewClientFromViper constructs a Pushgateway client from the [pushgateway] configuration.
+func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transport.TransportPool) (gostatsd.Backend, error) {
+	p := util.GetSubViper(v, "pushgateway")
+	p.SetDefault("address", DefaultAddress)
+	p.SetDefault("job", DefaultJob)
+	p.SetDefault("grouping-key", map[string]string{})
+	p.SetDefault("max-requests", defaultMaxRequests)
+	p.SetDefault("user-agent", defaultUserAgent)
+	p.SetDefault("transport", "default")
+	counterMode, err := gostatsd.CounterModeFromViper(p, gostatsd.ParamCounterMode)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
+
+	return NewClient(
+		p.GetString("address"),
+		p.GetString("job"),
+		p.GetStringMapString("grouping-key"),
+		p.GetString("user-agent"),
+		p.GetString("transport"),
+		p.GetUint("max-requests"),
+		gostatsd.DisabledSubMetrics(v),
+		counterMode,
+		logger,
+		pool,
+	)
+}
+
+// NewClient constructs a new Pushgateway client.
+func NewClient(
+	address,
+	job string,
+	groupingKey map[string]string,
+	userAgent,
+	transport string,
+	maxRequests uint,
+	disabled gostatsd.TimerSubtypes,
+	counterMode gostatsd.CounterMode,
+	logger logrus.FieldLogger,
+	pool *transport.TransportPool,
+) (*Client, error) {
+	if address == "" {
+		return nil, fmt.Errorf("[%s] address is required", BackendName)
+	}
+	if job == "" {
+		return nil, fmt.Errorf("[%s] job is required", BackendName)
+	}
+	if maxRequests == 0 {
+		return nil, fmt.Errorf("[%s] max-requests must be positive", BackendName)
+	}
+	for name := range groupingKey {
+		if name != labelName(name) || name == "job" || name == instanceLabel {
+			return nil, fmt.Errorf("[%s] grouping-key label %q is not allowed", BackendName, name)
+		}
+	}
+
+	httpClient, err := pool.Get(transport)
+	if err != nil {
+		logger.WithError(err).Error("failed to create http client")
+		return nil, err
+	}
+	logger.WithFields(logrus.Fields{
+		"address":      address,
+		"job":          job,
+		"grouping-key": groupingKey,
+		"max-requests": maxRequests,
+	}).Info("created backend")
+
+	return &Client{
+		logger:           logger,
+		address:          address,
+		job:              job,
+		groupingKey:      groupingKey,
+		userAgent:        userAgent,
+		client:           httpClient.Client,
+		requestSem:       make(chan struct{}, maxRequests),
+		disabledSubtypes: disabled,
+		counterMode:      counterMode,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package pushgateway
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/transport"
+)
+
+func newTestClient(t *testing.T, address string, groupingKey map[string]string) *Client {
+	p := transport.NewTransportPool(logrus.New(), viper.New())
+	c, err := NewClient(address, "job", groupingKey, defaultUserAgent, "default", defaultMaxRequests, gostatsd.TimerSubtypes{StdDev: true}, gostatsd.CounterModeBoth, logrus.New(), p)
+	require.NoError(t, err)
+	return c
+}
+
+func sendAndWait(t *testing.T, c *Client, mm *gostatsd.MetricMap) []error {
+	result := make(chan []error, 1)
+	c.SendMetricsAsync(context.Background(), mm, func(errs []error) {
+		result <- errs
+	})
+	return <-result
+}
+
+func TestSendMetrics(t *testing.T) {
+	t.Parallel()
+	var lock sync.Mutex
+	pushes := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, contentType, r.Header.Get("Content-Type"))
+		lock.Lock()
+		pushes[r.URL.EscapedPath()] = string(data)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	mm := gostatsd.NewMetricMap()
+	mm.Counters["c.1"] = map[string]gostatsd.Counter{
+		"env:prod,s:host1": {Value: 5, PerSecond: 0.5, Tags: gostatsd.Tags{"env:prod"}, Source: "host1"},
+	}
+	mm.Gauges["g"] = map[string]gostatsd.Gauge{
+		"":          {Value: 1.5},
+		"bad-key:a": {Value: math.Inf(1), Tags: gostatsd.Tags{"bad-key:a\"b", "flag"}},
+	}
+	mm.Sets["s"] = map[string]gostatsd.Set{
+		"s:host1": {Values: map[string]struct{}{"a": {}, "b": {}}, Source: "host1"},
+	}
+	mm.Timers["t"] = map[string]gostatsd.Timer{
+		"": {Count: 2, PerSecond: 0.2, Min: 1, Max: 3, Mean: 2, Median: 2, Sum: 4, SumSquares: 10,
+			Percentiles: gostatsd.Percentiles{{Float: 3, Str: "upper_90"}}},
+	}
+	mm.Timers["h"] = map[string]gostatsd.Timer{
+		"": {Histogram: map[gostatsd.HistogramThreshold]int{10: 1, gostatsd.HistogramThreshold(math.Inf(1)): 2}},
+	}
+
+	c := newTestClient(t, ts.URL, map[string]string{"region": "us/east"})
+	require.Equal(t, []error{nil, nil}, sendAndWait(t, c, mm))
+
+	lines := func(body string) []string {
+		l := strings.Split(strings.TrimSpace(body), "\n")
+		sort.Strings(l)
+		return l
+	}
+	assert.Equal(t, []string{
+		"# TYPE c_1 gauge",
+		"# TYPE c_1_count gauge",
+		"# TYPE s gauge",
+		`c_1_count{env="prod"} 5`,
+		`c_1{env="prod"} 0.5`,
+		"s 2",
+	}, lines(pushes["/metrics/job/job/instance/host1/region@base64/dXMvZWFzdA"]))
+	assert.Equal(t, []string{
+		"# TYPE g gauge",
+		"# TYPE h_histogram gauge",
+		"# TYPE t_count gauge",
+		"# TYPE t_count_ps gauge",
+		"# TYPE t_lower gauge",
+		"# TYPE t_mean gauge",
+		"# TYPE t_median gauge",
+		"# TYPE t_sum gauge",
+		"# TYPE t_sum_squares gauge",
+		"# TYPE t_upper gauge",
+		"# TYPE t_upper_90 gauge",
+		"g 1.5",
+		`g{bad_key="a\"b",unnamed="flag"} +Inf`,
+		`h_histogram{le="+Inf"} 2`,
+		`h_histogram{le="10"} 1`,
+		"t_count 2",
+		"t_count_ps 0.2",
+		"t_lower 1",
+		"t_mean 2",
+		"t_median 2",
+		"t_sum 4",
+		"t_sum_squares 10",
+		"t_upper 3",
+		"t_upper_90 3",
+	}, lines(pushes["/metrics/job/job/region@base64/dXMvZWFzdA"]))
+	assert.Len(t, pushes, 2)
+	assert.EqualValues(t, 2, c.batchesSent)
+	assert.EqualValues(t, 16, c.seriesSent)
+}
+
+func TestSendMetricsDuplicateNames(t *testing.T) {
+	t.Parallel()
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		data, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = string(data)
+	}))
+	defer ts.Close()
+
+	mm := gostatsd.NewMetricMap()
+	mm.Counters["foo"] = map[string]gostatsd.Counter{"": {Value: 5, PerSecond: 0.5}}
+	mm.Timers["foo"] = map[string]gostatsd.Timer{"": {Count: 2, PerSecond: 0.2, Min: 1, Max: 3}}
+	mm.Gauges["foo"] = map[string]gostatsd.Gauge{"": {Value: 1.5}}
+
+	c := newTestClient(t, ts.URL, nil)
+	c.disabledSubtypes = gostatsd.TimerSubtypes{Mean: true, Median: true, StdDev: true, Sum: true, SumSquares: true}
+	require.Equal(t, []error{nil}, sendAndWait(t, c, mm))
+
+	// The counter is kept, as the Pushgateway rejects a push with the same series twice
+	assert.Equal(t, "# TYPE foo gauge\nfoo 0.5\n"+
+		"# TYPE foo_count gauge\nfoo_count 5\n"+
+		"# TYPE foo_count_ps gauge\nfoo_count_ps 0.2\n"+
+		"# TYPE foo_lower gauge\nfoo_lower 1\n"+
+		"# TYPE foo_upper gauge\nfoo_upper 3\n", body)
+	assert.EqualValues(t, 2, c.seriesDuplicate)
+	assert.EqualValues(t, 5, c.seriesSent)
+}
+
+func TestSendMetricsError(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	mm := gostatsd.NewMetricMap()
+	mm.Gauges["g"] = map[string]gostatsd.Gauge{"": {Value: 1}}
+	c := newTestClient(t, ts.URL, nil)
+	errs := sendAndWait(t, c, mm)
+	require.Len(t, errs, 1)
+	assert.True(t, gostatsd.IsPermanent(errs[0]))
+	assert.EqualValues(t, 1, c.batchesDropped)
+}
+
+func TestSendMetricsEmpty(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Fail(t, "empty metrics should not be pushed")
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, nil)
+	assert.Empty(t, sendAndWait(t, c, gostatsd.NewMetricMap()))
+}
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "a_b_c:d", metricName("a.b-c:d"))
+	assert.Equal(t, "_9lives", metricName("9lives"))
+	assert.Equal(t, "a_b", labelName("a:b"))
+	assert.Equal(t, "_", labelName(""))
+	assert.Equal(t, "job/a%20b", pathLabel("job", "a b"))
+	assert.Equal(t, "instance@base64/=", pathLabel("instance", ""))
+}
+
+func TestNewClientInvalidGroupingKey(t *testing.T) {
+	t.Parallel()
+	p := transport.NewTransportPool(logrus.New(), viper.New())
+	for _, name := range []string{"job", "instance", "bad-name"} {
+		_, err := NewClient(DefaultAddress, DefaultJob, map[string]string{name: "a"}, defaultUserAgent, "default", defaultMaxRequests, gostatsd.TimerSubtypes{}, gostatsd.CounterModeBoth, logrus.New(), p)
+		assert.Error(t, err, name)
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/internal/util"
+	"github.com/atlassian/gostatsd/pkg/backends/dogstatsd"
 	"github.com/atlassian/gostatsd/pkg/backends/sender"
 	"github.com/atlassian/gostatsd/pkg/transport"
 )
@@ -111,12 +112,13 @@ func (client *Client) processMetrics(metrics *gostatsd.MetricMap, handler overfl
 	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
 		// do not send statsd stats as they will be recalculated on the master instead
 		if !strings.HasPrefix(key, "statsd.") {
-			writeLine("%s:%d|c", key, tagsKey, counter.Value)
+			writeLine("%s:%s|c", key, tagsKey, counter.FormatValue())
 		}
 	})
 	metrics.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		format := timerFormat(timer)
 		for _, tr := range timer.Values {
-			writeLine("%s:%f|ms", key, tagsKey, tr)
+			writeLine(format, key, tagsKey, tr)
 		}
 	})
 	metrics.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
@@ -135,6 +137,17 @@ func (client *Client) processMetrics(metrics *gostatsd.MetricMap, handler overfl
 	}
 }
 
+// timerFormat returns the format for the values of a timer.  If the timer was sampled, the sample rate is included
+// so the receiving server calculates the same count.  The rate compensates for the SampledCount being extrapolated
+// from the values when they were received.
+func timerFormat(timer gostatsd.Timer) string {
+	if timer.SampledCount <= 0 || float64(len(timer.Values)) == timer.SampledCount {
+		return "%s:%f|ms"
+	}
+	rate := float64(len(timer.Values)) / timer.SampledCount
+	return "%s:%f|ms|@" + strconv.FormatFloat(rate, 'g', -1, 64)
+}
+
 // SendEvent sends events to the statsd master server.
 func (client *Client) SendEvent(ctx context.Context, e *gostatsd.Event) error {
 	conn, err := client.sender.ConnFactory()
@@ -143,59 +156,11 @@ func (client *Client) SendEvent(ctx context.Context, e *gostatsd.Event) error {
 	}
 	defer conn.Close()
 
-	_, err = conn.Write(constructEventMessage(e).Bytes())
+	_, err = conn.Write(dogstatsd.EventMessage(e).Bytes())
 
 	return err
 }
 
-func constructEventMessage(e *gostatsd.Event) *bytes.Buffer {
-	text := strings.Replace(e.Text, "\n", "\\n", -1)
-
-	var buf bytes.Buffer
-	buf.WriteString("_e{")
-	buf.WriteString(strconv.Itoa(len(e.Title)))
-	buf.WriteByte(',')
-	buf.WriteString(strconv.Itoa(len(text)))
-	buf.WriteString("}:")
-	buf.WriteString(e.Title)
-	buf.WriteByte('|')
-	buf.WriteString(text)
-
-	if e.DateHappened != 0 {
-		buf.WriteString("|d:")
-		buf.WriteString(strconv.FormatInt(e.DateHappened, 10))
-	}
-	if e.Source != "" {
-		buf.WriteString("|h:")
-		buf.WriteString(string(e.Source))
-	}
-	if e.AggregationKey != "" {
-		buf.WriteString("|k:")
-		buf.WriteString(e.AggregationKey)
-	}
-	if e.SourceTypeName != "" {
-		buf.WriteString("|s:")
-		buf.WriteString(e.SourceTypeName)
-	}
-	if e.Priority != gostatsd.PriNormal {
-		buf.WriteString("|p:")
-		buf.WriteString(e.Priority.String())
-	}
-	if e.AlertType != gostatsd.AlertInfo {
-		buf.WriteString("|t:")
-		buf.WriteString(e.AlertType.String())
-	}
-	if len(e.Tags) > 0 {
-		buf.WriteString("|#")
-		buf.WriteString(e.Tags[0])
-		for _, tag := range e.Tags[1:] {
-			buf.WriteByte(',')
-			buf.WriteString(tag)
-		}
-	}
-	return &buf
-}
-
 // NewClient constructs a new statsd backend client.
 func NewClient(address string, dialTimeout, writeTimeout time.Duration, disableTags, tcpTransport bool, tlsConfig *tls.Config, logger logrus.FieldLogger) (*Client, error) {
 	if address == "" {
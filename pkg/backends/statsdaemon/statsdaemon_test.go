@@ -87,3 +87,27 @@ func TestProcessMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessMetricsSampledTimers(t *testing.T) {
+	t.Parallel()
+	input := gostatsd.MetricMap{
+		Timers: gostatsd.Timers{
+			"t": map[string]gostatsd.Timer{
+				"":     {Values: []float64{1, 2}, SampledCount: 2},
+				"tag1": {Values: []float64{3}, SampledCount: 10},
+			},
+		},
+	}
+	c, err := NewClient("localhost:8125", 1*time.Second, 1*time.Second, false, false, nil, logrus.New())
+	require.NoError(t, err)
+	var lines []string
+	c.processMetrics(&input, func(buf *bytes.Buffer) (*bytes.Buffer, bool) {
+		lines = append(lines, strings.Split(strings.TrimSpace(buf.String()), "\n")...)
+		return new(bytes.Buffer), false
+	})
+	assert.ElementsMatch(t, []string{
+		"t:1.000000|ms",
+		"t:2.000000|ms",
+		"t:3.000000|ms|@0.1|#tag1",
+	}, lines)
+}
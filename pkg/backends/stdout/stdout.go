@@ -13,6 +13,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
 	"github.com/atlassian/gostatsd/pkg/transport"
 )
 
@@ -22,19 +23,26 @@ const BackendName = "stdout"
 // Client is an object that is used to send messages to stdout.
 type Client struct {
 	disabledSubtypes gostatsd.TimerSubtypes
+	counterMode      gostatsd.CounterMode
 }
 
 // NewClientFromViper constructs a stdout backend.
 func NewClientFromViper(v *viper.Viper, logger logrus.FieldLogger, pool *transport.TransportPool) (gostatsd.Backend, error) {
+	counterMode, err := gostatsd.CounterModeFromViper(util.GetSubViper(v, "stdout"), gostatsd.ParamCounterMode)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", BackendName, err)
+	}
 	return NewClient(
 		gostatsd.DisabledSubMetrics(v),
+		counterMode,
 	)
 }
 
 // NewClient constructs a stdout backend.
-func NewClient(disabled gostatsd.TimerSubtypes) (*Client, error) {
+func NewClient(disabled gostatsd.TimerSubtypes, counterMode gostatsd.CounterMode) (*Client, error) {
 	return &Client{
 		disabledSubtypes: disabled,
+		counterMode:      counterMode,
 	}, nil
 }
 
@@ -56,7 +64,7 @@ func tagToMetricName(tag string) string {
 
 // SendMetricsAsync prints the metrics in a MetricsMap to the stdout, preparing payload synchronously but doing the send asynchronously.
 func (client Client) SendMetricsAsync(ctx context.Context, metrics *gostatsd.MetricMap, cb gostatsd.SendCallback) {
-	buf := preparePayload(metrics, &client.disabledSubtypes)
+	buf := preparePayload(metrics, &client.disabledSubtypes, client.counterMode)
 	go func() {
 		cb([]error{writePayload(buf)})
 	}()
@@ -73,13 +81,17 @@ func writePayload(buf *bytes.Buffer) (retErr error) {
 	return err
 }
 
-func preparePayload(metrics *gostatsd.MetricMap, disabled *gostatsd.TimerSubtypes) *bytes.Buffer {
+func preparePayload(metrics *gostatsd.MetricMap, disabled *gostatsd.TimerSubtypes, counterMode gostatsd.CounterMode) *bytes.Buffer {
 	buf := new(bytes.Buffer)
 	now := time.Now().Unix()
 	metrics.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
 		nk := composeMetricName(key, tagsKey)
-		fmt.Fprintf(buf, "stats.counter.%s.count %d %d\n", nk, counter.Value, now)          // #nosec
-		fmt.Fprintf(buf, "stats.counter.%s.per_second %f %d\n", nk, counter.PerSecond, now) // #nosec
+		if counterMode.Count() {
+			fmt.Fprintf(buf, "stats.counter.%s.count %s %d\n", nk, counter.FormatValue(), now) // #nosec
+		}
+		if counterMode.Rate() {
+			fmt.Fprintf(buf, "stats.counter.%s.per_second %f %d\n", nk, counter.PerSecond, now) // #nosec
+		}
 	})
 	metrics.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
 		nk := composeMetricName(key, tagsKey)
@@ -131,7 +143,7 @@ func preparePayload(metrics *gostatsd.MetricMap, disabled *gostatsd.TimerSubtype
 	})
 	metrics.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
 		nk := composeMetricName(key, tagsKey)
-		fmt.Fprintf(buf, "stats.set.%s %d %d\n", nk, len(set.Values), now) // #nosec
+		fmt.Fprintf(buf, "stats.set.%s %d %d\n", nk, set.Count(), now) // #nosec
 	})
 	return buf
 }
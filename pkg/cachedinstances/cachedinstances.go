@@ -2,6 +2,7 @@ package cachedinstances
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -19,6 +20,16 @@ var (
 	ErrUnknownProvider = errors.New("unknown cloud provider")
 )
 
+// Names returns the sorted names of all registered providers.
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Get creates an instance of the named provider.
 func Get(logger logrus.FieldLogger, name string, v *viper.Viper, version string) (gostatsd.CachedInstances, error) {
 	f, found := providers[name]
@@ -0,0 +1,42 @@
+package enrichers
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/enrichers/sourcetags"
+	"github.com/atlassian/gostatsd/pkg/enrichers/tagmap"
+)
+
+var (
+	// All registered enrichers.
+	enrichers = map[string]gostatsd.EnricherFactory{
+		sourcetags.EnricherName: sourcetags.NewEnricherFromViper,
+		tagmap.EnricherName:     tagmap.NewEnricherFromViper,
+	}
+
+	ErrUnknownEnricher = errors.New("unknown enricher")
+)
+
+// Names returns the sorted names of all registered enrichers.
+func Names() []string {
+	names := make([]string, 0, len(enrichers))
+	for name := range enrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get creates an instance of the named enricher.
+func Get(logger logrus.FieldLogger, name string, v *viper.Viper) (gostatsd.Enricher, error) {
+	f, found := enrichers[name]
+	if !found {
+		return nil, ErrUnknownEnricher
+	}
+	return f(v, logger.WithField("enricher", name))
+}
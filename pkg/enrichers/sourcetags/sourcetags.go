@@ -0,0 +1,214 @@
+package sourcetags
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
+)
+
+// EnricherName is the name of this enricher.
+const EnricherName = "sourcetags"
+
+const paramFile = "file"
+
+// Enricher adds tags to metrics based on their source IP, from a file mapping IPs and CIDRs to tags.  The file is
+// read again when the process receives SIGHUP.
+type Enricher struct {
+	logger logrus.FieldLogger
+	path   string
+	table  atomic.Value // *table
+}
+
+// table is the tags of each network in a file.  A lookup is at most one map lookup for each distinct prefix length.
+type table struct {
+	networks []prefixNetworks // Longest prefix first
+	maxTags  int
+}
+
+// prefixNetworks is the networks with the same address length and prefix length.
+type prefixNetworks struct {
+	mask net.IPMask
+	tags map[string]gostatsd.Tags // Network address as a string of bytes -> tags
+}
+
+// NewEnricherFromViper returns a new sourcetags enricher.
+func NewEnricherFromViper(v *viper.Viper, logger logrus.FieldLogger) (gostatsd.Enricher, error) {
+	st := util.GetSubViper(v, EnricherName)
+	return NewEnricher(st.GetString(paramFile), logger)
+}
+
+// NewEnricher returns a new sourcetags enricher which reads the file at path.  Each line of the file is an IP or a
+// CIDR, followed by whitespace and a comma separated list of tags.  Blank lines and lines starting with # are
+// ignored.  A source in more than one network gets the tags of the most specific one.
+func NewEnricher(path string, logger logrus.FieldLogger) (*Enricher, error) {
+	if path == "" {
+		return nil, errors.New("[" + EnricherName + "] " + paramFile + " is required")
+	}
+	e := &Enricher{
+		logger: logger,
+		path:   path,
+	}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Name returns the name of the enricher.
+func (e *Enricher) Name() string {
+	return EnricherName
+}
+
+// Enrich appends the tags of the most specific network containing the source, if there is one.
+func (e *Enricher) Enrich(name string, source gostatsd.Source, tags gostatsd.Tags) gostatsd.Tags {
+	ip := net.ParseIP(string(source))
+	if ip == nil {
+		return tags
+	}
+	return append(tags, e.table.Load().(*table).lookup(ip)...)
+}
+
+// EstimatedTags returns a guess of how many tags are likely to be added by the Enricher.
+func (e *Enricher) EstimatedTags() int {
+	return e.table.Load().(*table).maxTags
+}
+
+// Run reads the file again each time the process receives SIGHUP, until the context is cancelled.  If the file
+// can't be read the previous tags are kept.
+func (e *Enricher) Run(ctx context.Context) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c:
+			if err := e.reload(); err != nil {
+				e.logger.WithError(err).Error("Failed to reload source tags, keeping the previous tags")
+			} else {
+				e.logger.WithField("file", e.path).Info("Reloaded source tags")
+			}
+		}
+	}
+}
+
+// reload reads the file and replaces the table if it is valid.
+func (e *Enricher) reload() error {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return fmt.Errorf("[%s] %v", EnricherName, err)
+	}
+	defer f.Close()
+	t, err := readTable(f)
+	if err != nil {
+		return fmt.Errorf("[%s] %s: %v", EnricherName, e.path, err)
+	}
+	e.table.Store(t)
+	return nil
+}
+
+// readTable reads the networks and their tags.
+func readTable(r io.Reader) (*table, error) {
+	byMask := map[string]*prefixNetworks{}
+	t := &table{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected an IP or CIDR followed by tags", lineNumber)
+		}
+		network, err := parseNetwork(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		var tags gostatsd.Tags
+		for _, tag := range strings.Split(strings.Join(fields[1:], ""), ",") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			return nil, fmt.Errorf("line %d: no tags for %s", lineNumber, fields[0])
+		}
+
+		pn, ok := byMask[string(network.Mask)]
+		if !ok {
+			pn = &prefixNetworks{mask: network.Mask, tags: map[string]gostatsd.Tags{}}
+			byMask[string(network.Mask)] = pn
+		}
+		if _, ok := pn.tags[string(network.IP)]; ok {
+			return nil, fmt.Errorf("line %d: %s is listed more than once", lineNumber, fields[0])
+		}
+		pn.tags[string(network.IP)] = tags
+		if len(tags) > t.maxTags {
+			t.maxTags = len(tags)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, pn := range byMask {
+		t.networks = append(t.networks, *pn)
+	}
+	sort.Slice(t.networks, func(i, j int) bool {
+		ones1, _ := t.networks[i].mask.Size()
+		ones2, _ := t.networks[j].mask.Size()
+		return ones1 > ones2
+	})
+	return t, nil
+}
+
+// parseNetwork parses a CIDR, or an IP as a network with a single address.  IPv4 networks use 4 byte addresses.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.IndexByte(s, '/') < 0 {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// lookup returns the tags of the most specific network containing ip, or nil.
+func (t *table) lookup(ip net.IP) gostatsd.Tags {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, pn := range t.networks {
+		if len(pn.mask) != len(ip) {
+			continue
+		}
+		if tags, ok := pn.tags[string(ip.Mask(pn.mask))]; ok {
+			return tags
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package sourcetags
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+}
+
+func TestEnrich(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sources")
+	writeFile(t, path, `
+# Comments and blank lines are ignored
+10.0.0.0/8     dc:syd
+10.1.0.0/16    dc:syd, rack:1
+10.1.2.3       dc:syd,rack:1,host:db
+fd00::/8       dc:mel
+`)
+	e, err := NewEnricher(path, logrus.New())
+	require.NoError(t, err)
+
+	tests := map[gostatsd.Source]gostatsd.Tags{
+		"10.9.9.9":        {"a", "dc:syd"},
+		"10.1.9.9":        {"a", "dc:syd", "rack:1"},
+		"10.1.2.3":        {"a", "dc:syd", "rack:1", "host:db"},
+		"::ffff:10.1.2.3": {"a", "dc:syd", "rack:1", "host:db"},
+		"fd00::1":         {"a", "dc:mel"},
+		"192.168.0.1":     {"a"},
+		"host.example":    {"a"},
+		"":                {"a"},
+	}
+	for source, expected := range tests {
+		assert.Equal(t, expected, e.Enrich("m", source, gostatsd.Tags{"a"}), source)
+	}
+	assert.Equal(t, 3, e.EstimatedTags())
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sources")
+	writeFile(t, path, "10.0.0.1 env:old\n")
+	e, err := NewEnricher(path, logrus.New())
+	require.NoError(t, err)
+
+	writeFile(t, path, "10.0.0.1 env:new\n")
+	require.NoError(t, e.reload())
+	assert.Equal(t, gostatsd.Tags{"env:new"}, e.Enrich("m", "10.0.0.1", nil))
+
+	// An invalid file keeps the previous tags
+	writeFile(t, path, "10.0.0.1\n")
+	require.Error(t, e.reload())
+	assert.Equal(t, gostatsd.Tags{"env:new"}, e.Enrich("m", "10.0.0.1", nil))
+}
+
+func TestInvalidFiles(t *testing.T) {
+	t.Parallel()
+	for _, data := range []string{
+		"10.0.0.1\n",
+		"10.0.0.1 ,\n",
+		"10.0.0 a:b\n",
+		"10.0.0.0/33 a:b\n",
+		"10.0.0.1 a:b\n10.0.0.1 c:d\n",
+		"10.0.0.0/8 a:b\n10.1.0.0/8 c:d\n", // The same network
+	} {
+		_, err := readTable(bytes.NewBufferString(data))
+		assert.Error(t, err, data)
+	}
+	_, err := NewEnricher(filepath.Join(t.TempDir(), "missing"), logrus.New())
+	assert.Error(t, err)
+}
+
+func TestNewEnricherFromViper(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sources")
+	writeFile(t, path, "10.0.0.1 env:prod\n")
+	v := viper.New()
+	v.Set(EnricherName+"."+paramFile, path)
+	e, err := NewEnricherFromViper(v, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, gostatsd.Tags{"env:prod"}, e.Enrich("m", "10.0.0.1", nil))
+
+	_, err = NewEnricherFromViper(viper.New(), logrus.New())
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package tagmap
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/internal/util"
+)
+
+// EnricherName is the name of this enricher.
+const EnricherName = "tagmap"
+
+const (
+	paramSourceTag = "source-tag"
+	paramTargetTag = "target-tag"
+	paramValues    = "values"
+)
+
+// Enricher adds a tag to metrics with a value looked up from the value of another tag, such as a service name from
+// a port.
+type Enricher struct {
+	sourcePrefix string            // source-tag followed by a colon
+	targetPrefix string            // target-tag followed by a colon
+	values       map[string]string // Value of the source tag, lower cased -> value of the target tag
+}
+
+// NewEnricherFromViper returns a new tagmap enricher.
+func NewEnricherFromViper(v *viper.Viper, logger logrus.FieldLogger) (gostatsd.Enricher, error) {
+	tm := util.GetSubViper(v, EnricherName)
+	return NewEnricher(tm.GetString(paramSourceTag), tm.GetString(paramTargetTag), tm.GetStringMapString(paramValues))
+}
+
+// NewEnricher returns a new tagmap enricher which adds targetTag:<value> to metrics with a sourceTag whose value is
+// in values.  Values are matched case insensitively, as keys read from configuration are lower cased.
+func NewEnricher(sourceTag, targetTag string, values map[string]string) (*Enricher, error) {
+	if sourceTag == "" || targetTag == "" {
+		return nil, errors.New("[" + EnricherName + "] " + paramSourceTag + " and " + paramTargetTag + " are required")
+	}
+	lowerValues := make(map[string]string, len(values))
+	for key, value := range values {
+		lowerValues[strings.ToLower(key)] = value
+	}
+	return &Enricher{
+		sourcePrefix: sourceTag + ":",
+		targetPrefix: targetTag + ":",
+		values:       lowerValues,
+	}, nil
+}
+
+// Name returns the name of the enricher.
+func (e *Enricher) Name() string {
+	return EnricherName
+}
+
+// Enrich adds the target tag to the tags if the source tag has a value which is mapped, replacing any existing
+// target tag.  An existing target tag is replaced in a copy, as the tags may be shared with other metrics.
+func (e *Enricher) Enrich(name string, source gostatsd.Source, tags gostatsd.Tags) gostatsd.Tags {
+	var mapped string
+	found := false
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, e.sourcePrefix) {
+			mapped, found = e.values[strings.ToLower(tag[len(e.sourcePrefix):])]
+			break
+		}
+	}
+	if !found {
+		return tags
+	}
+	for idx, tag := range tags {
+		if strings.HasPrefix(tag, e.targetPrefix) {
+			tags = tags.Copy()
+			tags[idx] = e.targetPrefix + mapped
+			return tags
+		}
+	}
+	return append(tags, e.targetPrefix+mapped)
+}
+
+// EstimatedTags returns a guess of how many tags are likely to be added by the Enricher.
+func (e *Enricher) EstimatedTags() int {
+	return 1
+}
@@ -0,0 +1,64 @@
+package tagmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestEnrich(t *testing.T) {
+	t.Parallel()
+	e, err := NewEnricher("port", "service", map[string]string{"8080": "web", "Admin": "admin"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		tags     gostatsd.Tags
+		expected gostatsd.Tags
+	}{
+		{tags: gostatsd.Tags{"port:8080"}, expected: gostatsd.Tags{"port:8080", "service:web"}},
+		{tags: gostatsd.Tags{"port:ADMIN"}, expected: gostatsd.Tags{"port:ADMIN", "service:admin"}},
+		{tags: gostatsd.Tags{"service:old", "port:8080"}, expected: gostatsd.Tags{"service:web", "port:8080"}},
+		{tags: gostatsd.Tags{"port:9090"}, expected: gostatsd.Tags{"port:9090"}},
+		{tags: gostatsd.Tags{"a"}, expected: gostatsd.Tags{"a"}},
+		{tags: nil, expected: nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, e.Enrich("m", "", test.tags.Copy()), test.tags)
+	}
+}
+
+func TestEnrichDoesNotModifyTags(t *testing.T) {
+	t.Parallel()
+	e, err := NewEnricher("port", "service", map[string]string{"8080": "web"})
+	require.NoError(t, err)
+
+	tags := gostatsd.Tags{"service:old", "port:8080"}
+	assert.Equal(t, gostatsd.Tags{"service:web", "port:8080"}, e.Enrich("m", "", tags))
+	assert.Equal(t, gostatsd.Tags{"service:old", "port:8080"}, tags)
+}
+
+func TestNewEnricherFromViper(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(bytes.NewBufferString(`
+[tagmap]
+source-tag = 'port'
+target-tag = 'service'
+
+[tagmap.values]
+8080 = 'web'
+`)))
+	e, err := NewEnricherFromViper(v, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, gostatsd.Tags{"port:8080", "service:web"}, e.Enrich("m", "", gostatsd.Tags{"port:8080"}))
+
+	_, err = NewEnricherFromViper(viper.New(), logrus.New())
+	assert.Error(t, err)
+}
@@ -3,12 +3,17 @@ package statsd
 import (
 	"context"
 	"math"
+	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/pkg/stats"
+	"github.com/atlassian/gostatsd/pkg/web"
 )
 
 // percentStruct is a cache of percentile names to avoid creating them for each timer.
@@ -33,71 +38,264 @@ type MetricAggregator struct {
 	statser               stats.Statser
 	disabledSubtypes      gostatsd.TimerSubtypes
 	histogramLimit        uint32
+	cardinalityWarn       uint32                        // Number of tag sets a metric name may have before warning, 0 to disable
+	cardinalityWarned     map[seriesName]struct{}       // Metric names which exceeded cardinalityWarn in the last flush
+	disablePerSecond      bool                          // Skip calculating PerSecond for counters and timers
+	counterEvents         bool                          // Emit the number of times each counter was received as <name>.events
+	eventCounters         gostatsd.Counters             // The <name>.events counters calculated in the last flush
+	linearPercentiles     bool                          // Interpolate percentile thresholds rather than using nearest rank
+	cumulativeCounters    gostatsd.StringMatchList      // Counters which keep their value across flushes rather than resetting
+	cumulativeBases       map[string]map[string]float64 // The value of each cumulative counter at the last Reset
+	changedGaugesOnly     bool                          // Only send gauges with a different value to the last one sent
+	sentGauges            map[string]map[string]float64 // The last value sent of each gauge, if changedGaugesOnly
+	changedGauges         gostatsd.Gauges               // The gauges to send in this flush, if changedGaugesOnly
+	minSamplesPercentiles int                           // Timers with fewer values than this have no percentiles
+	setSuffix             string                        // Appended to the name of every set when it is processed
+	downsamples           DownsampleRules               // Metrics which are only sent every N flushes
+	flushes               uint64                        // The number of flushes, to find when downsampled metrics are sent
+	downsampleEvery       map[string]int                // The Every of each downsampled name in this flush
+	downsampleHeld        bool                          // If any downsampled names are not sent in this flush
+	approximateSets       gostatsd.StringMatchList      // Sets which are counted by a HyperLogLog rather than exactly
+	expiryPaused          bool                          // Don't expire metrics in Reset, set by the MetricFlusher
+	rollups               []*rollupAggregator           // Aggregate metrics over each of the longer rollup windows
+	dropCounterOverflows  bool                          // Drop counters which saturated at the int64 boundary
+	integerCounters       bool                          // Send counters without the fraction of their value
+	counterTotals         gostatsd.StringMatchList      // Counters which also send their lifetime total as <name>.total
+	totals                map[string]map[string]float64 // The lifetime total of each counter in counterTotals
+	totalGauges           gostatsd.Gauges               // The <name>.total gauges calculated in the last flush
+	percentileTags        map[string]gostatsd.Tags      // The tags of each percentile name, if sent as <name>.percentile
+	typeTags              bool                          // Tag every metric with metric_type:<type> when it is processed
+	averageGauges         gostatsd.StringMatchList      // Gauges which send the mean of the values received in each flush
+	percentileSampleRate  float64                       // Probability of a flush calculating timer percentiles
+	random                func() float64                // Returns a random number in [0, 1). Useful for testing.
+	untaggedMetrics       gostatsd.StringMatchList      // Metrics which are aggregated into a single series without tags
+	peakRateCounters      gostatsd.StringMatchList      // Counters which also send their peak rate as <name>.peak_per_second
+	peakRateWindow        time.Duration                 // The sub-window the peak rate of a counter is measured over
+	peakRates             map[string]map[string]bucket  // The sub-window values of each counter in peakRateCounters
+	peakGauges            gostatsd.Gauges               // The <name>.peak_per_second gauges calculated in the last flush
 	metricMap             *gostatsd.MetricMap
 }
 
+// bucket is the value a counter has received in the current sub-window of a flush interval, and the highest value
+// of the previous ones, to find the peak rate.
+type bucket struct {
+	window int64   // The index of the current sub-window since the epoch
+	count  float64 // The value received in the current sub-window
+	peak   float64 // The highest value received in a previous sub-window
+}
+
+// seriesName identifies all the series of a given type with the same name.
+type seriesName struct {
+	metricType gostatsd.MetricType
+	name       string
+}
+
+// AggregatorConfig is the configuration of a MetricAggregator.  The zero value of each field disables the feature it
+// configures, so a PercentileSampleRate of 0 calculates percentiles in every flush, the same as 1.
+type AggregatorConfig struct {
+	PercentThresholds     []float64
+	ExpiryIntervalCounter time.Duration
+	ExpiryIntervalGauge   time.Duration
+	ExpiryIntervalSet     time.Duration
+	ExpiryIntervalTimer   time.Duration
+	DisabledSubtypes      gostatsd.TimerSubtypes
+	HistogramLimit        uint32
+	CardinalityWarn       uint32          // Number of tag sets a metric name may have before warning, 0 to disable
+	DisablePerSecond      bool            // Skip calculating PerSecond for counters and timers
+	CounterEvents         bool            // Emit the number of times each counter was received as <name>.events
+	LinearPercentiles     bool            // Interpolate percentile thresholds rather than using nearest rank
+	CumulativeCounters    []string        // Counters which keep their value across flushes rather than resetting
+	PercentileNames       string          // The template for the names of the upper and lower percentiles
+	ChangedGaugesOnly     bool            // Only send gauges with a different value to the last one sent
+	MinSamplesPercentiles uint32          // Timers with fewer values than this have no percentiles
+	SetSuffix             string          // Appended to the name of every set when it is processed
+	Downsamples           DownsampleRules // Metrics which are only sent every N flushes
+	ApproximateSets       []string        // Sets which are counted by a HyperLogLog rather than exactly
+	Rollups               []Rollup        // Longer windows to also aggregate metrics over
+	DropCounterOverflows  bool            // Drop counters which saturated at the int64 boundary
+	IntegerCounters       bool            // Send counters without the fraction of their value
+	CounterTotals         []string        // Counters which also send their lifetime total as <name>.total
+	PercentileTags        bool            // Send percentiles as <name>.percentile tagged with the threshold
+	TypeTags              bool            // Tag every metric with metric_type:<type> when it is processed
+	AverageGauges         []string        // Gauges which send the mean of the values received in each flush
+	PercentileSampleRate  float64         // Probability of a flush calculating timer percentiles, 0 for every flush
+	UntaggedMetrics       []string        // Metrics which are aggregated into a single series without tags
+	PeakRateCounters      []string        // Counters which also send their peak rate as <name>.peak_per_second
+	PeakRateWindow        time.Duration   // The sub-window the peak rate of a counter is measured over
+}
+
 // NewMetricAggregator creates a new MetricAggregator object.
-func NewMetricAggregator(
-	percentThresholds []float64,
-	expiryIntervalCounter time.Duration,
-	expiryIntervalGauge time.Duration,
-	expiryIntervalSet time.Duration,
-	expiryIntervalTimer time.Duration,
-	disabled gostatsd.TimerSubtypes,
-	histogramLimit uint32,
-) *MetricAggregator {
+func NewMetricAggregator(config AggregatorConfig) *MetricAggregator {
 	a := MetricAggregator{
-		expiryIntervalCounter: expiryIntervalCounter,
-		expiryIntervalGauge:   expiryIntervalGauge,
-		expiryIntervalSet:     expiryIntervalSet,
-		expiryIntervalTimer:   expiryIntervalTimer,
-
-		percentThresholds: make(map[float64]percentStruct, len(percentThresholds)),
-		now:               time.Now,
-		statser:           stats.NewNullStatser(), // Will probably be replaced via RunMetrics
-		metricMap:         gostatsd.NewMetricMap(),
-		disabledSubtypes:  disabled,
-		histogramLimit:    histogramLimit,
-	}
-	for _, pct := range percentThresholds {
+		expiryIntervalCounter: config.ExpiryIntervalCounter,
+		expiryIntervalGauge:   config.ExpiryIntervalGauge,
+		expiryIntervalSet:     config.ExpiryIntervalSet,
+		expiryIntervalTimer:   config.ExpiryIntervalTimer,
+
+		percentThresholds:  make(map[float64]percentStruct, len(config.PercentThresholds)),
+		now:                time.Now,
+		statser:            stats.NewNullStatser(), // Will probably be replaced via RunMetrics
+		metricMap:          gostatsd.NewMetricMap(),
+		disabledSubtypes:   config.DisabledSubtypes,
+		histogramLimit:     config.HistogramLimit,
+		cardinalityWarn:    config.CardinalityWarn,
+		cardinalityWarned:  map[seriesName]struct{}{},
+		disablePerSecond:   config.DisablePerSecond,
+		counterEvents:      config.CounterEvents,
+		linearPercentiles:  config.LinearPercentiles,
+		cumulativeCounters: toStringMatch(config.CumulativeCounters),
+		changedGaugesOnly:  config.ChangedGaugesOnly,
+
+		minSamplesPercentiles: int(config.MinSamplesPercentiles),
+		setSuffix:             config.SetSuffix,
+		downsamples:           config.Downsamples,
+		approximateSets:       toStringMatch(config.ApproximateSets),
+		dropCounterOverflows:  config.DropCounterOverflows,
+		integerCounters:       config.IntegerCounters,
+		counterTotals:         toStringMatch(config.CounterTotals),
+		typeTags:              config.TypeTags,
+		averageGauges:         toStringMatch(config.AverageGauges),
+		percentileSampleRate:  config.PercentileSampleRate,
+		random:                rand.Float64,
+		untaggedMetrics:       toStringMatch(config.UntaggedMetrics),
+		peakRateCounters:      toStringMatch(config.PeakRateCounters),
+		peakRateWindow:        config.PeakRateWindow,
+	}
+	if len(config.CounterTotals) > 0 {
+		a.totals = map[string]map[string]float64{}
+	}
+	if len(config.CumulativeCounters) > 0 {
+		a.cumulativeBases = map[string]map[string]float64{}
+	}
+	if len(config.PeakRateCounters) > 0 && config.PeakRateWindow > 0 {
+		a.peakRates = map[string]map[string]bucket{}
+	}
+	if config.ChangedGaugesOnly {
+		a.sentGauges = map[string]map[string]float64{}
+	}
+	// Cardinality is already warned about by the MetricAggregator, downsampling a rollup is meaningless, the lifetime
+	// total of a counter is the same in a rollup, and the rollups receive metrics which are already untagged.
+	rollupConfig := config
+	rollupConfig.CardinalityWarn = 0
+	rollupConfig.Downsamples = nil
+	rollupConfig.Rollups = nil
+	rollupConfig.CounterTotals = nil
+	rollupConfig.UntaggedMetrics = nil
+	rollupConfig.PeakRateCounters = nil
+	rollupConfig.PeakRateWindow = 0
+	for _, rollup := range config.Rollups {
+		a.rollups = append(a.rollups, &rollupAggregator{
+			Rollup:     rollup,
+			tag:        "rollup:" + rollupName(rollup.Interval),
+			aggregator: NewMetricAggregator(rollupConfig),
+		})
+	}
+	for _, pct := range config.PercentThresholds {
 		sPct := strconv.Itoa(int(pct))
 		a.percentThresholds[pct] = percentStruct{
 			count:      "count_" + sPct,
 			mean:       "mean_" + sPct,
 			sum:        "sum_" + sPct,
 			sumSquares: "sum_squares_" + sPct,
-			upper:      "upper_" + sPct,
-			lower:      "lower_" + sPct,
+			upper:      gostatsd.PercentileName(config.PercentileNames, "upper", sPct),
+			lower:      gostatsd.PercentileName(config.PercentileNames, "lower", sPct),
+		}
+	}
+	if config.PercentileTags {
+		a.percentileTags = map[string]gostatsd.Tags{}
+		for pct, pctStruct := range a.percentThresholds {
+			sPct := "percentile:" + strconv.Itoa(int(pct))
+			names := map[string]string{
+				"count":       pctStruct.count,
+				"mean":        pctStruct.mean,
+				"sum":         pctStruct.sum,
+				"sum_squares": pctStruct.sumSquares,
+			}
+			// The upper and lower names may be the same, but only one is used for each threshold.
+			if pct > 0 {
+				names["upper"] = pctStruct.upper
+			} else {
+				names["lower"] = pctStruct.lower
+			}
+			for stat, name := range names {
+				// Percentiles.Set replaces dots in the name, so it must be looked up the same way.
+				a.percentileTags[strings.Replace(name, ".", "_", -1)] = gostatsd.Tags{sPct, "stat:" + stat}
+			}
 		}
 	}
 	return &a
 }
 
-// round rounds a number to its nearest integer value.
-// poor man's math.Round(x) = math.Floor(x + 0.5).
-func round(v float64) float64 {
-	return math.Floor(v + 0.5)
-}
-
 // Flush prepares the contents of a MetricAggregator for sending via the Sender.
 func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 	a.statser.Gauge("aggregator.metricmaps_received", float64(a.metricMapsReceived), nil)
+	a.flushCardinality()
+	a.flushes++
+	if len(a.downsamples) > 0 {
+		a.flushDownsamples()
+	}
+	for _, r := range a.rollups {
+		if a.flushes%uint64(r.Every) == 0 {
+			r.aggregator.Flush(flushInterval * time.Duration(r.Every))
+			r.flushed = true
+		}
+	}
+
+	a.flushCounterOverflows()
 
 	flushInSeconds := float64(flushInterval) / float64(time.Second)
+	// A non-positive interval would produce Inf or NaN rates, so PerSecond is left as 0 instead.
+	calcPerSecond := !a.disablePerSecond && flushInSeconds > 0
 
-	a.metricMap.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-		counter.PerSecond = float64(counter.Value) / flushInSeconds
-		a.metricMap.Counters[key][tagsKey] = counter
-	})
+	if calcPerSecond {
+		a.metricMap.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+			if a.held(key) {
+				return
+			}
+			value := a.counterValue(counter)
+			if a.cumulativeCounters.MatchAny(key) {
+				value -= a.cumulativeBases[key][tagsKey] // The rate is of the increase since the last flush
+			}
+			counter.PerSecond = value / (flushInSeconds * a.flushesAccumulated(key))
+			a.metricMap.Counters[key][tagsKey] = counter
+		})
+	}
 
+	if a.counterEvents {
+		a.flushCounterEvents(flushInSeconds, calcPerSecond)
+	}
+
+	if a.totals != nil {
+		a.flushCounterTotals()
+	}
+
+	if a.peakRates != nil {
+		a.flushPeakRates()
+	}
+
+	needSumSquaresPct := len(a.percentThresholds) > 0 && !a.disabledSubtypes.SumSquaresPct
+	// Percentiles need the values of every timer sorted, which is skipped on flushes which aren't sampled.
+	calcPercentiles := a.percentileSampleRate <= 0 || a.percentileSampleRate >= 1 || a.random() < a.percentileSampleRate
+	if !calcPercentiles {
+		a.statser.Count("aggregator.percentiles_skipped", 1, nil)
+	}
 	a.metricMap.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		if a.held(key) {
+			return
+		}
 		if hasHistogramTag(timer) {
 			timer.Histogram = latencyHistogram(timer, a.histogramLimit)
 			a.metricMap.Timers[key][tagsKey] = timer
 			return
 		}
 
-		if count := len(timer.Values); count > 0 {
+		if count := len(timer.Values); count > 0 && !calcPercentiles {
+			summariseTimer(&timer)
+			timer.Count = int(math.Round(timer.SampledCount))
+			if calcPerSecond {
+				timer.PerSecond = timer.SampledCount / (flushInSeconds * a.flushesAccumulated(key))
+			}
+		} else if count > 0 {
 			sort.Float64s(timer.Values)
 			timer.Min = timer.Values[0]
 			timer.Max = timer.Values[count-1]
@@ -105,12 +303,19 @@ func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 			count := float64(n)
 
 			cumulativeValues := make([]float64, n)
-			cumulSumSquaresValues := make([]float64, n)
 			cumulativeValues[0] = timer.Min
-			cumulSumSquaresValues[0] = timer.Min * timer.Min
 			for i := 1; i < n; i++ {
 				cumulativeValues[i] = timer.Values[i] + cumulativeValues[i-1]
-				cumulSumSquaresValues[i] = timer.Values[i]*timer.Values[i] + cumulSumSquaresValues[i-1]
+			}
+
+			// The cumulative sum of squares is only needed for the sum_squares percentile fields
+			var cumulSumSquaresValues []float64
+			if needSumSquaresPct {
+				cumulSumSquaresValues = make([]float64, n)
+				cumulSumSquaresValues[0] = timer.Min * timer.Min
+				for i := 1; i < n; i++ {
+					cumulSumSquaresValues[i] = timer.Values[i]*timer.Values[i] + cumulSumSquaresValues[i-1]
+				}
 			}
 
 			var sumSquares = timer.Min * timer.Min
@@ -118,21 +323,45 @@ func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 			var sum = timer.Min
 			var thresholdBoundary = timer.Max
 
-			for pct, pctStruct := range a.percentThresholds {
+			percentThresholds := a.percentThresholds
+			if n < a.minSamplesPercentiles {
+				percentThresholds = nil // Too few values for the percentiles to be meaningful
+			}
+			for pct, pctStruct := range percentThresholds {
+				// A single value is in every threshold, so it is sent for every threshold rather than rounding to
+				// none.  Otherwise a threshold which rounds to no values is not sent.
 				numInThreshold := n
 				if n > 1 {
-					numInThreshold = int(round(math.Abs(pct) / 100 * count))
+					numInThreshold = int(math.Round(math.Abs(pct) / 100 * count))
 					if numInThreshold == 0 {
 						continue
 					}
 					if pct > 0 {
 						thresholdBoundary = timer.Values[numInThreshold-1]
 						sum = cumulativeValues[numInThreshold-1]
-						sumSquares = cumulSumSquaresValues[numInThreshold-1]
+						if needSumSquaresPct {
+							sumSquares = cumulSumSquaresValues[numInThreshold-1]
+						}
+						if a.linearPercentiles {
+							thresholdBoundary = linearPercentile(timer.Values, pct/100)
+						}
 					} else {
-						thresholdBoundary = timer.Values[n-numInThreshold]
-						sum = cumulativeValues[n-1] - cumulativeValues[n-numInThreshold-1]
-						sumSquares = cumulSumSquaresValues[n-1] - cumulSumSquaresValues[n-numInThreshold-1]
+						// The threshold covers the largest numInThreshold values, which may be all of them
+						first := n - numInThreshold
+						thresholdBoundary = timer.Values[first]
+						sum = cumulativeValues[n-1]
+						if first > 0 {
+							sum -= cumulativeValues[first-1]
+						}
+						if needSumSquaresPct {
+							sumSquares = cumulSumSquaresValues[n-1]
+							if first > 0 {
+								sumSquares -= cumulSumSquaresValues[first-1]
+							}
+						}
+						if a.linearPercentiles {
+							thresholdBoundary = linearPercentile(timer.Values, 1+pct/100)
+						}
 					}
 					mean = sum / float64(numInThreshold)
 				}
@@ -146,7 +375,7 @@ func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 				if !a.disabledSubtypes.SumPct {
 					timer.Percentiles.Set(pctStruct.sum, sum)
 				}
-				if !a.disabledSubtypes.SumSquaresPct {
+				if needSumSquaresPct {
 					timer.Percentiles.Set(pctStruct.sumSquares, sumSquares)
 				}
 				if pct > 0 {
@@ -161,12 +390,13 @@ func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 			}
 
 			sum = cumulativeValues[n-1]
-			sumSquares = cumulSumSquaresValues[n-1]
 			mean = sum / count
 
 			var sumOfDiffs float64
+			sumSquares = 0
 			for i := 0; i < n; i++ {
 				sumOfDiffs += (timer.Values[i] - mean) * (timer.Values[i] - mean)
+				sumSquares += timer.Values[i] * timer.Values[i]
 			}
 
 			mid := int(math.Floor(count / 2))
@@ -181,23 +411,635 @@ func (a *MetricAggregator) Flush(flushInterval time.Duration) {
 			timer.Sum = sum
 			timer.SumSquares = sumSquares
 
-			timer.Count = int(round(timer.SampledCount))
-			timer.PerSecond = timer.SampledCount / flushInSeconds
+			timer.Count = int(math.Round(timer.SampledCount))
+			if calcPerSecond {
+				timer.PerSecond = timer.SampledCount / (flushInSeconds * a.flushesAccumulated(key))
+			}
 		} else {
 			timer.Count = 0
 			timer.SampledCount = 0
 			timer.PerSecond = 0
 		}
+		sanitizeTimer(&timer)
 		a.metricMap.Timers[key][tagsKey] = timer
 	})
+
+	a.metricMap.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		value := gauge.Value
+		if len(a.averageGauges) > 0 && a.averageGauges.MatchAny(key) {
+			value = gauge.Mean()
+		}
+		if value = gostatsd.CoerceToNumeric(value); value != gauge.Value {
+			gauge.Value = value
+			a.metricMap.Gauges[key][tagsKey] = gauge
+		}
+	})
+
+	if a.changedGaugesOnly {
+		a.flushChangedGauges()
+	}
+}
+
+// flushCounterOverflows counts the counters which saturated at the int64 boundary, rather than wrapping, and drops
+// them if dropCounterOverflows.
+func (a *MetricAggregator) flushCounterOverflows() {
+	overflows := 0
+	a.metricMap.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+		if !counter.Overflowed() {
+			return
+		}
+		overflows++
+		if a.dropCounterOverflows {
+			deleteMetric(key, tagsKey, a.metricMap.Counters)
+		}
+	})
+	if overflows > 0 {
+		a.statser.Count("aggregator.counter_overflows", float64(overflows), nil)
+	}
+}
+
+// flushChangedGauges finds the gauges with a different value to the last one sent, or which have not been sent
+// before, and records their value as sent.
+func (a *MetricAggregator) flushChangedGauges() {
+	a.changedGauges = gostatsd.Gauges{}
+	a.metricMap.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		if a.held(key) {
+			return // Not sent, so it is compared against the last value sent when it is next sent
+		}
+		sent, ok := a.sentGauges[key]
+		if !ok {
+			sent = map[string]float64{}
+			a.sentGauges[key] = sent
+		} else if value, ok := sent[tagsKey]; ok && value == gauge.Value {
+			return
+		}
+		sent[tagsKey] = gauge.Value
+		if _, ok := a.changedGauges[key]; !ok {
+			a.changedGauges[key] = map[string]gostatsd.Gauge{}
+		}
+		a.changedGauges[key][tagsKey] = gauge
+	})
+}
+
+// sanitizeTimer replaces any NaN or Inf values calculated for a timer, which may be caused by NaN or Inf values
+// being received, so backends are only sent numeric values.  See gostatsd.CoerceToNumeric.
+func sanitizeTimer(timer *gostatsd.Timer) {
+	timer.Min = gostatsd.CoerceToNumeric(timer.Min)
+	timer.Max = gostatsd.CoerceToNumeric(timer.Max)
+	timer.Mean = gostatsd.CoerceToNumeric(timer.Mean)
+	timer.Median = gostatsd.CoerceToNumeric(timer.Median)
+	timer.StdDev = gostatsd.CoerceToNumeric(timer.StdDev)
+	timer.Sum = gostatsd.CoerceToNumeric(timer.Sum)
+	timer.SumSquares = gostatsd.CoerceToNumeric(timer.SumSquares)
+	timer.PerSecond = gostatsd.CoerceToNumeric(timer.PerSecond)
+	for idx := range timer.Percentiles {
+		timer.Percentiles[idx].Float = gostatsd.CoerceToNumeric(timer.Percentiles[idx].Float)
+	}
+}
+
+// summariseTimer calculates the aggregates of the timer which don't need its values sorted, and its median by
+// selection, leaving it without percentiles.  The values are reordered.
+func summariseTimer(timer *gostatsd.Timer) {
+	n := len(timer.Values)
+	count := float64(n)
+	timer.Min = timer.Values[0]
+	timer.Max = timer.Values[0]
+	var sum, sumSquares float64
+	for _, v := range timer.Values {
+		timer.Min = math.Min(timer.Min, v)
+		timer.Max = math.Max(timer.Max, v)
+		sum += v
+		sumSquares += v * v
+	}
+	mean := sum / count
+	var sumOfDiffs float64
+	for _, v := range timer.Values {
+		sumOfDiffs += (v - mean) * (v - mean)
+	}
+
+	mid := n / 2
+	timer.Median = selectNth(timer.Values, mid)
+	if n%2 == 0 {
+		// The values before mid are the smallest, so the largest of them is the other middle value
+		lower := timer.Values[0]
+		for _, v := range timer.Values[1:mid] {
+			lower = math.Max(lower, v)
+		}
+		timer.Median = (lower + timer.Median) / 2
+	}
+
+	timer.Mean = mean
+	timer.StdDev = math.Sqrt(sumOfDiffs / count)
+	timer.Sum = sum
+	timer.SumSquares = sumSquares
+}
+
+// selectNth returns the value which would be at index k if the values were sorted, and partially sorts them so that
+// the values before k are no larger and the values after it are no smaller.
+func selectNth(values []float64, k int) float64 {
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		pivot := values[lo+(hi-lo)/2]
+		i, j := lo, hi
+		for i <= j {
+			for values[i] < pivot {
+				i++
+			}
+			for values[j] > pivot {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return values[k]
+		}
+	}
+	return values[k]
+}
+
+// linearPercentile returns the value at quantile q of the sorted values, linearly interpolating between the two
+// closest values.  This is the same as the default method used by numpy and R (type 7).
+func linearPercentile(sortedValues []float64, q float64) float64 {
+	pos := q * float64(len(sortedValues)-1)
+	lower := int(math.Floor(pos))
+	if lower >= len(sortedValues)-1 {
+		return sortedValues[len(sortedValues)-1]
+	}
+	return sortedValues[lower] + (pos-float64(lower))*(sortedValues[lower+1]-sortedValues[lower])
+}
+
+// flushCardinality emits the number of distinct series held by the aggregator, in total and for each metric type,
+// and logs a warning the first time a metric name exceeds the configured number of tag sets.  The warning will be
+// logged again if the metric name drops below the threshold and then exceeds it again.
+func (a *MetricAggregator) flushCardinality() {
+	warned := a.cardinalityWarned
+	if a.cardinalityWarn > 0 {
+		a.cardinalityWarned = map[seriesName]struct{}{}
+	}
+
+	series := 0
+	seriesByType := map[gostatsd.MetricType]int{}
+	check := func(metricType gostatsd.MetricType, name string, count int) {
+		series += count
+		seriesByType[metricType] += count
+		if a.cardinalityWarn == 0 || count <= int(a.cardinalityWarn) {
+			return
+		}
+		sn := seriesName{metricType: metricType, name: name}
+		a.cardinalityWarned[sn] = struct{}{}
+		if _, ok := warned[sn]; !ok {
+			logrus.WithFields(logrus.Fields{
+				"name":      name,
+				"type":      metricType.String(),
+				"series":    count,
+				"threshold": a.cardinalityWarn,
+			}).Warn("Metric name exceeds cardinality threshold")
+		}
+	}
+
+	for name, tagSets := range a.metricMap.Counters {
+		check(gostatsd.COUNTER, name, len(tagSets))
+	}
+	for name, tagSets := range a.metricMap.Timers {
+		check(gostatsd.TIMER, name, len(tagSets))
+	}
+	for name, tagSets := range a.metricMap.Gauges {
+		check(gostatsd.GAUGE, name, len(tagSets))
+	}
+	for name, tagSets := range a.metricMap.Sets {
+		check(gostatsd.SET, name, len(tagSets))
+	}
+	a.statser.Gauge("aggregator.series", float64(series), nil)
+	for _, metricType := range []gostatsd.MetricType{gostatsd.COUNTER, gostatsd.TIMER, gostatsd.GAUGE, gostatsd.SET} {
+		a.statser.Gauge("aggregator."+metricType.String()+"_series", float64(seriesByType[metricType]), nil)
+	}
+}
+
+// flushDownsamples finds the Every of each downsampled name, and if any of them are not sent in this flush.
+func (a *MetricAggregator) flushDownsamples() {
+	a.downsampleEvery = map[string]int{}
+	a.downsampleHeld = false
+	find := func(key string) {
+		if _, ok := a.downsampleEvery[key]; ok {
+			return
+		}
+		if every := a.downsamples.Every(key); every > 1 {
+			a.downsampleEvery[key] = every
+			a.downsampleHeld = a.downsampleHeld || a.held(key)
+		}
+	}
+	for key := range a.metricMap.Counters {
+		find(key)
+	}
+	for key := range a.metricMap.Timers {
+		find(key)
+	}
+	for key := range a.metricMap.Gauges {
+		find(key)
+	}
+	for key := range a.metricMap.Sets {
+		find(key)
+	}
+}
+
+// held returns true if the downsampled metrics with the name are accumulated rather than sent in this flush.
+func (a *MetricAggregator) held(key string) bool {
+	every, ok := a.downsampleEvery[key]
+	return ok && a.flushes%uint64(every) != 0
+}
+
+// flushesAccumulated returns the number of flushes the metrics with the name have been accumulated for.
+func (a *MetricAggregator) flushesAccumulated(key string) float64 {
+	if every, ok := a.downsampleEvery[key]; ok {
+		return float64(every)
+	}
+	return 1
 }
 
 func (a *MetricAggregator) RunMetrics(ctx context.Context, statser stats.Statser) {
 	a.statser = statser
 }
 
+// Process calls f with the metrics of the flush, and again with the metrics of each rollup window which ended in it.
 func (a *MetricAggregator) Process(f ProcessFunc) {
-	f(a.metricMap)
+	a.process(f)
+	for _, r := range a.rollups {
+		if r.flushed {
+			r.aggregator.Process(f)
+		}
+	}
+}
+
+// shouldSkipCopy returns true if the metrics of the flush are sent exactly as they are held, so process doesn't need
+// to copy the MetricMap.
+func (a *MetricAggregator) shouldSkipCopy() bool {
+	return a.eventCounters == nil && // No <name>.events counters are added
+		a.changedGauges == nil && // Every gauge is sent, not only the changed ones
+		a.totalGauges == nil && // No <name>.total gauges are added
+		a.peakGauges == nil && // No <name>.peak_per_second gauges are added
+		a.setSuffix == "" && // Sets are not renamed
+		!a.downsampleHeld && // No downsampled metrics are held back from this flush
+		!a.integerCounters && // Counters keep their fractions
+		a.percentileTags == nil && // Timer percentiles are not sent as tagged gauges
+		!a.typeTags // Metrics are not tagged with their type
+}
+
+func (a *MetricAggregator) process(f ProcessFunc) {
+	if a.shouldSkipCopy() {
+		f(a.metricMap)
+		return
+	}
+
+	// Pass a shallow copy including the <name>.events counters, only the changed gauges, the <name>.total and
+	// <name>.peak_per_second gauges, the renamed sets, the counters without their fractions, the timer percentiles
+	// as tagged gauges, the metric_type tags, and without the downsampled metrics which are not sent in this flush,
+	// so they are not retained after Reset.
+	mm := &gostatsd.MetricMap{
+		Counters: a.metricMap.Counters,
+		Timers:   a.metricMap.Timers,
+		Gauges:   a.metricMap.Gauges,
+		Sets:     a.metricMap.Sets,
+	}
+	if a.eventCounters != nil {
+		counters := make(gostatsd.Counters, len(a.metricMap.Counters)+len(a.eventCounters))
+		for key, value := range a.eventCounters {
+			counters[key] = value
+		}
+		for key, value := range a.metricMap.Counters {
+			counters[key] = value // A real counter takes precedence over a generated one with the same name.
+		}
+		mm.Counters = counters
+	}
+	if a.changedGauges != nil {
+		mm.Gauges = a.changedGauges
+	}
+	if a.totalGauges != nil {
+		mm.Gauges = withGeneratedGauges(mm.Gauges, a.totalGauges)
+	}
+	if a.peakGauges != nil {
+		mm.Gauges = withGeneratedGauges(mm.Gauges, a.peakGauges)
+	}
+	if a.downsampleHeld {
+		counters := make(gostatsd.Counters, len(mm.Counters))
+		for key, value := range mm.Counters {
+			if !a.held(key) {
+				counters[key] = value
+			}
+		}
+		mm.Counters = counters
+		timers := make(gostatsd.Timers, len(mm.Timers))
+		for key, value := range mm.Timers {
+			if !a.held(key) {
+				timers[key] = value
+			}
+		}
+		mm.Timers = timers
+		gauges := make(gostatsd.Gauges, len(mm.Gauges))
+		for key, value := range mm.Gauges {
+			if !a.held(key) {
+				gauges[key] = value
+			}
+		}
+		mm.Gauges = gauges
+		sets := make(gostatsd.Sets, len(mm.Sets))
+		for key, value := range mm.Sets {
+			if !a.held(key) {
+				sets[key] = value
+			}
+		}
+		mm.Sets = sets
+	}
+	if a.integerCounters {
+		// The fraction is kept by the MetricAggregator, so cumulative and downsampled counters still accumulate it.
+		counters := make(gostatsd.Counters, len(mm.Counters))
+		for key, value := range mm.Counters {
+			tagged := make(map[string]gostatsd.Counter, len(value))
+			for tagsKey, counter := range value {
+				counter.Fraction = 0
+				tagged[tagsKey] = counter
+			}
+			counters[key] = tagged
+		}
+		mm.Counters = counters
+	}
+	if a.setSuffix != "" {
+		sets := make(gostatsd.Sets, len(mm.Sets))
+		for key, value := range mm.Sets {
+			sets[key+a.setSuffix] = value
+		}
+		mm.Sets = sets
+	}
+	if a.percentileTags != nil {
+		a.tagPercentiles(mm)
+	}
+	if a.typeTags {
+		tagTypes(mm)
+	}
+	f(mm)
+}
+
+// tagTypes replaces every metric in mm with one tagged with metric_type:<type>, the type of the map it is in.
+func tagTypes(mm *gostatsd.MetricMap) {
+	counterTag := "metric_type:" + gostatsd.COUNTER.String()
+	counters := make(gostatsd.Counters, len(mm.Counters))
+	for key, value := range mm.Counters {
+		tagged := make(map[string]gostatsd.Counter, len(value))
+		for _, counter := range value {
+			counter.Tags = append(counter.Tags.Copy(), counterTag)
+			tagged[gostatsd.FormatTagsKey(counter.Source, counter.Tags)] = counter
+		}
+		counters[key] = tagged
+	}
+	timerTag := "metric_type:" + gostatsd.TIMER.String()
+	timers := make(gostatsd.Timers, len(mm.Timers))
+	for key, value := range mm.Timers {
+		tagged := make(map[string]gostatsd.Timer, len(value))
+		for _, timer := range value {
+			timer.Tags = append(timer.Tags.Copy(), timerTag)
+			tagged[gostatsd.FormatTagsKey(timer.Source, timer.Tags)] = timer
+		}
+		timers[key] = tagged
+	}
+	gaugeTag := "metric_type:" + gostatsd.GAUGE.String()
+	gauges := make(gostatsd.Gauges, len(mm.Gauges))
+	for key, value := range mm.Gauges {
+		tagged := make(map[string]gostatsd.Gauge, len(value))
+		for _, gauge := range value {
+			gauge.Tags = append(gauge.Tags.Copy(), gaugeTag)
+			tagged[gostatsd.FormatTagsKey(gauge.Source, gauge.Tags)] = gauge
+		}
+		gauges[key] = tagged
+	}
+	setTag := "metric_type:" + gostatsd.SET.String()
+	sets := make(gostatsd.Sets, len(mm.Sets))
+	for key, value := range mm.Sets {
+		tagged := make(map[string]gostatsd.Set, len(value))
+		for _, set := range value {
+			set.Tags = append(set.Tags.Copy(), setTag)
+			tagged[gostatsd.FormatTagsKey(set.Source, set.Tags)] = set
+		}
+		sets[key] = tagged
+	}
+	mm.Counters = counters
+	mm.Timers = timers
+	mm.Gauges = gauges
+	mm.Sets = sets
+}
+
+// tagPercentiles replaces the percentiles of the timers in mm with <name>.percentile gauges, tagged with the
+// percentile:<pct> threshold and the stat:<stat> it is, so the series of a timer share a name.
+func (a *MetricAggregator) tagPercentiles(mm *gostatsd.MetricMap) {
+	timers := make(gostatsd.Timers, len(mm.Timers))
+	gauges := make(gostatsd.Gauges, len(mm.Gauges))
+	for key, value := range mm.Timers {
+		tagged := make(map[string]gostatsd.Timer, len(value))
+		for tagsKey, timer := range value {
+			for _, pct := range timer.Percentiles {
+				pctTags, ok := a.percentileTags[pct.Str]
+				if !ok {
+					continue
+				}
+				percentiles, ok := gauges[key+".percentile"]
+				if !ok {
+					percentiles = map[string]gostatsd.Gauge{}
+					gauges[key+".percentile"] = percentiles
+				}
+				tags := append(timer.Tags.Copy(), pctTags...)
+				percentiles[gostatsd.FormatTagsKey(timer.Source, tags)] = gostatsd.Gauge{
+					Value:     pct.Float,
+					Timestamp: timer.Timestamp,
+					Source:    timer.Source,
+					Tags:      tags,
+				}
+			}
+			timer.Percentiles = nil
+			tagged[tagsKey] = timer
+		}
+		timers[key] = tagged
+	}
+	for key, value := range mm.Gauges {
+		gauges[key] = value // A real gauge takes precedence over a generated one with the same name.
+	}
+	mm.Timers = timers
+	mm.Gauges = gauges
+}
+
+// flushCounterEvents calculates a <name>.events counter for each counter, with the number of times it was received.
+func (a *MetricAggregator) flushCounterEvents(flushInSeconds float64, calcPerSecond bool) {
+	a.eventCounters = make(gostatsd.Counters, len(a.metricMap.Counters))
+	for key, value := range a.metricMap.Counters {
+		if a.held(key) {
+			continue
+		}
+		events := make(map[string]gostatsd.Counter, len(value))
+		for tagsKey, counter := range value {
+			c := gostatsd.Counter{
+				Value:     counter.Events,
+				Events:    counter.Events,
+				Timestamp: counter.Timestamp,
+				Source:    counter.Source,
+				Tags:      counter.Tags,
+			}
+			if calcPerSecond {
+				c.PerSecond = float64(c.Value) / (flushInSeconds * a.flushesAccumulated(key))
+			}
+			events[tagsKey] = c
+		}
+		a.eventCounters[key+".events"] = events
+	}
+}
+
+// flushCounterTotals adds the value of each counter in counterTotals to its lifetime total, and calculates a
+// <name>.total gauge with it.  A cumulative counter already has its lifetime total as its value.
+func (a *MetricAggregator) flushCounterTotals() {
+	a.totalGauges = gostatsd.Gauges{}
+	for key, value := range a.metricMap.Counters {
+		if a.held(key) || !a.counterTotals.MatchAny(key) {
+			continue
+		}
+		totals, ok := a.totals[key]
+		if !ok {
+			totals = make(map[string]float64, len(value))
+			a.totals[key] = totals
+		}
+		gauges := make(map[string]gostatsd.Gauge, len(value))
+		for tagsKey, counter := range value {
+			total := a.counterValue(counter)
+			if !a.cumulativeCounters.MatchAny(key) {
+				total += totals[tagsKey]
+			}
+			totals[tagsKey] = total
+			gauges[tagsKey] = gostatsd.Gauge{
+				Value:     total,
+				Timestamp: counter.Timestamp,
+				Source:    counter.Source,
+				Tags:      counter.Tags,
+			}
+		}
+		a.totalGauges[key+".total"] = gauges
+	}
+}
+
+// withGeneratedGauges returns a copy of gauges with the generated gauges added.
+func withGeneratedGauges(gauges, generated gostatsd.Gauges) gostatsd.Gauges {
+	merged := make(gostatsd.Gauges, len(gauges)+len(generated))
+	for key, value := range generated {
+		merged[key] = value
+	}
+	for key, value := range gauges {
+		merged[key] = value // A real gauge takes precedence over a generated one with the same name.
+	}
+	return merged
+}
+
+// receivePeakRates adds the value of each counter in peakRateCounters in mm to the sub-window of its timestamp.  A
+// value with the timestamp of an earlier sub-window, which happens when batches are delayed, is added to the current
+// one.
+func (a *MetricAggregator) receivePeakRates(mm *gostatsd.MetricMap) {
+	for key, value := range mm.Counters {
+		if !a.peakRateCounters.MatchAny(key) {
+			continue
+		}
+		rates, ok := a.peakRates[key]
+		if !ok {
+			rates = make(map[string]bucket, len(value))
+			a.peakRates[key] = rates
+		}
+		for tagsKey, counter := range value {
+			rate := rates[tagsKey]
+			if window := int64(counter.Timestamp) / int64(a.peakRateWindow); window > rate.window {
+				rate.peak = math.Max(rate.peak, rate.count)
+				rate.window = window
+				rate.count = 0
+			}
+			rate.count += counter.Total()
+			rates[tagsKey] = rate
+		}
+	}
+}
+
+// flushPeakRates calculates the <name>.peak_per_second gauge of each counter in peakRateCounters, from the sub-window
+// with the highest value.  The current sub-window is included, as if it were complete.
+func (a *MetricAggregator) flushPeakRates() {
+	a.peakGauges = gostatsd.Gauges{}
+	windowInSeconds := a.peakRateWindow.Seconds()
+	for key, rates := range a.peakRates {
+		counters, ok := a.metricMap.Counters[key]
+		if !ok || a.held(key) {
+			continue
+		}
+		gauges := make(map[string]gostatsd.Gauge, len(rates))
+		for tagsKey, rate := range rates {
+			counter, ok := counters[tagsKey]
+			if !ok {
+				continue // Deleted
+			}
+			gauges[tagsKey] = gostatsd.Gauge{
+				Value:     math.Max(rate.peak, rate.count) / windowInSeconds,
+				Timestamp: counter.Timestamp,
+				Source:    counter.Source,
+				Tags:      counter.Tags,
+			}
+		}
+		a.peakGauges[key+".peak_per_second"] = gauges
+	}
+}
+
+// counterValue returns the value of a counter as it is sent, without its fraction if integerCounters is set.
+func (a *MetricAggregator) counterValue(counter gostatsd.Counter) float64 {
+	if a.integerCounters {
+		return float64(counter.Value)
+	}
+	return counter.Total()
+}
+
+// deleteCounter deletes a counter series, along with its lifetime total, its peak rate sub-windows, its value at the
+// last Reset if it is cumulative, and any series generated from it in the current flush.
+func (a *MetricAggregator) deleteCounter(key, tagsKey string) {
+	deleteMetric(key, tagsKey, a.metricMap.Counters)
+	if totals, ok := a.totals[key]; ok {
+		delete(totals, tagsKey)
+		if len(totals) == 0 {
+			delete(a.totals, key)
+		}
+	}
+	if rates, ok := a.peakRates[key]; ok {
+		delete(rates, tagsKey)
+		if len(rates) == 0 {
+			delete(a.peakRates, key)
+		}
+	}
+	if bases, ok := a.cumulativeBases[key]; ok {
+		delete(bases, tagsKey)
+		if len(bases) == 0 {
+			delete(a.cumulativeBases, key)
+		}
+	}
+	deleteMetric(key+".events", tagsKey, a.eventCounters)
+	deleteMetric(key+".total", tagsKey, a.totalGauges)
+	deleteMetric(key+".peak_per_second", tagsKey, a.peakGauges)
+}
+
+// deleteGauge deletes a gauge series, along with the last value sent and any change to send in the current flush,
+// so it is sent again if it is received again, even with the same value.
+func (a *MetricAggregator) deleteGauge(key, tagsKey string) {
+	deleteMetric(key, tagsKey, a.metricMap.Gauges)
+	if sent, ok := a.sentGauges[key]; ok {
+		delete(sent, tagsKey)
+		if len(sent) == 0 {
+			delete(a.sentGauges, key)
+		}
+	}
+	deleteMetric(key, tagsKey, a.changedGauges)
 }
 
 func isExpired(interval time.Duration, now, ts gostatsd.Nanotime) bool {
@@ -211,14 +1053,140 @@ func deleteMetric(key, tagsKey string, metrics gostatsd.AggregatedMetrics) {
 	}
 }
 
+// DeleteMetric deletes every series of any type with the name, or only the series with exactly the tags (in any order)
+// if tags is not nil.  The state kept for each series is deleted with it, so a series received again starts from
+// scratch.  It returns the number of series deleted.
+func (a *MetricAggregator) DeleteMetric(name string, tags gostatsd.Tags) int {
+	match := func(seriesTags gostatsd.Tags) bool {
+		return tags == nil || sameTags(tags, seriesTags)
+	}
+	deleted := 0
+	for tagsKey, counter := range a.metricMap.Counters[name] {
+		if match(counter.Tags) {
+			a.deleteCounter(name, tagsKey)
+			deleted++
+		}
+	}
+	for tagsKey, timer := range a.metricMap.Timers[name] {
+		if match(timer.Tags) {
+			deleteMetric(name, tagsKey, a.metricMap.Timers)
+			deleted++
+		}
+	}
+	for tagsKey, gauge := range a.metricMap.Gauges[name] {
+		if match(gauge.Tags) {
+			a.deleteGauge(name, tagsKey)
+			deleted++
+		}
+	}
+	for tagsKey, set := range a.metricMap.Sets[name] {
+		if match(set.Tags) {
+			deleteMetric(name, tagsKey, a.metricMap.Sets)
+			deleted++
+		}
+	}
+	for _, r := range a.rollups {
+		if tags == nil {
+			deleted += r.aggregator.DeleteMetric(name, nil)
+		} else {
+			deleted += r.aggregator.DeleteMetric(name, r.tags(tags))
+		}
+	}
+	return deleted
+}
+
+// Gauges returns the gauges which will be sent in the next flush unless they are received again.  The Gauges must
+// not be modified, or retained after the Aggregator receives more metrics.
+func (a *MetricAggregator) Gauges() gostatsd.Gauges {
+	return a.metricMap.Gauges
+}
+
+// MetricVolumes returns the volume of each counter, timer, and set name received since the last Reset.  The volume of
+// a timer is its number of values adjusted by their sample rate, and of a set is its number of distinct values.
+func (a *MetricAggregator) MetricVolumes() map[seriesName]web.MetricVolume {
+	volumes := map[seriesName]web.MetricVolume{}
+	add := func(metricType gostatsd.MetricType, name string, volume float64) {
+		key := seriesName{metricType: metricType, name: name}
+		mv := volumes[key]
+		mv.Name = name
+		mv.Volume += volume
+		mv.Series++
+		volumes[key] = mv
+	}
+	a.metricMap.Counters.Each(func(name, _ string, counter gostatsd.Counter) {
+		add(gostatsd.COUNTER, name, counter.Total())
+	})
+	a.metricMap.Timers.Each(func(name, _ string, timer gostatsd.Timer) {
+		add(gostatsd.TIMER, name, timer.SampledCount)
+	})
+	a.metricMap.Sets.Each(func(name, _ string, set gostatsd.Set) {
+		add(gostatsd.SET, name, float64(set.Count()))
+	})
+	return volumes
+}
+
+// sameTags returns true if a and b contain the same tags, in any order.
+func sameTags(a, b gostatsd.Tags) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append(gostatsd.Tags(nil), a...)
+	sortedB := append(gostatsd.Tags(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for idx := range sortedA {
+		if sortedA[idx] != sortedB[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// PauseExpiry stops metrics being expired by Reset until it is called again with paused false.
+func (a *MetricAggregator) PauseExpiry(paused bool) {
+	a.expiryPaused = paused
+}
+
 // Reset clears the contents of a MetricAggregator.
 func (a *MetricAggregator) Reset() {
 	a.metricMapsReceived = 0
+	a.eventCounters = nil
+	a.changedGauges = nil
+	a.totalGauges = nil
+	a.peakGauges = nil
+	for key := range a.peakRates {
+		if !a.held(key) {
+			delete(a.peakRates, key) // Each flush interval has its own peak
+		}
+	}
+	for _, r := range a.rollups {
+		if r.flushed {
+			r.aggregator.PauseExpiry(a.expiryPaused)
+			r.aggregator.Reset()
+			r.flushed = false
+		}
+	}
 	nowNano := gostatsd.Nanotime(a.now().UnixNano())
+	expired := func(interval time.Duration, ts gostatsd.Nanotime) bool {
+		return !a.expiryPaused && isExpired(interval, nowNano, ts)
+	}
 
 	a.metricMap.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
-		if isExpired(a.expiryIntervalCounter, nowNano, counter.Timestamp) {
-			deleteMetric(key, tagsKey, a.metricMap.Counters)
+		if a.held(key) {
+			return // Accumulates until the flush it is sent in
+		}
+		if expired(a.expiryIntervalCounter, counter.Timestamp) {
+			a.deleteCounter(key, tagsKey)
+		} else if a.cumulativeCounters.MatchAny(key) {
+			// Cumulative counters keep accumulating across flushes until they expire
+			counter.PerSecond = 0
+			a.metricMap.Counters[key][tagsKey] = counter
+			bases, ok := a.cumulativeBases[key]
+			if !ok {
+				bases = map[string]float64{}
+				a.cumulativeBases[key] = bases
+			}
+			bases[tagsKey] = a.counterValue(counter)
 		} else {
 			a.metricMap.Counters[key][tagsKey] = gostatsd.Counter{
 				Timestamp: counter.Timestamp,
@@ -229,7 +1197,10 @@ func (a *MetricAggregator) Reset() {
 	})
 
 	a.metricMap.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
-		if isExpired(a.expiryIntervalTimer, nowNano, timer.Timestamp) {
+		if a.held(key) {
+			return // Accumulates until the flush it is sent in
+		}
+		if expired(a.expiryIntervalTimer, timer.Timestamp) {
 			deleteMetric(key, tagsKey, a.metricMap.Timers)
 		} else {
 			if hasHistogramTag(timer) {
@@ -252,14 +1223,25 @@ func (a *MetricAggregator) Reset() {
 	})
 
 	a.metricMap.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
-		if isExpired(a.expiryIntervalGauge, nowNano, gauge.Timestamp) {
-			deleteMetric(key, tagsKey, a.metricMap.Gauges)
+		if a.held(key) {
+			return // Accumulates until the flush it is sent in
+		}
+		if expired(a.expiryIntervalGauge, gauge.Timestamp) {
+			a.deleteGauge(key, tagsKey)
+		} else if gauge.Count > 0 && len(a.averageGauges) > 0 && a.averageGauges.MatchAny(key) {
+			// The mean starts again with the next value received, until then the last mean is kept
+			gauge.Sum = 0
+			gauge.Count = 0
+			a.metricMap.Gauges[key][tagsKey] = gauge
 		}
 		// No reset for gauges, they keep the last value until expiration
 	})
 
 	a.metricMap.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
-		if isExpired(a.expiryIntervalSet, nowNano, set.Timestamp) {
+		if a.held(key) {
+			return // Accumulates until the flush it is sent in
+		}
+		if expired(a.expiryIntervalSet, set.Timestamp) {
 			deleteMetric(key, tagsKey, a.metricMap.Sets)
 		} else {
 			a.metricMap.Sets[key][tagsKey] = gostatsd.Set{
@@ -275,5 +1257,69 @@ func (a *MetricAggregator) Reset() {
 // ReceiveMap takes a single metric map and will aggregate the values
 func (a *MetricAggregator) ReceiveMap(mm *gostatsd.MetricMap) {
 	a.metricMapsReceived++
+	if len(a.untaggedMetrics) > 0 {
+		mm = a.untag(mm)
+	}
+	for _, r := range a.rollups {
+		r.aggregator.ReceiveMap(r.tagged(mm))
+	}
 	a.metricMap.Merge(mm)
+	if len(a.approximateSets) > 0 {
+		a.estimateSets(mm)
+	}
+	if a.peakRates != nil {
+		a.receivePeakRates(mm)
+	}
+}
+
+// untag returns mm with every series of the untaggedMetrics merged into a single series of the name, without tags or
+// a source, so that their cardinality is bounded.  The values of the merged series may be shared with mm.
+func (a *MetricAggregator) untag(mm *gostatsd.MetricMap) *gostatsd.MetricMap {
+	untagged := gostatsd.NewMetricMap()
+	mm.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+		if a.untaggedMetrics.MatchAny(key) {
+			counter.Tags, counter.Source, tagsKey = nil, "", ""
+		}
+		untagged.MergeCounter(key, tagsKey, counter)
+	})
+	mm.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		if a.untaggedMetrics.MatchAny(key) {
+			gauge.Tags, gauge.Source, tagsKey = nil, "", ""
+		}
+		untagged.MergeGauge(key, tagsKey, gauge)
+	})
+	mm.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		if a.untaggedMetrics.MatchAny(key) {
+			timer.Tags, timer.Source, tagsKey = nil, "", ""
+		}
+		untagged.MergeTimer(key, tagsKey, timer)
+	})
+	mm.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
+		if a.untaggedMetrics.MatchAny(key) {
+			set.Tags, set.Source, tagsKey = nil, "", ""
+		}
+		untagged.MergeSet(key, tagsKey, set)
+	})
+	return untagged
+}
+
+// estimateSets moves the values of the approximate sets received in mm into the Estimator of the set, so that only
+// the fixed size Estimator is kept until the set is flushed.
+func (a *MetricAggregator) estimateSets(mm *gostatsd.MetricMap) {
+	for key, value := range mm.Sets {
+		if !a.approximateSets.MatchAny(key) {
+			continue
+		}
+		for tagsKey := range value {
+			set := a.metricMap.Sets[key][tagsKey]
+			if set.Estimator == nil {
+				set.Estimator = gostatsd.NewHyperLogLog()
+			}
+			for setValue := range set.Values {
+				set.Estimator.Add(setValue)
+			}
+			set.Values = map[string]struct{}{} // The received map may be shared with mm
+			a.metricMap.Sets[key][tagsKey] = set
+		}
+	}
 }
@@ -1,25 +1,39 @@
 package statsd
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/stats"
 )
 
+// newFakeAggregatorConfig returns the AggregatorConfig of newFakeAggregator, for tests to change.
+func newFakeAggregatorConfig() AggregatorConfig {
+	return AggregatorConfig{
+		PercentThresholds:     []float64{90},
+		ExpiryIntervalCounter: 5 * time.Minute,
+		ExpiryIntervalGauge:   5 * time.Minute,
+		ExpiryIntervalSet:     5 * time.Minute,
+		ExpiryIntervalTimer:   5 * time.Minute,
+		HistogramLimit:        math.MaxUint32,
+		PercentileNames:       gostatsd.PercentileNameTemplates["etsy"],
+		MinSamplesPercentiles: 1,
+		PercentileSampleRate:  1,
+	}
+}
+
 func newFakeAggregator() *MetricAggregator {
-	return NewMetricAggregator(
-		[]float64{90},
-		5*time.Minute,
-		5*time.Minute,
-		5*time.Minute,
-		5*time.Minute,
-		gostatsd.TimerSubtypes{},
-		math.MaxUint32,
-	)
+	return NewMetricAggregator(newFakeAggregatorConfig())
 }
 
 func TestNewAggregator(t *testing.T) {
@@ -211,6 +225,72 @@ func BenchmarkFlush(b *testing.B) {
 	}
 }
 
+// BenchmarkFlushTimers flushes a single timer with a varying number of values, which are copied before each flush
+// so that they are not already sorted by the previous one.
+func BenchmarkFlushTimers(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{1, 10, 100, 1000, 10000} {
+		values := make([]float64, size)
+		for i := range values {
+			values[i] = r.Float64() * 1000
+		}
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			ma := newFakeAggregator()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues(append([]float64(nil), values...))}
+				b.StartTimer()
+				ma.Flush(1 * time.Second)
+			}
+		})
+	}
+}
+
+// benchmarkReceiveMap benchmarks the aggregator receiving a MetricMap with 100 series of 10 metrics of one type.
+func benchmarkReceiveMap(b *testing.B, metricType gostatsd.MetricType) {
+	mm := gostatsd.NewMetricMap()
+	for i := 0; i < 100; i++ {
+		mm.Receive(&gostatsd.Metric{
+			Name:        fmt.Sprintf("metric.%d", i%10),
+			Value:       float64(i),
+			StringValue: strconv.Itoa(i),
+			Rate:        1,
+			Tags:        gostatsd.Tags{fmt.Sprintf("series:%d", i/10)},
+			Type:        metricType,
+		})
+	}
+	ma := newFakeAggregator()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if n%1000 == 999 {
+			// Timer values accumulate until the aggregator is reset
+			b.StopTimer()
+			ma.Reset()
+			b.StartTimer()
+		}
+		ma.ReceiveMap(mm)
+	}
+}
+
+func BenchmarkReceiveMapCounter(b *testing.B) {
+	benchmarkReceiveMap(b, gostatsd.COUNTER)
+}
+
+func BenchmarkReceiveMapGauge(b *testing.B) {
+	benchmarkReceiveMap(b, gostatsd.GAUGE)
+}
+
+func BenchmarkReceiveMapTimer(b *testing.B) {
+	benchmarkReceiveMap(b, gostatsd.TIMER)
+}
+
+func BenchmarkReceiveMapSet(b *testing.B) {
+	benchmarkReceiveMap(b, gostatsd.SET)
+}
+
 func TestReset(t *testing.T) {
 	t.Parallel()
 	assrt := assert.New(t)
@@ -446,6 +526,7 @@ func TestDisabledSumSquares(t *testing.T) {
 	ma.disabledSubtypes.SumSquaresPct = true
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Name: "x", Value: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "x", Value: 3, Type: gostatsd.TIMER})
 	ma.ReceiveMap(mm)
 	ma.Flush(1 * time.Second)
 	for _, pct := range ma.metricMap.Timers["x"][""].Percentiles {
@@ -453,6 +534,8 @@ func TestDisabledSumSquares(t *testing.T) {
 			t.Error("sum_squares not disabled")
 		}
 	}
+	// The total sum of squares is still calculated
+	assert.Equal(t, float64(10), ma.metricMap.Timers["x"][""].SumSquares)
 }
 
 func TestDisabledUpper(t *testing.T) {
@@ -472,15 +555,9 @@ func TestDisabledUpper(t *testing.T) {
 
 func TestDisabledLower(t *testing.T) {
 	t.Parallel()
-	ma := NewMetricAggregator(
-		[]float64{-90},
-		5*time.Minute,
-		5*time.Minute,
-		5*time.Minute,
-		5*time.Minute,
-		gostatsd.TimerSubtypes{},
-		math.MaxUint32,
-	)
+	config := newFakeAggregatorConfig()
+	config.PercentThresholds = []float64{-90}
+	ma := NewMetricAggregator(config)
 	ma.disabledSubtypes.LowerPct = true
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Name: "x", Value: 1, Type: gostatsd.TIMER})
@@ -492,3 +569,1067 @@ func TestDisabledLower(t *testing.T) {
 		}
 	}
 }
+
+func TestCardinalityWarn(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.cardinalityWarn = 2
+
+	mm := gostatsd.NewMetricMap()
+	for _, tag := range []string{"a", "b", "c"} {
+		mm.Receive(&gostatsd.Metric{Name: "wide", Value: 1, Rate: 1, Tags: gostatsd.Tags{tag}, Type: gostatsd.COUNTER})
+		mm.Receive(&gostatsd.Metric{Name: "wide", Value: 1, Rate: 1, Tags: gostatsd.Tags{tag}, Type: gostatsd.GAUGE})
+	}
+	mm.Receive(&gostatsd.Metric{Name: "narrow", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+	ma.Flush(1 * time.Second)
+
+	assert.Equal(t, map[seriesName]struct{}{
+		{metricType: gostatsd.COUNTER, name: "wide"}: {},
+		{metricType: gostatsd.GAUGE, name: "wide"}:   {},
+	}, ma.cardinalityWarned)
+
+	// Once expired, the metric name is no longer tracked.
+	ma.metricMap = gostatsd.NewMetricMap()
+	ma.Flush(1 * time.Second)
+	assert.Empty(t, ma.cardinalityWarned)
+}
+
+// gaugeStatser records the last value of each gauge sent to it.
+type gaugeStatser struct {
+	stats.NullStatser
+	gauges map[string]float64
+}
+
+func (gs *gaugeStatser) Gauge(name string, value float64, tags gostatsd.Tags) {
+	gs.gauges[name] = value
+}
+
+func TestIntegerCounters(t *testing.T) {
+	t.Parallel()
+	for _, integer := range []bool{false, true} {
+		ma := newFakeAggregator()
+		ma.integerCounters = integer
+		mm := gostatsd.NewMetricMap()
+		for i := 0; i < 3; i++ {
+			mm.Receive(&gostatsd.Metric{Name: "c", Value: 0.5, Rate: 1, Type: gostatsd.COUNTER})
+		}
+		ma.ReceiveMap(mm)
+		ma.Flush(time.Second)
+		var processed *gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = m
+		})
+
+		counter := processed.Counters["c"][""]
+		if integer {
+			assert.EqualValues(t, 1, counter.Value)
+			assert.Zero(t, counter.Fraction)
+			assert.Equal(t, 1.0, counter.PerSecond)
+		} else {
+			assert.Equal(t, 1.5, counter.Total())
+			assert.Equal(t, 1.5, counter.PerSecond)
+		}
+		assert.Equal(t, 0.5, ma.metricMap.Counters["c"][""].Fraction, integer) // Kept by the aggregator
+	}
+}
+
+func TestCounterTotals(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.counterTotals = toStringMatch([]string{"c", "cum"})
+	ma.cumulativeCounters = toStringMatch([]string{"cum"})
+	ma.cumulativeBases = map[string]map[string]float64{}
+	ma.totals = map[string]map[string]float64{}
+	now := gostatsd.Nanotime(time.Now().UnixNano())
+
+	flush := func(value float64) *gostatsd.MetricMap {
+		ma.Reset() // Before the flush, so the processed counters can be checked
+		mm := gostatsd.NewMetricMap()
+		for _, name := range []string{"c", "cum", "other"} {
+			mm.Receive(&gostatsd.Metric{Name: name, Value: value, Rate: 1, Type: gostatsd.COUNTER, Timestamp: now})
+		}
+		ma.ReceiveMap(mm)
+		ma.Flush(time.Second)
+		var processed *gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = m
+		})
+		return processed
+	}
+
+	processed := flush(2)
+	assert.EqualValues(t, 2, processed.Counters["c"][""].Value)
+	assert.Equal(t, 2.0, processed.Gauges["c.total"][""].Value)
+	assert.Equal(t, 2.0, processed.Gauges["cum.total"][""].Value)
+	assert.NotContains(t, processed.Gauges, "other.total")
+
+	// The total survives Reset, while the counter is the value for the flush
+	processed = flush(3)
+	assert.EqualValues(t, 3, processed.Counters["c"][""].Value)
+	assert.Equal(t, 5.0, processed.Gauges["c.total"][""].Value)
+	assert.Equal(t, 5.0, processed.Gauges["cum.total"][""].Value) // Not counted twice
+	assert.NotContains(t, ma.metricMap.Gauges, "c.total")         // Not kept with the aggregated gauges
+
+	ma.DeleteMetric("c", nil)
+	assert.NotContains(t, ma.totals, "c")
+	processed = flush(1)
+	assert.Equal(t, 1.0, processed.Gauges["c.total"][""].Value)
+}
+
+func TestAverageGauges(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.averageGauges = toStringMatch([]string{"avg.*"})
+	now := gostatsd.Nanotime(time.Now().UnixNano())
+
+	flush := func(values ...float64) gostatsd.Gauges {
+		for i, value := range values {
+			mm := gostatsd.NewMetricMap()
+			for _, name := range []string{"avg.g", "last"} {
+				mm.Receive(&gostatsd.Metric{Name: name, Value: value, Type: gostatsd.GAUGE, Timestamp: now + gostatsd.Nanotime(i)})
+			}
+			ma.ReceiveMap(mm)
+		}
+		ma.Flush(time.Second)
+		var gauges gostatsd.Gauges
+		ma.Process(func(m *gostatsd.MetricMap) {
+			gauges = m.Gauges
+		})
+		ma.Reset()
+		return gauges
+	}
+
+	gauges := flush(1, 2, 6)
+	assert.Equal(t, 3.0, gauges["avg.g"][""].Value)
+	assert.Equal(t, 6.0, gauges["last"][""].Value)
+
+	// A gauge which is not received keeps its last mean, and the mean restarts with the next value
+	gauges = flush()
+	assert.Equal(t, 3.0, gauges["avg.g"][""].Value)
+	gauges = flush(10)
+	assert.Equal(t, 10.0, gauges["avg.g"][""].Value)
+}
+
+func TestPercentileSampleRateZeroValue(t *testing.T) {
+	t.Parallel()
+	ma := NewMetricAggregator(AggregatorConfig{PercentThresholds: []float64{90}})
+	ma.random = func() float64 { return 0.5 }
+	ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{5, 1, 4, 2, 6, 3})}
+	ma.Flush(time.Second)
+	assert.NotEmpty(t, ma.metricMap.Timers["t"][""].Percentiles)
+}
+
+func TestPercentileSampleRate(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.percentileSampleRate = 0.5
+	random := 0.9
+	ma.random = func() float64 { return random }
+
+	flush := func() gostatsd.Timer {
+		ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{5, 1, 4, 2, 6, 3})}
+		ma.Flush(time.Second)
+		return ma.metricMap.Timers["t"][""]
+	}
+
+	// Not sampled, so only the aggregates which don't need the values sorted, and the median
+	timer := flush()
+	assert.Nil(t, timer.Percentiles)
+	assert.Equal(t, 1.0, timer.Min)
+	assert.Equal(t, 6.0, timer.Max)
+	assert.Equal(t, 3.5, timer.Median)
+	assert.Equal(t, 3.5, timer.Mean)
+	assert.Equal(t, 21.0, timer.Sum)
+	assert.Equal(t, 91.0, timer.SumSquares)
+	assert.InDelta(t, math.Sqrt(17.5/6), timer.StdDev, 1e-9)
+	assert.Equal(t, 6, timer.Count)
+	assert.Equal(t, 6.0, timer.PerSecond)
+
+	random = 0.1
+	sampled := flush()
+	assert.NotNil(t, sampled.Percentiles)
+	sampled.Percentiles = nil
+	sampled.Values = timer.Values
+	assert.Equal(t, timer, sampled) // The aggregates are the same either way
+}
+
+func TestSummariseTimerMedian(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	for n := 1; n < 50; n++ {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(r.Intn(10)) // Many duplicates
+		}
+		timer := gostatsd.NewTimerValues(values)
+		summariseTimer(&timer)
+
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		expected := sorted[n/2]
+		if n%2 == 0 {
+			expected = (sorted[n/2-1] + sorted[n/2]) / 2
+		}
+		assert.Equal(t, expected, timer.Median, "n=%d", n)
+		assert.ElementsMatch(t, sorted, timer.Values, "n=%d", n)
+	}
+}
+
+func TestUntaggedMetrics(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.untaggedMetrics = toStringMatch([]string{"noisy.*"})
+	ma.approximateSets = toStringMatch([]string{"noisy.approx"})
+	mm := gostatsd.NewMetricMap()
+	for i := 0; i < 3; i++ {
+		tags := gostatsd.Tags{"request:" + strconv.Itoa(i)}
+		source := gostatsd.Source("host" + strconv.Itoa(i))
+		mm.Receive(&gostatsd.Metric{Name: "noisy.c", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: tags, Source: source})
+		mm.Receive(&gostatsd.Metric{Name: "noisy.g", Value: float64(i), Rate: 1, Type: gostatsd.GAUGE, Tags: tags, Source: source, Timestamp: gostatsd.Nanotime(i)})
+		mm.Receive(&gostatsd.Metric{Name: "noisy.t", Value: float64(i), Rate: 1, Type: gostatsd.TIMER, Tags: tags, Source: source})
+		mm.Receive(&gostatsd.Metric{Name: "noisy.s", StringValue: strconv.Itoa(i), Rate: 1, Type: gostatsd.SET, Tags: tags, Source: source})
+		mm.Receive(&gostatsd.Metric{Name: "noisy.approx", StringValue: strconv.Itoa(i), Rate: 1, Type: gostatsd.SET, Tags: tags})
+		mm.Receive(&gostatsd.Metric{Name: "kept", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: tags})
+	}
+	ma.ReceiveMap(mm)
+
+	require.Len(t, ma.metricMap.Counters["noisy.c"], 1)
+	counter := ma.metricMap.Counters["noisy.c"][""]
+	assert.EqualValues(t, 3, counter.Value)
+	assert.Nil(t, counter.Tags)
+	assert.Empty(t, counter.Source)
+	require.Len(t, ma.metricMap.Gauges["noisy.g"], 1)
+	assert.Equal(t, 2.0, ma.metricMap.Gauges["noisy.g"][""].Value)
+	require.Len(t, ma.metricMap.Timers["noisy.t"], 1)
+	assert.ElementsMatch(t, []float64{0, 1, 2}, ma.metricMap.Timers["noisy.t"][""].Values)
+	require.Len(t, ma.metricMap.Sets["noisy.s"], 1)
+	assert.Equal(t, 3, ma.metricMap.Sets["noisy.s"][""].Count())
+	require.Len(t, ma.metricMap.Sets["noisy.approx"], 1)
+	assert.NotNil(t, ma.metricMap.Sets["noisy.approx"][""].Estimator)
+	assert.Len(t, ma.metricMap.Counters["kept"], 3)
+}
+
+func TestCounterPeakRates(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.peakRateCounters = toStringMatch([]string{"peak.*"})
+	ma.peakRateWindow = 100 * time.Millisecond
+	ma.peakRates = map[string]map[string]bucket{}
+	start := gostatsd.Nanotime(time.Now().Truncate(time.Second).UnixNano())
+
+	receive := func(offset time.Duration, value float64) {
+		mm := gostatsd.NewMetricMap()
+		for _, name := range []string{"peak.c", "other"} {
+			mm.Receive(&gostatsd.Metric{Name: name, Value: value, Rate: 1, Type: gostatsd.COUNTER, Timestamp: start + gostatsd.Nanotime(offset)})
+		}
+		ma.ReceiveMap(mm)
+	}
+	flush := func() gostatsd.Gauges {
+		ma.Flush(time.Second)
+		var gauges gostatsd.Gauges
+		ma.Process(func(m *gostatsd.MetricMap) {
+			gauges = m.Gauges
+		})
+		ma.Reset()
+		return gauges
+	}
+
+	receive(0, 1)
+	receive(50*time.Millisecond, 2)   // Same sub-window, 3 in total
+	receive(150*time.Millisecond, 10) // The peak
+	receive(120*time.Millisecond, 1)  // Delayed, so added to the current sub-window
+	receive(900*time.Millisecond, 5)
+	gauges := flush()
+	assert.Equal(t, 110.0, gauges["peak.c.peak_per_second"][""].Value)
+	assert.NotContains(t, gauges, "other.peak_per_second")
+	assert.NotContains(t, ma.metricMap.Gauges, "peak.c.peak_per_second") // Not kept with the aggregated gauges
+
+	// Each flush has its own peak, including the current sub-window
+	receive(time.Second, 2)
+	gauges = flush()
+	assert.Equal(t, 20.0, gauges["peak.c.peak_per_second"][""].Value)
+	assert.NotContains(t, flush(), "peak.c.peak_per_second") // Nothing received
+}
+
+func TestPercentileTags(t *testing.T) {
+	t.Parallel()
+	config := newFakeAggregatorConfig()
+	config.PercentThresholds = []float64{90, -90}
+	config.DisabledSubtypes = gostatsd.TimerSubtypes{MeanPct: true, SumPct: true}
+	config.PercentileNames = gostatsd.PercentileNameTemplates["datadog"]
+	config.PercentileTags = true
+	ma := NewMetricAggregator(config)
+	now := gostatsd.Nanotime(time.Now().UnixNano())
+	mm := gostatsd.NewMetricMap()
+	for _, value := range []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10} {
+		mm.Receive(&gostatsd.Metric{Name: "t", Value: value, Rate: 1, Type: gostatsd.TIMER, Tags: gostatsd.Tags{"a:b"}, Source: "s", Timestamp: now})
+	}
+	ma.ReceiveMap(mm)
+	ma.Flush(time.Second)
+
+	var processed *gostatsd.MetricMap
+	ma.Process(func(m *gostatsd.MetricMap) {
+		processed = m
+	})
+	timer := processed.Timers["t"]["a:b,s:s"]
+	assert.Empty(t, timer.Percentiles)
+	assert.Equal(t, 10.0, timer.Max)                                    // The aggregation is unchanged
+	assert.NotEmpty(t, ma.metricMap.Timers["t"]["a:b,s:s"].Percentiles) // The aggregated timer is not modified
+
+	values := map[string]float64{}
+	for _, gauge := range processed.Gauges["t.percentile"] {
+		assert.Equal(t, gostatsd.Source("s"), gauge.Source)
+		values[strings.Join(gauge.Tags, ",")] = gauge.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"a:b,percentile:90,stat:count":        9,
+		"a:b,percentile:90,stat:sum_squares":  285,
+		"a:b,percentile:90,stat:upper":        9,
+		"a:b,percentile:-90,stat:count":       9,
+		"a:b,percentile:-90,stat:sum_squares": 384,
+		"a:b,percentile:-90,stat:lower":       2,
+	}, values)
+}
+
+func TestMetricTypeTags(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.typeTags = true
+	now := gostatsd.Nanotime(time.Now().UnixNano())
+	mm := gostatsd.NewMetricMap()
+	for _, metricType := range []gostatsd.MetricType{gostatsd.COUNTER, gostatsd.TIMER, gostatsd.GAUGE, gostatsd.SET} {
+		mm.Receive(&gostatsd.Metric{Name: "m", Value: 1, StringValue: "a", Rate: 1, Type: metricType, Tags: gostatsd.Tags{"a:b"}, Timestamp: now})
+	}
+	ma.ReceiveMap(mm)
+	ma.Flush(time.Second)
+
+	var processed *gostatsd.MetricMap
+	ma.Process(func(m *gostatsd.MetricMap) {
+		processed = m
+	})
+	assert.Equal(t, gostatsd.Tags{"a:b", "metric_type:counter"}, processed.Counters["m"]["a:b,metric_type:counter"].Tags)
+	assert.Equal(t, gostatsd.Tags{"a:b", "metric_type:timer"}, processed.Timers["m"]["a:b,metric_type:timer"].Tags)
+	assert.Equal(t, gostatsd.Tags{"a:b", "metric_type:gauge"}, processed.Gauges["m"]["a:b,metric_type:gauge"].Tags)
+	assert.Equal(t, gostatsd.Tags{"a:b", "metric_type:set"}, processed.Sets["m"]["a:b,metric_type:set"].Tags)
+	assert.Equal(t, gostatsd.Tags{"a:b"}, ma.metricMap.Counters["m"]["a:b"].Tags) // The aggregated counter is not modified
+}
+
+func TestCounterOverflow(t *testing.T) {
+	t.Parallel()
+	for _, drop := range []bool{false, true} {
+		ma := newFakeAggregator()
+		ma.dropCounterOverflows = drop
+		statser := &flushStatser{gaugeStatser: gaugeStatser{gauges: map[string]float64{}}, counts: map[string]float64{}}
+		ma.statser = statser
+
+		// Each map is within int64, but the total over the flush isn't
+		for i := 0; i < 3; i++ {
+			mm := gostatsd.NewMetricMap()
+			mm.Receive(&gostatsd.Metric{Name: "big", Value: math.MaxInt64 / 2, Rate: 1, Type: gostatsd.COUNTER})
+			mm.Receive(&gostatsd.Metric{Name: "small", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+			ma.ReceiveMap(mm)
+		}
+		ma.Flush(time.Second)
+		var processed *gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = m
+		})
+
+		assert.Equal(t, 1.0, statser.counts["aggregator.counter_overflows"], drop)
+		assert.EqualValues(t, 3, processed.Counters["small"][""].Value, drop)
+		if drop {
+			assert.NotContains(t, processed.Counters, "big")
+		} else {
+			assert.EqualValues(t, math.MaxInt64, processed.Counters["big"][""].Value)
+			assert.True(t, processed.Counters["big"][""].PerSecond > 0)
+		}
+	}
+}
+
+func TestFlushSeriesByType(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	statser := &gaugeStatser{gauges: map[string]float64{}}
+	ma.statser = statser
+
+	mm := gostatsd.NewMetricMap()
+	for _, tag := range []string{"a", "b", "c"} {
+		mm.Receive(&gostatsd.Metric{Name: "c1", Value: 1, Rate: 1, Tags: gostatsd.Tags{tag}, Type: gostatsd.COUNTER})
+	}
+	mm.Receive(&gostatsd.Metric{Name: "c2", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Tags: gostatsd.Tags{"a"}, Type: gostatsd.GAUGE})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Tags: gostatsd.Tags{"b"}, Type: gostatsd.GAUGE})
+	ma.ReceiveMap(mm)
+	ma.Flush(1 * time.Second)
+
+	assert.Equal(t, map[string]float64{
+		"aggregator.metricmaps_received": 1,
+		"aggregator.series":              7,
+		"aggregator.counter_series":      4,
+		"aggregator.timer_series":        1,
+		"aggregator.gauge_series":        2,
+		"aggregator.set_series":          0,
+	}, statser.gauges)
+}
+
+func TestFlushSanitizesNonNumeric(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: math.Inf(1), Rate: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: math.NaN(), Rate: 1, Type: gostatsd.GAUGE})
+	ma.ReceiveMap(mm)
+	ma.Flush(1 * time.Second)
+
+	timer := ma.metricMap.Timers["t"][""]
+	assert.Equal(t, 1.0, timer.Min)
+	assert.Equal(t, math.MaxFloat64, timer.Max)
+	assert.Equal(t, math.MaxFloat64, timer.Mean)
+	assert.Equal(t, -1.0, timer.StdDev) // Inf - Inf is NaN
+	for _, pct := range timer.Percentiles {
+		assert.False(t, math.IsNaN(pct.Float) || math.IsInf(pct.Float, 0), pct.Str)
+	}
+	assert.Equal(t, -1.0, ma.metricMap.Gauges["g"][""].Value)
+}
+
+func TestFlushPerSecond(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		flushInterval    time.Duration
+		disablePerSecond bool
+		counterRate      float64
+		timerRate        float64
+	}{
+		{name: "one second", flushInterval: 1 * time.Second, counterRate: 5, timerRate: 3},
+		{name: "sub second", flushInterval: 250 * time.Millisecond, counterRate: 20, timerRate: 12},
+		{name: "multi second", flushInterval: 10 * time.Second, counterRate: 0.5, timerRate: 0.3},
+		{name: "zero interval", flushInterval: 0},
+		{name: "disabled", flushInterval: 250 * time.Millisecond, disablePerSecond: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ma := newFakeAggregator()
+			ma.disablePerSecond = test.disablePerSecond
+			ma.metricMap.Counters["c"] = map[string]gostatsd.Counter{"": {Value: 5}}
+			ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{1, 2, 3})}
+
+			ma.Flush(test.flushInterval)
+
+			counter := ma.metricMap.Counters["c"][""]
+			assert.EqualValues(t, 5, counter.Value)
+			assert.Equal(t, test.counterRate, counter.PerSecond)
+			timer := ma.metricMap.Timers["t"][""]
+			assert.Equal(t, 3, timer.Count)
+			assert.Equal(t, test.timerRate, timer.PerSecond)
+		})
+	}
+}
+
+func TestFlushNegativeValues(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: -4, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: -2, Rate: 1, Type: gostatsd.GAUGE})
+	ma.ReceiveMap(mm)
+	mm = gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+
+	ma.Flush(2 * time.Second)
+
+	counter := ma.metricMap.Counters["c"][""]
+	assert.EqualValues(t, -3, counter.Value)
+	assert.Equal(t, -1.5, counter.PerSecond)
+	assert.Equal(t, -2.0, ma.metricMap.Gauges["g"][""].Value)
+}
+
+func TestCounterEvents(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.counterEvents = true
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 5, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 0.1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 2, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+
+	ma.Flush(2 * time.Second)
+	var processed *gostatsd.MetricMap
+	ma.Process(func(m *gostatsd.MetricMap) {
+		processed = m
+	})
+	assert.EqualValues(t, 17, processed.Counters["c"][""].Value)
+	assert.EqualValues(t, 3, processed.Counters["c.events"][""].Value)
+	assert.Equal(t, 1.5, processed.Counters["c.events"][""].PerSecond)
+
+	// The events counter is not retained by the aggregator
+	ma.Reset()
+	assert.NotContains(t, ma.metricMap.Counters, "c.events")
+	ma.Flush(2 * time.Second)
+	ma.Process(func(m *gostatsd.MetricMap) {
+		processed = m
+	})
+	assert.EqualValues(t, 0, processed.Counters["c.events"][""].Value)
+}
+
+func TestSetSuffix(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.setSuffix = ".count"
+
+	mm := gostatsd.NewMetricMap()
+	for _, value := range []string{"a", "b", "c", "a"} {
+		mm.Receive(&gostatsd.Metric{Name: "users", StringValue: value, Rate: 1, Type: gostatsd.SET})
+	}
+	ma.ReceiveMap(mm)
+
+	ma.Flush(time.Second)
+	var processed *gostatsd.MetricMap
+	ma.Process(func(m *gostatsd.MetricMap) {
+		processed = m
+	})
+	require.Contains(t, processed.Sets, "users.count")
+	assert.NotContains(t, processed.Sets, "users")
+	assert.Len(t, processed.Sets["users.count"][""].Values, 3)
+
+	// The aggregator keeps the set under its received name
+	assert.Contains(t, ma.metricMap.Sets, "users")
+	assert.NotContains(t, ma.metricMap.Sets, "users.count")
+}
+
+func TestDownsample(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.downsamples = DownsampleRules{{MatchMetrics: toStringMatch([]string{"slow.*"}), Every: 3}}
+
+	for i := 1; i <= 3; i++ {
+		mm := gostatsd.NewMetricMap()
+		for _, name := range []string{"slow.c", "fast.c"} {
+			mm.Receive(&gostatsd.Metric{Name: name, Value: 2, Rate: 1, Type: gostatsd.COUNTER})
+			mm.Receive(&gostatsd.Metric{Name: name, Value: float64(i), Rate: 1, Type: gostatsd.TIMER})
+		}
+		ma.ReceiveMap(mm)
+
+		ma.Flush(time.Second)
+		var processed *gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = m
+		})
+
+		assert.EqualValues(t, 2, processed.Counters["fast.c"][""].Value)
+		assert.Equal(t, 2.0, processed.Counters["fast.c"][""].PerSecond)
+		assert.Equal(t, 1, processed.Timers["fast.c"][""].Count)
+		if i < 3 {
+			assert.NotContains(t, processed.Counters, "slow.c", i)
+			assert.NotContains(t, processed.Timers, "slow.c", i)
+			ma.Reset()
+			continue
+		}
+
+		// Accumulated over the 3 flushes, with the rate over all of them
+		assert.EqualValues(t, 6, processed.Counters["slow.c"][""].Value)
+		assert.Equal(t, 2.0, processed.Counters["slow.c"][""].PerSecond)
+		slow := processed.Timers["slow.c"][""]
+		assert.Equal(t, 3, slow.Count)
+		assert.Equal(t, 1.0, slow.PerSecond)
+		assert.Equal(t, 1.0, slow.Min)
+		assert.Equal(t, 3.0, slow.Max)
+		assert.Len(t, slow.Percentiles, 5) // Calculated once, when sent
+		ma.Reset()
+	}
+	assert.EqualValues(t, 0, ma.metricMap.Counters["slow.c"][""].Value) // Reset once sent
+}
+
+func TestRollups(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.rollups = []*rollupAggregator{{
+		Rollup:     Rollup{Interval: 3 * time.Second, Every: 3},
+		tag:        "rollup:3s",
+		aggregator: newFakeAggregator(),
+	}}
+
+	for i := 1; i <= 3; i++ {
+		mm := gostatsd.NewMetricMap()
+		now := gostatsd.Nanotime(time.Now().UnixNano())
+		mm.Receive(&gostatsd.Metric{Name: "c", Value: 2, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"a:b"}, Timestamp: now})
+		mm.Receive(&gostatsd.Metric{Name: "t", Value: float64(i), Rate: 1, Type: gostatsd.TIMER, Timestamp: now})
+		mm.Receive(&gostatsd.Metric{Name: "s", StringValue: strconv.Itoa(i), Rate: 1, Type: gostatsd.SET, Timestamp: now})
+		ma.ReceiveMap(mm)
+
+		ma.Flush(time.Second)
+		var processed []*gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = append(processed, m)
+		})
+
+		assert.EqualValues(t, 2, processed[0].Counters["c"]["a:b"].Value)
+		assert.Equal(t, 1, processed[0].Timers["t"][""].Count)
+		assert.Equal(t, 1, processed[0].Sets["s"][""].Count())
+		if i < 3 {
+			assert.Len(t, processed, 1, i)
+			ma.Reset()
+			continue
+		}
+
+		// Aggregated over the 3 flushes, with the rate over all of them
+		require.Len(t, processed, 2)
+		rollup := processed[1]
+		counter := rollup.Counters["c"]["a:b,rollup:3s"]
+		assert.EqualValues(t, 6, counter.Value)
+		assert.Equal(t, 2.0, counter.PerSecond)
+		assert.Equal(t, gostatsd.Tags{"a:b", "rollup:3s"}, counter.Tags)
+		timer := rollup.Timers["t"]["rollup:3s"]
+		assert.Equal(t, 3, timer.Count)
+		assert.Equal(t, 1.0, timer.Min)
+		assert.Equal(t, 3.0, timer.Max)
+		assert.Equal(t, 3, rollup.Sets["s"]["rollup:3s"].Count())
+		ma.Reset()
+	}
+	rollup := ma.rollups[0].aggregator.metricMap
+	require.Contains(t, rollup.Counters["c"], "a:b,rollup:3s")
+	assert.EqualValues(t, 0, rollup.Counters["c"]["a:b,rollup:3s"].Value) // Reset once sent
+	assert.False(t, ma.rollups[0].flushed)
+
+	// Deleting a metric deletes it from the rollups too
+	assert.Equal(t, 2, ma.DeleteMetric("c", gostatsd.Tags{"a:b"}))
+	assert.Equal(t, 2, ma.DeleteMetric("t", nil))
+	assert.Empty(t, rollup.Counters)
+	assert.Empty(t, rollup.Timers)
+}
+
+func TestApproximateSets(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.approximateSets = toStringMatch([]string{"users.*"})
+
+	for batch := 0; batch < 10; batch++ {
+		mm := gostatsd.NewMetricMap()
+		for i := 0; i < 1000; i++ {
+			value := strconv.Itoa(batch*1000 + i)
+			mm.Receive(&gostatsd.Metric{Name: "users.approximate", StringValue: value, Rate: 1, Type: gostatsd.SET})
+			mm.Receive(&gostatsd.Metric{Name: "exact", StringValue: value, Rate: 1, Type: gostatsd.SET})
+		}
+		ma.ReceiveMap(mm)
+	}
+
+	approximate := ma.metricMap.Sets["users.approximate"][""]
+	assert.Empty(t, approximate.Values)
+	assert.InEpsilon(t, 10000, approximate.Count(), 0.05)
+	exact := ma.metricMap.Sets["exact"][""]
+	assert.Nil(t, exact.Estimator)
+	assert.Equal(t, 10000, exact.Count())
+
+	ma.Flush(time.Second)
+	ma.Reset()
+	assert.Equal(t, 0, ma.metricMap.Sets["users.approximate"][""].Count())
+}
+
+func TestFlushLinearPercentiles(t *testing.T) {
+	t.Parallel()
+	for _, linear := range []bool{false, true} {
+		linear := linear
+		t.Run(strconv.FormatBool(linear), func(t *testing.T) {
+			t.Parallel()
+			config := newFakeAggregatorConfig()
+			config.PercentThresholds = []float64{90, -90}
+			config.LinearPercentiles = linear
+			ma := NewMetricAggregator(config)
+			ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100})}
+
+			ma.Flush(time.Second)
+
+			timer := ma.metricMap.Timers["t"][""]
+			pcts := map[string]float64{}
+			for _, p := range timer.Percentiles {
+				pcts[p.Str] = p.Float
+			}
+			// Count, sum, and mean are always based on the nearest rank
+			assert.Equal(t, 9.0, pcts["count_90"])
+			assert.Equal(t, 450.0, pcts["sum_90"])
+			if linear {
+				assert.InDelta(t, 91.0, pcts["upper_90"], 1e-9)
+				assert.InDelta(t, 19.0, pcts["lower_-90"], 1e-9)
+			} else {
+				assert.Equal(t, 90.0, pcts["upper_90"])
+				assert.Equal(t, 20.0, pcts["lower_-90"])
+			}
+		})
+	}
+}
+
+func TestLinearPercentile(t *testing.T) {
+	t.Parallel()
+	values := []float64{10, 20, 30, 40}
+	assert.Equal(t, 10.0, linearPercentile(values, 0))
+	assert.Equal(t, 25.0, linearPercentile(values, 0.5))
+	assert.InDelta(t, 39.7, linearPercentile(values, 0.99), 1e-9)
+	assert.Equal(t, 40.0, linearPercentile(values, 1))
+	assert.Equal(t, 5.0, linearPercentile([]float64{5}, 0.9))
+}
+
+func TestCumulativeCounters(t *testing.T) {
+	t.Parallel()
+	config := newFakeAggregatorConfig()
+	config.CumulativeCounters = []string{"total.*"}
+	ma := NewMetricAggregator(config)
+
+	for i, value := range []float64{5, 3} {
+		now := gostatsd.Nanotime(time.Now().UnixNano())
+		mm := gostatsd.NewMetricMap()
+		mm.Receive(&gostatsd.Metric{Name: "total.requests", Value: value, Rate: 1, Type: gostatsd.COUNTER, Timestamp: now})
+		mm.Receive(&gostatsd.Metric{Name: "requests", Value: value, Rate: 1, Type: gostatsd.COUNTER, Timestamp: now})
+		ma.ReceiveMap(mm)
+		ma.Flush(2 * time.Second)
+
+		cumulative := ma.metricMap.Counters["total.requests"][""]
+		assert.EqualValues(t, []int64{5, 8}[i], cumulative.Value)
+		assert.Equal(t, value/2, cumulative.PerSecond) // The rate of the increase in this flush
+		counter := ma.metricMap.Counters["requests"][""]
+		assert.EqualValues(t, value, counter.Value)
+		assert.Equal(t, value/2, counter.PerSecond)
+
+		ma.Reset()
+	}
+
+	// Nothing received, so the rate is 0 while the value is kept
+	ma.Flush(2 * time.Second)
+	assert.EqualValues(t, 8, ma.metricMap.Counters["total.requests"][""].Value)
+	assert.Zero(t, ma.metricMap.Counters["total.requests"][""].PerSecond)
+
+	ma.DeleteMetric("total.requests", nil)
+	assert.Empty(t, ma.cumulativeBases)
+}
+
+func TestPercentileNames(t *testing.T) {
+	t.Parallel()
+	config := newFakeAggregatorConfig()
+	config.PercentThresholds = []float64{90, -90}
+	config.PercentileNames = "p{pct}"
+	ma := NewMetricAggregator(config)
+	ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100})}
+
+	ma.Flush(time.Second)
+
+	pcts := map[string]float64{}
+	for _, p := range ma.metricMap.Timers["t"][""].Percentiles {
+		pcts[p.Str] = p.Float
+	}
+	assert.Equal(t, 90.0, pcts["p90"])
+	assert.Equal(t, 20.0, pcts["p-90"])
+	assert.Contains(t, pcts, "count_90")
+	assert.NotContains(t, pcts, "upper_90")
+}
+
+func TestPercentileMinSamples(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.minSamplesPercentiles = 3
+	ma.metricMap.Timers["few"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{10, 20})}
+	ma.metricMap.Timers["enough"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues([]float64{10, 20, 30})}
+
+	ma.Flush(time.Second)
+
+	few := ma.metricMap.Timers["few"][""]
+	assert.Empty(t, few.Percentiles)
+	assert.Equal(t, 2, few.Count)
+	assert.Equal(t, 10.0, few.Min)
+	assert.Equal(t, 20.0, few.Max)
+	assert.Equal(t, 15.0, few.Mean)
+	assert.NotEmpty(t, ma.metricMap.Timers["enough"][""].Percentiles)
+}
+
+func TestFlushTimerCount(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	for _, value := range []float64{5, 1, 3, 3} {
+		mm.Receive(&gostatsd.Metric{Name: "foo", Value: value, Rate: 1, Type: gostatsd.TIMER})
+	}
+	ma.ReceiveMap(mm)
+	ma.Flush(1 * time.Second)
+
+	// The count is the total number of samples, separate from the count_90 percentile
+	timer := ma.metricMap.Timers["foo"][""]
+	assert.Equal(t, 4, timer.Count)
+	assert.Contains(t, timer.Percentiles, gostatsd.Percentile{Float: 4, Str: "count_90"})
+
+	// And is kept when the flushed metrics are split between backends
+	for _, split := range ma.metricMap.Split(2) {
+		if timers, ok := split.Timers["foo"]; ok {
+			assert.Equal(t, 4, timers[""].Count)
+		}
+	}
+}
+
+func TestPercentileBoundaries(t *testing.T) {
+	t.Parallel()
+	// Expected values are from the reference statsd implementation, which rounds halves up, for the values 1 to n.
+	tests := []struct {
+		n        int
+		pct      float64
+		count    float64
+		boundary float64
+	}{
+		{n: 1, pct: 90, count: 1, boundary: 1},
+		{n: 2, pct: 25, count: 1, boundary: 1},    // 0.5 rounds up
+		{n: 3, pct: 50, count: 2, boundary: 2},    // 1.5 rounds up
+		{n: 4, pct: 90, count: 4, boundary: 4},    // 3.6 rounds up
+		{n: 5, pct: 10, count: 1, boundary: 1},    // 0.5 rounds up
+		{n: 5, pct: 90, count: 5, boundary: 5},    // 4.5 rounds up
+		{n: 15, pct: 90, count: 14, boundary: 14}, // 13.5 rounds up
+		{n: 20, pct: 99, count: 20, boundary: 20}, // 19.8 rounds up
+		{n: 20, pct: 97, count: 19, boundary: 19}, // 19.4 rounds down
+		{n: 5, pct: -90, count: 5, boundary: 1},
+		{n: 3, pct: -50, count: 2, boundary: 2},
+		{n: 10, pct: 4, count: 0}, // 0.4 rounds down, so the percentile is not sent
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(fmt.Sprintf("%d/%v", test.n, test.pct), func(t *testing.T) {
+			t.Parallel()
+			config := newFakeAggregatorConfig()
+			config.PercentThresholds = []float64{test.pct}
+			ma := NewMetricAggregator(config)
+			values := make([]float64, 0, test.n)
+			for i := 1; i <= test.n; i++ {
+				values = append(values, float64(i))
+			}
+			ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues(values)}
+			ma.Flush(time.Second)
+
+			pcts := map[string]float64{}
+			for _, p := range ma.metricMap.Timers["t"][""].Percentiles {
+				pcts[p.Str] = p.Float
+			}
+			sPct := strconv.Itoa(int(test.pct))
+			if test.count == 0 {
+				assert.Empty(t, pcts)
+				return
+			}
+			assert.Equal(t, test.count, pcts["count_"+sPct])
+			if test.pct > 0 {
+				assert.Equal(t, test.boundary, pcts["upper_"+sPct])
+			} else {
+				assert.Equal(t, test.boundary, pcts["lower_"+sPct])
+			}
+		})
+	}
+}
+
+func TestPercentileTinyTimers(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		values []float64
+		want   map[string]float64
+	}{
+		{
+			// A single value is sent for every threshold, even those which would round to no values.
+			values: []float64{7},
+			want: map[string]float64{
+				"count_90": 1, "mean_90": 7, "sum_90": 7, "sum_squares_90": 49, "upper_90": 7,
+				"count_10": 1, "mean_10": 7, "sum_10": 7, "sum_squares_10": 49, "upper_10": 7,
+				"count_-90": 1, "mean_-90": 7, "sum_-90": 7, "sum_squares_-90": 49, "lower_-90": 7,
+				"count_-10": 1, "mean_-10": 7, "sum_-10": 7, "sum_squares_-10": 49, "lower_-10": 7,
+			},
+		},
+		{
+			// 90% of 2 rounds to both values, 10% rounds to none so is not sent.
+			values: []float64{8, 2},
+			want: map[string]float64{
+				"count_90": 2, "mean_90": 5, "sum_90": 10, "sum_squares_90": 68, "upper_90": 8,
+				"count_-90": 2, "mean_-90": 5, "sum_-90": 10, "sum_squares_-90": 68, "lower_-90": 2,
+			},
+		},
+	}
+	for _, test := range tests {
+		config := newFakeAggregatorConfig()
+		config.PercentThresholds = []float64{90, 10, -90, -10}
+		ma := NewMetricAggregator(config)
+		ma.metricMap.Timers["t"] = map[string]gostatsd.Timer{"": gostatsd.NewTimerValues(test.values)}
+		ma.Flush(time.Second)
+
+		pcts := map[string]float64{}
+		for _, p := range ma.metricMap.Timers["t"][""].Percentiles {
+			pcts[p.Str] = p.Float
+		}
+		assert.Equal(t, test.want, pcts, "%v", test.values)
+	}
+}
+
+func TestFlushNegativePercentiles(t *testing.T) {
+	t.Parallel()
+	for _, n := range []int{1, 2, 3, 4, 20, 1000} {
+		for _, pct := range []float64{-95, -50, -100} {
+			n, pct := n, pct
+			t.Run(fmt.Sprintf("%d/%v", n, pct), func(t *testing.T) {
+				t.Parallel()
+				config := newFakeAggregatorConfig()
+				config.PercentThresholds = []float64{pct}
+				ma := NewMetricAggregator(config)
+
+				// Values are received in reverse order, so they must be sorted
+				mm := gostatsd.NewMetricMap()
+				values := make([]float64, 0, n)
+				for i := n; i > 0; i-- {
+					values = append(values, float64(i))
+					mm.Receive(&gostatsd.Metric{Name: "t", Value: float64(i), Rate: 1, Type: gostatsd.TIMER})
+				}
+				ma.ReceiveMap(mm)
+				ma.Flush(time.Second)
+
+				// Reference implementation: the threshold covers the largest values
+				sort.Float64s(values)
+				count := n
+				if n > 1 {
+					count = int(math.Floor(math.Abs(pct)/100*float64(n) + 0.5))
+				}
+				top := values[n-count:]
+				var sum, sumSquares float64
+				for _, v := range top {
+					sum += v
+					sumSquares += v * v
+				}
+				s := strconv.FormatFloat(pct, 'f', -1, 64)
+				expected := gostatsd.Percentiles{}
+				expected.Set("count_"+s, float64(count))
+				expected.Set("mean_"+s, sum/float64(count))
+				expected.Set("sum_"+s, sum)
+				expected.Set("sum_squares_"+s, sumSquares)
+				expected.Set("lower_"+s, top[0])
+				assert.ElementsMatch(t, expected, ma.metricMap.Timers["t"][""].Percentiles)
+			})
+		}
+	}
+}
+
+func TestChangedGaugesOnly(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	ma.changedGaugesOnly = true
+	ma.sentGauges = map[string]map[string]float64{}
+	now := time.Now()
+	ma.now = func() time.Time { return now }
+
+	receive := func(name string, value float64) {
+		now = now.Add(time.Millisecond) // The newest value of a gauge is kept
+		mm := gostatsd.NewMetricMap()
+		mm.Receive(&gostatsd.Metric{Name: name, Value: value, Rate: 1, Timestamp: gostatsd.Nanotime(now.UnixNano()), Type: gostatsd.GAUGE})
+		ma.ReceiveMap(mm)
+	}
+	flush := func() gostatsd.Gauges {
+		var gauges gostatsd.Gauges
+		ma.Flush(time.Second)
+		ma.Process(func(mm *gostatsd.MetricMap) {
+			gauges = mm.Gauges
+		})
+		ma.Reset()
+		return gauges
+	}
+
+	// The first flush always sends
+	receive("a", 1)
+	receive("b", 1)
+	gauges := flush()
+	assert.Len(t, gauges, 2)
+
+	// Unchanged gauges are not sent, whether or not they were received again
+	receive("a", 1)
+	receive("b", 2)
+	gauges = flush()
+	assert.Len(t, gauges, 1)
+	assert.Equal(t, float64(2), gauges["b"][""].Value)
+	assert.Empty(t, flush())
+	assert.Len(t, ma.metricMap.Gauges, 2) // Still held until expiry
+
+	// An expired gauge is sent again when it is next received
+	now = now.Add(10 * time.Minute)
+	assert.Empty(t, flush())
+	assert.Empty(t, ma.metricMap.Gauges)
+	assert.Empty(t, ma.sentGauges)
+	receive("a", 1)
+	gauges = flush()
+	assert.Len(t, gauges, 1)
+	assert.Equal(t, float64(1), gauges["a"][""].Value)
+}
+
+func TestDeleteMetric(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	for _, tags := range []gostatsd.Tags{{"a:1", "b:2"}, {"a:2"}} {
+		mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Tags: tags, Type: gostatsd.COUNTER})
+		mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Tags: tags, Type: gostatsd.TIMER})
+		mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Tags: tags, Type: gostatsd.GAUGE})
+		mm.Receive(&gostatsd.Metric{Name: "s", StringValue: "x", Rate: 1, Tags: tags, Type: gostatsd.SET})
+	}
+	ma.ReceiveMap(mm)
+
+	assert.Equal(t, 0, ma.DeleteMetric("missing", nil))
+	assert.Equal(t, 0, ma.DeleteMetric("c", gostatsd.Tags{"a:1"}))
+	assert.Equal(t, 1, ma.DeleteMetric("c", gostatsd.Tags{"b:2", "a:1"})) // Tags match in any order
+	assert.Len(t, ma.metricMap.Counters["c"], 1)
+	assert.Equal(t, 2, ma.DeleteMetric("t", nil))
+	assert.NotContains(t, ma.metricMap.Timers, "t")
+	assert.Equal(t, 1, ma.DeleteMetric("g", gostatsd.Tags{"a:2"}))
+	assert.Len(t, ma.metricMap.Gauges["g"], 1)
+	assert.Len(t, ma.metricMap.Sets["s"], 2)
+}
+
+func TestDeleteMetricSeriesState(t *testing.T) {
+	t.Parallel()
+	config := newFakeAggregatorConfig()
+	config.CounterEvents = true
+	config.CounterTotals = []string{"c"}
+	config.PeakRateCounters = []string{"c"}
+	config.PeakRateWindow = time.Second
+	config.ChangedGaugesOnly = true
+	ma := NewMetricAggregator(config)
+	now := gostatsd.Nanotime(time.Now().UnixNano())
+
+	receive := func() {
+		mm := gostatsd.NewMetricMap()
+		mm.Receive(&gostatsd.Metric{Name: "c", Value: 2, Rate: 1, Type: gostatsd.COUNTER, Timestamp: now})
+		mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Timestamp: now})
+		ma.ReceiveMap(mm)
+	}
+	process := func() *gostatsd.MetricMap {
+		var processed *gostatsd.MetricMap
+		ma.Process(func(m *gostatsd.MetricMap) {
+			processed = m
+		})
+		return processed
+	}
+
+	receive()
+	ma.Flush(time.Second)
+	require.Contains(t, ma.sentGauges, "g")
+
+	// Deleting during a flush also removes the series generated from them
+	assert.Equal(t, 2, ma.DeleteMetric("c", nil)+ma.DeleteMetric("g", nil))
+	processed := process()
+	assert.Empty(t, processed.Counters)
+	assert.Empty(t, processed.Gauges)
+	assert.Empty(t, ma.totals)
+	assert.Empty(t, ma.peakRates)
+	assert.Empty(t, ma.sentGauges)
+	ma.Reset()
+
+	// Received again, the series start from scratch, and the gauge is sent even though its value is unchanged
+	receive()
+	ma.Flush(time.Second)
+	processed = process()
+	assert.Equal(t, 1.0, processed.Gauges["g"][""].Value)
+	assert.Equal(t, 2.0, processed.Gauges["c.total"][""].Value)
+	assert.Equal(t, 2.0, processed.Gauges["c.peak_per_second"][""].Value)
+	assert.EqualValues(t, 1, processed.Counters["c.events"][""].Value)
+}
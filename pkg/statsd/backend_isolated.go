@@ -0,0 +1,235 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/stats"
+)
+
+// IsolatedBackend wraps a Backend so that a slow or failing backend does not delay the flush of other backends.
+//
+// Each send is given its own timeout, after which the send is considered failed and the flusher is no longer
+// waiting on it, even if the wrapped backend has not completed yet.  After a number of consecutive failed sends
+// the circuit breaker opens, and batches are dropped without being sent to the backend until the cooldown has
+// passed.  A single batch is then sent to probe the backend, closing the circuit if it succeeds, or opening it
+// for another cooldown if it fails.
+//
+// The number of sends in flight at once can also be limited, in which case a send waits for a previous one to
+// complete, or time out, before it is sent to the wrapped backend.  The wait is in its own goroutine, so it does not
+// delay the flush for other backends, and counts towards the timeout of the send.  A waiting send is given a copy of
+// the MetricMap, as the original is reset once SendMetricsAsync returns.
+type IsolatedBackend struct {
+	batchesDropped uint64 // Accessed atomically
+	inFlight       int64  // Accessed atomically
+
+	backend     gostatsd.Backend
+	timeout     time.Duration // Timeout for each send, 0 to disable
+	maxFailures uint          // Consecutive failures before the circuit opens, 0 to disable
+	cooldown    time.Duration // How long the circuit stays open before probing
+	sendSlots   chan struct{} // Limits the sends in flight, nil to disable
+	now         func() time.Time
+
+	mu        sync.Mutex
+	failures  uint      // Number of consecutive failed sends
+	openUntil time.Time // When the circuit can be probed, only valid if the circuit is open
+	probing   bool      // A probe send is in flight
+}
+
+// NewIsolatedBackend creates a new IsolatedBackend wrapping the provided Backend.  A maxConcurrent of 0 doesn't
+// limit the number of sends in flight.
+func NewIsolatedBackend(backend gostatsd.Backend, timeout time.Duration, maxFailures uint, cooldown time.Duration, maxConcurrent uint) *IsolatedBackend {
+	var sendSlots chan struct{}
+	if maxConcurrent > 0 {
+		sendSlots = make(chan struct{}, maxConcurrent)
+	}
+	return &IsolatedBackend{
+		backend:     backend,
+		timeout:     timeout,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		sendSlots:   sendSlots,
+		now:         time.Now,
+	}
+}
+
+// Name returns the name of the wrapped backend.
+func (ib *IsolatedBackend) Name() string {
+	return ib.backend.Name()
+}
+
+// SendEvent sends the event to the wrapped backend.  Events are not subject to the timeout or circuit breaker.
+func (ib *IsolatedBackend) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	return ib.backend.SendEvent(ctx, e)
+}
+
+// SendMetricsAsync sends the metrics to the wrapped backend, unless the circuit is open.  If the number of sends in
+// flight is limited and none are free, it waits in a goroutine until a previous send has completed, the timeout has
+// passed, or ctx is done.  The timeout covers both the wait and the send.
+func (ib *IsolatedBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	sendCtx, cancel := ctx, context.CancelFunc(func() {})
+	if ib.timeout > 0 {
+		sendCtx, cancel = context.WithTimeout(ctx, ib.timeout)
+	}
+
+	if ib.sendSlots == nil {
+		ib.send(ctx, sendCtx, cancel, mm, cb)
+		return
+	}
+	select {
+	case ib.sendSlots <- struct{}{}:
+		ib.send(ctx, sendCtx, cancel, mm, cb)
+	default:
+		mm := copyMetricMap(mm) // The MetricMap must not be read after SendMetricsAsync returns
+		go func() {
+			select {
+			case ib.sendSlots <- struct{}{}:
+				ib.send(ctx, sendCtx, cancel, mm, cb)
+			case <-sendCtx.Done():
+				cancel()
+				cb([]error{fmt.Errorf("[%s] timed out waiting to send metrics: %w", ib.Name(), sendCtx.Err())})
+			}
+		}()
+	}
+}
+
+// send sends the metrics to the wrapped backend once a slot has been acquired, with sendCtx being ctx with the
+// timeout applied.
+func (ib *IsolatedBackend) send(ctx, sendCtx context.Context, cancel context.CancelFunc, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	atomic.AddInt64(&ib.inFlight, 1)
+
+	if !ib.allowSend() {
+		cancel()
+		ib.releaseSlot()
+		atomic.AddUint64(&ib.batchesDropped, 1)
+		cb([]error{fmt.Errorf("[%s] circuit breaker open, metrics dropped", ib.Name())})
+		return
+	}
+
+	var once sync.Once
+	done := func(errs []error) {
+		once.Do(func() {
+			cancel()
+			ib.releaseSlot()
+			ib.recordResult(errs)
+			cb(errs)
+		})
+	}
+
+	if ib.timeout > 0 {
+		go func() {
+			<-sendCtx.Done()
+			if err := ctx.Err(); err != nil {
+				done([]error{err})
+			} else {
+				// This is a no-op if the send has already completed.
+				done([]error{fmt.Errorf("[%s] timed out sending metrics after %v", ib.Name(), ib.timeout)})
+			}
+		}()
+	}
+
+	ib.backend.SendMetricsAsync(sendCtx, mm, done)
+}
+
+// releaseSlot allows another send once a send has completed.
+func (ib *IsolatedBackend) releaseSlot() {
+	atomic.AddInt64(&ib.inFlight, -1)
+	if ib.sendSlots != nil {
+		<-ib.sendSlots
+	}
+}
+
+// allowSend returns true if a send should be attempted.
+func (ib *IsolatedBackend) allowSend() bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+
+	if !ib.isOpen() {
+		return true
+	}
+	if ib.probing || ib.now().Before(ib.openUntil) {
+		return false
+	}
+	ib.probing = true
+	return true
+}
+
+// recordResult updates the circuit breaker with the result of a send.  A backend which had nothing to send has
+// neither succeeded nor failed, so the consecutive failures are unchanged.
+func (ib *IsolatedBackend) recordResult(errs []error) {
+	if gostatsd.IsNothingToSend(errs) {
+		ib.mu.Lock()
+		ib.probing = false
+		ib.mu.Unlock()
+		return
+	}
+
+	failed := false
+	for _, err := range errs {
+		if err != nil {
+			failed = true
+			break
+		}
+	}
+
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+
+	ib.probing = false
+	if !failed {
+		if ib.isOpen() {
+			logrus.WithField("backend", ib.Name()).Info("Circuit breaker closed")
+		}
+		ib.failures = 0
+		return
+	}
+
+	ib.failures++
+	if ib.isOpen() {
+		if ib.failures == ib.maxFailures {
+			logrus.WithFields(logrus.Fields{
+				"backend":  ib.Name(),
+				"failures": ib.failures,
+				"cooldown": ib.cooldown,
+			}).Warn("Circuit breaker opened")
+		}
+		ib.openUntil = ib.now().Add(ib.cooldown)
+	}
+}
+
+// isOpen returns true if the circuit is open, must be called with mu held.
+func (ib *IsolatedBackend) isOpen() bool {
+	return ib.maxFailures > 0 && ib.failures >= ib.maxFailures
+}
+
+// RunMetricsContext emits internal metrics about the circuit breaker and the sends in flight.
+func (ib *IsolatedBackend) RunMetricsContext(ctx context.Context) {
+	statser := stats.FromContext(ctx).WithTags(gostatsd.Tags{"backend:" + ib.Name()})
+
+	flushed, unregister := statser.RegisterFlush()
+	defer unregister()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushed:
+			ib.mu.Lock()
+			open := ib.isOpen()
+			ib.mu.Unlock()
+			if open {
+				statser.Gauge("backend.circuit_open", 1, nil)
+			} else {
+				statser.Gauge("backend.circuit_open", 0, nil)
+			}
+			statser.Gauge("backend.circuit_dropped", float64(atomic.LoadUint64(&ib.batchesDropped)), nil)
+			statser.Gauge("backend.inflight_sends", float64(atomic.LoadInt64(&ib.inFlight)), nil)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/backends"
+)
+
+// failingBackend calls the callback with err, or never calls it if hang is set.
+type failingBackend struct {
+	sends uint64
+	err   error
+	hang  bool
+}
+
+func (fb *failingBackend) Name() string {
+	return "failingBackend"
+}
+
+func (fb *failingBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	atomic.AddUint64(&fb.sends, 1)
+	if !fb.hang {
+		cb([]error{fb.err})
+	}
+}
+
+func (fb *failingBackend) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	return nil
+}
+
+func sendAndWait(t *testing.T, ib *IsolatedBackend) []error {
+	result := make(chan []error, 1)
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) {
+		result <- errs
+	})
+	select {
+	case errs := <-result:
+		return errs
+	case <-time.After(time.Second):
+		require.Fail(t, "callback not called")
+		return nil
+	}
+}
+
+func TestIsolatedBackendTimeout(t *testing.T) {
+	t.Parallel()
+	fb := &failingBackend{hang: true}
+	ib := NewIsolatedBackend(fb, 10*time.Millisecond, 0, 0, 0)
+
+	errs := sendAndWait(t, ib)
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+}
+
+func TestIsolatedBackendCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1000, 0)
+	fb := &failingBackend{err: errors.New("boom")}
+	ib := NewIsolatedBackend(fb, 0, 2, 10*time.Second, 0)
+	ib.now = func() time.Time { return now }
+
+	// Two failures opens the circuit
+	sendAndWait(t, ib)
+	sendAndWait(t, ib)
+	require.EqualValues(t, 2, atomic.LoadUint64(&fb.sends))
+
+	// Open circuit drops the batch without sending
+	errs := sendAndWait(t, ib)
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+	assert.EqualValues(t, 2, atomic.LoadUint64(&fb.sends))
+	assert.EqualValues(t, 1, atomic.LoadUint64(&ib.batchesDropped))
+
+	// After the cooldown a failed probe keeps the circuit open
+	now = now.Add(11 * time.Second)
+	sendAndWait(t, ib)
+	assert.EqualValues(t, 3, atomic.LoadUint64(&fb.sends))
+	sendAndWait(t, ib)
+	assert.EqualValues(t, 3, atomic.LoadUint64(&fb.sends))
+
+	// A successful probe closes the circuit
+	now = now.Add(11 * time.Second)
+	fb.err = nil
+	assert.Equal(t, []error{nil}, sendAndWait(t, ib))
+	assert.Equal(t, []error{nil}, sendAndWait(t, ib))
+	assert.EqualValues(t, 5, atomic.LoadUint64(&fb.sends))
+}
+
+func TestIsolatedBackendCircuitBreakerNothingToSend(t *testing.T) {
+	t.Parallel()
+	fb := &failingBackend{}
+	ib := NewIsolatedBackend(backends.NewFilteredBackend(fb, []string{"included"}, nil), 0, 2, 10*time.Second, 0)
+
+	// Flushes with nothing matching the filter don't open the circuit
+	for i := 0; i < 3; i++ {
+		assert.True(t, gostatsd.IsNothingToSend(sendAndWait(t, ib)))
+	}
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "included", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	result := make(chan []error, 1)
+	ib.SendMetricsAsync(context.Background(), mm, func(errs []error) { result <- errs })
+	assert.Equal(t, []error{nil}, <-result)
+	assert.EqualValues(t, 1, atomic.LoadUint64(&fb.sends))
+	assert.Zero(t, atomic.LoadUint64(&ib.batchesDropped))
+}
+
+// heldBackend holds the callback of every send, until it is called by the test.  The timers of each MetricMap sent
+// are read during the send, and kept in timers if it is set.
+type heldBackend struct {
+	failingBackend
+	callbacks chan gostatsd.SendCallback
+	timers    chan []float64
+}
+
+func (hb *heldBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	var values []float64
+	mm.Timers.Each(func(_, _ string, timer gostatsd.Timer) {
+		values = append(values, timer.Values...)
+	})
+	if hb.timers != nil {
+		hb.timers <- values
+	}
+	hb.callbacks <- cb
+}
+
+func TestIsolatedBackendMaxConcurrent(t *testing.T) {
+	t.Parallel()
+	hb := &heldBackend{callbacks: make(chan gostatsd.SendCallback, 2)}
+	ib := NewIsolatedBackend(hb, 0, 0, 0, 1)
+
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) {})
+	assert.Len(t, hb.callbacks, 1)
+	assert.EqualValues(t, 1, atomic.LoadInt64(&ib.inFlight))
+
+	// A send which can't wait is not sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := make(chan []error, 1)
+	ib.SendMetricsAsync(ctx, gostatsd.NewMetricMap(), func(errs []error) { result <- errs })
+	errs := <-result
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+	assert.Len(t, hb.callbacks, 1)
+
+	// The next send waits without blocking the caller, and is sent once the first send completes
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) {})
+	first := <-hb.callbacks
+	select {
+	case <-hb.callbacks:
+		require.Fail(t, "send did not wait")
+	case <-time.After(10 * time.Millisecond):
+	}
+	first(nil)
+	second := <-hb.callbacks
+	assert.EqualValues(t, 1, atomic.LoadInt64(&ib.inFlight))
+	second(nil)
+	assert.EqualValues(t, 0, atomic.LoadInt64(&ib.inFlight))
+}
+
+func TestIsolatedBackendMaxConcurrentReset(t *testing.T) {
+	t.Parallel()
+	hb := &heldBackend{callbacks: make(chan gostatsd.SendCallback, 2), timers: make(chan []float64, 2)}
+	ib := NewIsolatedBackend(hb, 0, 0, 0, 1)
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) {})
+	<-hb.timers
+	first := <-hb.callbacks
+
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER})
+	ma.ReceiveMap(mm)
+	ib.SendMetricsAsync(context.Background(), ma.metricMap, func(errs []error) {})
+
+	// The waiting send is not affected by the aggregator being reset and receiving metrics once it has returned
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ma.Reset()
+		mm := gostatsd.NewMetricMap()
+		mm.Receive(&gostatsd.Metric{Name: "t", Value: 2, Rate: 1, Type: gostatsd.TIMER})
+		ma.ReceiveMap(mm)
+	}()
+	first(nil)
+	assert.Equal(t, []float64{1}, <-hb.timers)
+	(<-hb.callbacks)(nil)
+	<-done
+}
+
+func TestIsolatedBackendMaxConcurrentTimeout(t *testing.T) {
+	t.Parallel()
+	hb := &heldBackend{callbacks: make(chan gostatsd.SendCallback, 2)}
+	ib := NewIsolatedBackend(hb, 50*time.Millisecond, 0, 0, 1)
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) {})
+	first := <-hb.callbacks
+
+	// The wait for a slot counts towards the timeout, so a send is not given the timeout twice
+	result := make(chan []error, 1)
+	ib.SendMetricsAsync(context.Background(), gostatsd.NewMetricMap(), func(errs []error) { result <- errs })
+	time.Sleep(30 * time.Millisecond)
+	first(nil)
+	second := <-hb.callbacks
+	select {
+	case errs := <-result:
+		require.Len(t, errs, 1)
+		assert.Error(t, errs[0])
+	case <-time.After(40 * time.Millisecond):
+		require.Fail(t, "send was not timed out after waiting and sending for the timeout")
+	}
+	second(nil)
+}
@@ -0,0 +1,141 @@
+package statsd
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// Reasons a line is written to the Deadletter.
+const (
+	DeadletterBadLine     = "bad_line"
+	DeadletterOversized   = "oversized"
+	DeadletterRateLimited = "rate_limited"
+	DeadletterFiltered    = "filtered"
+)
+
+// Deadletter writes the lines of metrics which are dropped to a file, with the reason and the source ip, so the
+// offending payloads can be shared with whoever is sending them.  Writes are rate limited, and when the file
+// reaches its maximum size it is renamed with a .1 suffix, replacing any previous one, and a new file is started.
+type Deadletter struct {
+	lock    sync.Mutex
+	path    string
+	maxSize int64
+	limiter *rate.Limiter
+	file    *os.File
+	size    int64
+	now     func() time.Time
+}
+
+// deadletterEntry is a single line written to the Deadletter, as JSON.
+type deadletterEntry struct {
+	Time   time.Time       `json:"time"`
+	Source gostatsd.Source `json:"source"`
+	Reason string          `json:"reason"`
+	Error  string          `json:"error,omitempty"`
+	Line   string          `json:"line"`
+}
+
+// NewDeadletter opens, or creates, the file at path to append dropped lines to.  A limit of 0 writes every line.
+func NewDeadletter(path string, maxSize int64, linesPerSecond rate.Limit) (*Deadletter, error) {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if linesPerSecond > 0 {
+		burst := int(linesPerSecond)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(linesPerSecond, burst)
+	}
+	d := &Deadletter{
+		path:    path,
+		maxSize: maxSize,
+		limiter: limiter,
+		now:     time.Now,
+	}
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Deadletter) open() error {
+	file, err := os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	d.file = file
+	d.size = info.Size()
+	return nil
+}
+
+// Write writes the line dropped for the reason, if the rate limit has not been exceeded.  err is the error which
+// caused the line to be dropped, and may be nil.
+func (d *Deadletter) Write(reason string, source gostatsd.Source, line []byte, err error) {
+	if !d.limiter.Allow() {
+		return
+	}
+	entry := deadletterEntry{
+		Time:   d.now(),
+		Source: source,
+		Reason: reason,
+		Line:   string(line),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	data, _ := json.Marshal(entry) // Can't fail, the entry only has strings and a time
+	data = append(data, '\n')
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return // Closed, or a previous rotation failed
+	}
+	if d.maxSize > 0 && d.size > 0 && d.size+int64(len(data)) > d.maxSize {
+		if err := d.rotate(); err != nil {
+			logrus.WithError(err).Warn("Failed to rotate deadletter file, no more lines will be written")
+			return
+		}
+	}
+	n, err := d.file.Write(data)
+	d.size += int64(n)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to write to deadletter file")
+	}
+}
+
+// rotate renames the current file with a .1 suffix, and opens a new one.  The lock must be held.
+func (d *Deadletter) rotate() error {
+	err := d.file.Close()
+	d.file = nil
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(d.path, d.path+".1"); err != nil {
+		return err
+	}
+	return d.open()
+}
+
+// Close closes the file, after which lines are no longer written.
+func (d *Deadletter) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
@@ -0,0 +1,116 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func readDeadletter(t *testing.T, path string) []deadletterEntry {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var entries []deadletterEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry deadletterEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestDeadletter(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	d, err := NewDeadletter(path, 0, 0)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0).UTC()
+	d.now = func() time.Time { return now }
+
+	d.Write(DeadletterBadLine, "127.0.0.1", []byte("a:x|c"), errors.New("invalid value"))
+	d.Write(DeadletterRateLimited, "127.0.0.2", []byte("b:1|c\n\"quoted\""), nil)
+	require.NoError(t, d.Close())
+	d.Write(DeadletterBadLine, "127.0.0.1", []byte("closed"), nil) // Not written once closed
+
+	assert.Equal(t, []deadletterEntry{
+		{Time: now, Source: "127.0.0.1", Reason: DeadletterBadLine, Error: "invalid value", Line: "a:x|c"},
+		{Time: now, Source: "127.0.0.2", Reason: DeadletterRateLimited, Line: "b:1|c\n\"quoted\""},
+	}, readDeadletter(t, path))
+}
+
+func TestDeadletterRotate(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	d, err := NewDeadletter(path, 200, 0)
+	require.NoError(t, err)
+	defer d.Close()
+
+	for _, line := range []string{"first", "second", "third"} {
+		d.Write(DeadletterBadLine, "127.0.0.1", []byte(line), nil)
+	}
+	previous := readDeadletter(t, path+".1")
+	current := readDeadletter(t, path)
+	require.Len(t, previous, 2)
+	require.Len(t, current, 1)
+	assert.Equal(t, "second", previous[1].Line)
+	assert.Equal(t, "third", current[0].Line)
+}
+
+func TestDeadletterRateLimit(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	d, err := NewDeadletter(path, 0, rate.Limit(2))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		d.Write(DeadletterBadLine, "127.0.0.1", []byte("a"), nil)
+	}
+	require.NoError(t, d.Close())
+	assert.Len(t, readDeadletter(t, path), 2) // The burst is one second of lines
+}
+
+func TestParseDatagramDeadletter(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "deadletter.log")
+	d, err := NewDeadletter(path, 0, 0)
+	require.NoError(t, err)
+
+	ch := &countingHandler{}
+	srl := NewSourceRateLimiter(SourceRateLimit{Limit: 1}, nil)
+	mr := NewDatagramParser(nil, ch, ParserConfig{Limits: MetricLimits{MaxTags: 1}, RateLimiter: srl, Deadletter: d}, logrus.New())
+	mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte("bad\nok:1|c\na:1|c|#a,b\nlimited:1|c"))
+
+	th := NewTagHandler(ch, nil, []Filter{{MatchMetrics: toStringMatch([]string{"noisy.*"}), DropMetric: true}}, nil, d)
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "noisy.a", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"a:b"}, Source: fakeIP})
+	th.DispatchMetricMap(context.Background(), mm)
+	require.NoError(t, d.Close())
+
+	entries := readDeadletter(t, path)
+	require.Len(t, entries, 4)
+	for i, expected := range []struct{ reason, line string }{
+		{DeadletterBadLine, "bad"},
+		{DeadletterOversized, "a:1|c|#a,b"},
+		{DeadletterRateLimited, "limited:1|c"},
+		{DeadletterFiltered, "noisy.a|#a:b"},
+	} {
+		assert.Equal(t, expected.reason, entries[i].Reason)
+		assert.Equal(t, expected.line, entries[i].Line)
+		assert.Equal(t, fakeIP, entries[i].Source)
+	}
+	assert.NotEmpty(t, entries[0].Error)
+	assert.NotEmpty(t, entries[1].Error)
+}
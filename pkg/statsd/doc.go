@@ -15,5 +15,8 @@ interface can be used with the library. See available backends at
 https://github.com/atlassian/gostatsd/tree/master/backend/backends.
 
 As with the original etsy statsd, multiple backends can be used simultaneously.
+
+Programs embedding the library can also observe each flush without implementing a Backend, by setting
+Server.FlushHandlers to a list of FlushHandler objects.
 */
 package statsd
@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// DownsampleRule is a number of flushes to accumulate metrics for before sending them to the backends.
+type DownsampleRule struct {
+	MatchMetrics gostatsd.StringMatchList // Name must match
+	Every        int                      // Send the metrics every this many flushes
+}
+
+// DownsampleRules is a list of DownsampleRule, the first rule matching a metric wins.
+type DownsampleRules []DownsampleRule
+
+// Every returns the number of flushes of the first rule matching the metric name, or 1 if no rules match.
+func (dr DownsampleRules) Every(name string) int {
+	for _, rule := range dr {
+		if rule.MatchMetrics.MatchAny(name) {
+			return rule.Every
+		}
+	}
+	return 1
+}
+
+// NewDownsampleRuleFromViper creates a new DownsampleRule given a *viper.Viper
+func NewDownsampleRuleFromViper(v *viper.Viper) DownsampleRule {
+	v.SetDefault("match-metrics", []string{})
+	v.SetDefault("every", 1)
+	return DownsampleRule{
+		MatchMetrics: toStringMatch(v.GetStringSlice("match-metrics")),
+		Every:        v.GetInt("every"),
+	}
+}
+
+// NewDownsampleRulesFromViper creates the DownsampleRules named by the downsamples key.
+func NewDownsampleRulesFromViper(v *viper.Viper) DownsampleRules {
+	ruleNameList := v.GetStringSlice("downsamples")
+	var rules DownsampleRules
+	for _, ruleName := range ruleNameList {
+		vRule := v.Sub("downsample." + ruleName)
+		if vRule == nil {
+			logrus.Warnf("Downsample doesn't exist: %v", ruleName)
+			continue
+		}
+		rule := NewDownsampleRuleFromViper(vRule)
+		if rule.Every < 1 {
+			logrus.Warnf("Downsample %v has invalid every %v, must be at least 1", ruleName, rule.Every)
+			continue
+		}
+		if len(rule.MatchMetrics) == 0 {
+			logrus.Warnf("Downsample %v has no match-metrics", ruleName)
+			continue
+		}
+		rules = append(rules, rule)
+		logrus.Infof("Loaded downsample %v", ruleName)
+	}
+	return rules
+}
@@ -3,6 +3,8 @@ package statsd
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/internal/util"
 	"github.com/atlassian/gostatsd/pkg/stats"
+	"github.com/atlassian/gostatsd/pkg/web"
 )
 
 // MetricFlusher periodically flushes metrics from all Aggregators to Senders.
@@ -22,26 +25,91 @@ type MetricFlusher struct {
 	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	lastFlush      int64 // Last time the metrics where aggregated. Unix timestamp in nsec.
 	lastFlushError int64 // Time of the last flush error. Unix timestamp in nsec.
+	paused         int32 // Non-zero if flushing to the backends is paused.
 
 	flushInterval      time.Duration // How often to flush metrics to the sender
 	flushOffset        time.Duration // Offset for when to flush if alignment is enabled
 	flushAligned       bool          // Indicate if flush is aligned to the interval or not
+	dryRun             bool          // Indicate if metrics should be summarised in the log instead of sent to backends
 	aggregateProcesser AggregateProcesser
 	backends           []gostatsd.Backend
+	lastFlushMetrics   *LastFlush // Optional, keeps a copy of the most recent flush
+	flushHandlers      []FlushHandler
+	pauseMaxSeries     uint64 // Number of series buffered while paused which forces a flush, 0 to disable
+	pauseExpiry        bool   // Don't expire metrics while paused, or after a failed send to the backends
+	shutdownOnly       bool   // Don't flush periodically, only when FlushNow is called
+	failurePolicy      string // What to do with metrics which every backend failed to send
+	failureMaxSeries   uint64 // Number of series kept to send again by the failurePolicy, 0 for no limit
+	namespace          string
+	extraNamespaces    []string      // Namespaces which metrics in the namespace are also sent under
+	gaugeState         *GaugeState   // Optional, persists the gauges after each flush
+	warmup             time.Duration // Periodic flushes scheduled this soon after Run starts don't flush
+	warmupDiscard      bool          // Discard the metrics aggregated during the warmup rather than including them
+	flushNow           chan chan struct{}
+	started            time.Time // When Run started, for reporting uptime
+
+	retainedLock sync.Mutex
+	retained     []retainedMap // Metrics which every backend failed to send, oldest first
+}
+
+// retainedMap is a MetricMap which every backend failed to send, to be sent again.
+type retainedMap struct {
+	mm       *gostatsd.MetricMap
+	series   uint64
+	attempts int // The number of times sending it has failed
+}
+
+// FlusherConfig is the configuration of a MetricFlusher.  The zero value of each field disables the feature it
+// configures, and a FailurePolicy of "" drops metrics which every backend failed to send.
+type FlusherConfig struct {
+	FlushInterval    time.Duration  // How often to flush metrics to the backends
+	FlushOffset      time.Duration  // Offset for when to flush if FlushAligned is set
+	FlushAligned     bool           // Align flushes to multiples of the FlushInterval
+	DryRun           bool           // Summarise metrics in the log instead of sending them to the backends
+	LastFlush        *LastFlush     // Keeps a copy of the most recent flush
+	FlushHandlers    []FlushHandler // Observe the metrics in every flush
+	PauseMaxSeries   uint64         // Number of series buffered while paused which forces a flush, 0 to disable
+	PauseExpiry      bool           // Don't expire metrics while paused, or after a failed send to the backends
+	ShutdownOnly     bool           // Don't flush periodically, only when FlushNow is called
+	FailurePolicy    string         // What to do with metrics which every backend failed to send
+	FailureMaxSeries uint64         // Number of series kept to send again by the FailurePolicy, 0 for no limit
+	Namespace        string         // The namespace of the metrics, which ExtraNamespaces replace
+	ExtraNamespaces  []string       // Namespaces which metrics in the Namespace are also sent under
+	GaugeState       *GaugeState    // Persists the gauges after each flush
+	Warmup           time.Duration  // Periodic flushes scheduled this soon after Run starts don't flush
+	WarmupDiscard    bool           // Discard the metrics aggregated during the Warmup rather than including them
 }
 
 // NewMetricFlusher creates a new MetricFlusher with provided configuration.
-func NewMetricFlusher(flushInterval, flushOffset time.Duration, aligned bool, aggregateProcesser AggregateProcesser, backends []gostatsd.Backend) *MetricFlusher {
+func NewMetricFlusher(aggregateProcesser AggregateProcesser, backends []gostatsd.Backend, config FlusherConfig) *MetricFlusher {
 	return &MetricFlusher{
-		flushInterval:      flushInterval,
-		flushOffset:        flushOffset,
-		flushAligned:       aligned,
+		flushInterval:      config.FlushInterval,
+		flushOffset:        config.FlushOffset,
+		flushAligned:       config.FlushAligned,
+		dryRun:             config.DryRun,
 		aggregateProcesser: aggregateProcesser,
 		backends:           backends,
+		lastFlushMetrics:   config.LastFlush,
+		flushHandlers:      config.FlushHandlers,
+		pauseMaxSeries:     config.PauseMaxSeries,
+		pauseExpiry:        config.PauseExpiry,
+		shutdownOnly:       config.ShutdownOnly,
+		failurePolicy:      config.FailurePolicy,
+		failureMaxSeries:   config.FailureMaxSeries,
+		namespace:          config.Namespace,
+		extraNamespaces:    config.ExtraNamespaces,
+		gaugeState:         config.GaugeState,
+		warmup:             config.Warmup,
+		warmupDiscard:      config.WarmupDiscard,
+		flushNow:           make(chan chan struct{}),
 	}
 }
 
 func (f *MetricFlusher) makeTicker(ctx context.Context) (<-chan time.Time, func()) {
+	if f.shutdownOnly {
+		// A nil channel is never ready, so there are no periodic flushes
+		return nil, func() {}
+	}
 	if f.flushAligned {
 		flushTicker := util.NewAlignedTickerWithContext(ctx, f.flushInterval, f.flushOffset)
 		return flushTicker.C, flushTicker.Stop
@@ -57,27 +125,256 @@ func (f *MetricFlusher) Run(ctx context.Context) {
 	statser := stats.FromContext(ctx)
 
 	ch, stop := f.makeTicker(ctx)
-	defer stop()
+	defer func() {
+		stop()
+	}()
+
+	trigger, _ := f.aggregateProcesser.(FlushTrigger)
+	var flushRequired <-chan struct{}
+	if trigger != nil {
+		flushRequired = trigger.FlushRequired()
+	}
 
+	// lastFlush is when data was last flushed to the backends, and lastNotify is when the internal metrics were last
+	// flushed.  They differ while flushing is paused, as the aggregated data covers the whole time since lastFlush.
+	f.started = clock.FromContext(ctx).Now()
+	warmupEnd := f.started.Add(f.warmup)
 	lastFlush := time.Now()
+	lastNotify := lastFlush
+	doFlush := func(thisFlush time.Time, force bool) {
+		if f.flush(ctx, thisFlush.Sub(lastNotify), thisFlush.Sub(lastFlush), force, statser, trigger) {
+			lastFlush = thisFlush
+		}
+		lastNotify = thisFlush
+	}
+	// skipWarmup handles a periodic flush during the warmup, which only flushes the internal metrics.  The aggregated
+	// metrics are kept for the first flush after the warmup, or discarded so that it only covers its own interval.
+	skipWarmup := func(thisFlush time.Time) {
+		if f.warmupDiscard {
+			f.discard(ctx)
+			lastFlush = thisFlush
+		}
+		statser.NotifyFlush(ctx, thisFlush.Sub(lastNotify))
+		lastNotify = thisFlush
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case thisFlush := <-ch: // Time to flush to the backends
-			flushDelta := thisFlush.Sub(lastFlush)
-			statser.NotifyFlush(ctx, flushDelta)
-			if f.aggregateProcesser != AggregateProcesser(nil) {
-				f.flushData(ctx, flushDelta, statser)
+			statser.TimingDuration("flusher.flush_lag", flushLag(thisFlush, clock.FromContext(ctx).Now()), nil)
+			if thisFlush.Before(warmupEnd) {
+				skipWarmup(thisFlush)
+			} else {
+				doFlush(thisFlush, false)
 			}
-			lastFlush = thisFlush
+		case <-flushRequired: // Too many metrics buffered, flush early
+			statser.Count("flusher.early_flushes", 1, nil)
+			doFlush(clock.FromContext(ctx).Now(), false)
+			if !f.flushAligned {
+				// Restart the interval from the early flush.  An aligned flush keeps its schedule.
+				stop()
+				ch, stop = f.makeTicker(ctx)
+			}
+		case done := <-f.flushNow: // Explicitly requested flush
+			doFlush(clock.FromContext(ctx).Now(), true)
+			close(done)
+		}
+	}
+}
+
+// discard resets every Aggregator without flushing it, dropping the metrics it has aggregated.  Gauges keep their
+// value, as they would after a flush.
+func (f *MetricFlusher) discard(ctx context.Context) {
+	if f.aggregateProcesser == AggregateProcesser(nil) {
+		return
+	}
+	processWait := f.aggregateProcesser.Process(ctx, func(workerId int, aggr Aggregator) {
+		aggr.Reset()
+	})
+	processWait()
+}
+
+// flushLag returns how long after its scheduled time a flush started.  An aligned flush may be scheduled after now
+// if the clock has jumped backwards, which is not a lag.
+func flushLag(scheduled, now time.Time) time.Duration {
+	if lag := now.Sub(scheduled); lag > 0 {
+		return lag
+	}
+	return 0
+}
+
+// Pause stops metrics being flushed to the backends.  Metrics continue to be received and aggregated, and are sent
+// when Resume is called, unless more than pauseMaxSeries are buffered, in which case they are flushed anyway.
+func (f *MetricFlusher) Pause() {
+	if atomic.CompareAndSwapInt32(&f.paused, 0, 1) {
+		logrus.Info("Flushing to backends paused")
+	}
+}
+
+// Resume resumes flushing metrics to the backends at the next flush interval.
+func (f *MetricFlusher) Resume() {
+	if atomic.CompareAndSwapInt32(&f.paused, 1, 0) {
+		logrus.Info("Flushing to backends resumed")
+	}
+}
+
+// Paused returns true if flushing to the backends is paused.
+func (f *MetricFlusher) Paused() bool {
+	return atomic.LoadInt32(&f.paused) != 0
+}
+
+// DeleteMetric deletes the series with the name from every Aggregator which supports it, or only the series with
+// exactly the tags if tags is not nil, and returns the number of series deleted.
+func (f *MetricFlusher) DeleteMetric(ctx context.Context, name string, tags gostatsd.Tags) int {
+	if f.aggregateProcesser == AggregateProcesser(nil) {
+		return 0
+	}
+	var deleted int64
+	processWait := f.aggregateProcesser.Process(ctx, func(workerId int, aggr Aggregator) {
+		if md, ok := aggr.(metricDeleter); ok {
+			atomic.AddInt64(&deleted, int64(md.DeleteMetric(name, tags)))
+		}
+	})
+	processWait()
+	if deleted > 0 {
+		logrus.WithFields(logrus.Fields{
+			"name":    name,
+			"tags":    tags,
+			"deleted": deleted,
+		}).Info("Deleted metric")
+	}
+	return int(deleted)
+}
+
+// TopMetrics returns the n counter, timer, and set names with the most volume in the current flush interval, from
+// every Aggregator which supports it.
+func (f *MetricFlusher) TopMetrics(ctx context.Context, n int) web.TopMetrics {
+	if f.aggregateProcesser == AggregateProcesser(nil) {
+		return web.TopMetrics{}
+	}
+	var lock sync.Mutex
+	volumes := map[seriesName]web.MetricVolume{}
+	processWait := f.aggregateProcesser.Process(ctx, func(workerId int, aggr Aggregator) {
+		mv, ok := aggr.(metricVolumer)
+		if !ok {
+			return
+		}
+		aggrVolumes := mv.MetricVolumes()
+		lock.Lock()
+		defer lock.Unlock()
+		// Each series is only in one Aggregator, so the series of a name can be added up.
+		for key, volume := range aggrVolumes {
+			total := volumes[key]
+			total.Name = volume.Name
+			total.Volume += volume.Volume
+			total.Series += volume.Series
+			volumes[key] = total
+		}
+	})
+	processWait()
+
+	byType := map[gostatsd.MetricType][]web.MetricVolume{}
+	for key, volume := range volumes {
+		byType[key.metricType] = append(byType[key.metricType], volume)
+	}
+	top := func(volumes []web.MetricVolume) []web.MetricVolume {
+		sort.Slice(volumes, func(i, j int) bool {
+			if volumes[i].Volume != volumes[j].Volume {
+				return volumes[i].Volume > volumes[j].Volume
+			}
+			return volumes[i].Name < volumes[j].Name
+		})
+		if len(volumes) > n {
+			volumes = volumes[:n]
 		}
+		return volumes
 	}
+	return web.TopMetrics{
+		Counters: top(byType[gostatsd.COUNTER]),
+		Timers:   top(byType[gostatsd.TIMER]),
+		Sets:     top(byType[gostatsd.SET]),
+	}
+}
+
+// FlushNow flushes all metrics to the backends immediately, even if flushing is paused, and blocks until they have
+// been sent.  Run must be running for the flush to take place.
+func (f *MetricFlusher) FlushNow(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case <-ctx.Done():
+		return
+	case f.flushNow <- done:
+	}
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
+
+// flush flushes the internal metrics, and the aggregated metrics unless flushing is paused.  It returns true if the
+// aggregated metrics were flushed.
+func (f *MetricFlusher) flush(ctx context.Context, notifyDelta, flushDelta time.Duration, force bool, statser stats.Statser, trigger FlushTrigger) bool {
+	statser.NotifyFlush(ctx, notifyDelta)
+	if !f.started.IsZero() {
+		statser.Gauge("uptime_seconds", clock.FromContext(ctx).Since(f.started).Seconds(), nil)
+	}
+	if trigger != nil {
+		trigger.FlushStarted()
+	}
+	if f.aggregateProcesser == AggregateProcesser(nil) {
+		statser.Count("flushes_total", 1, nil)
+		return true
+	}
+	if !f.Paused() {
+		statser.Gauge("flusher.paused", 0, nil)
+	} else {
+		statser.Gauge("flusher.paused", 1, nil)
+		if !force {
+			if !f.pauseLimitReached(ctx) {
+				return false
+			}
+			statser.Count("flusher.paused_forced_flushes", 1, nil)
+		}
+	}
+	statser.Count("flushes_total", 1, nil)
+	f.flushData(ctx, flushDelta, statser)
+	return true
+}
+
+// pauseLimitReached returns true if more than pauseMaxSeries series have been buffered by the aggregators while
+// flushing is paused, so that memory usage does not grow without bound.
+func (f *MetricFlusher) pauseLimitReached(ctx context.Context) bool {
+	if f.pauseMaxSeries == 0 {
+		return false
+	}
+	var summary flushSummary
+	processWait := f.aggregateProcesser.Process(ctx, func(workerId int, aggr Aggregator) {
+		aggr.Process(summary.add)
+	})
+	processWait()
+	series := summary.total()
+	if series < f.pauseMaxSeries {
+		return false
+	}
+	logrus.WithFields(logrus.Fields{
+		"series": series,
+		"limit":  f.pauseMaxSeries,
+	}).Warn("Too many series buffered while paused, flushing to backends")
+	return true
 }
 
 func (f *MetricFlusher) flushData(ctx context.Context, flushInterval time.Duration, statser stats.Statser) {
 	var sendWg sync.WaitGroup
+	var summary flushSummary
 	timerTotal := statser.NewTimer("flusher.total_time", nil)
+	expiryPaused := f.pauseExpiry && f.expiryPaused()
+	if !f.dryRun {
+		// Send anything retained from previous flushes first, so the backends receive it in order.
+		for _, r := range f.takeRetained() {
+			f.sendMetricsAsync(ctx, statser, &sendWg, r.mm, time.Now(), r.attempts)
+		}
+	}
 	processWait := f.aggregateProcesser.Process(ctx, func(workerId int, aggr Aggregator) {
 		// This is in the flusher, but it's an aggregator action, so put it in that space.
 		tags := gostatsd.Tags{fmt.Sprintf("aggregator_id:%d", workerId)}
@@ -88,30 +385,111 @@ func (f *MetricFlusher) flushData(ctx context.Context, flushInterval time.Durati
 
 		timerProcess := statser.NewTimer("aggregator.process_time", tags)
 		aggr.Process(func(m *gostatsd.MetricMap) {
-			f.sendMetricsAsync(ctx, &sendWg, m)
+			produced := time.Now()
+			if f.lastFlushMetrics != nil {
+				f.lastFlushMetrics.add(m)
+			}
+			for _, fh := range f.flushHandlers {
+				fh.HandleFlush(ctx, m)
+			}
+			if f.dryRun {
+				summary.add(m)
+				for _, ns := range f.extraNamespaces {
+					summary.add(renameNamespace(m, f.namespace, ns))
+				}
+			} else {
+				if f.retainsFailures() {
+					// The MetricMap is modified by Reset, so a copy is sent which can be kept if the send fails.
+					m = copyMetricMap(m)
+				}
+				f.sendMetricsAsync(ctx, statser, &sendWg, m, produced, 0)
+				for _, ns := range f.extraNamespaces {
+					f.sendMetricsAsync(ctx, statser, &sendWg, renameNamespace(m, f.namespace, ns), produced, 0)
+				}
+			}
 		})
 		timerProcess.SendGauge()
 
 		timerReset := statser.NewTimer("aggregator.reset_time", tags)
+		if ep, ok := aggr.(expiryPauser); ok && f.pauseExpiry {
+			ep.PauseExpiry(expiryPaused)
+		}
 		aggr.Reset()
 		timerReset.SendGauge()
+
+		if f.gaugeState != nil {
+			if gs, ok := aggr.(gaugeSource); ok {
+				f.gaugeState.add(gs.Gauges())
+			}
+		}
 	})
 	processWait() // Wait for all workers to execute function
+	if f.gaugeState != nil {
+		f.gaugeState.save()
+	}
+	if f.lastFlushMetrics != nil {
+		f.lastFlushMetrics.complete(clock.FromContext(ctx).Now())
+	}
 	sendWg.Wait() // Wait for all backends to finish sending
 	timerTotal.SendGauge()
+	if f.retainsFailures() {
+		statser.Gauge("flusher.retained_series", float64(f.retainedSeries()), nil)
+	}
+	if f.dryRun {
+		summary.log(flushInterval)
+	}
+}
+
+// expiryPaused returns true if flushing is paused, or the most recent send to the backends failed, so that metrics
+// which are not being received during a backend outage are not expired before the backends recover.
+func (f *MetricFlusher) expiryPaused() bool {
+	return f.Paused() || atomic.LoadInt64(&f.lastFlushError) > atomic.LoadInt64(&f.lastFlush)
 }
 
-func (f *MetricFlusher) sendMetricsAsync(ctx context.Context, wg *sync.WaitGroup, m *gostatsd.MetricMap) {
+// sendMetricsAsync sends m to all backends.  The time between the MetricMap being produced and each send starting
+// is reported as flusher.backend_queue_time, and the time each backend takes to send is reported as
+// flusher.backend_send_time.  If every backend fails, m is retained according to the failurePolicy, attempts is the
+// number of times sending it has already failed.  It is not retained if every backend failed with a
+// gostatsd.PermanentError, as sending it again would fail again.  A backend which had nothing to send, as every
+// metric was filtered out, counts as neither a success nor a failure.
+func (f *MetricFlusher) sendMetricsAsync(ctx context.Context, statser stats.Statser, wg *sync.WaitGroup, m *gostatsd.MetricMap, produced time.Time, attempts int) {
+	pending := int32(len(f.backends))
+	failures := int32(0)
+	permanentFailures := int32(0)
+	skipped := int32(0)
 	wg.Add(len(f.backends))
 	for _, backend := range f.backends {
+		tags := gostatsd.Tags{"backend:" + backend.Name()}
+		started := time.Now()
+		statser.TimingDuration("flusher.backend_queue_time", started.Sub(produced), tags)
 		backend.SendMetricsAsync(ctx, m, func(errs []error) {
 			defer wg.Done()
-			f.handleSendResult(errs)
+			statser.TimingDuration("flusher.backend_send_time", time.Since(started), tags)
+			if gostatsd.IsNothingToSend(errs) {
+				atomic.AddInt32(&skipped, 1)
+			} else if f.handleSendResult(errs) {
+				atomic.AddInt32(&failures, 1)
+				if permanentFailure(errs) {
+					atomic.AddInt32(&permanentFailures, 1)
+				}
+			}
+			if atomic.AddInt32(&pending, -1) != 0 {
+				return
+			}
+			failed := atomic.LoadInt32(&failures)
+			if failed > 0 && failed+atomic.LoadInt32(&skipped) == int32(len(f.backends)) {
+				if atomic.LoadInt32(&permanentFailures) == failed {
+					statser.Count("flusher.permanent_failures", 1, nil)
+					return
+				}
+				f.retain(statser, m, attempts+1)
+			}
 		})
 	}
 }
 
-func (f *MetricFlusher) handleSendResult(flushResults []error) {
+// handleSendResult records the result of a send to a backend, and returns true if it failed.
+func (f *MetricFlusher) handleSendResult(flushResults []error) bool {
 	timestampPointer := &f.lastFlush
 	for _, err := range flushResults {
 		if err != nil {
@@ -122,4 +500,180 @@ func (f *MetricFlusher) handleSendResult(flushResults []error) {
 		}
 	}
 	atomic.StoreInt64(timestampPointer, time.Now().UnixNano())
+	return timestampPointer == &f.lastFlushError
+}
+
+// permanentFailure returns true if every error in errs which is not nil is a gostatsd.PermanentError.
+func permanentFailure(errs []error) bool {
+	for _, err := range errs {
+		if err != nil && !gostatsd.IsPermanent(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// retainsFailures returns true if metrics which every backend failed to send are sent again.
+func (f *MetricFlusher) retainsFailures() bool {
+	return f.failurePolicy == gostatsd.BackendFailureRetry || f.failurePolicy == gostatsd.BackendFailureBlock
+}
+
+// retain keeps m to be sent again in the next flush, unless it has already been retried by the retry policy.  The
+// oldest metrics are dropped if more than failureMaxSeries are retained.
+func (f *MetricFlusher) retain(statser stats.Statser, m *gostatsd.MetricMap, attempts int) {
+	if !f.retainsFailures() {
+		return
+	}
+	var summary flushSummary
+	summary.add(m)
+	series := summary.total()
+	if f.failurePolicy == gostatsd.BackendFailureRetry && attempts > 1 {
+		statser.Count("flusher.retained_series_dropped", float64(series), nil)
+		return
+	}
+
+	f.retainedLock.Lock()
+	defer f.retainedLock.Unlock()
+	f.retained = append(f.retained, retainedMap{mm: m, series: series, attempts: attempts})
+	if f.failureMaxSeries == 0 {
+		return
+	}
+	total := uint64(0)
+	for _, r := range f.retained {
+		total += r.series
+	}
+	dropped := uint64(0)
+	for len(f.retained) > 0 && total > f.failureMaxSeries {
+		total -= f.retained[0].series
+		dropped += f.retained[0].series
+		f.retained = f.retained[1:]
+	}
+	if dropped > 0 {
+		statser.Count("flusher.retained_series_dropped", float64(dropped), nil)
+	}
+}
+
+// takeRetained returns the metrics retained to be sent again, and forgets them.
+func (f *MetricFlusher) takeRetained() []retainedMap {
+	f.retainedLock.Lock()
+	defer f.retainedLock.Unlock()
+	retained := f.retained
+	f.retained = nil
+	return retained
+}
+
+// retainedSeries returns the number of series retained to be sent again.
+func (f *MetricFlusher) retainedSeries() uint64 {
+	f.retainedLock.Lock()
+	defer f.retainedLock.Unlock()
+	total := uint64(0)
+	for _, r := range f.retained {
+		total += r.series
+	}
+	return total
+}
+
+// copyMetricMap returns a copy of mm which doesn't share any timer values or set values with it, so that it is not
+// modified when the aggregator is reset.
+func copyMetricMap(mm *gostatsd.MetricMap) *gostatsd.MetricMap {
+	c := gostatsd.NewMetricMap()
+	mm.Counters.Each(c.MergeCounter)
+	mm.Gauges.Each(c.MergeGauge)
+	mm.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		timer.Values = append([]float64(nil), timer.Values...)
+		c.MergeTimer(key, tagsKey, timer)
+	})
+	mm.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
+		values := make(map[string]struct{}, len(set.Values))
+		for value := range set.Values {
+			values[value] = struct{}{}
+		}
+		set.Values = values
+		if set.Estimator != nil {
+			estimator := *set.Estimator
+			set.Estimator = &estimator
+		}
+		c.MergeSet(key, tagsKey, set)
+	})
+	return c
+}
+
+// renameNamespace returns a MetricMap with the metrics in mm which are in the namespace from, renamed to be in the
+// namespace to instead.  If from is "" every metric is in it, and is prefixed with to.  The values are shared with mm.
+func renameNamespace(mm *gostatsd.MetricMap, from, to string) *gostatsd.MetricMap {
+	prefix := ""
+	if from != "" {
+		prefix = from + "."
+	}
+	rename := func(name string) (string, bool) {
+		if !strings.HasPrefix(name, prefix) {
+			return "", false
+		}
+		return to + "." + name[len(prefix):], true
+	}
+	renamed := gostatsd.NewMetricMap()
+	mm.Counters.Each(func(key, tagsKey string, counter gostatsd.Counter) {
+		if name, ok := rename(key); ok {
+			renamed.MergeCounter(name, tagsKey, counter)
+		}
+	})
+	mm.Gauges.Each(func(key, tagsKey string, gauge gostatsd.Gauge) {
+		if name, ok := rename(key); ok {
+			renamed.MergeGauge(name, tagsKey, gauge)
+		}
+	})
+	mm.Timers.Each(func(key, tagsKey string, timer gostatsd.Timer) {
+		if name, ok := rename(key); ok {
+			renamed.MergeTimer(name, tagsKey, timer)
+		}
+	})
+	mm.Sets.Each(func(key, tagsKey string, set gostatsd.Set) {
+		if name, ok := rename(key); ok {
+			renamed.MergeSet(name, tagsKey, set)
+		}
+	})
+	return renamed
+}
+
+// flushSummary accumulates the number of series flushed by each aggregator.  It is used in dry-run mode
+// to report what would have been sent to the backends.  Fields must be accessed using atomic instructions.
+type flushSummary struct {
+	counters uint64
+	timers   uint64
+	gauges   uint64
+	sets     uint64
+}
+
+func (fs *flushSummary) add(m *gostatsd.MetricMap) {
+	var counters, timers, gauges, sets uint64
+	for _, c := range m.Counters {
+		counters += uint64(len(c))
+	}
+	for _, t := range m.Timers {
+		timers += uint64(len(t))
+	}
+	for _, g := range m.Gauges {
+		gauges += uint64(len(g))
+	}
+	for _, s := range m.Sets {
+		sets += uint64(len(s))
+	}
+	atomic.AddUint64(&fs.counters, counters)
+	atomic.AddUint64(&fs.timers, timers)
+	atomic.AddUint64(&fs.gauges, gauges)
+	atomic.AddUint64(&fs.sets, sets)
+}
+
+func (fs *flushSummary) total() uint64 {
+	return atomic.LoadUint64(&fs.counters) + atomic.LoadUint64(&fs.timers) + atomic.LoadUint64(&fs.gauges) + atomic.LoadUint64(&fs.sets)
+}
+
+func (fs *flushSummary) log(flushInterval time.Duration) {
+	logrus.WithFields(logrus.Fields{
+		"interval": flushInterval,
+		"counters": atomic.LoadUint64(&fs.counters),
+		"timers":   atomic.LoadUint64(&fs.timers),
+		"gauges":   atomic.LoadUint64(&fs.gauges),
+		"sets":     atomic.LoadUint64(&fs.sets),
+	}).Info("dry-run flush, metrics not sent to backends")
 }
@@ -1,11 +1,36 @@
 package statsd
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/ash2k/stager/wait"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tilinna/clock"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/stats"
+	"github.com/atlassian/gostatsd/pkg/web"
 )
 
+// singleAggregateProcesser runs the process function against a single Aggregator in the calling goroutine.
+type singleAggregateProcesser struct {
+	aggr Aggregator
+}
+
+func (sap *singleAggregateProcesser) Process(ctx context.Context, fn DispatcherProcessFunc) gostatsd.Wait {
+	fn(0, sap.aggr)
+	return func() {}
+}
+
 func TestFlusherHandleSendResultNoErrors(t *testing.T) {
 	t.Parallel()
 	input := [][]error{
@@ -17,7 +42,7 @@ func TestFlusherHandleSendResultNoErrors(t *testing.T) {
 		errs := errs
 		t.Run(strconv.Itoa(pos), func(t *testing.T) {
 			t.Parallel()
-			fl := NewMetricFlusher(0, 0, false, nil, nil)
+			fl := NewMetricFlusher(nil, nil, FlusherConfig{})
 			fl.handleSendResult(errs)
 
 			if fl.lastFlush == 0 || fl.lastFlushError != 0 {
@@ -39,7 +64,7 @@ func TestFlusherHandleSendResultError(t *testing.T) {
 		errs := errs
 		t.Run(strconv.Itoa(pos), func(t *testing.T) {
 			t.Parallel()
-			fl := NewMetricFlusher(0, 0, false, nil, nil)
+			fl := NewMetricFlusher(nil, nil, FlusherConfig{})
 			fl.handleSendResult(errs)
 
 			if fl.lastFlushError == 0 || fl.lastFlush != 0 {
@@ -48,3 +73,507 @@ func TestFlusherHandleSendResultError(t *testing.T) {
 		})
 	}
 }
+
+func TestFlusherDryRun(t *testing.T) {
+	t.Parallel()
+	for _, dryRun := range []bool{false, true} {
+		dryRun := dryRun
+		t.Run(strconv.FormatBool(dryRun), func(t *testing.T) {
+			t.Parallel()
+			ma := newFakeAggregator()
+			mm := gostatsd.NewMetricMap()
+			mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+			mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+			ma.ReceiveMap(mm)
+
+			backend := &countingBackend{}
+			fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{DryRun: dryRun})
+			fl.flushData(context.Background(), time.Second, stats.NewNullStatser())
+
+			if dryRun {
+				assert.EqualValues(t, 0, atomic.LoadUint64(&backend.metrics))
+			} else {
+				assert.EqualValues(t, 2, atomic.LoadUint64(&backend.metrics))
+			}
+		})
+	}
+}
+
+func TestFlusherAdditionalNamespaces(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "legacy.c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "legacy.g", Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+	mm.Receive(&gostatsd.Metric{Name: "other.g", Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+	ma.ReceiveMap(mm)
+
+	backend := &countingBackend{}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{Namespace: "legacy", ExtraNamespaces: []string{"new", "newer"}})
+	fl.flushData(context.Background(), time.Second, stats.NewNullStatser())
+
+	// Only the metrics in the namespace are sent again under each additional namespace
+	assert.EqualValues(t, 7, atomic.LoadUint64(&backend.metrics))
+}
+
+// notifyingStatser sends the time since the last flush to a channel each time the flusher notifies it of a flush.
+type notifyingStatser struct {
+	stats.NullStatser
+	notified chan time.Duration
+}
+
+func (ns *notifyingStatser) NotifyFlush(ctx context.Context, d time.Duration) {
+	ns.notified <- d
+}
+
+func TestFlusherWarmup(t *testing.T) {
+	t.Parallel()
+	for _, discard := range []bool{false, true} {
+		discard := discard
+		t.Run(fmt.Sprintf("discard=%t", discard), func(t *testing.T) {
+			t.Parallel()
+			ma := newFakeAggregator()
+			mm := gostatsd.NewMetricMap()
+			mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+			ma.ReceiveMap(mm)
+
+			flushed := make(chan int64, 10)
+			fh := FlushHandlerFunc(func(ctx context.Context, mm *gostatsd.MetricMap) {
+				flushed <- mm.Counters["c"][""].Value
+			})
+			fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, nil, FlusherConfig{FlushInterval: 10 * time.Second, FlushHandlers: []FlushHandler{fh}, Warmup: 15 * time.Second, WarmupDiscard: discard})
+
+			var wg wait.Group
+			defer wg.Wait()
+			ctx, cancelFunc := context.WithCancel(context.Background())
+			defer cancelFunc()
+			clck := clock.NewMock(time.Unix(0, 0))
+			statser := &notifyingStatser{notified: make(chan time.Duration, 10)}
+			ctx = stats.NewContext(clock.Context(ctx, clck), statser)
+			wg.StartWithContext(ctx, fl.Run)
+
+			// The flush at 10s is during the warmup, wait for the ticker to be created and tick
+			for _, d := clck.AddNext(); d == 0 && ctx.Err() == nil; _, d = clck.AddNext() {
+				time.Sleep(time.Millisecond)
+			}
+			<-statser.notified
+			require.Empty(t, flushed)
+
+			clck.Add(10 * time.Second)
+			<-statser.notified
+			if discard {
+				assert.EqualValues(t, 0, <-flushed) // The counter is kept until it expires, without its value
+			} else {
+				assert.EqualValues(t, 1, <-flushed)
+			}
+		})
+	}
+}
+
+func TestRenameNamespace(t *testing.T) {
+	t.Parallel()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "legacy.c", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"t:1"}})
+	mm.Receive(&gostatsd.Metric{Name: "legacy.g", Value: 2, Rate: 1, Type: gostatsd.GAUGE})
+	mm.Receive(&gostatsd.Metric{Name: "legacy.t", Value: 3, Rate: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "legacy.s", StringValue: "a", Rate: 1, Type: gostatsd.SET})
+	mm.Receive(&gostatsd.Metric{Name: "legacyc", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+
+	renamed := renameNamespace(mm, "legacy", "new")
+	assert.Equal(t, []string{"new.c", "new.g", "new.s", "new.t"}, metricNames(renamed))
+	assert.Equal(t, mm.Counters["legacy.c"], renamed.Counters["new.c"])
+	assert.Equal(t, mm.Timers["legacy.t"], renamed.Timers["new.t"])
+
+	assert.Equal(t, []string{"new.legacy.c", "new.legacy.g", "new.legacy.s", "new.legacy.t", "new.legacyc"}, metricNames(renameNamespace(mm, "", "new")))
+}
+
+// metricNames returns the sorted names of every metric in mm.
+func metricNames(mm *gostatsd.MetricMap) []string {
+	var names []string
+	for _, m := range mm.AsMetrics() {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFlusherTopMetrics(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	for i := 0; i < 3; i++ {
+		tags := gostatsd.Tags{"i:" + strconv.Itoa(i)}
+		mm.Receive(&gostatsd.Metric{Name: "busy", Value: 10, Rate: 1, Type: gostatsd.COUNTER, Tags: tags})
+		mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 0.5, Type: gostatsd.TIMER, Tags: tags})
+		mm.Receive(&gostatsd.Metric{Name: "s", StringValue: strconv.Itoa(i), Rate: 1, Type: gostatsd.SET})
+	}
+	mm.Receive(&gostatsd.Metric{Name: "quiet", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "sampled", Value: 1, Rate: 0.01, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+	ma.ReceiveMap(mm)
+
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, nil, FlusherConfig{})
+	assert.Equal(t, web.TopMetrics{
+		Counters: []web.MetricVolume{{Name: "sampled", Volume: 100, Series: 1}, {Name: "busy", Volume: 30, Series: 3}},
+		Timers:   []web.MetricVolume{{Name: "t", Volume: 6, Series: 3}},
+		Sets:     []web.MetricVolume{{Name: "s", Volume: 3, Series: 1}},
+	}, fl.TopMetrics(context.Background(), 2))
+
+	fl = NewMetricFlusher(nil, nil, FlusherConfig{})
+	assert.Equal(t, web.TopMetrics{}, fl.TopMetrics(context.Background(), 2))
+}
+
+func TestFlusherLastFlush(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 3, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 5, Rate: 1, Type: gostatsd.TIMER})
+	ma.ReceiveMap(mm)
+
+	lastFlush := NewLastFlush()
+	flushed, _ := lastFlush.LastFlush()
+	assert.Nil(t, flushed)
+
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, nil, FlusherConfig{LastFlush: lastFlush})
+	fl.flushData(context.Background(), time.Second, stats.NewNullStatser())
+
+	flushed, _ = lastFlush.LastFlush()
+	assert.EqualValues(t, 3, flushed.Counters["c"][""].Value)
+	assert.Equal(t, 1, flushed.Timers["t"][""].Count)
+	assert.Nil(t, flushed.Timers["t"][""].Values)
+
+	// The aggregator has been reset, but the last flush is unaffected
+	assert.EqualValues(t, 0, ma.metricMap.Counters["c"][""].Value)
+	assert.EqualValues(t, 3, flushed.Counters["c"][""].Value)
+}
+
+func TestFlusherFlushHandlers(t *testing.T) {
+	t.Parallel()
+	for _, dryRun := range []bool{false, true} {
+		dryRun := dryRun
+		t.Run(strconv.FormatBool(dryRun), func(t *testing.T) {
+			t.Parallel()
+			ma := newFakeAggregator()
+			mm := gostatsd.NewMetricMap()
+			mm.Receive(&gostatsd.Metric{Name: "c", Value: 3, Rate: 1, Type: gostatsd.COUNTER})
+			ma.ReceiveMap(mm)
+
+			var handled []int64
+			fh := FlushHandlerFunc(func(ctx context.Context, m *gostatsd.MetricMap) {
+				handled = append(handled, m.Counters["c"][""].Value)
+			})
+			fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, nil, FlusherConfig{DryRun: dryRun, FlushHandlers: []FlushHandler{fh, fh}})
+			fl.flushData(context.Background(), time.Second, stats.NewNullStatser())
+
+			assert.Equal(t, []int64{3, 3}, handled)
+		})
+	}
+}
+
+// timingStatser records the names and tags of timings sent to it.
+type timingStatser struct {
+	stats.NullStatser
+	mu      sync.Mutex
+	timings map[string][]gostatsd.Tags
+}
+
+func (ts *timingStatser) TimingDuration(name string, d time.Duration, tags gostatsd.Tags) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.timings[name] = append(ts.timings[name], tags)
+}
+
+func TestFlusherBackendTimings(t *testing.T) {
+	t.Parallel()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 3, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+
+	statser := &timingStatser{timings: map[string][]gostatsd.Tags{}}
+	backends := []gostatsd.Backend{&countingBackend{}, &failingBackend{}}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, backends, FlusherConfig{})
+	fl.flushData(context.Background(), time.Second, statser)
+
+	expected := []gostatsd.Tags{{"backend:countingBackend"}, {"backend:failingBackend"}}
+	assert.Equal(t, expected, statser.timings["flusher.backend_queue_time"])
+	assert.ElementsMatch(t, expected, statser.timings["flusher.backend_send_time"])
+}
+
+func TestFlusherPause(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	statser := stats.NewNullStatser()
+	ma := newFakeAggregator()
+	backend := &countingBackend{}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{PauseMaxSeries: 3})
+
+	receive := func(names ...string) {
+		mm := gostatsd.NewMetricMap()
+		for _, name := range names {
+			mm.Receive(&gostatsd.Metric{Name: name, Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+		}
+		ma.ReceiveMap(mm)
+	}
+
+	fl.Pause()
+	assert.True(t, fl.Paused())
+	receive("a", "b")
+	assert.False(t, fl.flush(ctx, time.Second, time.Second, false, statser, nil))
+	receive("a")
+	assert.False(t, fl.flush(ctx, time.Second, 2*time.Second, false, statser, nil))
+	assert.EqualValues(t, 0, atomic.LoadUint64(&backend.metrics))
+	assert.EqualValues(t, 2, ma.metricMap.Counters["a"][""].Value) // Still aggregating
+
+	// Buffering too many series forces a flush
+	receive("c")
+	assert.True(t, fl.flush(ctx, time.Second, 3*time.Second, false, statser, nil))
+	assert.EqualValues(t, 3, atomic.LoadUint64(&backend.metrics))
+
+	// An explicit flush ignores the pause
+	receive("a")
+	assert.True(t, fl.flush(ctx, time.Second, time.Second, true, statser, nil))
+	assert.EqualValues(t, 4, atomic.LoadUint64(&backend.metrics))
+
+	fl.Resume()
+	assert.False(t, fl.Paused())
+	receive("a")
+	assert.True(t, fl.flush(ctx, time.Second, time.Second, false, statser, nil))
+	assert.EqualValues(t, 5, atomic.LoadUint64(&backend.metrics))
+}
+
+func TestFlusherPauseExpiry(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	statser := stats.NewNullStatser()
+	ma := newFakeAggregator()
+	backend := &failingBackend{err: errors.New("down")}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{PauseExpiry: true})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Timestamp: gostatsd.Nanotime(time.Now().UnixNano())})
+	ma.ReceiveMap(mm)
+	fl.flushData(ctx, time.Second, statser)
+	ma.now = func() time.Time {
+		return time.Now().Add(time.Hour)
+	}
+
+	// The last send failed, so the gauge is not expired
+	fl.flushData(ctx, time.Second, statser)
+	assert.Contains(t, ma.metricMap.Gauges, "g")
+
+	// The backend has recovered, but the result is not known until after the aggregator is reset
+	backend.err = nil
+	fl.flushData(ctx, time.Second, statser)
+	assert.Contains(t, ma.metricMap.Gauges, "g")
+
+	fl.flushData(ctx, time.Second, statser)
+	assert.NotContains(t, ma.metricMap.Gauges, "g")
+
+	// Metrics are not expired by a flush forced while paused
+	ma.ReceiveMap(mm)
+	fl.Pause()
+	fl.flushData(ctx, time.Second, statser)
+	assert.Contains(t, ma.metricMap.Gauges, "g")
+}
+
+// summingBackend sums the values of the counters it successfully sends, and fails while err is set.
+type summingBackend struct {
+	lock sync.Mutex
+	err  error
+	sum  int64
+}
+
+func (sb *summingBackend) Name() string {
+	return "summingBackend"
+}
+
+func (sb *summingBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	sb.lock.Lock()
+	err := sb.err
+	if err == nil {
+		mm.Counters.Each(func(name, tagsKey string, c gostatsd.Counter) {
+			sb.sum += c.Value
+		})
+	}
+	sb.lock.Unlock()
+	cb([]error{err})
+}
+
+func (sb *summingBackend) SendEvent(ctx context.Context, e *gostatsd.Event) error {
+	return nil
+}
+
+func TestFlusherBackendFailure(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		policy    string
+		maxSeries uint64
+		expected  int64 // The sum of the counters sent by the backend
+		dropped   float64
+	}{
+		{name: "drop", policy: gostatsd.BackendFailureDrop, expected: 4},
+		{name: "retry", policy: gostatsd.BackendFailureRetry, expected: 2 + 4, dropped: 1},
+		{name: "block", policy: gostatsd.BackendFailureBlock, expected: 1 + 2 + 4},
+		{name: "block limited", policy: gostatsd.BackendFailureBlock, maxSeries: 1, expected: 2 + 4, dropped: 1},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			statser := &flushStatser{gaugeStatser: gaugeStatser{gauges: map[string]float64{}}, counts: map[string]float64{}}
+			ma := newFakeAggregator()
+			backend := &summingBackend{err: errors.New("down")}
+			fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{FailurePolicy: test.policy, FailureMaxSeries: test.maxSeries})
+
+			receive := func(value float64) {
+				mm := gostatsd.NewMetricMap()
+				mm.Receive(&gostatsd.Metric{Name: "c", Value: value, Rate: 1, Type: gostatsd.COUNTER})
+				ma.ReceiveMap(mm)
+			}
+			receive(1)
+			fl.flushData(ctx, time.Second, statser)
+			receive(2)
+			fl.flushData(ctx, time.Second, statser)
+			backend.err = nil
+			receive(4)
+			fl.flushData(ctx, time.Second, statser)
+
+			assert.Equal(t, test.expected, backend.sum)
+			assert.Equal(t, test.dropped, statser.counts["flusher.retained_series_dropped"])
+			assert.Zero(t, fl.retainedSeries())
+		})
+	}
+}
+
+func TestFlusherBackendFailureOneBackendSucceeds(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ma := newFakeAggregator()
+	failing := &summingBackend{err: errors.New("down")}
+	working := &summingBackend{}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{failing, working}, FlusherConfig{FailurePolicy: gostatsd.BackendFailureBlock})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+	fl.flushData(ctx, time.Second, stats.NewNullStatser())
+
+	// Metrics are only retained if every backend fails to send them
+	assert.Zero(t, fl.retainedSeries())
+	assert.EqualValues(t, 1, working.sum)
+}
+
+// emptyBackend has nothing to send, as if every metric was filtered out.
+type emptyBackend struct {
+	summingBackend
+}
+
+func (eb *emptyBackend) SendMetricsAsync(ctx context.Context, mm *gostatsd.MetricMap, cb gostatsd.SendCallback) {
+	cb([]error{gostatsd.ErrNothingToSend})
+}
+
+func TestFlusherBackendFailureOtherBackendHasNothingToSend(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ma := newFakeAggregator()
+	failing := &summingBackend{err: errors.New("down")}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{failing, &emptyBackend{}}, FlusherConfig{FailurePolicy: gostatsd.BackendFailureBlock})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+	fl.flushData(ctx, time.Second, stats.NewNullStatser())
+
+	// A backend with nothing to send is not a success, so the metrics are retained and expiry is paused
+	assert.EqualValues(t, 1, fl.retainedSeries())
+	assert.Zero(t, fl.lastFlush)
+	assert.True(t, fl.expiryPaused())
+}
+
+func TestFlusherBackendPermanentFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	statser := &flushStatser{gaugeStatser: gaugeStatser{gauges: map[string]float64{}}, counts: map[string]float64{}}
+	ma := newFakeAggregator()
+	backend := &summingBackend{err: gostatsd.Permanent(errors.New("unauthorized"))}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, []gostatsd.Backend{backend}, FlusherConfig{FailurePolicy: gostatsd.BackendFailureBlock})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ma.ReceiveMap(mm)
+	fl.flushData(ctx, time.Second, statser)
+
+	// Metrics which every backend rejected permanently are not sent again
+	assert.Zero(t, fl.retainedSeries())
+	assert.EqualValues(t, 1, statser.counts["flusher.permanent_failures"])
+}
+
+func TestCopyMetricMap(t *testing.T) {
+	t.Parallel()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER})
+	mm.Receive(&gostatsd.Metric{Name: "s", StringValue: "a", Rate: 1, Type: gostatsd.SET})
+	c := copyMetricMap(mm)
+	assert.Equal(t, mm, c)
+
+	mm.Timers["t"][""].Values[0] = 2
+	mm.Sets["s"][""].Values["b"] = struct{}{}
+	assert.Equal(t, []float64{1}, c.Timers["t"][""].Values)
+	assert.Len(t, c.Sets["s"][""].Values, 1)
+}
+
+// flushStatser records the last value of each gauge, and the total of each counter, sent to it.
+type flushStatser struct {
+	gaugeStatser
+	counts map[string]float64
+}
+
+func (fs *flushStatser) Count(name string, amount float64, tags gostatsd.Tags) {
+	fs.counts[name] += amount
+}
+
+func TestFlusherFlushesAndUptime(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	statser := &flushStatser{gaugeStatser: gaugeStatser{gauges: map[string]float64{}}, counts: map[string]float64{}}
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: newFakeAggregator()}, nil, FlusherConfig{})
+	fl.started = time.Now().Add(-time.Minute)
+
+	fl.flush(ctx, time.Second, time.Second, false, statser, nil)
+	fl.flush(ctx, time.Second, time.Second, false, statser, nil)
+	assert.EqualValues(t, 2, statser.counts["flushes_total"])
+	assert.GreaterOrEqual(t, statser.gauges["uptime_seconds"], float64(60))
+
+	// Paused flushes are not counted
+	fl.Pause()
+	fl.flush(ctx, time.Second, time.Second, false, statser, nil)
+	assert.EqualValues(t, 2, statser.counts["flushes_total"])
+}
+
+func TestFlusherFlushesAndUptimeNamespace(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ch := &capturingHandler{}
+	statser := stats.NewInternalStatser(nil, "statsd", gostatsd.UnknownSource, ch)
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: newFakeAggregator()}, nil, FlusherConfig{})
+	fl.started = time.Now().Add(-time.Minute)
+
+	fl.flush(ctx, time.Second, time.Second, false, statser, nil)
+	statser.NotifyFlush(ctx, time.Second)
+	require.NotEmpty(t, ch.mm)
+	mm := ch.mm[len(ch.mm)-1]
+	assert.Contains(t, mm.Counters, "statsd.flushes_total")
+	assert.Contains(t, mm.Gauges, "statsd.uptime_seconds")
+}
+
+func TestFlushLag(t *testing.T) {
+	t.Parallel()
+	scheduled := time.Unix(10, 0)
+	assert.Equal(t, time.Duration(0), flushLag(scheduled, scheduled))
+	assert.Equal(t, 250*time.Millisecond, flushLag(scheduled, scheduled.Add(250*time.Millisecond)))
+	assert.Equal(t, time.Duration(0), flushLag(scheduled, scheduled.Add(-time.Second)))
+}
@@ -0,0 +1,164 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// GaugeState writes the most recent value of every gauge to a file after each flush, and restores them when the
+// server starts, so that gauges are sent after a restart before they are received again.  It is best effort, a
+// file which can't be read or written is logged, and doesn't stop the server.
+type GaugeState struct {
+	path   string
+	expiry time.Duration // Gauges older than this are not restored, 0 to restore every gauge
+	logger logrus.FieldLogger
+	now    func() time.Time
+
+	lock    sync.Mutex
+	entries []gaugeStateEntry // The gauges of each Aggregator in the current flush
+}
+
+// gaugeStateEntry is a single gauge written to the file, as a line of JSON.
+type gaugeStateEntry struct {
+	Name      string            `json:"name"`
+	TagsKey   string            `json:"tags_key"`
+	Value     float64           `json:"value"`
+	Timestamp gostatsd.Nanotime `json:"timestamp"`
+	Source    gostatsd.Source   `json:"source,omitempty"`
+	Tags      gostatsd.Tags     `json:"tags,omitempty"`
+}
+
+// NewGaugeState returns a GaugeState which keeps the gauges in the file at path.
+func NewGaugeState(path string, expiry time.Duration, logger logrus.FieldLogger) *GaugeState {
+	return &GaugeState{
+		path:   path,
+		expiry: expiry,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Restore reads the gauges from the file and dispatches them to the handler, which should be the BackendHandler
+// so they are not tagged again.  They keep the timestamp they were last received at, so a gauge received since the
+// server started replaces its restored value.  A missing file is not an error, as it is expected on the first start.
+func (gs *GaugeState) Restore(ctx context.Context, handler gostatsd.PipelineHandler) {
+	mm, err := gs.load()
+	if err != nil {
+		if os.IsNotExist(err) {
+			gs.logger.WithField("file", gs.path).Info("No gauge state to restore")
+		} else {
+			gs.logger.WithError(err).WithField("file", gs.path).Warn("Failed to restore gauge state")
+		}
+		return
+	}
+	gauges := 0
+	mm.Gauges.Each(func(string, string, gostatsd.Gauge) {
+		gauges++
+	})
+	if gauges > 0 {
+		handler.DispatchMetricMap(ctx, mm)
+	}
+	gs.logger.WithFields(logrus.Fields{
+		"file":   gs.path,
+		"gauges": gauges,
+	}).Info("Restored gauge state")
+}
+
+func (gs *GaugeState) load() (*gostatsd.MetricMap, error) {
+	f, err := os.Open(gs.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	nowNano := gostatsd.Nanotime(gs.now().UnixNano())
+	mm := gostatsd.NewMetricMap()
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var entry gaugeStateEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			return mm, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if isExpired(gs.expiry, nowNano, entry.Timestamp) {
+			continue
+		}
+		// The Count is 0 so the mean of an average gauge is the restored value until another value is received.
+		mm.MergeGauge(entry.Name, entry.TagsKey, gostatsd.Gauge{
+			Value:     entry.Value,
+			Timestamp: entry.Timestamp,
+			Source:    entry.Source,
+			Tags:      entry.Tags,
+		})
+	}
+}
+
+// add keeps the gauges of an Aggregator to be written by the next save.  It is called by the MetricFlusher in the
+// context of each Aggregator after it is Reset.
+func (gs *GaugeState) add(gauges gostatsd.Gauges) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+	gauges.Each(func(name, tagsKey string, g gostatsd.Gauge) {
+		if math.IsNaN(g.Value) || math.IsInf(g.Value, 0) {
+			return // Can't be represented in JSON
+		}
+		gs.entries = append(gs.entries, gaugeStateEntry{
+			Name:      name,
+			TagsKey:   tagsKey,
+			Value:     g.Value,
+			Timestamp: g.Timestamp,
+			Source:    g.Source,
+			Tags:      g.Tags,
+		})
+	})
+}
+
+// save writes the gauges from every Aggregator to the file, replacing the previous state, and starts collecting the
+// next flush.  A temporary file is renamed over the file, so it is never partially written.
+func (gs *GaugeState) save() {
+	gs.lock.Lock()
+	entries := gs.entries
+	gs.entries = nil
+	gs.lock.Unlock()
+
+	if err := gs.write(entries); err != nil {
+		gs.logger.WithError(err).WithField("file", gs.path).Warn("Failed to save gauge state")
+	}
+}
+
+func (gs *GaugeState) write(entries []gaugeStateEntry) error {
+	tmpPath := gs.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for i := range entries {
+		if err = encoder.Encode(&entries[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, gs.path)
+}
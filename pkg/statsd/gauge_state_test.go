@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/stats"
+)
+
+func TestGaugeStateFlushAndRestore(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "gauges.json")
+	now := gostatsd.NanoNow()
+	ma := newFakeAggregator()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 5, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"t:1"}, Source: "1.2.3.4", Timestamp: now})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 6, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"t:2"}, Timestamp: now})
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Timestamp: now})
+	ma.ReceiveMap(mm)
+
+	fl := NewMetricFlusher(&singleAggregateProcesser{aggr: ma}, nil, FlusherConfig{GaugeState: NewGaugeState(path, 0, logrus.New())})
+	fl.flushData(context.Background(), time.Second, stats.NewNullStatser())
+
+	ch := &capturingHandler{}
+	NewGaugeState(path, time.Minute, logrus.New()).Restore(context.Background(), ch)
+	require.Len(t, ch.mm, 1)
+	restored := ch.mm[0]
+	assert.Empty(t, restored.Counters)
+	require.Contains(t, restored.Gauges, "g")
+	assert.Len(t, restored.Gauges, 1)
+	for tagsKey, g := range ma.metricMap.Gauges["g"] {
+		assert.Equal(t, gostatsd.Gauge{
+			Value:     g.Value,
+			Timestamp: g.Timestamp,
+			Source:    g.Source,
+			Tags:      g.Tags,
+		}, restored.Gauges["g"][tagsKey])
+	}
+	assert.Len(t, restored.Gauges["g"], 2)
+}
+
+func TestGaugeStateRestoreSkipsExpired(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "gauges.json")
+	now := time.Unix(1000, 0)
+	gs := NewGaugeState(path, time.Minute, logrus.New())
+	gs.now = func() time.Time { return now }
+	gs.add(gostatsd.Gauges{
+		"old": {"": {Value: 1, Timestamp: gostatsd.Nanotime(now.Add(-2 * time.Minute).UnixNano())}},
+		"new": {"": {Value: 2, Timestamp: gostatsd.Nanotime(now.Add(-30 * time.Second).UnixNano())}},
+		"nan": {"": {Value: math.NaN(), Timestamp: gostatsd.Nanotime(now.UnixNano())}}, // Can't be written as JSON
+	})
+	gs.save()
+	assert.Empty(t, gs.entries)
+
+	ch := &capturingHandler{}
+	gs.Restore(context.Background(), ch)
+	require.Len(t, ch.mm, 1)
+	assert.Equal(t, gostatsd.Gauges{
+		"new": {"": {Value: 2, Timestamp: gostatsd.Nanotime(now.Add(-30 * time.Second).UnixNano())}},
+	}, ch.mm[0].Gauges)
+}
+
+func TestGaugeStateRestoreInvalidFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ch := &capturingHandler{}
+
+	// A missing file is expected on the first start
+	NewGaugeState(filepath.Join(dir, "missing.json"), 0, logrus.New()).Restore(context.Background(), ch)
+	assert.Empty(t, ch.mm)
+
+	path := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"name":"g","value":1}`+"\n{"), 0644))
+	NewGaugeState(path, 0, logrus.New()).Restore(context.Background(), ch)
+	assert.Empty(t, ch.mm)
+}
+
+func TestGaugeStateSaveFailure(t *testing.T) {
+	t.Parallel()
+	gs := NewGaugeState(filepath.Join(t.TempDir(), "missing", "gauges.json"), 0, logrus.New())
+	gs.add(gostatsd.Gauges{"g": {"": {Value: 1}}})
+	gs.save() // Logged, rather than stopping the flush
+	assert.Empty(t, gs.entries)
+}
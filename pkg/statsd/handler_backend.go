@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ash2k/stager/wait"
@@ -13,6 +14,10 @@ import (
 	"github.com/atlassian/gostatsd/pkg/stats"
 )
 
+// queueWaitSampleInterval is how often the time DispatchMetricMap waits for the queue of each aggregator is timed,
+// one in every queueWaitSampleInterval dispatches.
+const queueWaitSampleInterval = 100
+
 // AggregatorFactory creates Aggregator objects.
 type AggregatorFactory interface {
 	// Create creates Aggregator objects.
@@ -29,6 +34,15 @@ func (f AggregatorFactoryFunc) Create() Aggregator {
 
 // BackendEventHandler dispatches metrics and events to all configured backends (via Aggregators)
 type BackendHandler struct {
+	// Counter fields below must be read/written only using atomic instructions.
+	// 64-bit fields must be the first fields in the struct to guarantee proper memory alignment.
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	metricsSinceFlush uint64 // Number of metrics dispatched since the last flush
+	dispatches        uint64 // Number of calls to DispatchMetricMap, to sample aggregator.queue_wait
+
+	flushMaxMetrics uint64        // Number of metrics which triggers an early flush, 0 to disable
+	flushRequired   chan struct{} // Signalled when flushMaxMetrics is exceeded, nil if disabled
+
 	eventWg          sync.WaitGroup
 	backends         []gostatsd.Backend
 	concurrentEvents chan struct{}
@@ -38,7 +52,7 @@ type BackendHandler struct {
 }
 
 // NewBackendHandler initialises a new Handler which sends metrics and events to all backends
-func NewBackendHandler(backends []gostatsd.Backend, maxConcurrentEvents uint, numWorkers int, perWorkerBufferSize int, af AggregatorFactory) *BackendHandler {
+func NewBackendHandler(backends []gostatsd.Backend, maxConcurrentEvents uint, numWorkers int, perWorkerBufferSize int, af AggregatorFactory, flushMaxMetrics uint64) *BackendHandler {
 	workers := make([]*worker, numWorkers)
 
 	for i := 0; i < numWorkers; i++ {
@@ -51,7 +65,15 @@ func NewBackendHandler(backends []gostatsd.Backend, maxConcurrentEvents uint, nu
 		}
 	}
 
+	var flushRequired chan struct{}
+	if flushMaxMetrics > 0 {
+		flushRequired = make(chan struct{}, 1)
+	}
+
 	return &BackendHandler{
+		flushMaxMetrics: flushMaxMetrics,
+		flushRequired:   flushRequired,
+
 		backends:         backends,
 		concurrentEvents: make(chan struct{}, maxConcurrentEvents),
 
@@ -121,21 +143,76 @@ func (bh *BackendHandler) EstimatedTags() int {
 	return 0
 }
 
-// DispatchMetricMap splits a MetricMap in to per-aggregator buckets and distributes it.
+// DispatchMetricMap splits a MetricMap in to per-aggregator buckets and distributes it.  The time spent waiting for
+// the queue of each aggregator to accept its bucket is sampled, and sent as the aggregator.queue_wait timer, to show
+// whether the aggregators are keeping up with the parsers.
 func (bh *BackendHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.MetricMap) {
+	if bh.flushRequired != nil {
+		bh.countMetrics(mm)
+	}
+
 	maps := mm.Split(bh.numWorkers)
+	sampled := atomic.AddUint64(&bh.dispatches, 1)%queueWaitSampleInterval == 0
 
 	for aggrIdx, mmSplit := range maps {
 		if !mmSplit.IsEmpty() {
 			w := bh.workers[aggrIdx]
+			var started time.Time
+			if sampled {
+				started = time.Now()
+			}
 			select {
 			case <-ctx.Done():
 			case w.metricMapQueue <- mmSplit:
 			}
+			if sampled {
+				tags := gostatsd.Tags{fmt.Sprintf("aggregator_id:%d", aggrIdx)}
+				stats.FromContext(ctx).TimingDuration("aggregator.queue_wait", time.Since(started), tags)
+			}
+		}
+	}
+}
+
+// countMetrics adds the number of metrics in the MetricMap to the count since the last flush, and signals
+// that a flush is required if it exceeds flushMaxMetrics.
+func (bh *BackendHandler) countMetrics(mm *gostatsd.MetricMap) {
+	var count uint64
+	for _, c := range mm.Counters {
+		count += uint64(len(c))
+	}
+	for _, t := range mm.Timers {
+		count += uint64(len(t))
+	}
+	for _, g := range mm.Gauges {
+		count += uint64(len(g))
+	}
+	for _, s := range mm.Sets {
+		count += uint64(len(s))
+	}
+	if atomic.AddUint64(&bh.metricsSinceFlush, count) >= bh.flushMaxMetrics {
+		select {
+		case bh.flushRequired <- struct{}{}:
+		default: // A flush has already been requested
 		}
 	}
 }
 
+// FlushRequired returns a channel which is signalled when the number of metrics dispatched since the last
+// flush exceeds the configured limit.  The channel is nil if the limit is disabled.
+func (bh *BackendHandler) FlushRequired() <-chan struct{} {
+	return bh.flushRequired
+}
+
+// FlushStarted resets the number of metrics dispatched since the last flush, and clears any pending request
+// for an early flush, as the metrics which caused it are included in this flush.
+func (bh *BackendHandler) FlushStarted() {
+	atomic.StoreUint64(&bh.metricsSinceFlush, 0)
+	select {
+	case <-bh.flushRequired:
+	default:
+	}
+}
+
 // Process concurrently executes provided function in goroutines that own Aggregators.
 // DispatcherProcessFunc function may be executed zero or up to numWorkers times. It is executed
 // less than numWorkers times if the context signals "done".
@@ -101,14 +101,14 @@ func TestNewBackendHandlerShouldCreateCorrectNumberOfWorkers(t *testing.T) {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	n := r.Intn(5) + 1
 	factory := newTestFactory()
-	h := NewBackendHandler(nil, 0, n, 1, factory)
+	h := NewBackendHandler(nil, 0, n, 1, factory, 0)
 	assert.Equal(t, n, len(h.workers))
 	assert.Equal(t, n, factory.numAgrs)
 }
 
 func TestRunShouldReturnWhenContextCancelled(t *testing.T) {
 	t.Parallel()
-	h := NewBackendHandler(nil, 0, 5, 1, newTestFactory())
+	h := NewBackendHandler(nil, 0, 5, 1, newTestFactory(), 0)
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	cancelFunc()
 	h.Run(ctx)
@@ -120,7 +120,7 @@ func TestDispatchMetricMapShouldDistributeMetrics(t *testing.T) {
 	numAggregators := r.Intn(5) + 1
 	factory := newTestFactory()
 	// use a sync channel (perWorkerBufferSize = 0) to force the workers to process events before the context is cancelled
-	h := NewBackendHandler(nil, 0, numAggregators, 0, factory)
+	h := NewBackendHandler(nil, 0, numAggregators, 0, factory, 0)
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
 	var wgFinish wait.Group
@@ -158,7 +158,7 @@ func TestDispatchMetricMapShouldDistributeMetrics(t *testing.T) {
 
 func TestBackendHandlerDispatchMetricMapTerminates(t *testing.T) {
 	t.Parallel()
-	h := NewBackendHandler(nil, 0, 1, 0, newTestFactory())
+	h := NewBackendHandler(nil, 0, 1, 0, newTestFactory(), 0)
 	cancelledCtx, cancelFunc := context.WithCancel(context.Background())
 	cancelFunc()
 	mm := gostatsd.NewMetricMap()
@@ -176,7 +176,7 @@ func TestBackendHandlerDispatchMetricMapTerminates(t *testing.T) {
 
 func TestBackendHandlerProcessTerminates(t *testing.T) {
 	t.Parallel()
-	h := NewBackendHandler(nil, 0, 1, 0, newTestFactory())
+	h := NewBackendHandler(nil, 0, 1, 0, newTestFactory(), 0)
 	cancelledCtx, cancelFunc := context.WithCancel(context.Background())
 	cancelFunc()
 	// perWorkerBufferSize is 0 (blocking channel), and we never call BackendHandler.Run, so we can be sure to
@@ -184,3 +184,97 @@ func TestBackendHandlerProcessTerminates(t *testing.T) {
 	waitFunc := h.Process(cancelledCtx, nil)
 	waitFunc()
 }
+
+func TestBackendHandlerFlushRequired(t *testing.T) {
+	t.Parallel()
+	h := NewBackendHandler(nil, 0, 1, 10, newTestFactory(), 3)
+	ctx := context.Background()
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c1", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "c2", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+
+	h.DispatchMetricMap(ctx, mm)
+	assert.Len(t, h.FlushRequired(), 0)
+	h.DispatchMetricMap(ctx, mm)
+	assert.Len(t, h.FlushRequired(), 1)
+	h.DispatchMetricMap(ctx, mm) // Does not block when a flush is already requested
+	assert.Len(t, h.FlushRequired(), 1)
+
+	h.FlushStarted()
+	assert.Len(t, h.FlushRequired(), 0)
+	h.DispatchMetricMap(ctx, mm)
+	assert.Len(t, h.FlushRequired(), 0)
+}
+
+func TestBackendHandlerFlushRequiredDisabled(t *testing.T) {
+	t.Parallel()
+	h := NewBackendHandler(nil, 0, 1, 1, newTestFactory(), 0)
+	assert.Nil(t, h.FlushRequired())
+}
+
+func TestBackendHandlerQueueWait(t *testing.T) {
+	t.Parallel()
+	h := NewBackendHandler(nil, 0, 1, 2*queueWaitSampleInterval, newTestFactory(), 0)
+	statser := &timingStatser{timings: map[string][]gostatsd.Tags{}}
+	ctx := stats.NewContext(context.Background(), statser)
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+
+	for i := 0; i < 2*queueWaitSampleInterval; i++ {
+		h.DispatchMetricMap(ctx, mm)
+	}
+	assert.Equal(t, []gostatsd.Tags{{"aggregator_id:0"}, {"aggregator_id:0"}}, statser.timings["aggregator.queue_wait"])
+}
+
+// BenchmarkDispatchMetricMap compares dispatching each metric in its own MetricMap with dispatching them as a
+// single batch, which is merged before it is queued, and received by the aggregator in one call.
+func BenchmarkDispatchMetricMap(b *testing.B) {
+	metrics := make([]*gostatsd.Metric, 0, 100)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, &gostatsd.Metric{
+			Type:  gostatsd.COUNTER,
+			Name:  fmt.Sprintf("counter.metric.%d", i%10),
+			Value: 1,
+			Rate:  1,
+		})
+	}
+
+	run := func(b *testing.B, dispatch func(ctx context.Context, h *BackendHandler)) {
+		factory := AggregatorFactoryFunc(func() Aggregator {
+			return newFakeAggregator()
+		})
+		h := NewBackendHandler(nil, 0, 1, 0, factory, 0)
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		var wgFinish wait.Group
+		wgFinish.StartWithContext(ctx, h.Run)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			dispatch(ctx, h)
+		}
+		b.StopTimer()
+
+		cancelFunc()
+		wgFinish.Wait()
+	}
+
+	b.Run("per-metric", func(b *testing.B) {
+		run(b, func(ctx context.Context, h *BackendHandler) {
+			for _, m := range metrics {
+				mm := gostatsd.NewMetricMap()
+				mm.Receive(m)
+				h.DispatchMetricMap(ctx, mm)
+			}
+		})
+	})
+	b.Run("batch", func(b *testing.B) {
+		run(b, func(ctx context.Context, h *BackendHandler) {
+			mm := gostatsd.NewMetricMap()
+			for _, m := range metrics {
+				mm.Receive(m)
+			}
+			h.DispatchMetricMap(ctx, mm)
+		})
+	})
+}
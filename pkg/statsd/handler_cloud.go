@@ -33,12 +33,13 @@ type CloudHandler struct {
 	awaitingMetrics map[gostatsd.Source]*gostatsd.MetricMap
 	toLookupIPs     []gostatsd.Source
 	wg              sync.WaitGroup
+	precedence      *TagPrecedence // Optional, resolves tags with the same key
 
 	estimatedTags int
 }
 
-// NewCloudHandler initialises a new cloud handler.
-func NewCloudHandler(cachedInstances gostatsd.CachedInstances, handler gostatsd.PipelineHandler) *CloudHandler {
+// NewCloudHandler initialises a new cloud handler.  If precedence is not nil, only one tag is kept for each key.
+func NewCloudHandler(cachedInstances gostatsd.CachedInstances, handler gostatsd.PipelineHandler, precedence *TagPrecedence) *CloudHandler {
 	return &CloudHandler{
 		cachedInstances: cachedInstances,
 		handler:         handler,
@@ -47,6 +48,7 @@ func NewCloudHandler(cachedInstances gostatsd.CachedInstances, handler gostatsd.
 		emitChan:        make(chan stats.Statser),
 		awaitingEvents:  make(map[gostatsd.Source][]*gostatsd.Event),
 		awaitingMetrics: make(map[gostatsd.Source]*gostatsd.MetricMap),
+		precedence:      precedence,
 		estimatedTags:   handler.EstimatedTags() + cachedInstances.EstimatedTags(),
 	}
 }
@@ -60,28 +62,28 @@ func (ch *CloudHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.Metr
 	mmToDispatch := gostatsd.NewMetricMap()
 	mmToHandle := gostatsd.NewMetricMap()
 	mm.Counters.Each(func(metricName string, tagsKey string, c gostatsd.Counter) {
-		if ch.updateTagsAndHostname(&c, c.Source) {
+		if ch.updateTagsAndHostname(&c.Tags, &c.Source) {
 			mmToDispatch.MergeCounter(metricName, gostatsd.FormatTagsKey(c.Source, c.Tags), c)
 		} else {
 			mmToHandle.MergeCounter(metricName, tagsKey, c)
 		}
 	})
 	mm.Gauges.Each(func(metricName string, tagsKey string, g gostatsd.Gauge) {
-		if ch.updateTagsAndHostname(&g, g.Source) {
+		if ch.updateTagsAndHostname(&g.Tags, &g.Source) {
 			mmToDispatch.MergeGauge(metricName, gostatsd.FormatTagsKey(g.Source, g.Tags), g)
 		} else {
 			mmToHandle.MergeGauge(metricName, tagsKey, g)
 		}
 	})
 	mm.Timers.Each(func(metricName string, tagsKey string, t gostatsd.Timer) {
-		if ch.updateTagsAndHostname(&t, t.Source) {
+		if ch.updateTagsAndHostname(&t.Tags, &t.Source) {
 			mmToDispatch.MergeTimer(metricName, gostatsd.FormatTagsKey(t.Source, t.Tags), t)
 		} else {
 			mmToHandle.MergeTimer(metricName, tagsKey, t)
 		}
 	})
 	mm.Sets.Each(func(metricName string, tagsKey string, s gostatsd.Set) {
-		if ch.updateTagsAndHostname(&s, s.Source) {
+		if ch.updateTagsAndHostname(&s.Tags, &s.Source) {
 			mmToDispatch.MergeSet(metricName, gostatsd.FormatTagsKey(s.Source, s.Tags), s)
 		} else {
 			mmToHandle.MergeSet(metricName, tagsKey, s)
@@ -101,7 +103,7 @@ func (ch *CloudHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.Metr
 }
 
 func (ch *CloudHandler) DispatchEvent(ctx context.Context, e *gostatsd.Event) {
-	if ch.updateTagsAndHostname(e, e.Source) {
+	if ch.updateTagsAndHostname(&e.Tags, &e.Source) {
 		ch.handler.DispatchEvent(ctx, e)
 		return
 	}
@@ -263,19 +265,19 @@ func (ch *CloudHandler) handleIncomingEvent(e *gostatsd.Event) {
 func (ch *CloudHandler) updateAndDispatchMetrics(ctx context.Context, instance *gostatsd.Instance, mmIn *gostatsd.MetricMap) {
 	mmOut := gostatsd.NewMetricMap()
 	mmIn.Counters.Each(func(metricName string, tagsKey string, c gostatsd.Counter) {
-		updateInplace(&c, instance)
+		ch.updateInplace(&c.Tags, &c.Source, instance)
 		mmOut.MergeCounter(metricName, gostatsd.FormatTagsKey(c.Source, c.Tags), c)
 	})
 	mmIn.Gauges.Each(func(metricName string, tagsKey string, g gostatsd.Gauge) {
-		updateInplace(&g, instance)
+		ch.updateInplace(&g.Tags, &g.Source, instance)
 		mmOut.MergeGauge(metricName, gostatsd.FormatTagsKey(g.Source, g.Tags), g)
 	})
 	mmIn.Sets.Each(func(metricName string, tagsKey string, s gostatsd.Set) {
-		updateInplace(&s, instance)
+		ch.updateInplace(&s.Tags, &s.Source, instance)
 		mmOut.MergeSet(metricName, gostatsd.FormatTagsKey(s.Source, s.Tags), s)
 	})
 	mmIn.Timers.Each(func(metricName string, tagsKey string, t gostatsd.Timer) {
-		updateInplace(&t, instance)
+		ch.updateInplace(&t.Tags, &t.Source, instance)
 		mmOut.MergeTimer(metricName, gostatsd.FormatTagsKey(t.Source, t.Tags), t)
 	})
 	ch.handler.DispatchMetricMap(ctx, mmOut)
@@ -287,16 +289,16 @@ func (ch *CloudHandler) updateAndDispatchEvents(ctx context.Context, instance *g
 		ch.wg.Add(-dispatched)
 	}()
 	for _, e := range events {
-		updateInplace(e, instance)
+		ch.updateInplace(&e.Tags, &e.Source, instance)
 		dispatched++
 		ch.handler.DispatchEvent(ctx, e)
 	}
 }
 
-func (ch *CloudHandler) updateTagsAndHostname(obj TagChanger, source gostatsd.Source) bool /*is a cache hit*/ {
-	instance, cacheHit := ch.getInstance(source)
+func (ch *CloudHandler) updateTagsAndHostname(tags *gostatsd.Tags, source *gostatsd.Source) bool /*is a cache hit*/ {
+	instance, cacheHit := ch.getInstance(*source)
 	if cacheHit {
-		updateInplace(obj, instance)
+		ch.updateInplace(tags, source, instance)
 	}
 	return cacheHit
 }
@@ -314,8 +316,17 @@ func (ch *CloudHandler) getInstance(ip gostatsd.Source) (*gostatsd.Instance, boo
 	return instance, true
 }
 
-func updateInplace(obj TagChanger, instance *gostatsd.Instance) {
-	if instance != nil { // It was a positive cache hit (successful lookup cache, not failed lookup cache)
-		obj.AddTagsSetSource(instance.Tags, instance.ID)
+func (ch *CloudHandler) updateInplace(tags *gostatsd.Tags, source *gostatsd.Source, instance *gostatsd.Instance) {
+	if ch.precedence != nil {
+		// Tags are resolved even without an instance, as the TagHandler relies on it.
+		var cloudTags gostatsd.Tags
+		if instance != nil {
+			cloudTags = instance.Tags
+			*source = instance.ID
+		}
+		*tags = ch.precedence.resolveCloud(*tags, cloudTags)
+	} else if instance != nil { // It was a positive cache hit (successful lookup cache, not failed lookup cache)
+		*tags = tags.Concat(instance.Tags)
+		*source = instance.ID
 	}
 }
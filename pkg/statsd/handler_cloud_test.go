@@ -30,7 +30,7 @@ func BenchmarkCloudHandlerDispatchMetricMap(b *testing.B) {
 		CacheTTL:                  500 * time.Millisecond,
 		CacheNegativeTTL:          500 * time.Millisecond,
 	})
-	ch := NewCloudHandler(ci, nh)
+	ch := NewCloudHandler(ci, nh, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -68,7 +68,7 @@ func TestTransientInstanceFailure(t *testing.T) {
 		CacheTTL:                  1 * time.Millisecond,
 		CacheNegativeTTL:          1 * time.Millisecond,
 	})
-	ch := NewCloudHandler(ci, expecting)
+	ch := NewCloudHandler(ci, expecting, nil)
 
 	// t+0: instance is queried, goes in cache
 	// t+50ms: instance refreshed (failure)
@@ -221,7 +221,7 @@ func doCheck(
 		CacheTTL:                  gostatsd.DefaultCacheTTL,
 		CacheNegativeTTL:          gostatsd.DefaultCacheNegativeTTL,
 	})
-	ch := NewCloudHandler(ci, expecting)
+	ch := NewCloudHandler(ci, expecting, nil)
 
 	var wg wait.Group
 	defer wg.Wait()
@@ -0,0 +1,71 @@
+package statsd
+
+import (
+	"context"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// EnricherHandler calls each Enricher with every metric received, to add or modify its tags, before passing it to
+// the next handler.  Events are passed to the next handler unchanged.
+type EnricherHandler struct {
+	handler   gostatsd.PipelineHandler
+	enrichers []gostatsd.Enricher
+}
+
+// NewEnricherHandler initialises a new EnricherHandler which calls the enrichers in order.
+func NewEnricherHandler(handler gostatsd.PipelineHandler, enrichers []gostatsd.Enricher) *EnricherHandler {
+	return &EnricherHandler{
+		handler:   handler,
+		enrichers: enrichers,
+	}
+}
+
+// EstimatedTags returns a guess for how many tags to pre-allocate
+func (eh *EnricherHandler) EstimatedTags() int {
+	tags := eh.handler.EstimatedTags()
+	for _, enricher := range eh.enrichers {
+		tags += enricher.EstimatedTags()
+	}
+	return tags
+}
+
+// DispatchMetricMap enriches the tags of every metric, and passes them to the next handler.  Metrics which have the
+// same tags after being enriched are merged.
+func (eh *EnricherHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.MetricMap) {
+	mmNew := gostatsd.NewMetricMap()
+	mm.Counters.Each(func(metricName, _ string, c gostatsd.Counter) {
+		c.Tags = eh.enrich(metricName, c.Source, c.Tags)
+		mmNew.MergeCounter(metricName, gostatsd.FormatTagsKey(c.Source, c.Tags), c)
+	})
+	mm.Gauges.Each(func(metricName, _ string, g gostatsd.Gauge) {
+		g.Tags = eh.enrich(metricName, g.Source, g.Tags)
+		mmNew.MergeGauge(metricName, gostatsd.FormatTagsKey(g.Source, g.Tags), g)
+	})
+	mm.Timers.Each(func(metricName, _ string, t gostatsd.Timer) {
+		t.Tags = eh.enrich(metricName, t.Source, t.Tags)
+		mmNew.MergeTimer(metricName, gostatsd.FormatTagsKey(t.Source, t.Tags), t)
+	})
+	mm.Sets.Each(func(metricName, _ string, s gostatsd.Set) {
+		s.Tags = eh.enrich(metricName, s.Source, s.Tags)
+		mmNew.MergeSet(metricName, gostatsd.FormatTagsKey(s.Source, s.Tags), s)
+	})
+	eh.handler.DispatchMetricMap(ctx, mmNew)
+}
+
+func (eh *EnricherHandler) enrich(name string, source gostatsd.Source, tags gostatsd.Tags) gostatsd.Tags {
+	for _, enricher := range eh.enrichers {
+		tags = enricher.Enrich(name, source, tags)
+	}
+	return tags
+}
+
+// DispatchEvent passes the event to the next handler.
+func (eh *EnricherHandler) DispatchEvent(ctx context.Context, e *gostatsd.Event) {
+	eh.handler.DispatchEvent(ctx, e)
+}
+
+// WaitForEvents waits for all event-dispatching goroutines to finish.
+func (eh *EnricherHandler) WaitForEvents() {
+	eh.handler.WaitForEvents()
+}
@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// sourceEnricher tags every metric with the source it was received from.
+type sourceEnricher struct{}
+
+func (sourceEnricher) Name() string {
+	return "source"
+}
+
+func (sourceEnricher) Enrich(name string, source gostatsd.Source, tags gostatsd.Tags) gostatsd.Tags {
+	return append(tags, "from:"+string(source))
+}
+
+func (sourceEnricher) EstimatedTags() int {
+	return 1
+}
+
+// dropTagEnricher removes every tag.
+type dropTagEnricher struct{}
+
+func (dropTagEnricher) Name() string {
+	return "drop"
+}
+
+func (dropTagEnricher) Enrich(name string, source gostatsd.Source, tags gostatsd.Tags) gostatsd.Tags {
+	return nil
+}
+
+func (dropTagEnricher) EstimatedTags() int {
+	return 0
+}
+
+func TestEnricherHandler(t *testing.T) {
+	t.Parallel()
+	ch := &capturingHandler{}
+	eh := NewEnricherHandler(ch, []gostatsd.Enricher{sourceEnricher{}})
+	assert.Equal(t, 1, eh.EstimatedTags())
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Source: "h1"})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Source: "h1", Tags: gostatsd.Tags{"a"}})
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER, Source: "h2"})
+	mm.Receive(&gostatsd.Metric{Name: "s", StringValue: "x", Rate: 1, Type: gostatsd.SET, Source: "h2"})
+	eh.DispatchMetricMap(context.Background(), mm)
+
+	require.Len(t, ch.mm, 1)
+	result := ch.mm[0]
+	assert.Equal(t, gostatsd.Tags{"from:h1"}, result.Counters["c"][gostatsd.FormatTagsKey("h1", gostatsd.Tags{"from:h1"})].Tags)
+	assert.Equal(t, gostatsd.Tags{"a", "from:h1"}, result.Gauges["g"][gostatsd.FormatTagsKey("h1", gostatsd.Tags{"a", "from:h1"})].Tags)
+	assert.Contains(t, result.Timers["t"], gostatsd.FormatTagsKey("h2", gostatsd.Tags{"from:h2"}))
+	assert.Contains(t, result.Sets["s"], gostatsd.FormatTagsKey("h2", gostatsd.Tags{"from:h2"}))
+}
+
+func TestEnricherHandlerMerges(t *testing.T) {
+	t.Parallel()
+	ch := &capturingHandler{}
+	eh := NewEnricherHandler(ch, []gostatsd.Enricher{dropTagEnricher{}})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"a"}})
+	mm.Receive(&gostatsd.Metric{Name: "c", Value: 2, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"b"}})
+	eh.DispatchMetricMap(context.Background(), mm)
+
+	// Metrics with the same tags after being enriched are merged
+	require.Len(t, ch.mm, 1)
+	require.Len(t, ch.mm[0].Counters["c"], 1)
+	assert.EqualValues(t, 3, ch.mm[0].Counters["c"][""].Value)
+}
@@ -0,0 +1,128 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// NamePrefixTemplate is a prefix for metric names, which may refer to the value of a tag of the metric as
+// {<tag name>}, such as {account}. for the value of an account:<value> tag.
+type NamePrefixTemplate struct {
+	literals []string // The text between the tags, there is always one more than there are tags
+	tags     []string // The names of the tags, each with a trailing :
+}
+
+// NewNamePrefixTemplate parses a NamePrefixTemplate.
+func NewNamePrefixTemplate(template string) (*NamePrefixTemplate, error) {
+	npt := &NamePrefixTemplate{}
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("unexpected } in name prefix template %q", template)
+			}
+			npt.literals = append(npt.literals, rest)
+			return npt, nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated { in name prefix template %q", template)
+		}
+		tag := rest[start+1 : start+end]
+		if tag == "" || strings.ContainsAny(tag, "{:") || strings.IndexByte(rest[:start], '}') >= 0 {
+			return nil, fmt.Errorf("invalid tag name in name prefix template %q", template)
+		}
+		npt.literals = append(npt.literals, rest[:start])
+		npt.tags = append(npt.tags, tag+":")
+		rest = rest[start+end+1:]
+	}
+}
+
+// Prefix returns the prefix for a metric with the tags, and true, or false if the metric doesn't have every tag
+// in the template.
+func (npt *NamePrefixTemplate) Prefix(tags gostatsd.Tags) (string, bool) {
+	if len(npt.tags) == 0 {
+		return npt.literals[0], true
+	}
+	var sb strings.Builder
+	sb.WriteString(npt.literals[0])
+	for i, name := range npt.tags {
+		value, ok := tagValue(tags, name)
+		if !ok {
+			return "", false
+		}
+		sb.WriteString(value)
+		sb.WriteString(npt.literals[i+1])
+	}
+	return sb.String(), true
+}
+
+// tagValue returns the value of the first tag starting with prefix.
+func tagValue(tags gostatsd.Tags, prefix string) (string, bool) {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			return tag[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// NamePrefixHandler prefixes the name of every metric using a NamePrefixTemplate, so that the same metric from
+// sources with different tags, such as the account added by the cloud provider, is kept separate.  Metrics which
+// don't have the tags in the template pass through unchanged.  Events are passed to the next handler unchanged.
+type NamePrefixHandler struct {
+	handler  gostatsd.PipelineHandler
+	template *NamePrefixTemplate
+}
+
+// NewNamePrefixHandler initialises a new NamePrefixHandler.
+func NewNamePrefixHandler(handler gostatsd.PipelineHandler, template *NamePrefixTemplate) *NamePrefixHandler {
+	return &NamePrefixHandler{
+		handler:  handler,
+		template: template,
+	}
+}
+
+// EstimatedTags returns a guess for how many tags to pre-allocate
+func (nph *NamePrefixHandler) EstimatedTags() int {
+	return nph.handler.EstimatedTags()
+}
+
+// DispatchMetricMap prefixes the name of every metric, and passes them to the next handler.
+func (nph *NamePrefixHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.MetricMap) {
+	mmNew := gostatsd.NewMetricMap()
+	mm.Counters.Each(func(metricName, tagsKey string, c gostatsd.Counter) {
+		mmNew.MergeCounter(nph.name(metricName, c.Tags), tagsKey, c)
+	})
+	mm.Gauges.Each(func(metricName, tagsKey string, g gostatsd.Gauge) {
+		mmNew.MergeGauge(nph.name(metricName, g.Tags), tagsKey, g)
+	})
+	mm.Timers.Each(func(metricName, tagsKey string, t gostatsd.Timer) {
+		mmNew.MergeTimer(nph.name(metricName, t.Tags), tagsKey, t)
+	})
+	mm.Sets.Each(func(metricName, tagsKey string, s gostatsd.Set) {
+		mmNew.MergeSet(nph.name(metricName, s.Tags), tagsKey, s)
+	})
+	nph.handler.DispatchMetricMap(ctx, mmNew)
+}
+
+func (nph *NamePrefixHandler) name(name string, tags gostatsd.Tags) string {
+	if prefix, ok := nph.template.Prefix(tags); ok {
+		return prefix + name
+	}
+	return name
+}
+
+// DispatchEvent passes the event to the next handler.
+func (nph *NamePrefixHandler) DispatchEvent(ctx context.Context, e *gostatsd.Event) {
+	nph.handler.DispatchEvent(ctx, e)
+}
+
+// WaitForEvents waits for all event-dispatching goroutines to finish.
+func (nph *NamePrefixHandler) WaitForEvents() {
+	nph.handler.WaitForEvents()
+}
@@ -0,0 +1,61 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestNewNamePrefixTemplate(t *testing.T) {
+	t.Parallel()
+	for _, template := range []string{"{account", "account}.", "{}.", "{a:b}.", "{{a}}"} {
+		_, err := NewNamePrefixTemplate(template)
+		assert.Error(t, err, template)
+	}
+
+	npt, err := NewNamePrefixTemplate("tenant.{account}.{region}.")
+	require.NoError(t, err)
+	prefix, ok := npt.Prefix(gostatsd.Tags{"region:us-east-1", "account:123"})
+	assert.True(t, ok)
+	assert.Equal(t, "tenant.123.us-east-1.", prefix)
+	_, ok = npt.Prefix(gostatsd.Tags{"region:us-east-1", "accounts:123"})
+	assert.False(t, ok)
+
+	npt, err = NewNamePrefixTemplate("static.")
+	require.NoError(t, err)
+	prefix, ok = npt.Prefix(nil)
+	assert.True(t, ok)
+	assert.Equal(t, "static.", prefix)
+}
+
+func TestNamePrefixHandler(t *testing.T) {
+	t.Parallel()
+	ch := &capturingHandler{}
+	npt, err := NewNamePrefixTemplate("{account}.")
+	require.NoError(t, err)
+	nph := NewNamePrefixHandler(ch, npt)
+
+	a := gostatsd.Tags{"account:a"}
+	b := gostatsd.Tags{"account:b"}
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "foo", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: a})
+	mm.Receive(&gostatsd.Metric{Name: "foo", Value: 2, Rate: 1, Type: gostatsd.COUNTER, Tags: b})
+	mm.Receive(&gostatsd.Metric{Name: "foo", Value: 3, Rate: 1, Type: gostatsd.COUNTER})
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Type: gostatsd.GAUGE, Tags: a})
+	mm.Receive(&gostatsd.Metric{Name: "t", Value: 1, Rate: 1, Type: gostatsd.TIMER, Tags: a})
+	mm.Receive(&gostatsd.Metric{Name: "s", StringValue: "x", Rate: 1, Type: gostatsd.SET, Tags: b})
+	nph.DispatchMetricMap(context.Background(), mm)
+
+	require.Len(t, ch.mm, 1)
+	result := ch.mm[0]
+	assert.EqualValues(t, 1, result.Counters["a.foo"][gostatsd.FormatTagsKey("", a)].Value)
+	assert.EqualValues(t, 2, result.Counters["b.foo"][gostatsd.FormatTagsKey("", b)].Value)
+	assert.EqualValues(t, 3, result.Counters["foo"][""].Value) // No account tag, so not prefixed
+	assert.Contains(t, result.Gauges, "a.g")
+	assert.Contains(t, result.Timers, "a.t")
+	assert.Contains(t, result.Sets, "b.s")
+}
@@ -0,0 +1,113 @@
+package statsd
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+	"github.com/atlassian/gostatsd/pkg/stats"
+)
+
+// PassthroughHandler sends matching gauges directly to the backends as they are received, without waiting for
+// them to be aggregated and flushed.  All other metrics and events are passed to the next handler.
+type PassthroughHandler struct {
+	// Counter fields below must be read/written only using atomic instructions.
+	// 64-bit fields must be the first fields in the struct to guarantee proper memory alignment.
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	gaugesSent   uint64
+	sendFailures uint64
+
+	handler  gostatsd.PipelineHandler
+	backends []gostatsd.Backend
+	match    gostatsd.StringMatchList
+}
+
+// NewPassthroughHandler initialises a new PassthroughHandler which sends gauges with names matching any of the
+// provided patterns to the backends.
+func NewPassthroughHandler(handler gostatsd.PipelineHandler, backends []gostatsd.Backend, gauges []string) *PassthroughHandler {
+	return &PassthroughHandler{
+		handler:  handler,
+		backends: backends,
+		match:    toStringMatch(gauges),
+	}
+}
+
+// EstimatedTags returns a guess for how many tags to pre-allocate
+func (ph *PassthroughHandler) EstimatedTags() int {
+	return ph.handler.EstimatedTags()
+}
+
+// DispatchMetricMap sends any matching gauges to the backends, and the rest to the next handler.
+func (ph *PassthroughHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.MetricMap) {
+	var passthrough *gostatsd.MetricMap
+	for metricName, gauges := range mm.Gauges {
+		if !ph.match.MatchAny(metricName) {
+			continue
+		}
+		if passthrough == nil {
+			passthrough = gostatsd.NewMetricMap()
+		}
+		passthrough.Gauges[metricName] = gauges
+		delete(mm.Gauges, metricName)
+	}
+
+	if passthrough != nil {
+		ph.send(ctx, passthrough)
+	}
+	if !mm.IsEmpty() {
+		ph.handler.DispatchMetricMap(ctx, mm)
+	}
+}
+
+func (ph *PassthroughHandler) send(ctx context.Context, mm *gostatsd.MetricMap) {
+	count := 0
+	for _, gauges := range mm.Gauges {
+		count += len(gauges)
+	}
+	atomic.AddUint64(&ph.gaugesSent, uint64(count))
+
+	for _, backend := range ph.backends {
+		backend.SendMetricsAsync(ctx, mm, func(errs []error) {
+			if gostatsd.IsNothingToSend(errs) {
+				return
+			}
+			for _, err := range errs {
+				if err != nil {
+					atomic.AddUint64(&ph.sendFailures, 1)
+					if err != context.DeadlineExceeded && err != context.Canceled {
+						logrus.WithError(err).Error("Sending passthrough metrics to backend failed")
+					}
+				}
+			}
+		})
+	}
+}
+
+// DispatchEvent passes the event to the next handler.
+func (ph *PassthroughHandler) DispatchEvent(ctx context.Context, e *gostatsd.Event) {
+	ph.handler.DispatchEvent(ctx, e)
+}
+
+// WaitForEvents waits for all event-dispatching goroutines to finish.
+func (ph *PassthroughHandler) WaitForEvents() {
+	ph.handler.WaitForEvents()
+}
+
+// RunMetricsContext emits internal metrics about the gauges sent directly to the backends.
+func (ph *PassthroughHandler) RunMetricsContext(ctx context.Context) {
+	statser := stats.FromContext(ctx)
+	flushed, unregister := statser.RegisterFlush()
+	defer unregister()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushed:
+			statser.Gauge("passthrough.gauges_sent", float64(atomic.LoadUint64(&ph.gaugesSent)), nil)
+			statser.Gauge("passthrough.send_failures", float64(atomic.LoadUint64(&ph.sendFailures)), nil)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestPassthroughHandler(t *testing.T) {
+	t.Parallel()
+	ch := &capturingHandler{}
+	backend := &countingBackend{}
+	ph := NewPassthroughHandler(ch, []gostatsd.Backend{backend}, []string{"event.*", "exact"})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "event.deploy", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"a"}})
+	mm.Receive(&gostatsd.Metric{Name: "event.deploy", Value: 1, Rate: 1, Type: gostatsd.GAUGE, Tags: gostatsd.Tags{"b"}})
+	mm.Receive(&gostatsd.Metric{Name: "exact", Value: 2, Rate: 1, Type: gostatsd.GAUGE})
+	mm.Receive(&gostatsd.Metric{Name: "exactly", Value: 3, Rate: 1, Type: gostatsd.GAUGE})
+	mm.Receive(&gostatsd.Metric{Name: "event.count", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	ph.DispatchMetricMap(context.Background(), mm)
+
+	assert.EqualValues(t, 3, atomic.LoadUint64(&backend.metrics))
+	assert.EqualValues(t, 3, atomic.LoadUint64(&ph.gaugesSent))
+	require.Len(t, ch.mm, 1)
+	assert.Contains(t, ch.mm[0].Gauges, "exactly")
+	assert.NotContains(t, ch.mm[0].Gauges, "exact")
+	assert.NotContains(t, ch.mm[0].Gauges, "event.deploy")
+	assert.Contains(t, ch.mm[0].Counters, "event.count") // Only gauges are passed through
+}
+
+func TestPassthroughHandlerSkipsEmpty(t *testing.T) {
+	t.Parallel()
+	ch := &capturingHandler{}
+	fb := &failingBackend{err: errors.New("boom")}
+	ph := NewPassthroughHandler(ch, []gostatsd.Backend{fb}, []string{"*"})
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "g", Value: 1, Rate: 1, Type: gostatsd.GAUGE})
+	ph.DispatchMetricMap(context.Background(), mm)
+
+	assert.Len(t, ch.mm, 0) // Nothing left for the aggregators
+	assert.EqualValues(t, 1, atomic.LoadUint64(&fb.sends))
+	assert.EqualValues(t, 1, atomic.LoadUint64(&ph.sendFailures))
+}
@@ -2,6 +2,7 @@ package statsd
 
 import (
 	"context"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -13,12 +14,14 @@ type TagHandler struct {
 	handler       gostatsd.PipelineHandler
 	tags          gostatsd.Tags // Tags to add to all metrics
 	filters       []Filter
+	precedence    *TagPrecedence // Optional, resolves tags with the same key
 	estimatedTags int
+	deadletter    *Deadletter // Dropped metrics are written here, may be nil
 }
 
 var present = struct{}{}
 
-func NewTagHandlerFromViper(v *viper.Viper, handler gostatsd.PipelineHandler, tags gostatsd.Tags) *TagHandler {
+func NewTagHandlerFromViper(v *viper.Viper, handler gostatsd.PipelineHandler, tags gostatsd.Tags, precedence *TagPrecedence, deadletter *Deadletter) *TagHandler {
 	filterNameList := v.GetStringSlice("filters")
 	var filters []Filter
 	for _, filterName := range filterNameList {
@@ -30,18 +33,21 @@ func NewTagHandlerFromViper(v *viper.Viper, handler gostatsd.PipelineHandler, ta
 		filters = append(filters, NewFilterFromViper(vFilter))
 		logrus.Infof("Loaded filter %v", filterName)
 	}
-	return NewTagHandler(handler, tags, filters)
+	return NewTagHandler(handler, tags, filters, precedence, deadletter)
 }
 
 // NewTagHandler initialises a new handler which adds unique tags, and sends metrics/events to the next handler based
-// on filter rules.
-func NewTagHandler(handler gostatsd.PipelineHandler, tags gostatsd.Tags, filters []Filter) *TagHandler {
+// on filter rules.  If precedence is not nil, only one tag is kept for each key.  If deadletter is not nil, metrics
+// dropped by a filter are written to it.
+func NewTagHandler(handler gostatsd.PipelineHandler, tags gostatsd.Tags, filters []Filter, precedence *TagPrecedence, deadletter *Deadletter) *TagHandler {
 	tags = uniqueTags(tags, gostatsd.Tags{}) // de-dupe tags
 	return &TagHandler{
 		handler:       handler,
 		tags:          tags,
 		filters:       filters,
+		precedence:    precedence,
 		estimatedTags: len(tags) + handler.EstimatedTags(),
+		deadletter:    deadletter,
 	}
 }
 
@@ -63,7 +69,9 @@ func (th *TagHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.Metric
 			newTagsKey := gostatsd.FormatTagsKey(cOriginal.Source, cOriginal.Tags)
 			if cs, ok := mmNew.Counters[metricName]; ok {
 				if cNew, ok := cs[newTagsKey]; ok {
-					cNew.Value += cOriginal.Value
+					cNew.Value = gostatsd.AddCounterValues(cNew.Value, cOriginal.Value)
+					cNew.AddFraction(cOriginal.Fraction)
+					cNew.Events += cOriginal.Events
 					cNew.Timestamp = gostatsd.NanoMax(cNew.Timestamp, cOriginal.Timestamp)
 					cs[newTagsKey] = cNew
 				} else {
@@ -83,8 +91,10 @@ func (th *TagHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.Metric
 					if gOriginal.Timestamp > gNew.Timestamp {
 						gNew.Value = gOriginal.Value
 						gNew.Timestamp = gOriginal.Timestamp
-						gs[newTagsKey] = gNew
 					}
+					gNew.Sum += gOriginal.Sum
+					gNew.Count += gOriginal.Count
+					gs[newTagsKey] = gNew
 				} else {
 					gs[newTagsKey] = gOriginal
 				}
@@ -147,7 +157,7 @@ func (th *TagHandler) DispatchMetricMap(ctx context.Context, mm *gostatsd.Metric
 // Returns true if the metric should be processed further, or false to drop it.
 func (th *TagHandler) uniqueFilterAndAddTags(mName string, mHostname *gostatsd.Source, mTags *gostatsd.Tags) bool {
 	if len(th.filters) == 0 {
-		*mTags = uniqueTags(*mTags, th.tags)
+		*mTags = uniqueTags(th.resolveTags(*mTags))
 		return true
 	}
 
@@ -171,6 +181,10 @@ func (th *TagHandler) uniqueFilterAndAddTags(mName string, mHostname *gostatsd.S
 		}
 
 		if filter.DropMetric {
+			if th.deadletter != nil {
+				// The original line isn't available after parsing, so the name and tags are written instead.
+				th.deadletter.Write(DeadletterFiltered, *mHostname, formatDeadletterLine(mName, *mTags), nil)
+			}
 			return false
 		}
 
@@ -187,13 +201,30 @@ func (th *TagHandler) uniqueFilterAndAddTags(mName string, mHostname *gostatsd.S
 		}
 	}
 
-	*mTags = uniqueTagsWithSeen(dropTags, *mTags, th.tags)
+	tags, defaultTags := th.resolveTags(*mTags)
+	*mTags = uniqueTagsWithSeen(dropTags, tags, defaultTags)
 	return true
 }
 
+// formatDeadletterLine formats a metric name and its tags like the line it was received in, without the value.
+func formatDeadletterLine(name string, tags gostatsd.Tags) []byte {
+	if len(tags) == 0 {
+		return []byte(name)
+	}
+	return []byte(name + "|#" + strings.Join(tags, ","))
+}
+
+// resolveTags returns tags, and the static tags to add to them, with any tags which conflict by key removed.
+func (th *TagHandler) resolveTags(tags gostatsd.Tags) (gostatsd.Tags, gostatsd.Tags) {
+	if th.precedence == nil {
+		return tags, th.tags
+	}
+	return th.precedence.resolveDefaults(tags, th.tags)
+}
+
 // DispatchEvent adds the unique tags from the TagHandler to the event and passes it to the next stage in the pipeline
 func (th *TagHandler) DispatchEvent(ctx context.Context, e *gostatsd.Event) {
-	e.Tags = uniqueTags(e.Tags, th.tags)
+	e.Tags = uniqueTags(th.resolveTags(e.Tags))
 	th.handler.DispatchEvent(ctx, e)
 }
 
@@ -20,7 +20,7 @@ func TestTagStripMergesCounters(t *testing.T) {
 	tch := &capturingHandler{}
 	th := NewTagHandler(tch, gostatsd.Tags{}, []Filter{
 		{DropTags: gostatsd.StringMatchList{gostatsd.NewStringMatch("key2:*")}},
-	})
+	}, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Type: gostatsd.COUNTER, Name: "metric", Timestamp: 10, Tags: gostatsd.Tags{"key:value"}, Value: 20, Rate: 1})                              // Will merge in to metric with TS 20
@@ -29,8 +29,8 @@ func TestTagStripMergesCounters(t *testing.T) {
 
 	expected := gostatsd.NewMetricMap()
 	expected.Counters["metric"] = map[string]gostatsd.Counter{
-		"key:value":             {Timestamp: 20, Value: 30, Tags: gostatsd.Tags{"key:value"}},
-		"key3:value3,key:value": {Timestamp: 30, Value: 1, Tags: gostatsd.Tags{"key3:value3", "key:value"}},
+		"key:value":             {Timestamp: 20, Value: 30, Events: 2, Tags: gostatsd.Tags{"key:value"}},
+		"key3:value3,key:value": {Timestamp: 30, Value: 1, Events: 1, Tags: gostatsd.Tags{"key3:value3", "key:value"}},
 	}
 
 	// TagHandler.DispatchMetricMap has 2 possible executing orderings when resolving a conflicting, depending on map
@@ -47,7 +47,7 @@ func TestTagStripMergesGauges(t *testing.T) {
 	tch := &capturingHandler{}
 	th := NewTagHandler(tch, gostatsd.Tags{}, []Filter{
 		{DropTags: gostatsd.StringMatchList{gostatsd.NewStringMatch("key2:*")}},
-	})
+	}, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Type: gostatsd.GAUGE, Name: "metric", Timestamp: 10, Tags: gostatsd.Tags{"key:value"}, Value: 10})                               // Will merge in to metric with TS 20
@@ -56,8 +56,8 @@ func TestTagStripMergesGauges(t *testing.T) {
 
 	expected := gostatsd.NewMetricMap()
 	expected.Gauges["metric"] = map[string]gostatsd.Gauge{
-		"key:value":             {Timestamp: 20, Value: 20, Tags: gostatsd.Tags{"key:value"}},
-		"key3:value3,key:value": {Timestamp: 30, Value: 30, Tags: gostatsd.Tags{"key3:value3", "key:value"}},
+		"key:value":             {Timestamp: 20, Value: 20, Sum: 30, Count: 2, Tags: gostatsd.Tags{"key:value"}},
+		"key3:value3,key:value": {Timestamp: 30, Value: 30, Sum: 30, Count: 1, Tags: gostatsd.Tags{"key3:value3", "key:value"}},
 	}
 
 	// TagHandler.DispatchMetricMap has 2 possible executing orderings when resolving a conflicting, depending on map
@@ -74,7 +74,7 @@ func TestTagStripMergesTimers(t *testing.T) {
 	tch := &capturingHandler{}
 	th := NewTagHandler(tch, gostatsd.Tags{}, []Filter{
 		{DropTags: gostatsd.StringMatchList{gostatsd.NewStringMatch("key2:*")}},
-	})
+	}, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Type: gostatsd.TIMER, Name: "metric", Timestamp: 10, Tags: gostatsd.Tags{"key:value"}, Value: 10, Rate: 1})                               // Will merge in to metric with TS 20
@@ -103,7 +103,7 @@ func TestTagStripMergesSets(t *testing.T) {
 	tch := &capturingHandler{}
 	th := NewTagHandler(tch, gostatsd.Tags{}, []Filter{
 		{DropTags: gostatsd.StringMatchList{gostatsd.NewStringMatch("key2:*")}},
-	})
+	}, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(&gostatsd.Metric{Type: gostatsd.SET, Name: "metric", Timestamp: 10, Tags: gostatsd.Tags{"key:value"}, StringValue: "abc"})                               // Will merge in to metric with TS 20
@@ -129,7 +129,7 @@ func TestFilterPassesNoFilters(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(MakeMetric())
@@ -144,7 +144,7 @@ func TestFilterPassesEmptyFilters(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{}
 
 	mm := gostatsd.NewMetricMap()
@@ -160,7 +160,7 @@ func TestFilterKeepNonMatch(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics: gostatsd.StringMatchList{gostatsd.NewStringMatch("bad.name")},
@@ -181,7 +181,7 @@ func TestFilterDropsBadName(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics: gostatsd.StringMatchList{gostatsd.NewStringMatch("name")},
@@ -199,7 +199,7 @@ func TestFilterDropsBadPrefix(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics: gostatsd.StringMatchList{gostatsd.NewStringMatch("na*")},
@@ -217,7 +217,7 @@ func TestFilterKeepsWhitelist(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics:   gostatsd.StringMatchList{gostatsd.NewStringMatch("name.*")},
@@ -242,7 +242,7 @@ func TestFilterDropsTag(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics: gostatsd.StringMatchList{gostatsd.NewStringMatch("bad.name")},
@@ -264,7 +264,7 @@ func TestFilterDropsHost(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 	th.filters = []Filter{
 		{
 			MatchMetrics: gostatsd.StringMatchList{gostatsd.NewStringMatch("name")},
@@ -321,7 +321,7 @@ drop-tags='host:*'
 	}
 
 	nh := &nopHandler{}
-	th := NewTagHandlerFromViper(v, nh, nil)
+	th := NewTagHandlerFromViper(v, nh, nil, nil, nil)
 
 	empty := gostatsd.StringMatchList{}
 
@@ -378,7 +378,7 @@ func TestTagMetricHandlerAddsNoTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(MakeMetric(DropSource))
@@ -394,7 +394,7 @@ func TestTagMetricHandlerAddsSingleTag(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1"}, nil, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(MakeMetric())
@@ -410,7 +410,7 @@ func TestTagMetricHandlerAddsMultipleTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2"}, nil, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(MakeMetric())
@@ -426,7 +426,7 @@ func TestTagMetricHandlerAddsDuplicateTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2", "tag2", "tag3", "tag1"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2", "tag2", "tag3", "tag1"}, nil, nil, nil)
 
 	mm := gostatsd.NewMetricMap()
 	mm.Receive(MakeMetric())
@@ -442,7 +442,7 @@ func TestTagEventHandlerAddsNoTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 
 	e := &gostatsd.Event{}
 	th.DispatchEvent(context.Background(), e)
@@ -455,7 +455,7 @@ func TestTagEventHandlerAddsSingleTag(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1"}, nil, nil, nil)
 
 	e := &gostatsd.Event{}
 	th.DispatchEvent(context.Background(), e)
@@ -468,7 +468,7 @@ func TestTagEventHandlerAddsMultipleTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2"}, nil, nil, nil)
 
 	e := &gostatsd.Event{}
 	th.DispatchEvent(context.Background(), e)
@@ -481,7 +481,7 @@ func TestTagEventHandlerAddsHostname(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{}, nil, nil, nil)
 
 	e := &gostatsd.Event{
 		Source: "1.2.3.4",
@@ -496,7 +496,7 @@ func TestTagEventHandlerAddsDuplicateTags(t *testing.T) {
 	t.Parallel()
 
 	tch := &capturingHandler{}
-	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2", "tag2", "tag3", "tag1"}, nil)
+	th := NewTagHandler(tch, gostatsd.Tags{"tag1", "tag2", "tag2", "tag3", "tag1"}, nil, nil, nil)
 
 	e := &gostatsd.Event{}
 	th.DispatchEvent(context.Background(), e)
@@ -511,7 +511,7 @@ func BenchmarkTagMetricHandlerAddsDuplicateTagsSmall(b *testing.B) {
 		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
 		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
 		"cccccccccccccccccccccccccccccccc:cccccccccccccccccccccccccccccccc",
-	}, nil)
+	}, nil, nil, nil)
 
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -548,7 +548,7 @@ func BenchmarkTagMetricHandlerAddsDuplicateTagsLarge(b *testing.B) {
 		"hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh:hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh",
 		"iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii:iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii",
 		"jjjjjjjjjjjjjjjjjjjjjjjjjjjjjjjj:jjjjjjjjjjjjjjjjjjjjjjjjjjjjjjjj",
-	}, nil)
+	}, nil, nil, nil)
 
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -580,7 +580,7 @@ func BenchmarkTagEventHandlerAddsDuplicateTagsSmall(b *testing.B) {
 		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
 		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
 		"cccccccccccccccccccccccccccccccc:cccccccccccccccccccccccccccccccc",
-	}, nil)
+	}, nil, nil, nil)
 
 	eventTags := gostatsd.Tags{
 		"cccccccccccccccccccccccccccccccc:cccccccccccccccccccccccccccccccc",
@@ -612,7 +612,7 @@ func BenchmarkTagEventHandlerAddsDuplicateTagsLarge(b *testing.B) {
 		"hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh:hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh",
 		"iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii:iiiiiiiiiiiiiiiiiiiiiiiiiiiiiiii",
 		"jjjjjjjjjjjjjjjjjjjjjjjjjjjjjjjj:jjjjjjjjjjjjjjjjjjjjjjjjjjjjjjjj",
-	}, nil)
+	}, nil, nil, nil)
 
 	eventTags := gostatsd.Tags{
 		"hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh:hhhhhhhhhhhhhhhhhhhhhhhhhhhhhhhh",
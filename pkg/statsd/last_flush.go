@@ -0,0 +1,64 @@
+package statsd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// LastFlush keeps a copy of the metrics from the most recent flush, for debugging purposes.  Raw timer values
+// are not kept.
+type LastFlush struct {
+	pendingLock sync.Mutex
+	pending     *gostatsd.MetricMap // Metrics from the flush in progress
+
+	lock      sync.RWMutex
+	metricMap *gostatsd.MetricMap // Metrics from the most recent flush, must not be modified once set
+	flushed   time.Time
+}
+
+// NewLastFlush creates a new LastFlush.
+func NewLastFlush() *LastFlush {
+	return &LastFlush{
+		pending: gostatsd.NewMetricMap(),
+	}
+}
+
+// add copies the metrics from a single aggregator in to the flush in progress.  It is safe to call concurrently,
+// and must be called before the aggregator is reset.
+func (lf *LastFlush) add(mm *gostatsd.MetricMap) {
+	lf.pendingLock.Lock()
+	defer lf.pendingLock.Unlock()
+
+	// Each series belongs to a single aggregator, so merging only copies.  Counters, gauges, and sets are not
+	// modified after being flushed, however timer values are re-used and must not be kept.
+	mm.Counters.Each(lf.pending.MergeCounter)
+	mm.Gauges.Each(lf.pending.MergeGauge)
+	mm.Sets.Each(lf.pending.MergeSet)
+	mm.Timers.Each(func(metricName, tagsKey string, timer gostatsd.Timer) {
+		timer.Values = nil
+		lf.pending.MergeTimer(metricName, tagsKey, timer)
+	})
+}
+
+// complete makes the flush in progress available through LastFlush.
+func (lf *LastFlush) complete(flushed time.Time) {
+	lf.pendingLock.Lock()
+	mm := lf.pending
+	lf.pending = gostatsd.NewMetricMap()
+	lf.pendingLock.Unlock()
+
+	lf.lock.Lock()
+	defer lf.lock.Unlock()
+	lf.metricMap = mm
+	lf.flushed = flushed
+}
+
+// LastFlush returns the metrics from the most recent flush, and when it completed.  The MetricMap will be
+// nil if no flush has completed.  The returned MetricMap must not be modified.
+func (lf *LastFlush) LastFlush() (*gostatsd.MetricMap, time.Time) {
+	lf.lock.RLock()
+	defer lf.lock.RUnlock()
+	return lf.metricMap, lf.flushed
+}
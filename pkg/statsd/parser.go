@@ -3,10 +3,13 @@ package statsd
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
@@ -20,6 +23,9 @@ import (
 // Default buffer size for debug channel
 const logRawMetricChannelBufferSize = 1000
 
+// maxUniqueSources bounds the memory used to count the distinct sources seen in a flush interval.
+const maxUniqueSources = 100000
+
 // DatagramParser receives datagrams and parses them into Metrics/Events
 // For each Metric/Event it calls Handler.HandleMetric/Event()
 type DatagramParser struct {
@@ -27,8 +33,15 @@ type DatagramParser struct {
 	// 64-bit fields must be the first fields in the struct to guarantee proper memory alignment.
 	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	badLines        stats.ChangeGauge
+	oversizedLines  stats.ChangeGauge
+	strippedTags    stats.ChangeGauge
+	badTypes        stats.ChangeGauge
 	metricsReceived uint64
 	eventsReceived  uint64
+	transformed     uint64                  // Metrics with a value changed by a ValueTransformRule
+	sampledOut      uint64                  // Metrics dropped by the SampleExpression
+	sampleErrors    uint64                  // Metrics the SampleExpression failed for
+	lastReceived    [gostatsd.SET + 1]int64 // Nanotime of the last metric of each MetricType received, 0 for none
 
 	logger logrus.FieldLogger
 
@@ -45,34 +58,107 @@ type DatagramParser struct {
 	logRawMetric         bool
 	logRawMetricInitOnce sync.Once
 	logRawMetricChan     chan []*gostatsd.Metric
+
+	sampleRates   SampleRateRules     // Sample rates to assume for metrics received without one
+	normalizeTags bool                // Lowercase and clean up whitespace in tags
+	limits        MetricLimits        // Limits on the size of individual metrics
+	rateLimiter   *SourceRateLimiter  // Limits the rate of metrics from each source, may be nil
+	allowedTags   map[string]struct{} // Tag keys which are kept on metrics, nil to keep every tag
+	unknownType   gostatsd.MetricType // Type of metrics with an unknown type, 0 to drop them
+	deadletter    *Deadletter         // Dropped lines are written here, may be nil
+	transforms    ValueTransformRules // Rules which change the value of metrics received
+	sampler       *SampleExpression   // Samples metrics received, may be nil
+
+	sources atomic.Value // *uniqueSources seen since the last flush
+}
+
+// uniqueSources is the distinct sources seen in a flush interval, up to maxUniqueSources.  A sync.Map is used as
+// the workers mostly see sources which are already present, which it looks up without a lock.
+type uniqueSources struct {
+	count int64 // Accessed atomically
+	seen  sync.Map
+}
+
+// MetricLimits are limits on the size of individual metrics.  A value of 0 disables the limit.
+type MetricLimits struct {
+	MaxNameLength int // Maximum length of a metric name in bytes, including the namespace
+	MaxTags       int // Maximum number of tags on a metric
+	MaxTagLength  int // Maximum length of a single tag in bytes
+}
+
+// check returns an error describing the first limit exceeded by the metric, or nil if it is within the limits.
+func (ml MetricLimits) check(m *gostatsd.Metric) error {
+	if ml.MaxNameLength > 0 && len(m.Name) > ml.MaxNameLength {
+		return fmt.Errorf("metric name length %d exceeds limit of %d", len(m.Name), ml.MaxNameLength)
+	}
+	if ml.MaxTags > 0 && len(m.Tags) > ml.MaxTags {
+		return fmt.Errorf("metric has %d tags, exceeding limit of %d", len(m.Tags), ml.MaxTags)
+	}
+	if ml.MaxTagLength > 0 {
+		for _, tag := range m.Tags {
+			if len(tag) > ml.MaxTagLength {
+				return fmt.Errorf("tag length %d exceeds limit of %d", len(tag), ml.MaxTagLength)
+			}
+		}
+	}
+	return nil
+}
+
+// ParserConfig is the configuration of a DatagramParser.  The zero value of each field disables the feature it
+// configures.
+type ParserConfig struct {
+	Namespace                 string              // Namespace to prefix all metrics
+	IgnoreHost                bool                // Use the host: tag of a metric as its source, rather than the ip
+	EstimatedTags             int                 // The number of tags to allocate for each metric
+	BadLineRateLimitPerSecond rate.Limit          // How often bad lines are logged
+	LogRawMetric              bool                // Log every metric received
+	SampleRates               SampleRateRules     // Sample rates to assume for metrics received without one
+	NormalizeTags             bool                // Lowercase and clean up whitespace in tags
+	Limits                    MetricLimits        // Limits on the size of individual metrics
+	RateLimiter               *SourceRateLimiter  // Limits the rate of metrics from each source
+	AllowedTagKeys            []string            // Tag keys which are kept on metrics, empty to keep every tag
+	UnknownType               gostatsd.MetricType // Type of metrics with an unknown type, 0 to drop them
+	Deadletter                *Deadletter         // Dropped lines are written here
+	Transforms                ValueTransformRules // Rules which change the value of metrics received
+	SampleExpression          *SampleExpression   // Samples metrics received
 }
 
 // NewDatagramParser initialises a new DatagramParser.
-func NewDatagramParser(
-	in <-chan []*Datagram,
-	ns string,
-	ignoreHost bool,
-	estimatedTags int,
-	handler gostatsd.PipelineHandler,
-	badLineRateLimitPerSecond rate.Limit,
-	logRawMetric bool,
-	logger logrus.FieldLogger,
-) *DatagramParser {
+func NewDatagramParser(in <-chan []*Datagram, handler gostatsd.PipelineHandler, config ParserConfig, logger logrus.FieldLogger) *DatagramParser {
 	limiter := &rate.Limiter{}
-	if badLineRateLimitPerSecond > 0 {
-		limiter = rate.NewLimiter(badLineRateLimitPerSecond, 1)
+	if config.BadLineRateLimitPerSecond > 0 {
+		limiter = rate.NewLimiter(config.BadLineRateLimitPerSecond, 1)
+	}
+
+	var allowedTags map[string]struct{}
+	if len(config.AllowedTagKeys) > 0 {
+		allowedTags = make(map[string]struct{}, len(config.AllowedTagKeys))
+		for _, key := range config.AllowedTagKeys {
+			allowedTags[key] = present
+		}
 	}
 
-	return &DatagramParser{
+	dp := &DatagramParser{
 		logger:         logger,
 		in:             in,
-		ignoreHost:     ignoreHost,
+		ignoreHost:     config.IgnoreHost,
 		handler:        handler,
-		namespace:      ns,
-		metricPool:     pool.NewMetricPool(estimatedTags + handler.EstimatedTags()),
+		namespace:      config.Namespace,
+		metricPool:     pool.NewMetricPool(config.EstimatedTags + handler.EstimatedTags()),
 		badLineLimiter: limiter,
-		logRawMetric:   logRawMetric,
+		logRawMetric:   config.LogRawMetric,
+		sampleRates:    config.SampleRates,
+		normalizeTags:  config.NormalizeTags,
+		limits:         config.Limits,
+		rateLimiter:    config.RateLimiter,
+		allowedTags:    allowedTags,
+		unknownType:    config.UnknownType,
+		deadletter:     config.Deadletter,
+		transforms:     config.Transforms,
+		sampler:        config.SampleExpression,
 	}
+	dp.sources.Store(&uniqueSources{})
+	return dp
 }
 
 func (dp *DatagramParser) RunMetricsContext(ctx context.Context) {
@@ -87,7 +173,24 @@ func (dp *DatagramParser) RunMetricsContext(ctx context.Context) {
 		case <-flushed:
 			statser.Gauge("parser.metrics_received", float64(atomic.LoadUint64(&dp.metricsReceived)), nil)
 			statser.Gauge("parser.events_received", float64(atomic.LoadUint64(&dp.eventsReceived)), nil)
+			if dp.transforms != nil {
+				statser.Gauge("parser.metrics_transformed", float64(atomic.LoadUint64(&dp.transformed)), nil)
+			}
+			if dp.sampler != nil {
+				statser.Gauge("parser.metrics_sampled_out", float64(atomic.LoadUint64(&dp.sampledOut)), nil)
+				statser.Gauge("parser.sample_expression_errors", float64(atomic.LoadUint64(&dp.sampleErrors)), nil)
+			}
 			dp.badLines.SendIfChanged(statser, "parser.bad_lines_seen", nil)
+			dp.oversizedLines.SendIfChanged(statser, "parser.oversized", nil)
+			dp.strippedTags.SendIfChanged(statser, "parser.stripped_tags_seen", nil)
+			dp.badTypes.SendIfChanged(statser, "parser.bad_types_seen", nil)
+			statser.Gauge("parser.unique_sources", float64(dp.resetSources()), nil)
+			dp.sendSinceLastReceived(statser, gostatsd.NanoNow())
+			if dp.rateLimiter != nil {
+				for source, count := range dp.rateLimiter.flush() {
+					statser.Gauge("parser.rate_limited", float64(count), gostatsd.Tags{"source:" + string(source)})
+				}
+			}
 		}
 	}
 }
@@ -95,39 +198,120 @@ func (dp *DatagramParser) RunMetricsContext(ctx context.Context) {
 func (dp *DatagramParser) Run(ctx context.Context) {
 	dp.initLogRawMetric(ctx)
 
-	l := &lexer.Lexer{
-		MetricPool: dp.metricPool,
-	}
-
+	l := dp.newLexer()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case dgs := <-dp.in:
-			var metrics []*gostatsd.Metric
+			dp.processDatagrams(ctx, l, dgs)
+		}
+	}
+}
 
-			accumB, accumE := uint64(0), uint64(0)
-			for _, dg := range dgs {
-				// TODO: Dispatch Events in Run, not handleDatagram, so it's consistent with Metrics
-				parsedMetrics, eventCount, badLineCount := dp.handleDatagram(ctx, l, dg.Timestamp, dg.IP, dg.Msg)
-				dg.DoneFunc()
-				metrics = append(metrics, parsedMetrics...)
-				accumE += eventCount
-				accumB += badLineCount
-			}
-			// TODO: Refactor this to use a MetricConsolidator
-			mm := gostatsd.NewMetricMap()
-			for _, m := range metrics {
-				mm.Receive(m)
-			}
-			if len(metrics) > 0 {
-				dp.handler.DispatchMetricMap(ctx, mm)
-				dp.doLogRawMetric(metrics)
-			}
-			atomic.AddUint64(&dp.metricsReceived, uint64(len(metrics)))
-			atomic.AddUint64(&dp.eventsReceived, accumE)
-			atomic.AddUint64(&dp.badLines.Cur, accumB)
+func (dp *DatagramParser) newLexer() *lexer.Lexer {
+	l := &lexer.Lexer{
+		MetricPool:  dp.metricPool,
+		UnknownType: dp.unknownType,
+	}
+	if len(dp.sampleRates) > 0 {
+		l.DefaultSampleRate = dp.sampleRates.SampleRate
+	}
+	return l
+}
+
+// processDatagrams parses a batch of datagrams and dispatches the resulting metrics to the handler.
+func (dp *DatagramParser) processDatagrams(ctx context.Context, l *lexer.Lexer, dgs []*Datagram) {
+	var metrics []*gostatsd.Metric
+
+	dp.addSources(dgs)
+
+	accumB, accumE, accumO, accumS := uint64(0), uint64(0), uint64(0), uint64(0)
+	for _, dg := range dgs {
+		// TODO: Dispatch Events in Run, not handleDatagram, so it's consistent with Metrics
+		parsedMetrics, eventCount, badLineCount, oversizedCount, strippedCount := dp.handleDatagram(ctx, l, dg.Timestamp, dg.IP, dg.Msg)
+		dg.DoneFunc()
+		metrics = append(metrics, parsedMetrics...)
+		accumE += eventCount
+		accumB += badLineCount
+		accumO += oversizedCount
+		accumS += strippedCount
+	}
+	// Metrics with the same name and tags are merged before dispatching, so a batch which repeats a metric only
+	// results in a single value to aggregate, rather than one per line.
+	// TODO: Refactor this to use a MetricConsolidator
+	mm := gostatsd.NewMetricMap()
+	var lastReceived [gostatsd.SET + 1]gostatsd.Nanotime
+	for _, m := range metrics {
+		if m.Type <= gostatsd.SET {
+			lastReceived[m.Type] = gostatsd.NanoMax(lastReceived[m.Type], m.Timestamp)
+		}
+		mm.Receive(m)
+	}
+	for metricType, last := range lastReceived {
+		if last != 0 {
+			atomic.StoreInt64(&dp.lastReceived[metricType], int64(last))
+		}
+	}
+	if len(metrics) > 0 {
+		dp.handler.DispatchMetricMap(ctx, mm)
+		dp.doLogRawMetric(metrics)
+	}
+	atomic.AddUint64(&dp.metricsReceived, uint64(len(metrics)))
+	atomic.AddUint64(&dp.eventsReceived, accumE)
+	atomic.AddUint64(&dp.badLines.Cur, accumB)
+	atomic.AddUint64(&dp.oversizedLines.Cur, accumO)
+	atomic.AddUint64(&dp.strippedTags.Cur, accumS)
+}
+
+// sendSinceLastReceived sends the seconds since the last metric of each type was received, for each type which has
+// been received at least once.
+func (dp *DatagramParser) sendSinceLastReceived(statser stats.Statser, now gostatsd.Nanotime) {
+	for metricType := range dp.lastReceived {
+		last := atomic.LoadInt64(&dp.lastReceived[metricType])
+		if last == 0 {
+			continue
+		}
+		since := time.Duration(now - gostatsd.Nanotime(last)).Seconds()
+		if since < 0 {
+			since = 0
 		}
+		statser.Gauge("parser.seconds_since_last_metric", since, gostatsd.Tags{"type:" + gostatsd.MetricType(metricType).String()})
+	}
+}
+
+// addSources records the sources of a batch of datagrams.
+func (dp *DatagramParser) addSources(dgs []*Datagram) {
+	us := dp.sources.Load().(*uniqueSources)
+	for _, dg := range dgs {
+		if _, ok := us.seen.Load(dg.IP); ok {
+			continue
+		}
+		if atomic.LoadInt64(&us.count) >= maxUniqueSources {
+			return
+		}
+		if _, loaded := us.seen.LoadOrStore(dg.IP, present); !loaded {
+			atomic.AddInt64(&us.count, 1)
+		}
+	}
+}
+
+// resetSources returns the number of distinct sources seen since it was last called, and resets the count.  It is
+// only called by the flush loop, a source added by a worker as it resets may be counted in either interval.
+func (dp *DatagramParser) resetSources() int {
+	us := dp.sources.Load().(*uniqueSources)
+	dp.sources.Store(&uniqueSources{})
+	count := atomic.LoadInt64(&us.count)
+	if count > maxUniqueSources {
+		count = maxUniqueSources // Workers racing to add the last source may each add one
+	}
+	return int(count)
+}
+
+// writeDeadletter writes a dropped line to the deadletter file, if there is one.
+func (dp *DatagramParser) writeDeadletter(reason string, line []byte, ip gostatsd.Source, err error) {
+	if dp.deadletter != nil {
+		dp.deadletter.Write(reason, ip, line, err)
 	}
 }
 
@@ -143,9 +327,17 @@ func (dp *DatagramParser) logBadLineRateLimited(line []byte, ip gostatsd.Source,
 }
 
 // handleDatagram handles the contents of a datagram and parsers it in to Metrics (which are returned), or
-// Events (which are sent to the pipeline via DispatchEvent).
-func (dp *DatagramParser) handleDatagram(ctx context.Context, l *lexer.Lexer, now gostatsd.Nanotime, ip gostatsd.Source, msg []byte) (metrics []*gostatsd.Metric, eventCount uint64, badLineCount uint64) {
-	var numEvents, numBad uint64
+// Events (which are sent to the pipeline via DispatchEvent).  Metrics which exceed the configured limits are
+// dropped and counted separately from bad lines.  Metrics over the rate limit of the source ip are dropped and
+// counted by the rate limiter.  Tags on metrics with keys which are not allowed are stripped and counted.  Metrics
+// are then sampled by the SampleExpression, on the value as received, and the values of metrics matching a
+// ValueTransformRule are transformed, both being counted.
+func (dp *DatagramParser) handleDatagram(ctx context.Context, l *lexer.Lexer, now gostatsd.Nanotime, ip gostatsd.Source, msg []byte) (metrics []*gostatsd.Metric, eventCount uint64, badLineCount uint64, oversizedCount uint64, strippedCount uint64) {
+	var numEvents, numBad, numOversized, numStripped, numTransformed, numSampledOut, numSampleErrors uint64
+	var limiter *sourceLimiter
+	if dp.rateLimiter != nil {
+		limiter = dp.rateLimiter.forSource(ip)
+	}
 	for {
 		idx := bytes.IndexByte(msg, '\n')
 		var line []byte
@@ -159,16 +351,26 @@ func (dp *DatagramParser) handleDatagram(ctx context.Context, l *lexer.Lexer, no
 		} else { // usual case
 			line = msg[:idx]
 			msg = msg[idx+1:]
+			if len(line) == 0 { // blank lines between metrics are not an error
+				continue
+			}
 		}
 		metric, event, err := dp.parseLine(l, line)
 		if err != nil {
 			// logging as debug to avoid spamming logs when a bad actor sends
 			// badly formatted messages
 			dp.logBadLineRateLimited(line, ip, err)
+			dp.writeDeadletter(DeadletterBadLine, line, ip, err)
+			if err == lexer.ErrInvalidType {
+				atomic.AddUint64(&dp.badTypes.Cur, 1)
+			}
 			numBad++
 			continue
 		}
 		if metric != nil {
+			if dp.normalizeTags {
+				normalizeTags(metric.Tags)
+			}
 			if dp.ignoreHost {
 				for idx, tag := range metric.Tags {
 					if strings.HasPrefix(tag, "host:") {
@@ -184,9 +386,40 @@ func (dp *DatagramParser) handleDatagram(ctx context.Context, l *lexer.Lexer, no
 			} else {
 				metric.Source = ip
 			}
+			if dp.allowedTags != nil {
+				numStripped += dp.stripTags(metric)
+			}
+			if err := dp.limits.check(metric); err != nil {
+				dp.logBadLineRateLimited(line, ip, err)
+				dp.writeDeadletter(DeadletterOversized, line, ip, err)
+				metric.Done()
+				numOversized++
+				continue
+			}
+			if !limiter.allow(now) {
+				dp.writeDeadletter(DeadletterRateLimited, line, ip, nil)
+				metric.Done()
+				continue
+			}
+			if dp.sampler != nil {
+				keep, err := dp.sampler.Sample(metric)
+				if err != nil {
+					numSampleErrors++
+				} else if !keep {
+					metric.Done()
+					numSampledOut++
+					continue
+				}
+			}
+			if dp.transforms != nil && dp.transforms.Transform(metric) {
+				numTransformed++
+			}
 			metric.Timestamp = now
 			metrics = append(metrics, metric)
 		} else if event != nil {
+			if dp.normalizeTags {
+				normalizeTags(event.Tags)
+			}
 			numEvents++
 			event.Source = ip // Always keep the source ip for events
 			if event.DateHappened == 0 {
@@ -198,7 +431,70 @@ func (dp *DatagramParser) handleDatagram(ctx context.Context, l *lexer.Lexer, no
 			dp.logger.Panic("Both event and metric are nil")
 		}
 	}
-	return metrics, numEvents, numBad
+	if numTransformed > 0 {
+		atomic.AddUint64(&dp.transformed, numTransformed)
+	}
+	if numSampledOut > 0 {
+		atomic.AddUint64(&dp.sampledOut, numSampledOut)
+	}
+	if numSampleErrors > 0 {
+		atomic.AddUint64(&dp.sampleErrors, numSampleErrors)
+	}
+	return metrics, numEvents, numBad, numOversized, numStripped
+}
+
+// stripTags removes the tags with keys which are not allowed from the metric, and returns the number removed.  The
+// key of a tag without a value is the whole tag.
+func (dp *DatagramParser) stripTags(metric *gostatsd.Metric) uint64 {
+	kept := metric.Tags[:0]
+	for _, tag := range metric.Tags {
+		key := tag
+		if idx := strings.IndexByte(tag, ':'); idx != -1 {
+			key = tag[:idx]
+		}
+		if _, ok := dp.allowedTags[key]; ok {
+			kept = append(kept, tag)
+		}
+	}
+	stripped := uint64(len(metric.Tags) - len(kept))
+	metric.Tags = kept
+	return stripped
+}
+
+// normalizeTags lowercases each tag, trims whitespace around the tag key and value, and replaces any remaining
+// whitespace with an underscore.  The tags are modified in place.
+func normalizeTags(tags gostatsd.Tags) {
+	for idx, tag := range tags {
+		if needsNormalizing(tag) {
+			tags[idx] = normalizeTag(tag)
+		}
+	}
+}
+
+// needsNormalizing is a fast path to avoid allocating for tags which are already normalized.
+func needsNormalizing(tag string) bool {
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if ('A' <= c && c <= 'Z') || c == ' ' || c == '\t' || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(tag)
+	if idx := strings.IndexByte(tag, ':'); idx != -1 {
+		tag = strings.TrimSpace(tag[:idx]) + ":" + strings.TrimSpace(tag[idx+1:])
+	} else {
+		tag = strings.TrimSpace(tag)
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, tag)
 }
 
 // parseLine with lexer.
@@ -206,6 +502,19 @@ func (dp *DatagramParser) parseLine(l *lexer.Lexer, line []byte) (*gostatsd.Metr
 	return l.Run(line, dp.namespace)
 }
 
+// parseLinePool is the MetricPool used by ParseLine.
+var parseLinePool = pool.NewMetricPool(0)
+
+// ParseLine parses a single line of the statsd protocol, without a namespace, in to either a Metric or an Event.
+// It uses the same lexer as the DatagramParser, and is intended for tests and tools which need to parse lines
+// outside of the server.  The returned Metric does not have a Source or Timestamp.
+func ParseLine(line []byte) (*gostatsd.Metric, *gostatsd.Event, error) {
+	l := &lexer.Lexer{
+		MetricPool: parseLinePool,
+	}
+	return l.Run(line, "")
+}
+
 func (dp *DatagramParser) initLogRawMetric(ctx context.Context) {
 	if dp.logRawMetric {
 		dp.logRawMetricInitOnce.Do(func() {
@@ -1,19 +1,25 @@
 package statsd
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/time/rate"
+	"github.com/stretchr/testify/require"
 
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/internal/fixtures"
 	"github.com/atlassian/gostatsd/internal/lexer"
 	"github.com/atlassian/gostatsd/internal/pool"
+	"github.com/atlassian/gostatsd/pkg/stats"
 )
 
 type metricAndEvent struct {
@@ -31,7 +37,7 @@ func lex() *lexer.Lexer {
 
 func newTestParser(ignoreHost bool) (*DatagramParser, *countingHandler) {
 	ch := &countingHandler{}
-	return NewDatagramParser(nil, "", ignoreHost, 0, ch, rate.Limit(0), false, logrus.New()), ch
+	return NewDatagramParser(nil, ch, ParserConfig{IgnoreHost: ignoreHost}, logrus.New()), ch
 }
 
 func TestParseEmptyDatagram(t *testing.T) {
@@ -46,7 +52,7 @@ func TestParseEmptyDatagram(t *testing.T) {
 		t.Run(strconv.Itoa(pos), func(t *testing.T) {
 			t.Parallel()
 			mr, ch := newTestParser(false)
-			_, _, _ = mr.handleDatagram(context.Background(), lex(), 0, gostatsd.UnknownSource, inp)
+			_, _, _, _, _ = mr.handleDatagram(context.Background(), lex(), 0, gostatsd.UnknownSource, inp)
 			assert.Zero(t, len(ch.events), ch.events)
 			assert.Zero(t, len(ch.metrics), ch.metrics)
 		})
@@ -103,7 +109,7 @@ func TestParseDatagram(t *testing.T) {
 		t.Run(datagram, func(t *testing.T) {
 			t.Parallel()
 			mr, ch := newTestParser(false)
-			metrics, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
+			metrics, _, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
 			mm := gostatsd.NewMetricMap()
 			for _, m := range metrics {
 				mm.Receive(m)
@@ -184,7 +190,7 @@ func TestParseDatagramIgnoreHost(t *testing.T) {
 		t.Run(datagram, func(t *testing.T) {
 			t.Parallel()
 			mr, ch := newTestParser(true)
-			metrics, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
+			metrics, _, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
 			for i, e := range ch.events {
 				if e.DateHappened <= 0 {
 					t.Errorf("%q: DateHappened should be positive", e)
@@ -209,3 +215,359 @@ func TestParseDatagramIgnoreHost(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDatagramDefaultSampleRate(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+sample-rates='legacy invalid missing'
+
+[sample-rate.legacy]
+match-metrics='legacy.*'
+rate=0.1
+
+[sample-rate.invalid]
+match-metrics='invalid.*'
+rate=2
+`)
+	v := viper.New()
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(bytes.NewBuffer(data)))
+
+	sampleRates := NewSampleRateRulesFromViper(v)
+	require.Equal(t, SampleRateRules{{MatchMetrics: toStringMatch([]string{"legacy.*"}), Rate: 0.1}}, sampleRates)
+
+	l := lex()
+	l.DefaultSampleRate = sampleRates.SampleRate
+	mr, _ := newTestParser(false)
+	metrics, _, _, _, _ := mr.handleDatagram(context.Background(), l, 0, fakeIP, []byte("legacy.a:2|c\nlegacy.b:2|c|@0.5\nlegacy.c:2|c|@1\nother:2|c"))
+	require.Len(t, metrics, 4)
+	assert.Equal(t, 0.1, metrics[0].Rate)
+	assert.Equal(t, 0.5, metrics[1].Rate) // Explicit rate always wins
+	assert.Equal(t, 1.0, metrics[2].Rate)
+	assert.Equal(t, 1.0, metrics[3].Rate)
+}
+
+func TestParseDatagramValueTransform(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+value-transforms='celsius bytes empty missing'
+
+[value-transform.celsius]
+match-metrics='temp.*'
+multiplier=1.8
+offset=32
+
+[value-transform.bytes]
+match-metrics='bytes.*'
+multiplier=0.000001
+
+[value-transform.empty]
+multiplier=2
+`)
+	v := viper.New()
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(bytes.NewBuffer(data)))
+
+	transforms := NewValueTransformRulesFromViper(v)
+	require.Equal(t, ValueTransformRules{
+		{MatchMetrics: toStringMatch([]string{"temp.*"}), Multiplier: 1.8, Offset: 32},
+		{MatchMetrics: toStringMatch([]string{"bytes.*"}), Multiplier: 0.000001},
+	}, transforms)
+
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{Transforms: transforms}, logrus.New())
+	metrics, _, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte("temp.a:100|g\ntemp.b:100|ms\ntemp.c:100|c|@0.5\nbytes.a:2000000|g\ntemp.d:x|s\nother:2|g"))
+	require.Len(t, metrics, 6)
+	assert.InDelta(t, 212, metrics[0].Value, 1e-9)
+	assert.InDelta(t, 212, metrics[1].Value, 1e-9)
+	assert.InDelta(t, 180, metrics[2].Value, 1e-9) // Counters are only multiplied, and still scaled by the rate
+	assert.Equal(t, 0.5, metrics[2].Rate)
+	assert.InDelta(t, 2, metrics[3].Value, 1e-9)
+	assert.Equal(t, "x", metrics[4].StringValue) // Sets are never transformed
+	assert.Equal(t, 2.0, metrics[5].Value)
+	assert.EqualValues(t, 4, mr.transformed)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	t.Parallel()
+	tags := gostatsd.Tags{
+		"env:prod",
+		"Env:Prod",
+		" env : prod ",
+		"Some Tag",
+		"key:Value With\tSpaces",
+		"ÜBER:Ärger",
+		"nocolon",
+	}
+	normalizeTags(tags)
+	assert.Equal(t, gostatsd.Tags{
+		"env:prod",
+		"env:prod",
+		"env:prod",
+		"some_tag",
+		"key:value_with_spaces",
+		"über:ärger",
+		"nocolon",
+	}, tags)
+}
+
+func TestParseDatagramNormalizeTags(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{NormalizeTags: true}, logrus.New())
+	metrics, _, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte("f:1|c|#Env:Prod\nf:1|c|#env:prod\n_e{1,1}:a|b|#Env:Prod"))
+
+	mm := gostatsd.NewMetricMap()
+	for _, m := range metrics {
+		mm.Receive(m)
+	}
+	assert.Equal(t, gostatsd.Counters{"f": {"env:prod,s:127.0.0.1": {Value: 2, Events: 2, Source: fakeIP, Tags: gostatsd.Tags{"env:prod"}}}}, mm.Counters)
+	require.Len(t, ch.events, 1)
+	assert.Equal(t, gostatsd.Tags{"env:prod"}, ch.events[0].Tags)
+}
+
+func TestParseDatagramMultipleLines(t *testing.T) {
+	t.Parallel()
+	mr, _ := newTestParser(false)
+	var lines []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf("m%d:%d|c", i, i))
+	}
+	metrics, _, bad, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(strings.Join(lines, "\n")))
+	require.Len(t, metrics, 50)
+	assert.EqualValues(t, 0, bad)
+	for i, m := range metrics {
+		assert.Equal(t, fmt.Sprintf("m%d", i), m.Name)
+		assert.EqualValues(t, i, m.Value)
+	}
+
+	// Invalid lines are counted and skipped, without affecting the valid lines around them.
+	datagram := "a:1|c\n" +
+		"not a metric\n" +
+		"b:2|g\n" +
+		"c:x|ms\n" +
+		"\n" +
+		"d:4|s\n" +
+		"e:5|q"
+	metrics, _, bad, _, _ = mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "a", metrics[0].Name)
+	assert.Equal(t, "b", metrics[1].Name)
+	assert.Equal(t, "d", metrics[2].Name)
+	assert.EqualValues(t, 3, bad)
+}
+
+func TestParseDatagramLimits(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	limits := MetricLimits{MaxNameLength: 5, MaxTags: 2, MaxTagLength: 5}
+	mr := NewDatagramParser(nil, ch, ParserConfig{Limits: limits}, logrus.New())
+	datagram := "ok:1|c|#a:b,c\n" +
+		"toolong:1|c\n" +
+		"tags:1|c|#a,b,c\n" +
+		"tag:1|c|#a:long\n" +
+		"max:1|c|#a:bcd,e\n" +
+		"_e{1,1}:a|b|#a,b,c"
+	metrics, events, bad, oversized, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "ok", metrics[0].Name)
+	assert.Equal(t, "max", metrics[1].Name)
+	assert.EqualValues(t, 1, events) // Limits only apply to metrics
+	assert.EqualValues(t, 0, bad)
+	assert.EqualValues(t, 3, oversized)
+}
+
+func TestParseDatagramAllowedTags(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{Limits: MetricLimits{MaxTags: 2}, AllowedTagKeys: []string{"env", "service", "canary"}}, logrus.New())
+	datagram := "a:1|c|#env:prod,user_id:123,service:web,canary\n" +
+		"b:1|c|#request_id:abc\n" +
+		"c:1|c\n" +
+		"_e{1,1}:a|b|#user_id:123"
+	metrics, events, _, oversized, stripped := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(datagram))
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "b", metrics[0].Name)
+	assert.Empty(t, metrics[0].Tags)
+	assert.Equal(t, "c", metrics[1].Name)
+	assert.EqualValues(t, 1, events)    // Events are not affected
+	assert.EqualValues(t, 1, oversized) // Limits are checked after stripping
+	assert.EqualValues(t, 2, stripped)
+}
+
+func TestParseDatagramUnknownType(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{}, logrus.New())
+	metrics, _, bad, _, _ := mr.handleDatagram(context.Background(), mr.newLexer(), 0, fakeIP, []byte("a:1|x\nb:x|c\nc:1|c"))
+	require.Len(t, metrics, 1)
+	assert.EqualValues(t, 2, bad)
+	assert.EqualValues(t, 1, mr.badTypes.Cur)
+
+	mr = NewDatagramParser(nil, ch, ParserConfig{UnknownType: gostatsd.GAUGE}, logrus.New())
+	metrics, _, bad, _, _ = mr.handleDatagram(context.Background(), mr.newLexer(), 0, fakeIP, []byte("a:1|x\nc:1|c"))
+	require.Len(t, metrics, 2)
+	assert.Equal(t, gostatsd.GAUGE, metrics[0].Type)
+	assert.Equal(t, gostatsd.COUNTER, metrics[1].Type)
+	assert.Zero(t, bad)
+	assert.Zero(t, mr.badTypes.Cur)
+}
+
+func TestParseDatagramMalformed(t *testing.T) {
+	t.Parallel()
+	mr, _ := newTestParser(false)
+	malformed := []string{"foo:|c", "foo:|s", "foo||c", "foo:1", "foo1|c", "foo:1|c|", "foo:1|c|@|#a", "foo:x|g"}
+	metrics, _, bad, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte(strings.Join(append(malformed, "bar:1|c"), "\n")))
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "bar", metrics[0].Name)
+	assert.EqualValues(t, len(malformed), bad)
+}
+
+func TestProcessDatagramsMergesMetrics(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{}, logrus.New())
+	msg := strings.Repeat("c:1|c\n", 10) + "t:1|ms\nt:2|ms\ng:1|g\ng:2|g\nc:1|c|#a:b"
+	done := 0
+	mr.processDatagrams(context.Background(), lex(), []*Datagram{
+		{IP: fakeIP, Msg: []byte(msg), Timestamp: 10, DoneFunc: func() { done++ }},
+	})
+	assert.Equal(t, 1, done)
+	maps := ch.MetricMaps()
+	require.Len(t, maps, 1)
+	mm := maps[0]
+	key := gostatsd.FormatTagsKey(fakeIP, nil)
+	require.Len(t, mm.Counters["c"], 2)
+	assert.EqualValues(t, 10, mm.Counters["c"][key].Value)
+	assert.EqualValues(t, 1, mm.Counters["c"][gostatsd.FormatTagsKey(fakeIP, gostatsd.Tags{"a:b"})].Value)
+	assert.Equal(t, []float64{1, 2}, mm.Timers["t"][key].Values)
+	assert.EqualValues(t, 2, mm.Gauges["g"][key].Value) // The last value in the datagram is kept
+	assert.EqualValues(t, 15, mr.metricsReceived)
+}
+
+// taggedGaugeStatser keeps the most recent value of each gauge, keyed by name and tags.
+type taggedGaugeStatser struct {
+	stats.NullStatser
+	gauges map[string]float64
+}
+
+func (tgs *taggedGaugeStatser) Gauge(name string, value float64, tags gostatsd.Tags) {
+	tgs.gauges[name+"|"+strings.Join(tags, ",")] = value
+}
+
+func TestSinceLastReceived(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	mr := NewDatagramParser(nil, ch, ParserConfig{}, logrus.New())
+	second := gostatsd.Nanotime(time.Second)
+	mr.processDatagrams(context.Background(), lex(), []*Datagram{
+		{IP: fakeIP, Msg: []byte("c:1|c\nt:1|ms"), Timestamp: 10 * second, DoneFunc: func() {}},
+		{IP: fakeIP, Msg: []byte("c:1|c"), Timestamp: 12 * second, DoneFunc: func() {}},
+	})
+
+	statser := &taggedGaugeStatser{gauges: map[string]float64{}}
+	mr.sendSinceLastReceived(statser, 15*second)
+	// Types which have never been received are not sent
+	assert.Equal(t, map[string]float64{
+		"parser.seconds_since_last_metric|type:counter": 3,
+		"parser.seconds_since_last_metric|type:timer":   5,
+	}, statser.gauges)
+}
+
+func TestMetricLimitsDisabled(t *testing.T) {
+	t.Parallel()
+	m := &gostatsd.Metric{Name: strings.Repeat("a", 1000), Tags: make(gostatsd.Tags, 1000)}
+	assert.NoError(t, MetricLimits{}.check(m))
+}
+
+func TestParseLine(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		line   string
+		metric *gostatsd.Metric
+		event  *gostatsd.Event
+		err    bool
+	}{
+		{line: "f:2|c", metric: &gostatsd.Metric{Name: "f", Value: 2, Type: gostatsd.COUNTER, Rate: 1}},
+		{line: "f:2|c|@0.1", metric: &gostatsd.Metric{Name: "f", Value: 2, Type: gostatsd.COUNTER, Rate: 0.1}},
+		{line: "f:-2.5|g|#a:b,c", metric: &gostatsd.Metric{Name: "f", Value: -2.5, Type: gostatsd.GAUGE, Rate: 1, Tags: gostatsd.Tags{"a:b", "c"}}},
+		{line: "f:10|ms|@0.5|#a", metric: &gostatsd.Metric{Name: "f", Value: 10, Type: gostatsd.TIMER, Rate: 0.5, Tags: gostatsd.Tags{"a"}}},
+		{line: "f:joe|s", metric: &gostatsd.Metric{Name: "f", StringValue: "joe", Type: gostatsd.SET, Rate: 1}},
+		{line: "_e{1,1}:a|b", event: &gostatsd.Event{Title: "a", Text: "b"}},
+		{line: "f", err: true},
+		{line: "f:2|x", err: true},
+		{line: "f:x|c", err: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.line, func(t *testing.T) {
+			t.Parallel()
+			metric, event, err := ParseLine([]byte(test.line))
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if metric != nil {
+				metric.DoneFunc = nil
+			}
+			assert.Equal(t, test.metric, metric)
+			assert.Equal(t, test.event, event)
+		})
+	}
+}
+
+func TestParserUniqueSources(t *testing.T) {
+	t.Parallel()
+	mr, _ := newTestParser(false)
+	mr.addSources([]*Datagram{{IP: "1.1.1.1"}, {IP: "2.2.2.2"}, {IP: "1.1.1.1"}})
+	mr.addSources([]*Datagram{{IP: "3.3.3.3"}, {IP: "2.2.2.2"}})
+	assert.Equal(t, 3, mr.resetSources())
+	assert.Equal(t, 0, mr.resetSources())
+
+	for i := 0; i <= maxUniqueSources; i++ {
+		mr.addSources([]*Datagram{{IP: gostatsd.Source(strconv.Itoa(i))}})
+	}
+	assert.Equal(t, maxUniqueSources, mr.resetSources())
+}
+
+// benchmarkDatagram is a representative datagram of every metric type, with and without tags and sample rates.
+var benchmarkDatagram = []byte(strings.Join([]string{
+	"requests:1|c",
+	"requests:1|c|@0.1|#env:prod,service:web",
+	"memory.used:1024|g|#env:prod,service:web",
+	"cpu.idle:87.5|g",
+	"request.time:320|ms|#env:prod,service:web,endpoint:/api",
+	"request.time:12.5|ms|@0.5",
+	"users:joe|s|#env:prod",
+	"users:jane|s",
+}, "\n"))
+
+// BenchmarkParseDatagram parses a datagram in to metrics, without merging them.
+func BenchmarkParseDatagram(b *testing.B) {
+	mr, _ := newTestParser(false)
+	l := lex()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_, _, _, _, _ = mr.handleDatagram(ctx, l, 0, fakeIP, benchmarkDatagram)
+	}
+}
+
+// BenchmarkProcessDatagrams parses a batch of datagrams, merges them in to a MetricMap and dispatches it, as the
+// parser does for each batch read by the receiver.
+func BenchmarkProcessDatagrams(b *testing.B) {
+	mr := NewDatagramParser(nil, &nopHandler{}, ParserConfig{}, logrus.New())
+	l := mr.newLexer()
+	ctx := context.Background()
+	dgs := make([]*Datagram, 0, 10)
+	for i := 0; i < cap(dgs); i++ {
+		dgs = append(dgs, &Datagram{IP: fakeIP, Msg: benchmarkDatagram, DoneFunc: func() {}})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		mr.processDatagrams(ctx, l, dgs)
+	}
+}
@@ -33,17 +33,20 @@ type DatagramReceiver struct {
 	receiveBatchSize int // The number of datagrams to read in each batch
 	numReaders       int
 	socketFactory    SocketFactory
+	tee              *DatagramTee // Sent a copy of every datagram, may be nil
 
 	out chan<- []*Datagram // Output chan of read datagram batches
 }
 
-// NewDatagramReceiver initialises a new DatagramReceiver.
-func NewDatagramReceiver(out chan<- []*Datagram, sf SocketFactory, numReaders, receiveBatchSize int) *DatagramReceiver {
+// NewDatagramReceiver initialises a new DatagramReceiver.  If tee is not nil, every datagram received is also
+// sent to it.
+func NewDatagramReceiver(out chan<- []*Datagram, sf SocketFactory, numReaders, receiveBatchSize int, tee *DatagramTee) *DatagramReceiver {
 	return &DatagramReceiver{
 		out:              out,
 		receiveBatchSize: receiveBatchSize,
 		numReaders:       numReaders,
 		socketFactory:    sf,
+		tee:              tee,
 		bufPool:          pool.NewDatagramBufferPool(packetSizeUDP),
 	}
 }
@@ -136,6 +139,9 @@ func (dr *DatagramReceiver) Receive(ctx context.Context, c net.PacketConn) {
 			addr := messages[i].Addr
 			nbytes := messages[i].N
 			buf := messages[i].Buffers[0][:nbytes]
+			if dr.tee != nil {
+				dr.tee.Send(buf)
+			}
 
 			retBuf := retBuffers[i]
 			doneFn := func() {
@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// StdinMetricsAddr is the metrics address which makes the server read metrics from stdin instead of a socket.
+const StdinMetricsAddr = "stdin"
+
+// StdinReceiver reads newline delimited metrics from a reader, and parses them until the reader is exhausted.
+type StdinReceiver struct {
+	in               io.Reader
+	parser           *DatagramParser
+	receiveBatchSize int // The number of lines to parse in each batch
+}
+
+// NewStdinReceiver initialises a new StdinReceiver which passes everything read from in to parser.
+func NewStdinReceiver(in io.Reader, parser *DatagramParser, receiveBatchSize int) *StdinReceiver {
+	return &StdinReceiver{
+		in:               in,
+		parser:           parser,
+		receiveBatchSize: receiveBatchSize,
+	}
+}
+
+// Run reads and parses lines until EOF, or the context is done.  Metrics are dispatched to the parsers handler
+// before Run returns.  It returns an error if the input could not be read.
+func (sr *StdinReceiver) Run(ctx context.Context) error {
+	sr.parser.initLogRawMetric(ctx)
+	l := sr.parser.newLexer()
+
+	scanner := bufio.NewScanner(sr.in)
+	scanner.Buffer(make([]byte, 0, 4096), packetSizeUDP)
+
+	var buf bytes.Buffer
+	lines := 0
+	flush := func() {
+		if lines == 0 {
+			return
+		}
+		sr.parser.processDatagrams(ctx, l, []*Datagram{{
+			IP:        gostatsd.UnknownSource,
+			Msg:       buf.Bytes(),
+			Timestamp: gostatsd.NanoNow(),
+			DoneFunc:  func() {},
+		}})
+		buf.Reset()
+		lines = 0
+	}
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		buf.Write(scanner.Bytes())
+		buf.WriteByte('\n')
+		lines++
+		if lines >= sr.receiveBatchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.WithError(err).Error("Error reading metrics from stdin")
+		return err
+	}
+	flush()
+	return nil
+}
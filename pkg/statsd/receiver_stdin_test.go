@@ -0,0 +1,29 @@
+package statsd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdinReceiver(t *testing.T) {
+	t.Parallel()
+	parser, ch := newTestParser(false)
+	receiver := NewStdinReceiver(strings.NewReader("a:1|c\nb:2|g\n\nc:3|ms\nnot a metric\nd:4|s"), parser, 2)
+
+	require.NoError(t, receiver.Run(context.Background()))
+	assert.Len(t, ch.MetricMaps(), 3)
+	assert.EqualValues(t, 4, parser.metricsReceived)
+	assert.EqualValues(t, 1, parser.badLines.Cur)
+}
+
+func TestStdinReceiverLineTooLong(t *testing.T) {
+	t.Parallel()
+	parser, _ := newTestParser(false)
+	receiver := NewStdinReceiver(strings.NewReader(strings.Repeat("a", packetSizeUDP+1)), parser, 2)
+
+	require.Error(t, receiver.Run(context.Background()))
+}
@@ -2,6 +2,7 @@ package statsd
 
 import (
 	"context"
+	"net"
 	"runtime"
 	"sync"
 	"testing"
@@ -25,7 +26,7 @@ func BenchmarkReceive(b *testing.B) {
 	//
 	// ... so this is pretty arbitrary.
 	ch := make(chan []*Datagram, 5000)
-	mr := NewDatagramReceiver(ch, nil, 0, gostatsd.DefaultReceiveBatchSize)
+	mr := NewDatagramReceiver(ch, nil, 0, gostatsd.DefaultReceiveBatchSize, nil)
 	c, done := fakesocket.NewCountedFakePacketConn(uint64(b.N))
 
 	var wg sync.WaitGroup
@@ -71,7 +72,7 @@ func BenchmarkReceive(b *testing.B) {
 
 func TestDatagramReceiver_Receive(t *testing.T) {
 	ch := make(chan []*Datagram, 1)
-	mr := NewDatagramReceiver(ch, nil, 0, 2)
+	mr := NewDatagramReceiver(ch, nil, 0, 2, nil)
 	c := fakesocket.NewFakePacketConn()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -93,3 +94,33 @@ func TestDatagramReceiver_Receive(t *testing.T) {
 	assert.Equal(t, string(dg.IP), fakesocket.FakeAddr.IP.String())
 	assert.Equal(t, dg.Msg, fakesocket.FakeMetric)
 }
+
+func TestDatagramReceiver_ReceiveTee(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tee, err := NewDatagramTee(listener.LocalAddr().String())
+	require.NoError(t, err)
+
+	ch := make(chan []*Datagram, 1)
+	mr := NewDatagramReceiver(ch, nil, 0, 2, tee)
+	c := fakesocket.NewFakePacketConn()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go tee.Run(ctx)
+	go mr.Receive(ctx, c)
+
+	buf := make([]byte, packetSizeUDP)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, fakesocket.FakeMetric, buf[:n])
+
+	// The datagram is still processed as normal
+	dgs := <-ch
+	require.NotEmpty(t, dgs)
+	assert.Equal(t, fakesocket.FakeMetric, dgs[0].Msg)
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package statsd
+
+import (
+	"syscall"
+)
+
+// reusePortSupported indicates if SO_REUSEPORT can be set on this platform.
+const reusePortSupported = false
+
+// reusePortControl does nothing, as SO_REUSEPORT is not supported on this platform.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package statsd
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortSupported indicates if SO_REUSEPORT can be set on this platform.
+const reusePortSupported = true
+
+// reusePortControl sets SO_REUSEPORT on a socket before it is bound, so multiple processes can bind the same address
+// and the kernel distributes datagrams between them.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketFactoryReusePort(t *testing.T) {
+	t.Parallel()
+	first, err := socketFactory("127.0.0.1:0", false, true)()
+	require.NoError(t, err)
+	defer first.Close()
+
+	// A second socket can bind the same address
+	second, err := socketFactory(first.LocalAddr().String(), false, true)()
+	require.NoError(t, err)
+	defer second.Close()
+
+	// Without reuse-port the address is in use
+	_, err = socketFactory(first.LocalAddr().String(), false, false)()
+	require.Error(t, err)
+}
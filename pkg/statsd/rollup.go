@@ -0,0 +1,83 @@
+package statsd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// Rollup is an interval, longer than the flush interval, which metrics are also aggregated over.
+type Rollup struct {
+	Interval time.Duration // The length of the rollup window
+	Every    int           // The number of flushes in the rollup window
+}
+
+// NewRollups creates a Rollup for each interval, which must be a multiple of the flush interval.
+func NewRollups(intervals []time.Duration, flushInterval time.Duration) ([]Rollup, error) {
+	rollups := make([]Rollup, 0, len(intervals))
+	for _, interval := range intervals {
+		if flushInterval <= 0 || interval <= flushInterval || interval%flushInterval != 0 {
+			return nil, fmt.Errorf("rollup interval %v must be a multiple of the flush interval %v", interval, flushInterval)
+		}
+		rollups = append(rollups, Rollup{
+			Interval: interval,
+			Every:    int(interval / flushInterval),
+		})
+	}
+	return rollups, nil
+}
+
+// rollupName formats the interval without any trailing zero units, so 5m0s is 5m.
+func rollupName(interval time.Duration) string {
+	name := interval.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = name[:len(name)-2]
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = name[:len(name)-2]
+	}
+	return name
+}
+
+// rollupAggregator aggregates every metric received over a Rollup, and tags them with rollup:<interval>.
+type rollupAggregator struct {
+	Rollup
+	tag        string
+	aggregator *MetricAggregator
+	flushed    bool // If the rollup window ended in this flush, so it is processed and reset
+}
+
+// tagged returns a copy of mm with the rollup tag added to every metric.  The copy doesn't share any values or sets
+// with mm, so that the rollup can aggregate them independently of the MetricAggregator.
+func (r *rollupAggregator) tagged(mm *gostatsd.MetricMap) *gostatsd.MetricMap {
+	tagged := gostatsd.NewMetricMap()
+	mm.Counters.Each(func(key, _ string, counter gostatsd.Counter) {
+		counter.Tags = r.tags(counter.Tags)
+		tagged.MergeCounter(key, gostatsd.FormatTagsKey(counter.Source, counter.Tags), counter)
+	})
+	mm.Timers.Each(func(key, _ string, timer gostatsd.Timer) {
+		timer.Tags = r.tags(timer.Tags)
+		timer.Values = append([]float64(nil), timer.Values...)
+		tagged.MergeTimer(key, gostatsd.FormatTagsKey(timer.Source, timer.Tags), timer)
+	})
+	mm.Gauges.Each(func(key, _ string, gauge gostatsd.Gauge) {
+		gauge.Tags = r.tags(gauge.Tags)
+		tagged.MergeGauge(key, gostatsd.FormatTagsKey(gauge.Source, gauge.Tags), gauge)
+	})
+	mm.Sets.Each(func(key, _ string, set gostatsd.Set) {
+		values := make(map[string]struct{}, len(set.Values))
+		for value := range set.Values {
+			values[value] = struct{}{}
+		}
+		set.Values = values
+		set.Tags = r.tags(set.Tags)
+		tagged.MergeSet(key, gostatsd.FormatTagsKey(set.Source, set.Tags), set)
+	})
+	return tagged
+}
+
+func (r *rollupAggregator) tags(tags gostatsd.Tags) gostatsd.Tags {
+	return append(tags.Copy(), r.tag)
+}
@@ -0,0 +1,30 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRollups(t *testing.T) {
+	t.Parallel()
+	rollups, err := NewRollups([]time.Duration{time.Minute, 5 * time.Minute}, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []Rollup{{Interval: time.Minute, Every: 6}, {Interval: 5 * time.Minute, Every: 30}}, rollups)
+
+	for _, interval := range []time.Duration{15 * time.Second, 10 * time.Second, 5 * time.Second, 0} {
+		_, err := NewRollups([]time.Duration{interval}, 10*time.Second)
+		assert.Error(t, err, interval)
+	}
+}
+
+func TestRollupName(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "30s", rollupName(30*time.Second))
+	assert.Equal(t, "1m", rollupName(time.Minute))
+	assert.Equal(t, "1m30s", rollupName(90*time.Second))
+	assert.Equal(t, "1h", rollupName(time.Hour))
+	assert.Equal(t, "1h30m", rollupName(90*time.Minute))
+}
@@ -0,0 +1,95 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// SampleExpression is an expression evaluated for each metric received, which returns the rate to sample it at.  A
+// metric is kept with that probability, and its sample rate is scaled by it, so the aggregated values are the same
+// on average.  An expression which fails, or returns a rate which is not greater than 0 and at most 1, doesn't
+// sample the metric.
+type SampleExpression struct {
+	program *vm.Program
+	logger  logrus.FieldLogger
+
+	errorLimiter *rate.Limiter // Limits how often failures are logged
+	rands        sync.Pool     // *rand.Rand, so parser workers don't share the lock of the global source
+}
+
+// sampleEnv is the metric an expression is evaluated against.
+type sampleEnv struct {
+	Name   string   `expr:"name"`
+	Tags   []string `expr:"tags"`
+	Value  float64  `expr:"value"`
+	Type   string   `expr:"type"`
+	Source string   `expr:"source"`
+}
+
+// NewSampleExpression compiles a SampleExpression, returning an error if it is invalid.
+func NewSampleExpression(source string, logger logrus.FieldLogger) (*SampleExpression, error) {
+	program, err := expr.Compile(source, expr.Env(sampleEnv{}), expr.AsFloat64())
+	if err != nil {
+		return nil, fmt.Errorf("invalid sample-expression: %v", err)
+	}
+	return &SampleExpression{
+		program:      program,
+		logger:       logger,
+		errorLimiter: rate.NewLimiter(1, 1),
+		rands: sync.Pool{
+			New: func() interface{} {
+				return rand.New(rand.NewSource(rand.Int63()))
+			},
+		},
+	}, nil
+}
+
+// NewSampleExpressionFromViper creates the SampleExpression in the sample-expression key, or returns nil if there
+// isn't one.
+func NewSampleExpressionFromViper(v *viper.Viper, logger logrus.FieldLogger) (*SampleExpression, error) {
+	source := v.GetString("sample-expression")
+	if source == "" {
+		return nil, nil
+	}
+	return NewSampleExpression(source, logger)
+}
+
+// Sample evaluates the expression for the metric, and returns false if the metric should be dropped.  If it is kept
+// the sample rate of the metric is scaled by the rate returned.  An error is returned, and the metric is kept
+// unchanged, if the expression fails.
+func (se *SampleExpression) Sample(m *gostatsd.Metric) (bool, error) {
+	out, err := expr.Run(se.program, &sampleEnv{
+		Name:   m.Name,
+		Tags:   m.Tags,
+		Value:  m.Value,
+		Type:   m.Type.String(),
+		Source: string(m.Source),
+	})
+	if err == nil {
+		if sampleRate := out.(float64); math.IsNaN(sampleRate) || sampleRate <= 0 || sampleRate > 1 {
+			err = fmt.Errorf("sample rate %v must be greater than 0 and at most 1", sampleRate)
+		} else if sampleRate < 1 {
+			r := se.rands.Get().(*rand.Rand)
+			keep := r.Float64() < sampleRate
+			se.rands.Put(r)
+			if !keep {
+				return false, nil
+			}
+			m.Rate *= sampleRate
+		}
+	}
+	if err != nil && se.errorLimiter.Allow() {
+		se.logger.WithError(err).WithField("metric", m.Name).Warn("sample-expression failed, metric not sampled")
+	}
+	return true, err
+}
@@ -0,0 +1,85 @@
+package statsd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestSampleExpression(t *testing.T) {
+	t.Parallel()
+	se, err := NewSampleExpression(`name startsWith "noisy." && "env:dev" in tags ? 0.5 : 1`, logrus.New())
+	require.NoError(t, err)
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		m := &gostatsd.Metric{Name: "noisy.a", Tags: gostatsd.Tags{"env:dev"}, Rate: 0.5, Type: gostatsd.COUNTER}
+		keep, err := se.Sample(m)
+		require.NoError(t, err)
+		if keep {
+			kept++
+			assert.Equal(t, 0.25, m.Rate) // Scaled by the rate it was sampled at
+		}
+	}
+	assert.InDelta(t, 500, kept, 150)
+
+	m := &gostatsd.Metric{Name: "noisy.a", Tags: gostatsd.Tags{"env:prod"}, Rate: 1, Type: gostatsd.COUNTER}
+	keep, err := se.Sample(m)
+	require.NoError(t, err)
+	assert.True(t, keep)
+	assert.Equal(t, 1.0, m.Rate)
+}
+
+func TestSampleExpressionErrors(t *testing.T) {
+	t.Parallel()
+	_, err := NewSampleExpression(`name +`, logrus.New())
+	assert.Error(t, err)
+	_, err = NewSampleExpression(`name`, logrus.New()) // Not a number
+	assert.Error(t, err)
+
+	for _, source := range []string{`value > 0 ? 0 : 1`, `value > 0 ? 2 : 1`, `tags[5] == "a" ? 0.5 : 1`} {
+		se, err := NewSampleExpression(source, logrus.New())
+		require.NoError(t, err, source)
+		m := &gostatsd.Metric{Name: "a", Value: 1, Rate: 1, Type: gostatsd.GAUGE}
+		keep, err := se.Sample(m)
+		assert.Error(t, err, source)
+		assert.True(t, keep, source) // Failures don't sample
+		assert.Equal(t, 1.0, m.Rate, source)
+	}
+}
+
+func TestNewSampleExpressionFromViper(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	se, err := NewSampleExpressionFromViper(v, logrus.New())
+	require.NoError(t, err)
+	assert.Nil(t, se)
+
+	v.Set("sample-expression", `type == "timer" ? 0.1 : 1`)
+	se, err = NewSampleExpressionFromViper(v, logrus.New())
+	require.NoError(t, err)
+	assert.NotNil(t, se)
+
+	v.Set("sample-expression", `type ==`)
+	_, err = NewSampleExpressionFromViper(v, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestParseDatagramSampleExpression(t *testing.T) {
+	t.Parallel()
+	se, err := NewSampleExpression(`name == "drop" ? 0.000000001 : name == "bad" ? 0 : 1`, logrus.New())
+	require.NoError(t, err)
+	mr := NewDatagramParser(nil, &countingHandler{}, ParserConfig{SampleExpression: se}, logrus.New())
+	metrics, _, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte("drop:1|c\nbad:1|c\nkeep:1|c"))
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "bad", metrics[0].Name)
+	assert.Equal(t, "keep", metrics[1].Name)
+	assert.EqualValues(t, 1, mr.sampledOut)
+	assert.EqualValues(t, 1, mr.sampleErrors)
+}
@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// SampleRateRule is a sample rate to assume for metrics which are received without one.
+type SampleRateRule struct {
+	MatchMetrics gostatsd.StringMatchList // Name must match
+	Rate         float64                  // Sample rate to assume
+}
+
+// SampleRateRules is a list of SampleRateRule, the first rule matching a metric wins.
+type SampleRateRules []SampleRateRule
+
+// SampleRate returns the sample rate of the first rule matching the metric name, or 1 if no rules match.
+func (srr SampleRateRules) SampleRate(name string) float64 {
+	for _, rule := range srr {
+		if rule.MatchMetrics.MatchAny(name) {
+			return rule.Rate
+		}
+	}
+	return 1
+}
+
+// NewSampleRateRuleFromViper creates a new SampleRateRule given a *viper.Viper
+func NewSampleRateRuleFromViper(v *viper.Viper) SampleRateRule {
+	v.SetDefault("match-metrics", []string{})
+	v.SetDefault("rate", 1.0)
+	return SampleRateRule{
+		MatchMetrics: toStringMatch(v.GetStringSlice("match-metrics")),
+		Rate:         v.GetFloat64("rate"),
+	}
+}
+
+// NewSampleRateRulesFromViper creates the SampleRateRules named by the sample-rates key.
+func NewSampleRateRulesFromViper(v *viper.Viper) SampleRateRules {
+	ruleNameList := v.GetStringSlice("sample-rates")
+	var rules SampleRateRules
+	for _, ruleName := range ruleNameList {
+		vRule := v.Sub("sample-rate." + ruleName)
+		if vRule == nil {
+			logrus.Warnf("Sample rate doesn't exist: %v", ruleName)
+			continue
+		}
+		rule := NewSampleRateRuleFromViper(vRule)
+		if rule.Rate <= 0 || rule.Rate > 1 {
+			logrus.Warnf("Sample rate %v has invalid rate %v, must be greater than 0 and at most 1", ruleName, rule.Rate)
+			continue
+		}
+		if len(rule.MatchMetrics) == 0 {
+			logrus.Warnf("Sample rate %v has no match-metrics", ruleName)
+			continue
+		}
+		rules = append(rules, rule)
+		logrus.Infof("Loaded sample rate %v", ruleName)
+	}
+	return rules
+}
@@ -0,0 +1,150 @@
+package statsd
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// SourceRateLimit is the number of metrics per second a single source may send, and the number of metrics it may
+// burst above that.  A Limit of 0 means the source is not limited.
+type SourceRateLimit struct {
+	Limit rate.Limit
+	Burst int
+}
+
+func (srl SourceRateLimit) newLimiter() *rate.Limiter {
+	if srl.Limit <= 0 {
+		return nil
+	}
+	burst := srl.Burst
+	if burst <= 0 {
+		burst = int(srl.Limit) // One second of metrics
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return rate.NewLimiter(srl.Limit, burst)
+}
+
+// SourceRateLimiter applies a token bucket to the metrics received from each source IP, and counts the metrics
+// dropped from each source.  It is safe for concurrent use.  The limiter of a source is looked up once per datagram,
+// so the lock shared by every source is not taken for each metric.
+type SourceRateLimiter struct {
+	defaultLimit SourceRateLimit
+	overrides    map[gostatsd.Source]SourceRateLimit
+
+	lock     sync.Mutex
+	limiters map[gostatsd.Source]*sourceLimiter // A nil limiter indicates the source is not limited
+	seen     map[gostatsd.Source]struct{}       // Sources seen since the last flush
+}
+
+// sourceLimiter is the token bucket of a single source.
+type sourceLimiter struct {
+	limited uint64 // Metrics dropped since the last flush, accessed atomically
+	limiter *rate.Limiter
+}
+
+// NewSourceRateLimiter creates a SourceRateLimiter which limits every source to defaultLimit, unless it has an
+// override.  It returns nil if no source would be limited.
+func NewSourceRateLimiter(defaultLimit SourceRateLimit, overrides map[gostatsd.Source]SourceRateLimit) *SourceRateLimiter {
+	limited := defaultLimit.Limit > 0
+	for _, override := range overrides {
+		limited = limited || override.Limit > 0
+	}
+	if !limited {
+		return nil
+	}
+	return &SourceRateLimiter{
+		defaultLimit: defaultLimit,
+		overrides:    overrides,
+		limiters:     map[gostatsd.Source]*sourceLimiter{},
+		seen:         map[gostatsd.Source]struct{}{},
+	}
+}
+
+// forSource returns the limiter of source, creating it if the source has not been seen recently.  It returns nil if
+// the source is not limited.
+func (srl *SourceRateLimiter) forSource(source gostatsd.Source) *sourceLimiter {
+	srl.lock.Lock()
+	defer srl.lock.Unlock()
+	srl.seen[source] = present
+	sl, ok := srl.limiters[source]
+	if !ok {
+		limit, ok := srl.overrides[source]
+		if !ok {
+			limit = srl.defaultLimit
+		}
+		if limiter := limit.newLimiter(); limiter != nil {
+			sl = &sourceLimiter{limiter: limiter}
+		}
+		srl.limiters[source] = sl
+	}
+	return sl
+}
+
+// allow reports if a metric received at now is within the rate limit of the source.  A nil sourceLimiter allows
+// every metric.
+func (sl *sourceLimiter) allow(now gostatsd.Nanotime) bool {
+	if sl == nil || sl.limiter.AllowN(time.Unix(0, int64(now)), 1) {
+		return true
+	}
+	atomic.AddUint64(&sl.limited, 1)
+	return false
+}
+
+// flush returns the number of metrics dropped from each source since it was last called.  The limiters of sources
+// which have not been seen since the last flush are discarded, to bound the memory used by sources which come and go.
+func (srl *SourceRateLimiter) flush() map[gostatsd.Source]uint64 {
+	srl.lock.Lock()
+	defer srl.lock.Unlock()
+	limited := map[gostatsd.Source]uint64{}
+	for source, sl := range srl.limiters {
+		if sl != nil {
+			if count := atomic.SwapUint64(&sl.limited, 0); count > 0 {
+				limited[source] = count
+			}
+		}
+		if _, ok := srl.seen[source]; !ok {
+			delete(srl.limiters, source)
+		}
+	}
+	srl.seen = make(map[gostatsd.Source]struct{}, len(srl.seen))
+	return limited
+}
+
+// NewSourceRateOverridesFromViper creates the per source rate limits named by the source-rate-overrides key.  Each
+// override is a block named source-rate-override.<name>, with a list of sources, and the limit and burst for them.
+func NewSourceRateOverridesFromViper(v *viper.Viper) map[gostatsd.Source]SourceRateLimit {
+	overrides := map[gostatsd.Source]SourceRateLimit{}
+	for _, name := range v.GetStringSlice("source-rate-overrides") {
+		vOverride := v.Sub("source-rate-override." + name)
+		if vOverride == nil {
+			logrus.Warnf("Source rate override doesn't exist: %v", name)
+			continue
+		}
+		vOverride.SetDefault("sources", []string{})
+		vOverride.SetDefault("limit", 0.0)
+		vOverride.SetDefault("burst", 0)
+		limit := SourceRateLimit{
+			Limit: rate.Limit(vOverride.GetFloat64("limit")),
+			Burst: vOverride.GetInt("burst"),
+		}
+		sources := vOverride.GetStringSlice("sources")
+		if len(sources) == 0 {
+			logrus.Warnf("Source rate override %v has no sources", name)
+			continue
+		}
+		for _, source := range sources {
+			overrides[gostatsd.Source(source)] = limit
+		}
+		logrus.Infof("Loaded source rate override %v", name)
+	}
+	return overrides
+}
@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestNewSourceRateLimiterDisabled(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, NewSourceRateLimiter(SourceRateLimit{}, nil))
+	assert.Nil(t, NewSourceRateLimiter(SourceRateLimit{Burst: 10}, map[gostatsd.Source]SourceRateLimit{"a": {}}))
+	assert.NotNil(t, NewSourceRateLimiter(SourceRateLimit{}, map[gostatsd.Source]SourceRateLimit{"a": {Limit: 1}}))
+}
+
+func TestSourceRateLimiter(t *testing.T) {
+	t.Parallel()
+	srl := NewSourceRateLimiter(SourceRateLimit{Limit: 2}, map[gostatsd.Source]SourceRateLimit{
+		"burst":     {Limit: 1, Burst: 3},
+		"unlimited": {},
+	})
+	now := gostatsd.Nanotime(time.Second)
+
+	allowed := func(source gostatsd.Source, count int, now gostatsd.Nanotime) int {
+		n := 0
+		for i := 0; i < count; i++ {
+			if srl.forSource(source).allow(now) {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 2, allowed("a", 5, now)) // Default burst is one second of metrics
+	assert.Equal(t, 2, allowed("b", 5, now)) // Each source has its own bucket
+	assert.Equal(t, 3, allowed("burst", 5, now))
+	assert.Equal(t, 100, allowed("unlimited", 100, now))
+	assert.Equal(t, 1, allowed("a", 5, now+gostatsd.Nanotime(500*time.Millisecond)))
+
+	assert.Equal(t, map[gostatsd.Source]uint64{"a": 7, "b": 3, "burst": 2}, srl.flush())
+	assert.Len(t, srl.limiters, 4)
+
+	// Sources not seen in the last flush interval are forgotten
+	allowed("a", 1, now+gostatsd.Nanotime(10*time.Second))
+	assert.Empty(t, srl.flush())
+	assert.Len(t, srl.limiters, 1)
+}
+
+func TestParseDatagramSourceRateLimit(t *testing.T) {
+	t.Parallel()
+	ch := &countingHandler{}
+	srl := NewSourceRateLimiter(SourceRateLimit{Limit: 2}, nil)
+	mr := NewDatagramParser(nil, ch, ParserConfig{RateLimiter: srl}, logrus.New())
+	metrics, events, _, _, _ := mr.handleDatagram(context.Background(), lex(), 0, fakeIP, []byte("a:1|c\nb:1|c\nc:1|c\n_e{1,1}:a|b"))
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "a", metrics[0].Name)
+	assert.Equal(t, "b", metrics[1].Name)
+	assert.EqualValues(t, 1, events) // Events are not limited
+	assert.Equal(t, map[gostatsd.Source]uint64{fakeIP: 1}, srl.flush())
+}
+
+func TestNewSourceRateOverridesFromViper(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+source-rate-overrides='noisy quiet missing'
+
+[source-rate-override.noisy]
+sources=['10.0.0.1', '10.0.0.2']
+limit=10
+burst=100
+
+[source-rate-override.quiet]
+sources=['10.0.0.3']
+
+[source-rate-override.empty]
+limit=10
+`)
+	v := viper.New()
+	v.SetConfigType("toml")
+	require.NoError(t, v.ReadConfig(bytes.NewBuffer(data)))
+
+	assert.Equal(t, map[gostatsd.Source]SourceRateLimit{
+		"10.0.0.1": {Limit: 10, Burst: 100},
+		"10.0.0.2": {Limit: 10, Burst: 100},
+		"10.0.0.3": {},
+	}, NewSourceRateOverridesFromViper(v))
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
 	"time"
 
 	"github.com/ash2k/stager"
@@ -24,6 +26,7 @@ import (
 type Server struct {
 	Runnables                 []gostatsd.Runnable
 	Backends                  []gostatsd.Backend
+	FlushHandlers             []FlushHandler
 	CachedInstances           gostatsd.CachedInstances
 	InternalTags              gostatsd.Tags
 	InternalNamespace         string
@@ -35,6 +38,7 @@ type Server struct {
 	FlushInterval             time.Duration
 	FlushOffset               time.Duration
 	FlushAligned              bool
+	DryRun                    bool
 	MaxReaders                int
 	MaxParsers                int
 	MaxWorkers                int
@@ -48,28 +52,83 @@ type Server struct {
 	PercentThreshold          []float64
 	IgnoreHost                bool
 	ConnPerReader             bool
+	ReusePort                 bool
 	HeartbeatEnabled          bool
 	HeartbeatTags             gostatsd.Tags
 	ReceiveBatchSize          int
 	DisabledSubTypes          gostatsd.TimerSubtypes
 	HistogramLimit            uint32
+	CardinalityWarnThreshold  uint32
+	DisablePerSecond          bool
 	BadLineRateLimitPerSecond rate.Limit
 	ServerMode                string
 	Hostname                  gostatsd.Source
 	LogRawMetric              bool
 	Viper                     *viper.Viper
 	TransportPool             *transport.TransportPool
+	BackendTimeout            time.Duration
+	BackendCircuitFailures    uint
+	BackendCircuitCooldown    time.Duration
+	NormalizeTags             bool
+	FlushMaxMetrics           uint64
+	CounterEvents             bool
+	MetricLimits              MetricLimits
+	LinearPercentiles         bool
+	PassthroughGauges         []string
+	CumulativeCounters        []string
+	TagPrecedence             []string
+	PercentileNames           string    // Template for naming percentile thresholds, see gostatsd.PercentileNameTemplate, defaults to etsy
+	Stdin                     io.Reader // Metrics are read from here if MetricsAddr is StdinMetricsAddr, defaults to os.Stdin
+	SourceRateLimit           SourceRateLimit
+	PauseMaxSeries            uint64              // Number of series buffered while flushing is paused which forces a flush, 0 to disable
+	TagAllowlist              []string            // Tag keys which are kept on metrics received by the parser, empty to keep every tag
+	AggregatorHostTag         bool                // Add an aggregator_host tag with the Hostname to all metrics, in standalone mode
+	ChangedGaugesOnly         bool                // Only send gauges with a different value to the last one sent
+	UnknownMetricType         gostatsd.MetricType // Type of metrics received with an unknown type, 0 to drop them
+	PercentileMinSamples      uint32              // Timers with fewer values than this have no percentiles
+	SetSuffix                 string              // Appended to the name of every set sent to the backends
+	ApproximateSets           []string            // Sets which are counted by a HyperLogLog rather than exactly
+	PauseExpiry               bool                // Don't expire metrics while flushing is paused or failing
+	RollupIntervals           []time.Duration     // Intervals to also aggregate metrics over, multiples of FlushInterval
+	DeadletterFile            string              // File to write dropped lines to, empty to disable
+	DeadletterMaxSize         int64               // Size in bytes of the deadletter file before it is rotated
+	DeadletterRate            rate.Limit          // Lines per second written to the deadletter file, 0 for unlimited
+	DropCounterOverflows      bool                // Drop counters which overflow int64, rather than saturating
+	IntegerCounters           bool                // Send counters without the fraction of their value
+	TeeAddr                   string              // Address to send a copy of received datagrams to, empty to disable
+	FlushOnShutdownOnly       bool                // Don't flush periodically, only once during shutdown
+	BackendFailure            string              // Handling of metrics which every backend failed to send
+	BackendFailureMaxSeries   uint64              // Number of series kept to send again by BackendFailure, 0 for no limit
+	Enrichers                 []gostatsd.Enricher // Called with every metric received to add or modify its tags
+	CounterTotals             []string            // Counters which also send their lifetime total as <name>.total
+	BackendMaxConcurrent      uint                // Sends to each backend which can be in flight at once, 0 for no limit
+	PercentileTags            bool                // Send timer percentiles as <name>.percentile gauges tagged with percentile and stat
+	MetricTypeTags            bool                // Tag every metric sent with metric_type:<type>
+	AverageGauges             []string            // Gauges which send the mean of the values received in each flush
+	NamePrefixTemplate        string              // Prefix for the name of every metric, which may use the value of its tags
+	AdditionalNamespaces      []string            // Namespaces to also send metrics in Namespace under, replacing Namespace
+	PercentileSampleRate      float64             // Probability of a flush calculating timer percentiles
+	UntaggedMetrics           []string            // Metrics which are aggregated into a single series without their tags
+	CounterPeakRates          []string            // Counters which also send their peak rate as <name>.peak_per_second
+	CounterPeakRateWindow     time.Duration       // The sub-window the peak rate of CounterPeakRates is measured over
+	GaugeStateFile            string              // File to persist gauges to across restarts, empty to disable
+	FlushWarmup               time.Duration       // Periodic flushes scheduled this soon after startup are skipped
+	FlushWarmupDiscard        bool                // Discard the metrics aggregated during the FlushWarmup
 }
 
 // Run runs the server until context signals done.
 func (s *Server) Run(ctx context.Context) error {
-	return s.RunWithCustomSocket(ctx, socketFactory(s.MetricsAddr, s.ConnPerReader))
+	return s.RunWithCustomSocket(ctx, socketFactory(s.MetricsAddr, s.ConnPerReader, s.ReusePort))
 }
 
 // SocketFactory is an indirection layer over net.ListenPacket() to allow for different implementations.
 type SocketFactory func() (net.PacketConn, error)
 
-func socketFactory(metricsAddr string, connPerReader bool) SocketFactory {
+func socketFactory(metricsAddr string, connPerReader, reusePort bool) SocketFactory {
+	if reusePort && !reusePortSupported {
+		logrus.Warn("reuse-port is not supported on this platform, ignoring")
+		reusePort = false
+	}
 	if connPerReader {
 		// go-reuseport requires explicitly representing the unspecified address
 		addr, err := net.ResolveUDPAddr("udp", metricsAddr)
@@ -81,6 +140,13 @@ func socketFactory(metricsAddr string, connPerReader bool) SocketFactory {
 		return func() (net.PacketConn, error) {
 			return reuseport.ListenPacket("udp", metricsAddr)
 		}
+	} else if reusePort {
+		// Set SO_REUSEPORT so other processes can bind the same address.
+		lc := net.ListenConfig{Control: reusePortControl}
+		conn, err := lc.ListenPacket(context.Background(), "udp", metricsAddr)
+		return func() (net.PacketConn, error) {
+			return conn, err
+		}
 	} else {
 		conn, err := net.ListenPacket("udp", metricsAddr)
 		return func() (net.PacketConn, error) {
@@ -89,53 +155,150 @@ func socketFactory(metricsAddr string, connPerReader bool) SocketFactory {
 	}
 }
 
-func (s *Server) createStandaloneSink() (gostatsd.PipelineHandler, []gostatsd.Runnable, error) {
+func (s *Server) createStandaloneSink(logger logrus.FieldLogger, lastFlush *LastFlush) (gostatsd.PipelineHandler, []gostatsd.Runnable, *MetricFlusher, error) {
 	var runnables []gostatsd.Runnable
 
+	percentileNames := s.PercentileNames
+	if percentileNames == "" {
+		percentileNames = gostatsd.PercentileNameTemplates[gostatsd.DefaultPercentileNames]
+	}
+
+	rollups, err := NewRollups(s.RollupIntervals, s.FlushInterval)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// Create the backend handler
-	factory := agrFactory{
-		percentThresholds:     s.PercentThreshold,
-		expiryIntervalCounter: s.ExpiryIntervalCounter,
-		expiryIntervalGauge:   s.ExpiryIntervalGauge,
-		expiryIntervalSet:     s.ExpiryIntervalSet,
-		expiryIntervalTimer:   s.ExpiryIntervalTimer,
-		disabledSubtypes:      s.DisabledSubTypes,
-		histogramLimit:        s.HistogramLimit,
+	factory := agrFactory{config: AggregatorConfig{
+		PercentThresholds:     s.PercentThreshold,
+		ExpiryIntervalCounter: s.ExpiryIntervalCounter,
+		ExpiryIntervalGauge:   s.ExpiryIntervalGauge,
+		ExpiryIntervalSet:     s.ExpiryIntervalSet,
+		ExpiryIntervalTimer:   s.ExpiryIntervalTimer,
+		DisabledSubtypes:      s.DisabledSubTypes,
+		HistogramLimit:        s.HistogramLimit,
+		CardinalityWarn:       s.CardinalityWarnThreshold,
+		DisablePerSecond:      s.DisablePerSecond,
+		CounterEvents:         s.CounterEvents,
+		LinearPercentiles:     s.LinearPercentiles,
+		CumulativeCounters:    s.CumulativeCounters,
+		PercentileNames:       percentileNames,
+		ChangedGaugesOnly:     s.ChangedGaugesOnly,
+		MinSamplesPercentiles: s.PercentileMinSamples,
+		SetSuffix:             s.SetSuffix,
+		Downsamples:           NewDownsampleRulesFromViper(s.Viper),
+		ApproximateSets:       s.ApproximateSets,
+		Rollups:               rollups,
+		DropCounterOverflows:  s.DropCounterOverflows,
+		IntegerCounters:       s.IntegerCounters,
+		CounterTotals:         s.CounterTotals,
+		PercentileTags:        s.PercentileTags,
+		TypeTags:              s.MetricTypeTags,
+		AverageGauges:         s.AverageGauges,
+		PercentileSampleRate:  s.PercentileSampleRate,
+		UntaggedMetrics:       s.UntaggedMetrics,
+		PeakRateCounters:      s.CounterPeakRates,
+		PeakRateWindow:        s.CounterPeakRateWindow,
+	}}
+
+	// Events are sent directly to the backends, so in dry-run mode they are dropped entirely.
+	eventBackends := s.Backends
+	if s.DryRun {
+		eventBackends = nil
 	}
 
-	backendHandler := NewBackendHandler(s.Backends, uint(s.MaxConcurrentEvents), s.MaxWorkers, s.MaxQueueSize, &factory)
+	backendHandler := NewBackendHandler(eventBackends, uint(s.MaxConcurrentEvents), s.MaxWorkers, s.MaxQueueSize, &factory, s.FlushMaxMetrics)
 	runnables = append(runnables, backendHandler.Run, backendHandler.RunMetricsContext)
 
+	// Isolate metric backends from each other if required, events are not affected.
+	metricBackends := s.Backends
+	if s.BackendTimeout > 0 || s.BackendCircuitFailures > 0 || s.BackendMaxConcurrent > 0 {
+		metricBackends = make([]gostatsd.Backend, 0, len(s.Backends))
+		for _, backend := range s.Backends {
+			isolated := NewIsolatedBackend(backend, s.BackendTimeout, s.BackendCircuitFailures, s.BackendCircuitCooldown, s.BackendMaxConcurrent)
+			metricBackends = append(metricBackends, isolated)
+			runnables = append(runnables, isolated.RunMetricsContext)
+		}
+	}
+
+	// Restore the gauges from before the last restart, and persist them after each flush
+	var gaugeState *GaugeState
+	if s.GaugeStateFile != "" {
+		gaugeState = NewGaugeState(s.GaugeStateFile, s.ExpiryIntervalGauge, logger)
+		runnables = append(runnables, func(ctx context.Context) {
+			gaugeState.Restore(ctx, backendHandler)
+		})
+	}
+
 	// Create the Flusher
-	flusher := NewMetricFlusher(s.FlushInterval, s.FlushOffset, s.FlushAligned, backendHandler, s.Backends)
+	flusher := NewMetricFlusher(backendHandler, metricBackends, FlusherConfig{
+		FlushInterval:    s.FlushInterval,
+		FlushOffset:      s.FlushOffset,
+		FlushAligned:     s.FlushAligned,
+		DryRun:           s.DryRun,
+		LastFlush:        lastFlush,
+		FlushHandlers:    s.FlushHandlers,
+		PauseMaxSeries:   s.PauseMaxSeries,
+		PauseExpiry:      s.PauseExpiry,
+		ShutdownOnly:     s.FlushOnShutdownOnly,
+		FailurePolicy:    s.BackendFailure,
+		FailureMaxSeries: s.BackendFailureMaxSeries,
+		Namespace:        s.Namespace,
+		ExtraNamespaces:  s.AdditionalNamespaces,
+		GaugeState:       gaugeState,
+		Warmup:           s.FlushWarmup,
+		WarmupDiscard:    s.FlushWarmupDiscard,
+	})
 	runnables = append(runnables, flusher.Run)
 
-	return backendHandler, runnables, nil
+	// Send gauges which skip aggregation directly to the backends
+	if len(s.PassthroughGauges) > 0 {
+		passthroughBackends := metricBackends
+		if s.DryRun {
+			passthroughBackends = nil
+		}
+		passthroughHandler := NewPassthroughHandler(backendHandler, passthroughBackends, s.PassthroughGauges)
+		runnables = append(runnables, passthroughHandler.RunMetricsContext)
+		return passthroughHandler, runnables, flusher, nil
+	}
+
+	return backendHandler, runnables, flusher, nil
 }
 
-func (s *Server) createForwarderSink(logger logrus.FieldLogger) (gostatsd.PipelineHandler, []gostatsd.Runnable, error) {
+func (s *Server) createForwarderSink(logger logrus.FieldLogger) (gostatsd.PipelineHandler, []gostatsd.Runnable, *MetricFlusher, error) {
 	forwarderHandler, err := NewHttpForwarderHandlerV2FromViper(
 		logger,
 		s.Viper,
 		s.TransportPool,
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// Create a Flusher, this is primarily for all the periodic metrics which are emitted.
-	flusher := NewMetricFlusher(s.FlushInterval, 0, false, nil, s.Backends)
+	flusher := NewMetricFlusher(nil, s.Backends, FlusherConfig{FlushInterval: s.FlushInterval})
 
-	return forwarderHandler, []gostatsd.Runnable{forwarderHandler.Run, forwarderHandler.RunMetricsContext, flusher.Run}, nil
+	return forwarderHandler, []gostatsd.Runnable{forwarderHandler.Run, forwarderHandler.RunMetricsContext, flusher.Run}, flusher, nil
 }
 
-func (s *Server) createFinalSink(logger logrus.FieldLogger) (gostatsd.PipelineHandler, []gostatsd.Runnable, error) {
+func (s *Server) createFinalSink(logger logrus.FieldLogger, lastFlush *LastFlush) (gostatsd.PipelineHandler, []gostatsd.Runnable, *MetricFlusher, error) {
 	if s.ServerMode == "standalone" {
-		return s.createStandaloneSink()
+		return s.createStandaloneSink(logger, lastFlush)
 	} else if s.ServerMode == "forwarder" {
 		return s.createForwarderSink(logger)
 	}
-	return nil, nil, errors.New("invalid server-mode, must be standalone, or forwarder")
+	return nil, nil, nil, errors.New("invalid server-mode, must be standalone, or forwarder")
+}
+
+// validatePercentThresholds checks each percentile is between -100 and 100, exclusive.  A percentile outside of that
+// range covers more values than a timer has.
+func validatePercentThresholds(percentThresholds []float64) error {
+	for _, pct := range percentThresholds {
+		if !(pct > -100 && pct < 100) { // Also rejects NaN
+			return fmt.Errorf("invalid percent-threshold %v, must be between -100 and 100 exclusive", pct)
+		}
+	}
+	return nil
 }
 
 // RunWithCustomSocket runs the server until context signals done.
@@ -143,19 +306,76 @@ func (s *Server) createFinalSink(logger logrus.FieldLogger) (gostatsd.PipelineHa
 func (s *Server) RunWithCustomSocket(ctx context.Context, sf SocketFactory) error {
 	logger := logrus.StandardLogger()
 
-	handler, runnables, err := s.createFinalSink(logger)
+	readStdin := s.MetricsAddr == StdinMetricsAddr
+	if readStdin && s.ServerMode != "standalone" {
+		return errors.New("reading metrics from stdin is only supported in standalone server-mode")
+	}
+	if s.FlushOnShutdownOnly && s.ServerMode != "standalone" {
+		return errors.New("flush-on-shutdown-only is only supported in standalone server-mode")
+	}
+	if err := validatePercentThresholds(s.PercentThreshold); err != nil {
+		return err
+	}
+
+	// Keep a copy of the most recent flush if any http server is exposing it, this is only supported in standalone mode.
+	var lastFlush *LastFlush
+	var lastFlushSource web.LastFlushSource
+	if s.ServerMode == "standalone" && web.LastFlushEnabledFromViper(s.Viper) {
+		lastFlush = NewLastFlush()
+		lastFlushSource = lastFlush
+	}
+
+	handler, runnables, flusher, err := s.createFinalSink(logger, lastFlush)
 	if err != nil {
 		return err
 	}
 
 	runnables = append(append(make([]gostatsd.Runnable, 0, len(s.Runnables)), s.Runnables...), runnables...)
 
+	// Identify the server which aggregated each metric, when metrics from multiple servers are sent to one backend.
+	defaultTags := s.DefaultTags
+	if s.AggregatorHostTag && s.ServerMode == "standalone" && s.Hostname != "" {
+		defaultTags = append(defaultTags[:len(defaultTags):len(defaultTags)], "aggregator_host:"+string(s.Hostname))
+	}
+
+	tagPrecedence, err := NewTagPrecedence(s.TagPrecedence, defaultTags, s.CachedInstances != nil)
+	if err != nil {
+		return err
+	}
+
+	var deadletter *Deadletter
+	if s.DeadletterFile != "" {
+		deadletter, err = NewDeadletter(s.DeadletterFile, s.DeadletterMaxSize, s.DeadletterRate)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := deadletter.Close(); err != nil {
+				logger.WithError(err).Warn("Failed to close deadletter file")
+			}
+		}()
+	}
+
 	// Create the tag processor
-	handler = NewTagHandlerFromViper(s.Viper, handler, s.DefaultTags)
+	handler = NewTagHandlerFromViper(s.Viper, handler, defaultTags, tagPrecedence, deadletter)
+
+	// Create the name prefix handler, after the cloud handler and enrichers so it can use the tags they add
+	if s.NamePrefixTemplate != "" {
+		template, err := NewNamePrefixTemplate(s.NamePrefixTemplate)
+		if err != nil {
+			return err
+		}
+		handler = NewNamePrefixHandler(handler, template)
+	}
+
+	// Create the enricher handler
+	if len(s.Enrichers) > 0 {
+		handler = NewEnricherHandler(handler, s.Enrichers)
+	}
 
 	// Create the cloud handler
 	if s.CachedInstances != nil {
-		cloudHandler := NewCloudHandler(s.CachedInstances, handler)
+		cloudHandler := NewCloudHandler(s.CachedInstances, handler, tagPrecedence)
 		runnables = gostatsd.MaybeAppendRunnable(runnables, cloudHandler)
 		handler = cloudHandler
 	}
@@ -170,15 +390,69 @@ func (s *Server) RunWithCustomSocket(ctx context.Context, sf SocketFactory) erro
 	datagrams := make(chan []*Datagram)
 
 	// Create the Parser
-	parser := NewDatagramParser(datagrams, s.Namespace, s.IgnoreHost, s.EstimatedTags, handler, s.BadLineRateLimitPerSecond, s.LogRawMetric, logger)
+	sampleRates := NewSampleRateRulesFromViper(s.Viper)
+	transforms := NewValueTransformRulesFromViper(s.Viper)
+	sampleExpression, err := NewSampleExpressionFromViper(s.Viper, logger)
+	if err != nil {
+		return err
+	}
+	rateLimiter := NewSourceRateLimiter(s.SourceRateLimit, NewSourceRateOverridesFromViper(s.Viper))
+	parser := NewDatagramParser(datagrams, handler, ParserConfig{
+		Namespace:                 s.Namespace,
+		IgnoreHost:                s.IgnoreHost,
+		EstimatedTags:             s.EstimatedTags,
+		BadLineRateLimitPerSecond: s.BadLineRateLimitPerSecond,
+		LogRawMetric:              s.LogRawMetric,
+		SampleRates:               sampleRates,
+		NormalizeTags:             s.NormalizeTags,
+		Limits:                    s.MetricLimits,
+		RateLimiter:               rateLimiter,
+		AllowedTagKeys:            s.TagAllowlist,
+		UnknownType:               s.UnknownMetricType,
+		Deadletter:                deadletter,
+		Transforms:                transforms,
+		SampleExpression:          sampleExpression,
+	}, logger)
 	runnables = append(runnables, parser.RunMetricsContext)
 	for i := 0; i < s.MaxParsers; i++ {
 		runnables = append(runnables, parser.Run)
 	}
 
 	// Create the Receiver
-	receiver := NewDatagramReceiver(datagrams, sf, s.MaxReaders, s.ReceiveBatchSize)
-	runnables = gostatsd.MaybeAppendRunnable(runnables, receiver)
+	var stdinDone chan error
+	if readStdin {
+		// Read until EOF, then flush everything received and stop the server.
+		stdinDone = make(chan error, 1)
+		in := s.Stdin
+		if in == nil {
+			in = os.Stdin
+		}
+		receiver := NewStdinReceiver(in, parser, s.ReceiveBatchSize)
+		finalHandler := handler
+		runnables = append(runnables, func(ctx context.Context) {
+			err := receiver.Run(ctx)
+			if err == nil {
+				finalHandler.WaitForEvents()
+				flusher.FlushNow(ctx)
+			}
+			stdinDone <- err
+		})
+	} else {
+		var tee *DatagramTee
+		if s.TeeAddr != "" {
+			tee, err = NewDatagramTee(s.TeeAddr)
+			if err != nil {
+				return err
+			}
+			runnables = gostatsd.MaybeAppendRunnable(runnables, tee)
+		}
+		receiver := NewDatagramReceiver(datagrams, sf, s.MaxReaders, s.ReceiveBatchSize, tee)
+		runnables = gostatsd.MaybeAppendRunnable(runnables, receiver)
+	}
+
+	if s.TransportPool != nil {
+		runnables = append(runnables, transportMetrics(s.TransportPool))
+	}
 
 	// Create the Statser
 	hostname := s.Hostname
@@ -186,7 +460,17 @@ func (s *Server) RunWithCustomSocket(ctx context.Context, sf SocketFactory) erro
 	runnables = gostatsd.MaybeAppendRunnable(runnables, statser)
 
 	// Create any http servers
-	httpServers, err := web.NewHttpServersFromViper(s.Viper, logger, handler)
+	// Flushing can only be paused, metrics deleted, and the top metrics found, in standalone mode, as the forwarder
+	// does not aggregate.
+	var pauser web.FlushPauser
+	var deleter web.MetricDeleter
+	var topMetrics web.TopMetricsSource
+	if s.ServerMode == "standalone" {
+		pauser = flusher
+		deleter = flusher
+		topMetrics = flusher
+	}
+	httpServers, err := web.NewHttpServersFromViper(s.Viper, logger, handler, lastFlushSource, pauser, deleter, topMetrics)
 	if err != nil {
 		return err
 	}
@@ -207,8 +491,18 @@ func (s *Server) RunWithCustomSocket(ctx context.Context, sf SocketFactory) erro
 	sendStartEvent(runCtx, statser, hostname)
 
 	// Listen until done
-	<-ctx.Done()
-	return ctx.Err()
+	select {
+	case <-ctx.Done():
+		if s.FlushOnShutdownOnly {
+			// Flush everything aggregated before the pipeline is stopped, runCtx is still running.
+			logger.Info("Flushing before shutdown")
+			handler.WaitForEvents()
+			flusher.FlushNow(runCtx)
+		}
+		return ctx.Err()
+	case err := <-stdinDone:
+		return err
+	}
 }
 
 func (s *Server) createStatser(hostname gostatsd.Source, handler gostatsd.PipelineHandler, logger logrus.FieldLogger) stats.Statser {
@@ -230,6 +524,28 @@ func (s *Server) createStatser(hostname gostatsd.Source, handler gostatsd.Pipeli
 	}
 }
 
+// transportMetrics returns a Runnable which emits the connection stats of the clients in the TransportPool.
+func transportMetrics(pool *transport.TransportPool) gostatsd.Runnable {
+	return func(ctx context.Context) {
+		statser := stats.FromContext(ctx)
+		flushed, unregister := statser.RegisterFlush()
+		defer unregister()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-flushed:
+				for name, connStats := range pool.ConnStats() {
+					tags := gostatsd.Tags{"transport:" + name}
+					statser.Gauge("transport.connections_created", float64(connStats.Created), tags)
+					statser.Gauge("transport.connections_reused", float64(connStats.Reused), tags)
+				}
+			}
+		}
+	}
+}
+
 func sendStartEvent(ctx context.Context, statser stats.Statser, hostname gostatsd.Source) {
 	statser.Event(ctx, &gostatsd.Event{
 		Title:        "Gostatsd started",
@@ -254,23 +570,9 @@ func sendStopEvent(statser stats.Statser, hostname gostatsd.Source) {
 }
 
 type agrFactory struct {
-	percentThresholds     []float64
-	expiryIntervalCounter time.Duration
-	expiryIntervalGauge   time.Duration
-	expiryIntervalSet     time.Duration
-	expiryIntervalTimer   time.Duration
-	disabledSubtypes      gostatsd.TimerSubtypes
-	histogramLimit        uint32
+	config AggregatorConfig
 }
 
 func (af *agrFactory) Create() Aggregator {
-	return NewMetricAggregator(
-		af.percentThresholds,
-		af.expiryIntervalCounter,
-		af.expiryIntervalGauge,
-		af.expiryIntervalSet,
-		af.expiryIntervalTimer,
-		af.disabledSubtypes,
-		af.histogramLimit,
-	)
+	return NewMetricAggregator(af.config)
 }
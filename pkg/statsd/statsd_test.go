@@ -2,8 +2,12 @@ package statsd
 
 import (
 	"context"
+	"math"
 	"math/rand"
+	"net"
 	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -200,3 +204,140 @@ func (fp *fakeProvider) Instance(ctx context.Context, ips ...gostatsd.Source) (m
 	}
 	return instances, nil
 }
+
+func TestStatsdStdin(t *testing.T) {
+	t.Parallel()
+	backend := &countingBackend{}
+	s := Server{
+		Backends:            []gostatsd.Backend{backend},
+		FlushInterval:       time.Hour,
+		MaxParsers:          1,
+		MaxWorkers:          2,
+		MaxQueueSize:        gostatsd.DefaultMaxQueueSize,
+		ReceiveBatchSize:    2,
+		MaxConcurrentEvents: 2,
+		MetricsAddr:         StdinMetricsAddr,
+		ServerMode:          "standalone",
+		StatserType:         gostatsd.StatserNull,
+		Stdin:               strings.NewReader("a:1|c\nb:2|g\nc:3|ms\nd:4|s\n"),
+		Viper:               viper.New(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.RunWithCustomSocket(ctx, fakesocket.Factory)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, atomic.LoadUint64(&backend.metrics))
+}
+
+// lastMetricsBackend keeps the most recent metrics sent to it.
+type lastMetricsBackend struct {
+	countingBackend
+	lock sync.Mutex
+	mm   *gostatsd.MetricMap
+}
+
+func (lmb *lastMetricsBackend) SendMetricsAsync(ctx context.Context, m *gostatsd.MetricMap, callback gostatsd.SendCallback) {
+	lmb.lock.Lock()
+	lmb.mm = m
+	lmb.lock.Unlock()
+	callback(nil)
+}
+
+func TestStatsdAggregatorHostTag(t *testing.T) {
+	t.Parallel()
+	backend := &lastMetricsBackend{}
+	s := Server{
+		Backends:            []gostatsd.Backend{backend},
+		DefaultTags:         gostatsd.Tags{"env:test"},
+		AggregatorHostTag:   true,
+		Hostname:            "agg1",
+		FlushInterval:       time.Hour,
+		MaxParsers:          1,
+		MaxWorkers:          1,
+		MaxQueueSize:        gostatsd.DefaultMaxQueueSize,
+		ReceiveBatchSize:    2,
+		MaxConcurrentEvents: 2,
+		MetricsAddr:         StdinMetricsAddr,
+		ServerMode:          "standalone",
+		StatserType:         gostatsd.StatserNull,
+		Stdin:               strings.NewReader("a:1|c|#x:y\n"),
+		Viper:               viper.New(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, s.RunWithCustomSocket(ctx, fakesocket.Factory))
+	backend.lock.Lock()
+	defer backend.lock.Unlock()
+	require.NotNil(t, backend.mm)
+	require.Len(t, backend.mm.Counters, 1)
+	backend.mm.Counters.Each(func(name, tagsKey string, c gostatsd.Counter) {
+		require.ElementsMatch(t, gostatsd.Tags{"x:y", "env:test", "aggregator_host:agg1"}, c.Tags)
+	})
+	require.Equal(t, gostatsd.Tags{"env:test"}, s.DefaultTags) // Not modified
+}
+
+func TestStatsdFlushOnShutdownOnly(t *testing.T) {
+	t.Parallel()
+	backend := &countingBackend{}
+	s := Server{
+		Backends:            []gostatsd.Backend{backend},
+		FlushInterval:       10 * time.Millisecond,
+		FlushOnShutdownOnly: true,
+		MaxReaders:          1,
+		MaxParsers:          1,
+		MaxWorkers:          1,
+		MaxQueueSize:        gostatsd.DefaultMaxQueueSize,
+		ReceiveBatchSize:    2,
+		MaxConcurrentEvents: 2,
+		ServerMode:          "standalone",
+		StatserType:         gostatsd.StatserNull,
+		Viper:               viper.New(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	sf := func() (net.PacketConn, error) {
+		return fakesocket.NewFakePacketConn(), nil
+	}
+	require.Equal(t, context.DeadlineExceeded, s.RunWithCustomSocket(ctx, sf))
+
+	// The fake socket only sends a single counter, so it is sent once by the flush during shutdown, rather than by
+	// every periodic flush.
+	require.EqualValues(t, 1, atomic.LoadUint64(&backend.metrics))
+}
+
+func TestStatsdFlushOnShutdownOnlyForwarder(t *testing.T) {
+	t.Parallel()
+	s := Server{
+		FlushOnShutdownOnly: true,
+		ServerMode:          "forwarder",
+		Viper:               viper.New(),
+	}
+	require.Error(t, s.RunWithCustomSocket(context.Background(), fakesocket.Factory))
+}
+
+func TestStatsdInvalidPercentThreshold(t *testing.T) {
+	t.Parallel()
+	for _, pct := range []float64{100, -100, 150, -200, math.NaN()} {
+		s := Server{
+			PercentThreshold: []float64{90, pct},
+			ServerMode:       "standalone",
+			Viper:            viper.New(),
+		}
+		err := s.RunWithCustomSocket(context.Background(), fakesocket.Factory)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "must be between -100 and 100", pct)
+	}
+}
+
+func TestStatsdStdinForwarder(t *testing.T) {
+	t.Parallel()
+	s := Server{
+		MetricsAddr: StdinMetricsAddr,
+		ServerMode:  "forwarder",
+		Viper:       viper.New(),
+	}
+	require.Error(t, s.RunWithCustomSocket(context.Background(), fakesocket.Factory))
+}
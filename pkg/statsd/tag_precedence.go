@@ -0,0 +1,126 @@
+package statsd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// Sources of tags which may be given a precedence with TagPrecedence.
+const (
+	TagSourceWire    = "wire"    // Tags received with the metric
+	TagSourceCloud   = "cloud"   // Tags from the cloud provider
+	TagSourceDefault = "default" // Tags from the default-tags option
+)
+
+// TagPrecedence resolves tags with the same key from different sources, so that only the tag from the source with
+// the highest precedence survives.  A tag without a value is its own key.
+//
+// Wire and cloud tags are resolved by the CloudHandler, which also drops any tags a default tag takes precedence
+// over.  The TagHandler then only adds the default tags which have no remaining tag with the same key.  If there is
+// no CloudHandler, the TagHandler resolves the wire and default tags itself.
+type TagPrecedence struct {
+	wire, cloud, def int // Position of each source, lower takes precedence
+	defaultKeys      map[string]struct{}
+	cloudResolves    bool // A CloudHandler will resolve tags before the TagHandler
+}
+
+// NewTagPrecedence creates a TagPrecedence from order, which must contain each of wire, cloud, and default exactly
+// once, highest precedence first.  It returns nil if order is empty, indicating duplicate keys are allowed.
+// cloudResolves indicates if a CloudHandler will resolve tags before the TagHandler.
+func NewTagPrecedence(order []string, defaultTags gostatsd.Tags, cloudResolves bool) (*TagPrecedence, error) {
+	if len(order) == 0 {
+		return nil, nil
+	}
+	positions := map[string]int{}
+	for idx, source := range order {
+		switch source {
+		case TagSourceWire, TagSourceCloud, TagSourceDefault:
+			positions[source] = idx
+		}
+	}
+	if len(order) != 3 || len(positions) != 3 {
+		return nil, fmt.Errorf("tag precedence %q must contain each of %s, %s, and %s exactly once", strings.Join(order, " "), TagSourceWire, TagSourceCloud, TagSourceDefault)
+	}
+	return &TagPrecedence{
+		wire:          positions[TagSourceWire],
+		cloud:         positions[TagSourceCloud],
+		def:           positions[TagSourceDefault],
+		defaultKeys:   tagKeys(defaultTags),
+		cloudResolves: cloudResolves,
+	}, nil
+}
+
+// resolveCloud merges the wire and cloud tags of a metric or event.  It returns a new Tags.
+func (tp *TagPrecedence) resolveCloud(wire, cloud gostatsd.Tags) gostatsd.Tags {
+	wireKeys := tagKeys(wire)
+	cloudKeys := tagKeys(cloud)
+
+	var wireStronger, cloudStronger []map[string]struct{}
+	if tp.cloud < tp.wire {
+		wireStronger = append(wireStronger, cloudKeys)
+	} else {
+		cloudStronger = append(cloudStronger, wireKeys)
+	}
+	if tp.def < tp.wire {
+		wireStronger = append(wireStronger, tp.defaultKeys)
+	}
+	if tp.def < tp.cloud {
+		cloudStronger = append(cloudStronger, tp.defaultKeys)
+	}
+
+	tags := make(gostatsd.Tags, 0, len(wire)+len(cloud))
+	tags = appendWeaker(tags, wire, wireStronger...)
+	return appendWeaker(tags, cloud, cloudStronger...)
+}
+
+// resolveDefaults returns the tags of a metric or event with conflicting tags removed, and the default tags which
+// should be added to it.  tags may be modified.
+func (tp *TagPrecedence) resolveDefaults(tags, defaultTags gostatsd.Tags) (gostatsd.Tags, gostatsd.Tags) {
+	var stronger []map[string]struct{}
+	if !tp.cloudResolves && tp.def < tp.wire {
+		stronger = append(stronger, tp.defaultKeys)
+	}
+	tags = appendWeaker(tags[:0], tags, stronger...)
+	// Any remaining tag with the same key as a default tag takes precedence over it.
+	return tags, appendWeaker(nil, defaultTags, tagKeys(tags))
+}
+
+// appendWeaker appends the tags in candidates whose keys are not in any of stronger to dst.  If candidates has
+// multiple tags with the same key, only the first is appended.  dst may share its backing array with candidates,
+// provided it does not start after it.
+func appendWeaker(dst, candidates gostatsd.Tags, stronger ...map[string]struct{}) gostatsd.Tags {
+	seen := make(map[string]struct{}, len(candidates))
+next:
+	for _, tag := range candidates {
+		key := tagKey(tag)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		for _, keys := range stronger {
+			if _, ok := keys[key]; ok {
+				continue next
+			}
+		}
+		seen[key] = present
+		dst = append(dst, tag)
+	}
+	return dst
+}
+
+func tagKeys(tags gostatsd.Tags) map[string]struct{} {
+	keys := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		keys[tagKey(tag)] = present
+	}
+	return keys
+}
+
+// tagKey returns the key of a tag, or the whole tag if it has no value.
+func tagKey(tag string) string {
+	if idx := strings.IndexByte(tag, ':'); idx >= 0 {
+		return tag[:idx]
+	}
+	return tag
+}
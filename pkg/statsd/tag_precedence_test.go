@@ -0,0 +1,86 @@
+package statsd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atlassian/gostatsd"
+)
+
+func TestNewTagPrecedence(t *testing.T) {
+	t.Parallel()
+	tp, err := NewTagPrecedence(nil, nil, false)
+	require.NoError(t, err)
+	assert.Nil(t, tp)
+
+	for _, order := range []string{"wire cloud", "wire cloud cloud", "wire cloud default host", "wire cloud host"} {
+		_, err := NewTagPrecedence(strings.Fields(order), nil, false)
+		assert.Error(t, err, order)
+	}
+}
+
+// TestTagPrecedenceThreeWay resolves the same key from all three sources, for every order, both with and without
+// a CloudHandler in front of the TagHandler.
+func TestTagPrecedenceThreeWay(t *testing.T) {
+	t.Parallel()
+	wire := gostatsd.Tags{"env:wire", "wire", "a:wire"}
+	cloud := gostatsd.Tags{"env:cloud", "b:cloud", "a:cloud"}
+	defaults := gostatsd.Tags{"env:default", "b:default", "c:default"}
+
+	tests := []struct {
+		order    string
+		expected gostatsd.Tags
+	}{
+		{"wire cloud default", gostatsd.Tags{"env:wire", "wire", "a:wire", "b:cloud", "c:default"}},
+		{"wire default cloud", gostatsd.Tags{"env:wire", "wire", "a:wire", "b:default", "c:default"}},
+		{"cloud wire default", gostatsd.Tags{"wire", "env:cloud", "b:cloud", "a:cloud", "c:default"}},
+		{"cloud default wire", gostatsd.Tags{"wire", "env:cloud", "b:cloud", "a:cloud", "c:default"}},
+		{"default wire cloud", gostatsd.Tags{"wire", "a:wire", "env:default", "b:default", "c:default"}},
+		{"default cloud wire", gostatsd.Tags{"wire", "a:cloud", "env:default", "b:default", "c:default"}},
+	}
+	for _, test := range tests {
+		tp, err := NewTagPrecedence(strings.Fields(test.order), defaults, true)
+		require.NoError(t, err)
+		tags := tp.resolveCloud(wire.Copy(), cloud)
+		tags, toAdd := tp.resolveDefaults(tags, defaults)
+		assert.ElementsMatch(t, test.expected, uniqueTags(tags, toAdd), test.order)
+	}
+}
+
+func TestTagPrecedenceWithoutCloud(t *testing.T) {
+	t.Parallel()
+	wire := gostatsd.Tags{"env:wire", "env:other", "a:wire"}
+	defaults := gostatsd.Tags{"env:default", "c:default"}
+
+	tp, err := NewTagPrecedence([]string{"wire", "cloud", "default"}, defaults, false)
+	require.NoError(t, err)
+	tags, toAdd := tp.resolveDefaults(wire.Copy(), defaults)
+	assert.ElementsMatch(t, gostatsd.Tags{"env:wire", "a:wire", "c:default"}, uniqueTags(tags, toAdd))
+
+	tp, err = NewTagPrecedence([]string{"default", "wire", "cloud"}, defaults, false)
+	require.NoError(t, err)
+	tags, toAdd = tp.resolveDefaults(wire.Copy(), defaults)
+	assert.ElementsMatch(t, gostatsd.Tags{"a:wire", "env:default", "c:default"}, uniqueTags(tags, toAdd))
+}
+
+func TestTagHandlerPrecedence(t *testing.T) {
+	t.Parallel()
+	defaults := gostatsd.Tags{"env:default"}
+	tp, err := NewTagPrecedence([]string{"wire", "cloud", "default"}, defaults, false)
+	require.NoError(t, err)
+	tch := &capturingHandler{}
+	th := NewTagHandler(tch, defaults, nil, tp, nil)
+
+	mm := gostatsd.NewMetricMap()
+	mm.Receive(&gostatsd.Metric{Name: "a", Value: 1, Rate: 1, Type: gostatsd.COUNTER, Tags: gostatsd.Tags{"env:wire"}})
+	mm.Receive(&gostatsd.Metric{Name: "b", Value: 1, Rate: 1, Type: gostatsd.COUNTER})
+	th.DispatchMetricMap(context.Background(), mm)
+
+	require.Len(t, tch.mm, 1)
+	assert.Equal(t, gostatsd.Tags{"env:wire"}, tch.mm[0].Counters["a"]["env:wire"].Tags)
+	assert.Equal(t, gostatsd.Tags{"env:default"}, tch.mm[0].Counters["b"]["env:default"].Tags)
+}
@@ -0,0 +1,80 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/atlassian/gostatsd/pkg/stats"
+)
+
+// teeQueueSize is the number of datagrams which can be waiting to be sent by the DatagramTee before they are dropped.
+const teeQueueSize = 10000
+
+// DatagramTee sends a copy of every datagram received to another address, verbatim.  It is best effort, if the
+// datagrams can't be sent as fast as they are received they are dropped rather than slowing down the receiver.
+type DatagramTee struct {
+	datagramsSent uint64 // atomic
+
+	dropped    stats.ChangeGauge
+	sendErrors stats.ChangeGauge
+
+	conn  net.Conn
+	queue chan []byte
+}
+
+// NewDatagramTee creates a DatagramTee which sends datagrams to the UDP address addr.
+func NewDatagramTee(addr string) (*DatagramTee, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &DatagramTee{
+		conn:  conn,
+		queue: make(chan []byte, teeQueueSize),
+	}, nil
+}
+
+// Send queues a copy of msg to be sent, or drops it if the queue is full.  msg may be reused after Send returns.
+func (t *DatagramTee) Send(msg []byte) {
+	select {
+	case t.queue <- append([]byte(nil), msg...):
+	default:
+		atomic.AddUint64(&t.dropped.Cur, 1)
+	}
+}
+
+// Run sends the queued datagrams until the context is cancelled.
+func (t *DatagramTee) Run(ctx context.Context) {
+	defer t.conn.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-t.queue:
+			if _, err := t.conn.Write(msg); err != nil {
+				// Usually the address isn't listening, which shouldn't be logged for every datagram
+				atomic.AddUint64(&t.sendErrors.Cur, 1)
+				continue
+			}
+			atomic.AddUint64(&t.datagramsSent, 1)
+		}
+	}
+}
+
+func (t *DatagramTee) RunMetricsContext(ctx context.Context) {
+	statser := stats.FromContext(ctx)
+	flushed, unregister := statser.RegisterFlush()
+	defer unregister()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushed:
+			statser.Gauge("tee.datagrams_sent", float64(atomic.LoadUint64(&t.datagramsSent)), nil)
+			t.dropped.SendIfChanged(statser, "tee.datagrams_dropped", nil)
+			t.sendErrors.SendIfChanged(statser, "tee.send_errors", nil)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package statsd
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatagramTeeDropsWhenFull(t *testing.T) {
+	t.Parallel()
+	tee, err := NewDatagramTee("127.0.0.1:1")
+	require.NoError(t, err)
+	defer tee.conn.Close()
+
+	msg := []byte("foo:1|c")
+	for i := 0; i < teeQueueSize+5; i++ {
+		tee.Send(msg)
+	}
+	assert.Len(t, tee.queue, teeQueueSize)
+	assert.EqualValues(t, 5, atomic.LoadUint64(&tee.dropped.Cur))
+
+	// The queued datagram is a copy, so the buffer can be reused by the receiver
+	msg[0] = 'b'
+	assert.Equal(t, []byte("foo:1|c"), <-tee.queue)
+}
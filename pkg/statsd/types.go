@@ -6,6 +6,7 @@ import (
 
 	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/pkg/stats"
+	"github.com/atlassian/gostatsd/pkg/web"
 )
 
 // DispatcherProcessFunc is a function that gets executed by Dispatcher for each Aggregator, passing it into the function.
@@ -17,6 +18,30 @@ type AggregateProcesser interface {
 	Process(ctx context.Context, fn DispatcherProcessFunc) gostatsd.Wait
 }
 
+// FlushTrigger is an interface which an AggregateProcesser can implement to request a flush before the
+// next flush interval.
+type FlushTrigger interface {
+	// FlushRequired returns a channel which receives a value when an early flush is required.
+	FlushRequired() <-chan struct{}
+	// FlushStarted is called by the flusher when a flush starts.
+	FlushStarted()
+}
+
+// FlushHandler is an interface to observe the metrics in each flush, without implementing a full Backend.
+type FlushHandler interface {
+	// HandleFlush is called synchronously with the metrics from each Aggregator on every flush, and may be called
+	// concurrently.  The MetricMap must not be modified, or retained after HandleFlush returns.
+	HandleFlush(ctx context.Context, mm *gostatsd.MetricMap)
+}
+
+// FlushHandlerFunc type is an adapter to allow the use of ordinary functions as FlushHandler.
+type FlushHandlerFunc func(ctx context.Context, mm *gostatsd.MetricMap)
+
+// HandleFlush calls f(ctx, mm).
+func (f FlushHandlerFunc) HandleFlush(ctx context.Context, mm *gostatsd.MetricMap) {
+	f(ctx, mm)
+}
+
 // ProcessFunc is a function that gets executed by Aggregator with its state passed into the function.
 type ProcessFunc func(*gostatsd.MetricMap)
 
@@ -39,15 +64,29 @@ type Datagram struct {
 	DoneFunc  func() // to be called once the datagram has been parsed and msg can be freed
 }
 
+// metricDeleter is implemented by an Aggregator which can delete the series of a single metric.
+type metricDeleter interface {
+	DeleteMetric(name string, tags gostatsd.Tags) int
+}
+
+// metricVolumer is implemented by an Aggregator which can report the volume of each metric name it has aggregated
+// so far in the flush interval.
+type metricVolumer interface {
+	MetricVolumes() map[seriesName]web.MetricVolume
+}
+
+// gaugeSource is implemented by an Aggregator which can provide the gauges it is holding, so they can be persisted.
+type gaugeSource interface {
+	Gauges() gostatsd.Gauges
+}
+
+// expiryPauser is implemented by an Aggregator which can stop expiring metrics when it is Reset.
+type expiryPauser interface {
+	PauseExpiry(paused bool)
+}
+
 // MetricEmitter is an object that emits metrics.  Used to pass a Statser to the object
 // after initialization, as Statsers may be created after MetricEmitters
 type MetricEmitter interface {
 	RunMetrics(ctx context.Context, statser stats.Statser)
 }
-
-// TagChanger is an interface that Metric/Event can implement to update their tags
-// and source.  It is so the CloudHandler can change the tags without worrying about
-// the TagsKey cache.
-type TagChanger interface {
-	AddTagsSetSource(additionalTags gostatsd.Tags, newSource gostatsd.Source)
-}
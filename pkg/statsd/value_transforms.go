@@ -0,0 +1,71 @@
+package statsd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// ValueTransformRule scales the value of metrics which are received in one unit, so they are aggregated in another.
+type ValueTransformRule struct {
+	MatchMetrics gostatsd.StringMatchList // Name must match
+	Multiplier   float64                  // Each value is multiplied by this
+	Offset       float64                  // Then this is added, except to counters
+}
+
+// ValueTransformRules is a list of ValueTransformRule, the first rule matching a metric wins.
+type ValueTransformRules []ValueTransformRule
+
+// Transform applies the first rule matching the name of the metric to its value, and returns true if a rule matched.
+// Sets have no numeric value and are never transformed.  The offset is not added to counters, as a counter is the
+// sum of every value received, so it would be added once per value, and then scaled by the sample rate.  The
+// multiplier is applied to the value before the sample rate scales it, which gives the same result either way.
+func (vtr ValueTransformRules) Transform(m *gostatsd.Metric) bool {
+	if m.Type == gostatsd.SET {
+		return false
+	}
+	for _, rule := range vtr {
+		if rule.MatchMetrics.MatchAny(m.Name) {
+			m.Value *= rule.Multiplier
+			if m.Type != gostatsd.COUNTER {
+				m.Value += rule.Offset
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// NewValueTransformRuleFromViper creates a new ValueTransformRule given a *viper.Viper
+func NewValueTransformRuleFromViper(v *viper.Viper) ValueTransformRule {
+	v.SetDefault("match-metrics", []string{})
+	v.SetDefault("multiplier", 1.0)
+	v.SetDefault("offset", 0.0)
+	return ValueTransformRule{
+		MatchMetrics: toStringMatch(v.GetStringSlice("match-metrics")),
+		Multiplier:   v.GetFloat64("multiplier"),
+		Offset:       v.GetFloat64("offset"),
+	}
+}
+
+// NewValueTransformRulesFromViper creates the ValueTransformRules named by the value-transforms key.
+func NewValueTransformRulesFromViper(v *viper.Viper) ValueTransformRules {
+	ruleNameList := v.GetStringSlice("value-transforms")
+	var rules ValueTransformRules
+	for _, ruleName := range ruleNameList {
+		vRule := v.Sub("value-transform." + ruleName)
+		if vRule == nil {
+			logrus.Warnf("Value transform doesn't exist: %v", ruleName)
+			continue
+		}
+		rule := NewValueTransformRuleFromViper(vRule)
+		if len(rule.MatchMetrics) == 0 {
+			logrus.Warnf("Value transform %v has no match-metrics", ruleName)
+			continue
+		}
+		rules = append(rules, rule)
+		logrus.Infof("Loaded value transform %v", ruleName)
+	}
+	return rules
+}
@@ -32,25 +32,57 @@ func (w *worker) work() {
 			}
 			w.aggr.ReceiveMap(mm)
 		case cmd := <-w.processChan:
+			w.drainQueue()
 			w.executeProcess(cmd)
 		}
 	}
 }
 
+// drainQueue receives any metric maps which were queued before a process command, so they are included in it.
+func (w *worker) drainQueue() {
+	for n := len(w.metricMapQueue); n > 0; n-- {
+		mm, ok := <-w.metricMapQueue
+		if !ok {
+			return
+		}
+		w.aggr.ReceiveMap(mm)
+	}
+}
+
 func (w *worker) executeProcess(cmd *processCommand) {
 	defer cmd.done() // Done with the process command
 	cmd.f(w.id, w.aggr)
 }
 
 func (w *worker) RunMetrics(ctx context.Context, statser stats.Statser) {
+	tags := gostatsd.Tags{fmt.Sprintf("aggregator_id:%d", w.id)}
 	wg := &wait.Group{}
 	wg.StartWithContext(ctx, stats.NewChannelStatsWatcher(
 		statser,
 		"dispatch_aggregator_map",
-		gostatsd.Tags{fmt.Sprintf("aggregator_id:%d", w.id)},
+		tags,
 		cap(w.metricMapQueue),
 		func() int { return len(w.metricMapQueue) },
 		1000*time.Millisecond,
 	).Run)
+	wg.StartWithContext(ctx, func(ctx context.Context) {
+		w.runQueueMetrics(ctx, statser, tags)
+	})
 	wg.Wait()
 }
+
+// runQueueMetrics emits the length and capacity of the queue of metric maps waiting for the aggregator at each
+// flush, so a queue which is consistently near full can be alerted on.
+func (w *worker) runQueueMetrics(ctx context.Context, statser stats.Statser, tags gostatsd.Tags) {
+	flushed, unregister := statser.RegisterFlush()
+	defer unregister()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushed:
+			statser.Gauge("aggregator.queue_length", float64(len(w.metricMapQueue)), tags)
+			statser.Gauge("aggregator.queue_capacity", float64(cap(w.metricMapQueue)), tags)
+		}
+	}
+}
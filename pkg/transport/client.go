@@ -8,6 +8,12 @@ import (
 // attached to it (PostProtobuf, PostJson, retries, metrics, etc).  The underlying Client
 // is exposed so that things that require a real http.Client (such as Cloudwatch) can
 // still utilize the TransportPool.
+//
+// The Transport of Client counts the connections created and reused by its requests.  The
+// underlying Transport is also exposed, for things which require a real http.Transport.
 type Client struct {
-	Client *http.Client
+	Client    *http.Client
+	Transport *http.Transport
+
+	stats *connStats
 }
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// ConnStats is the number of requests made by a client which created a new connection, and which reused an idle
+// connection from the pool.
+type ConnStats struct {
+	Created uint64
+	Reused  uint64
+}
+
+// connStats counts the connections used by the requests made with a Client.
+type connStats struct {
+	// Counter fields below must be read/written only using atomic instructions.
+	created uint64 // Requests which used a new connection
+	reused  uint64 // Requests which used an idle connection from the pool
+}
+
+// countingRoundTripper is an http.RoundTripper which records whether each request reused a pooled connection.
+type countingRoundTripper struct {
+	stats *connStats
+	next  http.RoundTripper
+}
+
+func (crt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&crt.stats.reused, 1)
+			} else {
+				atomic.AddUint64(&crt.stats.created, 1)
+			}
+		},
+	}
+	return crt.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped http.RoundTripper, if it supports it.
+func (crt *countingRoundTripper) CloseIdleConnections() {
+	if ci, ok := crt.next.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -86,10 +87,27 @@ func (tp *TransportPool) newClient(name string) (*Client, error) {
 		paramTransportClientTimeout: clientTimeout,
 	}).Info("created client")
 
+	stats := &connStats{}
 	return &Client{
 		Client: &http.Client{
-			Transport: transport,
+			Transport: &countingRoundTripper{stats: stats, next: transport},
 			Timeout:   clientTimeout,
 		},
+		Transport: transport,
+		stats:     stats,
 	}, nil
 }
+
+// ConnStats returns the number of connections created and reused by the requests of each client, by name.
+func (tp *TransportPool) ConnStats() map[string]ConnStats {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	result := make(map[string]ConnStats, len(tp.clients))
+	for name, client := range tp.clients {
+		result[name] = ConnStats{
+			Created: atomic.LoadUint64(&client.stats.created),
+			Reused:  atomic.LoadUint64(&client.stats.reused),
+		}
+	}
+	return result
+}
@@ -1,6 +1,10 @@
 package transport
 
 import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -104,3 +108,24 @@ func TestGetUnknownType(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, c)
 }
+
+func TestConnStats(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	p := NewTransportPool(logrus.New(), viper.New())
+	c, err := p.Get("default")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Client.Get(server.URL)
+		require.NoError(t, err)
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	require.Equal(t, map[string]ConnStats{"default": {Created: 1, Reused: 1}}, p.ConnStats())
+}
@@ -3,7 +3,10 @@ package transport
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"time"
@@ -20,18 +23,26 @@ const paramHttpDialerTimeout = "dialer-timeout"
 const paramHttpEnableHttp2 = "enable-http2"
 const paramHttpIdleConnectionTimeout = "idle-connection-timeout"
 const paramHttpMaxIdleConnections = "max-idle-connections"
+const paramHttpMaxIdleConnectionsPerHost = "max-idle-connections-per-host"
 const paramHttpNetwork = "network"
 const paramHttpTLSHandshakeTimeout = "tls-handshake-timeout"
 const paramHttpResponseHeaderTimeout = "response-header-timeout"
+const paramHttpTLSCertFile = "tls-cert-file"
+const paramHttpTLSKeyFile = "tls-key-file"
+const paramHttpTLSCAFile = "tls-ca-file"
 
 const defaultHttpDialerKeepAlive = 30 * time.Second
 const defaultHttpDialerTimeout = 5 * time.Second
 const defaultHttpEnableHttp2 = false
 const defaultHttpIdleConnectionTimeout = 1 * time.Minute
 const defaultHttpMaxIdleConnections = 50
+const defaultHttpMaxIdleConnectionsPerHost = 0
 const defaultHttpNetwork = "tcp"
 const defaultHttpTLSHandshakeTimeout = 3 * time.Second
 const defaultHttpResponseHeaderTimeout = time.Duration(0)
+const defaultHttpTLSCertFile = ""
+const defaultHttpTLSKeyFile = ""
+const defaultHttpTLSCAFile = ""
 
 func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Transport, error) {
 	v.SetDefault(paramHttpDialerKeepAlive, defaultHttpDialerKeepAlive)
@@ -39,18 +50,26 @@ func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Tr
 	v.SetDefault(paramHttpEnableHttp2, defaultHttpEnableHttp2)
 	v.SetDefault(paramHttpIdleConnectionTimeout, defaultHttpIdleConnectionTimeout)
 	v.SetDefault(paramHttpMaxIdleConnections, defaultHttpMaxIdleConnections)
+	v.SetDefault(paramHttpMaxIdleConnectionsPerHost, defaultHttpMaxIdleConnectionsPerHost)
 	v.SetDefault(paramHttpNetwork, defaultHttpNetwork)
 	v.SetDefault(paramHttpTLSHandshakeTimeout, defaultHttpTLSHandshakeTimeout)
 	v.SetDefault(paramHttpResponseHeaderTimeout, defaultHttpResponseHeaderTimeout)
+	v.SetDefault(paramHttpTLSCertFile, defaultHttpTLSCertFile)
+	v.SetDefault(paramHttpTLSKeyFile, defaultHttpTLSKeyFile)
+	v.SetDefault(paramHttpTLSCAFile, defaultHttpTLSCAFile)
 
 	dialerKeepAlive := v.GetDuration(paramHttpDialerKeepAlive)
 	dialerTimeout := v.GetDuration(paramHttpDialerTimeout)
 	enableHttp2 := v.GetBool(paramHttpEnableHttp2)
 	idleConnectionTimeout := v.GetDuration(paramHttpIdleConnectionTimeout)
 	maxIdleConnections := v.GetInt(paramHttpMaxIdleConnections)
+	maxIdleConnectionsPerHost := v.GetInt(paramHttpMaxIdleConnectionsPerHost)
 	network := v.GetString(paramHttpNetwork)
 	tlsHandshakeTimeout := v.GetDuration(paramHttpTLSHandshakeTimeout)
 	responseHeaderTimeout := v.GetDuration(paramHttpResponseHeaderTimeout)
+	tlsCertFile := v.GetString(paramHttpTLSCertFile)
+	tlsKeyFile := v.GetString(paramHttpTLSKeyFile)
+	tlsCAFile := v.GetString(paramHttpTLSCAFile)
 
 	if dialerKeepAlive < -1 {
 		return nil, errors.New(paramHttpDialerKeepAlive + " must be -1, 0, or positive") // -1 = disabled, 0 = keepalives enabled, not configured, >0 = keepalive interval
@@ -64,6 +83,9 @@ func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Tr
 	if maxIdleConnections < 0 {
 		return nil, errors.New(paramHttpMaxIdleConnections + " must not be negative") // 0 = no limit
 	}
+	if maxIdleConnectionsPerHost < 0 {
+		return nil, errors.New(paramHttpMaxIdleConnectionsPerHost + " must not be negative") // 0 = http.DefaultMaxIdleConnsPerHost
+	}
 	if tlsHandshakeTimeout < 0 {
 		return nil, errors.New(paramHttpTLSHandshakeTimeout + " must not be negative") // 0 = no timeout
 	}
@@ -71,6 +93,31 @@ func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Tr
 		return nil, errors.New(paramHttpResponseHeaderTimeout + " must not be negative") // 0 = no timeout
 	}
 
+	tlsConfig := &tls.Config{
+		// Can't use SSLv3 because of POODLE and BEAST
+		// Can't use TLSv1.0 because of POODLE and BEAST using CBC cipher
+		// Can't use TLSv1.1 because of RC4 cipher usage
+		MinVersion: tls.VersionTLS12,
+	}
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		// Client certificate for servers requiring mutual TLS
+		cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s and %s: %v", paramHttpTLSCertFile, paramHttpTLSKeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if tlsCAFile != "" {
+		pem, err := ioutil.ReadFile(tlsCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", paramHttpTLSCAFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + paramHttpTLSCAFile)
+		}
+	}
+
 	dialer := &net.Dialer{
 		Timeout:   dialerTimeout,
 		KeepAlive: dialerKeepAlive,
@@ -79,17 +126,13 @@ func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Tr
 	transport := &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
 		TLSHandshakeTimeout: tlsHandshakeTimeout,
-		TLSClientConfig: &tls.Config{
-			// Can't use SSLv3 because of POODLE and BEAST
-			// Can't use TLSv1.0 because of POODLE and BEAST using CBC cipher
-			// Can't use TLSv1.1 because of RC4 cipher usage
-			MinVersion: tls.VersionTLS12,
-		},
+		TLSClientConfig:     tlsConfig,
 		DialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
 			// replace the network with our own
 			return dialer.DialContext(ctx, network, address)
 		},
 		MaxIdleConns:          maxIdleConnections,
+		MaxIdleConnsPerHost:   maxIdleConnectionsPerHost,
 		IdleConnTimeout:       idleConnectionTimeout,
 		ResponseHeaderTimeout: responseHeaderTimeout,
 	}
@@ -101,14 +144,17 @@ func (tp *TransportPool) newHttpTransport(name string, v *viper.Viper) (*http.Tr
 	}
 
 	tp.logger.WithFields(logrus.Fields{
-		"name":                         name,
-		paramHttpDialerKeepAlive:       dialerKeepAlive,
-		paramHttpDialerTimeout:         dialerTimeout,
-		paramHttpEnableHttp2:           enableHttp2,
-		paramHttpIdleConnectionTimeout: idleConnectionTimeout,
-		paramHttpMaxIdleConnections:    maxIdleConnections,
-		paramHttpNetwork:               network,
-		paramHttpTLSHandshakeTimeout:   tlsHandshakeTimeout,
+		"name":                             name,
+		paramHttpDialerKeepAlive:           dialerKeepAlive,
+		paramHttpDialerTimeout:             dialerTimeout,
+		paramHttpEnableHttp2:               enableHttp2,
+		paramHttpIdleConnectionTimeout:     idleConnectionTimeout,
+		paramHttpMaxIdleConnections:        maxIdleConnections,
+		paramHttpMaxIdleConnectionsPerHost: maxIdleConnectionsPerHost,
+		paramHttpNetwork:                   network,
+		paramHttpTLSHandshakeTimeout:       tlsHandshakeTimeout,
+		paramHttpTLSCertFile:               tlsCertFile,
+		paramHttpTLSCAFile:                 tlsCAFile,
 	}).Info("created transport")
 
 	return transport, nil
@@ -33,6 +33,9 @@ func TestNewHttpTransportEnforceRanges(t *testing.T) {
 		{paramHttpTLSHandshakeTimeout, -1, false},
 		{paramHttpTLSHandshakeTimeout, 0, true},
 		{paramHttpTLSHandshakeTimeout, 1, true},
+		{paramHttpTLSCertFile, "missing.pem", false},
+		{paramHttpTLSKeyFile, "missing.pem", false},
+		{paramHttpTLSCAFile, "missing.pem", false},
 	} {
 		v := viper.New()
 		v.Set("transport.test."+config.param, config.value)
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// MetricDeleter deletes the aggregated series of a metric.
+type MetricDeleter interface {
+	DeleteMetric(ctx context.Context, name string, tags gostatsd.Tags) int
+}
+
+type deleteHandler struct {
+	logger  logrus.FieldLogger
+	deleter MetricDeleter
+}
+
+type deleteResponse struct {
+	Deleted int
+}
+
+// deleteMetric deletes the series of the metric in the name query parameter.  If the tags query parameter is
+// present, only the series with exactly those comma separated tags are deleted, otherwise every series is deleted.
+func (dh *deleteHandler) deleteMetric(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	var tags gostatsd.Tags
+	if values, ok := query["tags"]; ok {
+		tags = gostatsd.Tags{}
+		for _, value := range values {
+			for _, tag := range strings.Split(value, ",") {
+				if tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+
+	deleted := dh.deleter.DeleteMetric(req.Context(), name, tags)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deleteResponse{Deleted: deleted}); err != nil {
+		dh.logger.WithError(err).Info("failed to write delete result")
+	}
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/atlassian/gostatsd"
+)
+
+// LastFlushSource provides the metrics from the most recent flush.  The returned MetricMap must not be modified.
+type LastFlushSource interface {
+	LastFlush() (*gostatsd.MetricMap, time.Time)
+}
+
+type lastFlushHandler struct {
+	logger logrus.FieldLogger
+	source LastFlushSource
+}
+
+type lastFlushResponse struct {
+	Flushed  time.Time
+	Counters gostatsd.Counters
+	Timers   gostatsd.Timers
+	Gauges   gostatsd.Gauges
+	Sets     gostatsd.Sets
+}
+
+// lastFlush writes the metrics from the most recent flush as JSON.
+func (lfh *lastFlushHandler) lastFlush(w http.ResponseWriter, req *http.Request) {
+	mm, flushed := lfh.source.LastFlush()
+	if mm == nil {
+		http.Error(w, "no flush has completed", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(lastFlushResponse{
+		Flushed:  flushed,
+		Counters: mm.Counters,
+		Timers:   mm.Timers,
+		Gauges:   mm.Gauges,
+		Sets:     mm.Sets,
+	})
+	if err != nil {
+		lfh.logger.WithError(err).Info("failed to write last flush")
+	}
+}
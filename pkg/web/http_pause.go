@@ -0,0 +1,44 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FlushPauser pauses and resumes flushing metrics to the backends.
+type FlushPauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+type pauseHandler struct {
+	logger logrus.FieldLogger
+	pauser FlushPauser
+}
+
+type pauseResponse struct {
+	Paused bool
+}
+
+// pause pauses flushing, and writes the resulting state as JSON.
+func (ph *pauseHandler) pause(w http.ResponseWriter, req *http.Request) {
+	ph.pauser.Pause()
+	ph.paused(w, req)
+}
+
+// resume resumes flushing, and writes the resulting state as JSON.
+func (ph *pauseHandler) resume(w http.ResponseWriter, req *http.Request) {
+	ph.pauser.Resume()
+	ph.paused(w, req)
+}
+
+// paused writes if flushing is paused as JSON.
+func (ph *pauseHandler) paused(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pauseResponse{Paused: ph.pauser.Paused()}); err != nil {
+		ph.logger.WithError(err).Info("failed to write paused state")
+	}
+}
@@ -192,6 +192,8 @@ func translateFromProtobufV2(pbMetricMap *pb.RawMessageV2) *gostatsd.MetricMap {
 		for tagsKey, gauge := range tagMap.TagMap {
 			mm.Gauges[metricName][tagsKey] = gostatsd.Gauge{
 				Value:     gauge.Value,
+				Sum:       gauge.Value,
+				Count:     1,
 				Timestamp: now,
 				Source:    gostatsd.Source(gauge.Hostname),
 				Tags:      gauge.Tags,
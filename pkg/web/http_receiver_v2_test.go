@@ -35,12 +35,24 @@ func TestForwardingEndToEndV2(t *testing.T) {
 	hs, err := web.NewHttpServer(
 		logrus.StandardLogger(),
 		ch,
+		nil,
+		nil,
+		nil,
+		nil,
 		"TestForwardingEndToEndV2",
 		"",
+		nil,
+		0,
+		0,
+		0,
 		false,
 		false,
 		true,
 		false,
+		false,
+		false,
+		false,
+		false,
 	)
 	require.NoError(t, err)
 
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTopMetrics is the number of metric names of each type returned by /debug/top if n is not given.
+const defaultTopMetrics = 10
+
+// MetricVolume is the volume of a metric name received so far in the current flush interval.
+type MetricVolume struct {
+	Name   string
+	Volume float64 // The value of a counter, the number of values of a timer, or the number of values in a set
+	Series int     // The number of series of the name, each with a different set of tags
+}
+
+// TopMetrics is the metric names of each type with the most volume, largest first.
+type TopMetrics struct {
+	Counters []MetricVolume
+	Timers   []MetricVolume
+	Sets     []MetricVolume
+}
+
+// TopMetricsSource provides the n metric names of each type with the most volume in the current flush interval.
+type TopMetricsSource interface {
+	TopMetrics(ctx context.Context, n int) TopMetrics
+}
+
+type topHandler struct {
+	logger logrus.FieldLogger
+	source TopMetricsSource
+}
+
+// top writes the metric names with the most volume as JSON.  The n query parameter is the number of names of each
+// type, which defaults to defaultTopMetrics.
+func (th *topHandler) top(w http.ResponseWriter, req *http.Request) {
+	n := defaultTopMetrics
+	if value := req.URL.Query().Get("n"); value != "" {
+		var err error
+		n, err = strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "n must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(th.source.TopMetrics(req.Context(), n)); err != nil {
+		th.logger.WithError(err).Info("failed to write top metrics")
+	}
+}
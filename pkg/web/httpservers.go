@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"expvar"
 	"fmt"
 	"net/http"
@@ -21,7 +22,11 @@ import (
 type httpServer struct {
 	logger       logrus.FieldLogger
 	address      string
-	Router       *mux.Router // should be private, but project layout is not great.
+	tlsConfig    *tls.Config   // nil if TLS is disabled
+	readTimeout  time.Duration // 0 for no timeout
+	writeTimeout time.Duration // 0 for no timeout
+	idleTimeout  time.Duration // 0 to use readTimeout
+	Router       *mux.Router   // should be private, but project layout is not great.
 	rawMetricsV2 *rawHttpHandlerV2
 }
 
@@ -34,11 +39,11 @@ type route struct {
 
 var done = struct{}{}
 
-func NewHttpServersFromViper(v *viper.Viper, logger logrus.FieldLogger, handler gostatsd.PipelineHandler) ([]*httpServer, error) {
+func NewHttpServersFromViper(v *viper.Viper, logger logrus.FieldLogger, handler gostatsd.PipelineHandler, lastFlush LastFlushSource, pauser FlushPauser, deleter MetricDeleter, topMetrics TopMetricsSource) ([]*httpServer, error) {
 	httpServerNames := v.GetStringSlice("http-servers")
 	servers := make([]*httpServer, 0, len(httpServerNames))
 	for _, httpServerName := range httpServerNames {
-		server, err := newHttpServerFromViper(logger, v, httpServerName, handler)
+		server, err := newHttpServerFromViper(logger, v, httpServerName, handler, lastFlush, pauser, deleter, topMetrics)
 		if err != nil {
 			return nil, fmt.Errorf("failed to make http-server %s: %v", httpServerName, err)
 		}
@@ -47,11 +52,25 @@ func NewHttpServersFromViper(v *viper.Viper, logger logrus.FieldLogger, handler
 	return servers, nil
 }
 
+// LastFlushEnabledFromViper returns true if any http server has enable-last-flush set.
+func LastFlushEnabledFromViper(v *viper.Viper) bool {
+	for _, httpServerName := range v.GetStringSlice("http-servers") {
+		if v.GetBool("http." + httpServerName + ".enable-last-flush") {
+			return true
+		}
+	}
+	return false
+}
+
 func newHttpServerFromViper(
 	logger logrus.FieldLogger,
 	vMain *viper.Viper,
 	serverName string,
 	handler gostatsd.PipelineHandler,
+	lastFlush LastFlushSource,
+	pauser FlushPauser,
+	deleter MetricDeleter,
+	topMetrics TopMetricsSource,
 ) (*httpServer, error) {
 	vSub := util.GetSubViper(vMain, "http."+serverName)
 	vSub.SetDefault("address", "127.0.0.1:8080")
@@ -59,33 +78,89 @@ func newHttpServerFromViper(
 	vSub.SetDefault("enable-expvar", false)
 	vSub.SetDefault("enable-ingestion", false)
 	vSub.SetDefault("enable-healthcheck", true)
+	vSub.SetDefault("enable-last-flush", false)
+	vSub.SetDefault("enable-pause", false)
+	vSub.SetDefault("enable-delete", false)
+	vSub.SetDefault("enable-top", false)
+	vSub.SetDefault("tls-cert-file", "")
+	vSub.SetDefault("tls-key-file", "")
+	vSub.SetDefault("tls-client-ca-file", "")
+	vSub.SetDefault("tls-min-version", "1.2")
+	vSub.SetDefault("tls-cipher-suites", []string{})
+	vSub.SetDefault("read-timeout", time.Duration(0))
+	vSub.SetDefault("write-timeout", time.Duration(0))
+	vSub.SetDefault("idle-timeout", time.Duration(0))
+
+	tlsConfig, err := newTLSConfig(
+		vSub.GetString("tls-cert-file"),
+		vSub.GetString("tls-key-file"),
+		vSub.GetString("tls-client-ca-file"),
+		vSub.GetString("tls-min-version"),
+		vSub.GetStringSlice("tls-cipher-suites"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	readTimeout := vSub.GetDuration("read-timeout")
+	writeTimeout := vSub.GetDuration("write-timeout")
+	idleTimeout := vSub.GetDuration("idle-timeout")
+	if readTimeout < 0 || writeTimeout < 0 || idleTimeout < 0 {
+		return nil, fmt.Errorf("read-timeout, write-timeout, and idle-timeout must not be negative")
+	}
 
 	return NewHttpServer(
 		logger.WithField("http-server", serverName),
 		handler,
+		lastFlush,
+		pauser,
+		deleter,
+		topMetrics,
 		serverName,
 		vSub.GetString("address"),
+		tlsConfig,
+		readTimeout,
+		writeTimeout,
+		idleTimeout,
 		vSub.GetBool("enable-prof"),
 		vSub.GetBool("enable-expvar"),
 		vSub.GetBool("enable-ingestion"),
 		vSub.GetBool("enable-healthcheck"),
+		vSub.GetBool("enable-last-flush"),
+		vSub.GetBool("enable-pause"),
+		vSub.GetBool("enable-delete"),
+		vSub.GetBool("enable-top"),
 	)
 }
 
 func NewHttpServer(
 	logger logrus.FieldLogger,
 	handler gostatsd.PipelineHandler,
+	lastFlush LastFlushSource,
+	pauser FlushPauser,
+	deleter MetricDeleter,
+	topMetrics TopMetricsSource,
 	serverName, address string,
+	tlsConfig *tls.Config,
+	readTimeout, writeTimeout, idleTimeout time.Duration,
 	enableProf,
 	enableExpVar,
 	enableIngestion,
-	enableHealthcheck bool,
+	enableHealthcheck,
+	enableLastFlush,
+	enablePause,
+	enableDelete,
+	enableTop bool,
 ) (*httpServer, error) {
 	var routes []route
 
 	server := &httpServer{
-		logger:  logger,
-		address: address,
+		logger:       logger,
+		address:      address,
+		tlsConfig:    tlsConfig,
+		readTimeout:  readTimeout,
+		writeTimeout: writeTimeout,
+		idleTimeout:  idleTimeout,
 	}
 
 	if enableProf {
@@ -120,8 +195,50 @@ func NewHttpServer(
 		)
 	}
 
+	if enableLastFlush {
+		if lastFlush == nil {
+			return nil, fmt.Errorf("last-flush is only available in standalone mode")
+		}
+		lfh := &lastFlushHandler{logger: logger, source: lastFlush}
+		routes = append(routes,
+			route{path: "/debug/lastflush", handler: lfh.lastFlush, methods: []string{"GET"}, name: "lastflush_get"},
+		)
+	}
+
+	if enablePause {
+		if pauser == nil {
+			return nil, fmt.Errorf("pause is only available in standalone mode")
+		}
+		ph := &pauseHandler{logger: logger, pauser: pauser}
+		routes = append(routes,
+			route{path: "/debug/pause", handler: ph.pause, methods: []string{"POST"}, name: "pause_post"},
+			route{path: "/debug/resume", handler: ph.resume, methods: []string{"POST"}, name: "resume_post"},
+			route{path: "/debug/paused", handler: ph.paused, methods: []string{"GET"}, name: "paused_get"},
+		)
+	}
+
+	if enableDelete {
+		if deleter == nil {
+			return nil, fmt.Errorf("delete is only available in standalone mode")
+		}
+		dh := &deleteHandler{logger: logger, deleter: deleter}
+		routes = append(routes,
+			route{path: "/debug/metric", handler: dh.deleteMetric, methods: []string{"DELETE"}, name: "metric_delete"},
+		)
+	}
+
+	if enableTop {
+		if topMetrics == nil {
+			return nil, fmt.Errorf("top is only available in standalone mode")
+		}
+		th := &topHandler{logger: logger, source: topMetrics}
+		routes = append(routes,
+			route{path: "/debug/top", handler: th.top, methods: []string{"GET"}, name: "top_get"},
+		)
+	}
+
 	if len(routes) == 0 {
-		return nil, fmt.Errorf("must enable at least one of prof, expvar, ingestion, or healthcheck")
+		return nil, fmt.Errorf("must enable at least one of prof, expvar, ingestion, healthcheck, last-flush, pause, delete, or top")
 	}
 
 	router, err := createRoutes(routes)
@@ -134,10 +251,18 @@ func NewHttpServer(
 
 	logger.WithFields(logrus.Fields{
 		"address":            address,
+		"tls":                tlsConfig != nil,
+		"tls-client-auth":    tlsConfig != nil && tlsConfig.ClientCAs != nil,
+		"read-timeout":       readTimeout,
+		"write-timeout":      writeTimeout,
+		"idle-timeout":       idleTimeout,
 		"enable-pprof":       enableProf,
 		"enable-expvar":      enableExpVar,
 		"enable-ingestion":   enableIngestion,
 		"enable-healthcheck": enableHealthcheck,
+		"enable-last-flush":  enableLastFlush,
+		"enable-pause":       enablePause,
+		"enable-delete":      enableDelete,
 	}).Info("Created server")
 
 	return server, nil
@@ -198,8 +323,12 @@ func (hs *httpServer) Run(ctx context.Context) {
 	}
 
 	server := &http.Server{
-		Addr:    hs.address,
-		Handler: hs.Router,
+		Addr:         hs.address,
+		Handler:      hs.Router,
+		TLSConfig:    hs.tlsConfig,
+		ReadTimeout:  hs.readTimeout,
+		WriteTimeout: hs.writeTimeout,
+		IdleTimeout:  hs.idleTimeout,
 	}
 
 	chStopped := make(chan struct{}, 1)
@@ -207,7 +336,12 @@ func (hs *httpServer) Run(ctx context.Context) {
 
 	hs.logger.WithField("address", server.Addr).Info("listening")
 
-	err := server.ListenAndServe()
+	var err error
+	if hs.tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "") // Certificates are already in the TLSConfig
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != http.ErrServerClosed {
 		hs.logger.WithError(err).Error("web server failed")
 		return
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig creates a tls.Config for an http server.  It returns nil if certFile and keyFile are both empty,
+// indicating TLS is disabled.  If clientCAFile is set, clients must present a certificate signed by one of the
+// CAs in it.  An empty cipherSuites uses the Go defaults.
+func newTLSConfig(certFile, keyFile, clientCAFile, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("tls-client-ca-file requires tls-cert-file and tls-key-file")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate: %v", err)
+	}
+
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid tls-min-version %q, must be one of 1.0, 1.1, 1.2, or 1.3", minVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   version,
+	}
+
+	if len(cipherSuites) > 0 {
+		tlsConfig.CipherSuites, err = cipherSuiteIDs(cipherSuites)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls-client-ca-file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls-client-ca-file %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// cipherSuiteIDs converts cipher suite names to their IDs.  Only secure cipher suites are accepted.
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	known := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure tls cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate and its key to dir, returning their paths.
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gostatsd"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestNewTLSConfigDisabled(t *testing.T) {
+	t.Parallel()
+	tlsConfig, err := newTLSConfig("", "", "", "1.2", nil)
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = newTLSConfig("", "", "ca.pem", "1.2", nil)
+	assert.Error(t, err)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Parallel()
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+
+	tlsConfig, err := newTLSConfig(certFile, keyFile, "", "1.3", nil)
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.EqualValues(t, tls.VersionTLS13, tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.CipherSuites)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	tlsConfig, err = newTLSConfig(certFile, keyFile, certFile, "1.2", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+}
+
+func TestNewTLSConfigInvalid(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	_, err := newTLSConfig(certFile, "", "", "1.2", nil)
+	assert.Error(t, err)
+	_, err = newTLSConfig(certFile, keyFile, "", "1.4", nil)
+	assert.Error(t, err)
+	_, err = newTLSConfig(certFile, keyFile, "", "1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err)
+	_, err = newTLSConfig(certFile, keyFile, filepath.Join(dir, "missing.pem"), "1.2", nil)
+	assert.Error(t, err)
+	_, err = newTLSConfig(certFile, keyFile, keyFile, "1.2", nil)
+	assert.Error(t, err)
+}
@@ -2,12 +2,18 @@ package web_test
 
 import (
 	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 
+	"github.com/atlassian/gostatsd"
 	"github.com/atlassian/gostatsd/pkg/web"
 )
 
@@ -18,12 +24,24 @@ func TestHttpServerShutsdown(t *testing.T) {
 	hs, err := web.NewHttpServer(
 		logrus.StandardLogger(),
 		nil,
+		nil,
+		nil,
+		nil,
+		nil,
 		"TestHttpServerShutsdown",
 		"127.0.0.1:0", // should pick a random port to bind to
+		nil,
+		0,
+		0,
+		0,
 		false,
 		false,
 		false,
 		true,
+		false,
+		false,
+		false,
+		false,
 	)
 	require.NoError(t, err)
 
@@ -44,3 +62,257 @@ func TestHttpServerShutsdown(t *testing.T) {
 	case <-chDone:
 	}
 }
+
+type fixedLastFlush struct {
+	mm      *gostatsd.MetricMap
+	flushed time.Time
+}
+
+func (flf *fixedLastFlush) LastFlush() (*gostatsd.MetricMap, time.Time) {
+	return flf.mm, flf.flushed
+}
+
+func TestHttpServerLastFlush(t *testing.T) {
+	t.Parallel()
+	source := &fixedLastFlush{}
+	hs, err := web.NewHttpServer(
+		logrus.StandardLogger(),
+		nil,
+		source,
+		nil,
+		nil,
+		nil,
+		"TestHttpServerLastFlush",
+		"",
+		nil,
+		0,
+		0,
+		0,
+		false,
+		false,
+		false,
+		false,
+		true,
+		false,
+		false,
+		false,
+	)
+	require.NoError(t, err)
+
+	c := httptest.NewServer(hs.Router)
+	defer c.Close()
+
+	resp, err := http.Get(c.URL + "/debug/lastflush")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	source.mm = gostatsd.NewMetricMap()
+	source.mm.Receive(&gostatsd.Metric{Name: "c", Value: 2, Rate: 1, Type: gostatsd.COUNTER})
+	source.mm.Timers["t"] = map[string]gostatsd.Timer{
+		"": {Count: 1, Histogram: map[gostatsd.HistogramThreshold]int{1: 1, gostatsd.HistogramThreshold(math.Inf(1)): 1}},
+	}
+	source.flushed = time.Unix(100, 0).UTC()
+
+	resp, err = http.Get(c.URL + "/debug/lastflush")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Flushed  time.Time
+		Counters gostatsd.Counters
+		Timers   map[string]map[string]struct {
+			Count     int
+			Histogram map[string]int
+		}
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(t, source.flushed, result.Flushed)
+	require.EqualValues(t, 2, result.Counters["c"][""].Value)
+	require.Equal(t, map[string]int{"1": 1, "+Inf": 1}, result.Timers["t"][""].Histogram)
+}
+
+func TestHttpServerLastFlushRequiresSource(t *testing.T) {
+	t.Parallel()
+	_, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, nil, nil, "TestHttpServerLastFlushRequiresSource", "", nil, 0, 0, 0, false, false, false, false, true, false, false, false)
+	require.Error(t, err)
+}
+
+type fakePauser struct {
+	paused bool
+}
+
+func (fp *fakePauser) Pause() {
+	fp.paused = true
+}
+
+func (fp *fakePauser) Resume() {
+	fp.paused = false
+}
+
+func (fp *fakePauser) Paused() bool {
+	return fp.paused
+}
+
+func TestHttpServerPause(t *testing.T) {
+	t.Parallel()
+	pauser := &fakePauser{}
+	hs, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, pauser, nil, nil, "TestHttpServerPause", "", nil, 0, 0, 0, false, false, false, false, false, true, false, false)
+	require.NoError(t, err)
+
+	c := httptest.NewServer(hs.Router)
+	defer c.Close()
+
+	paused := func(method, path string) bool {
+		req, err := http.NewRequest(method, c.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result struct {
+			Paused bool
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Paused
+	}
+	require.False(t, paused("GET", "/debug/paused"))
+	require.True(t, paused("POST", "/debug/pause"))
+	require.True(t, pauser.paused)
+	require.True(t, paused("GET", "/debug/paused"))
+	require.False(t, paused("POST", "/debug/resume"))
+	require.False(t, pauser.paused)
+}
+
+type fakeDeleter struct {
+	name string
+	tags gostatsd.Tags
+}
+
+func (fd *fakeDeleter) DeleteMetric(ctx context.Context, name string, tags gostatsd.Tags) int {
+	fd.name = name
+	fd.tags = tags
+	return 3
+}
+
+func TestHttpServerDelete(t *testing.T) {
+	t.Parallel()
+	deleter := &fakeDeleter{}
+	hs, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, deleter, nil, "TestHttpServerDelete", "", nil, 0, 0, 0, false, false, false, false, false, false, true, false)
+	require.NoError(t, err)
+
+	c := httptest.NewServer(hs.Router)
+	defer c.Close()
+
+	del := func(query string) *http.Response {
+		req, err := http.NewRequest("DELETE", c.URL+"/debug/metric"+query, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := del("")
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = del("?name=a.b")
+	var result struct {
+		Deleted int
+	}
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	require.Equal(t, 3, result.Deleted)
+	require.Equal(t, "a.b", deleter.name)
+	require.Nil(t, deleter.tags)
+
+	resp = del("?name=a.b&tags=x:1,y:2")
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, gostatsd.Tags{"x:1", "y:2"}, deleter.tags)
+
+	// An empty tags parameter only deletes the series without tags
+	resp = del("?name=a.b&tags=")
+	resp.Body.Close()
+	require.Equal(t, gostatsd.Tags{}, deleter.tags)
+}
+
+func TestHttpServerDeleteRequiresDeleter(t *testing.T) {
+	t.Parallel()
+	_, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, nil, nil, "TestHttpServerDeleteRequiresDeleter", "", nil, 0, 0, 0, false, false, false, false, false, false, true, false)
+	require.Error(t, err)
+}
+
+func TestHttpServerPauseRequiresPauser(t *testing.T) {
+	t.Parallel()
+	_, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, nil, nil, "TestHttpServerPauseRequiresPauser", "", nil, 0, 0, 0, false, false, false, false, false, true, false, false)
+	require.Error(t, err)
+}
+
+type fakeTopMetrics struct {
+	n int
+}
+
+func (ftm *fakeTopMetrics) TopMetrics(ctx context.Context, n int) web.TopMetrics {
+	ftm.n = n
+	return web.TopMetrics{Counters: []web.MetricVolume{{Name: "c", Volume: 10, Series: 2}}}
+}
+
+func TestHttpServerTop(t *testing.T) {
+	t.Parallel()
+	source := &fakeTopMetrics{}
+	hs, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, nil, source, "TestHttpServerTop", "", nil, 0, 0, 0, false, false, false, false, false, false, false, true)
+	require.NoError(t, err)
+
+	c := httptest.NewServer(hs.Router)
+	defer c.Close()
+
+	get := func(query string) *http.Response {
+		resp, err := http.Get(c.URL + "/debug/top" + query)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := get("")
+	var result web.TopMetrics
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	require.Equal(t, 10, source.n)
+	require.Equal(t, web.TopMetrics{Counters: []web.MetricVolume{{Name: "c", Volume: 10, Series: 2}}}, result)
+
+	resp = get("?n=3")
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, source.n)
+
+	for _, query := range []string{"?n=0", "?n=x"} {
+		resp = get(query)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestHttpServerTopRequiresSource(t *testing.T) {
+	t.Parallel()
+	_, err := web.NewHttpServer(logrus.StandardLogger(), nil, nil, nil, nil, nil, "TestHttpServerTopRequiresSource", "", nil, 0, 0, 0, false, false, false, false, false, false, false, true)
+	require.Error(t, err)
+}
+
+func TestHttpServersFromViperTimeouts(t *testing.T) {
+	t.Parallel()
+	v := viper.New()
+	v.Set("http-servers", []string{"web"})
+	v.Set("http.web.read-timeout", "10s")
+	v.Set("http.web.write-timeout", "1m")
+	v.Set("http.web.idle-timeout", "2m")
+	servers, err := web.NewHttpServersFromViper(v, logrus.StandardLogger(), nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+
+	v.Set("http.web.read-timeout", "-1s")
+	_, err = web.NewHttpServersFromViper(v, logrus.StandardLogger(), nil, nil, nil, nil, nil)
+	require.Error(t, err)
+}
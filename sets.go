@@ -3,9 +3,10 @@ package gostatsd
 // Set is used for storing aggregated values for sets.
 type Set struct {
 	Values    map[string]struct{}
-	Timestamp Nanotime // Last time value was updated
-	Source    Source   // Hostname of the source of the metric
-	Tags      Tags     // The tags for the set
+	Timestamp Nanotime     // Last time value was updated
+	Source    Source       // Hostname of the source of the metric
+	Tags      Tags         // The tags for the set
+	Estimator *HyperLogLog // If not nil, values have been added to the Estimator rather than kept in Values
 }
 
 // NewSet initialises a new set.
@@ -13,6 +14,23 @@ func NewSet(timestamp Nanotime, values map[string]struct{}, source Source, tags
 	return Set{Values: values, Timestamp: timestamp, Source: source, Tags: tags.Copy()}
 }
 
+// Count returns the number of distinct values in the set, which is an estimate if it has an Estimator.
+func (s Set) Count() int {
+	if s.Estimator == nil {
+		return len(s.Values)
+	}
+	estimator := s.Estimator
+	if len(s.Values) > 0 {
+		// Values received since they were last added to the Estimator
+		estimator = NewHyperLogLog()
+		estimator.Merge(s.Estimator)
+		for value := range s.Values {
+			estimator.Add(value)
+		}
+	}
+	return int(estimator.Estimate())
+}
+
 func (s *Set) AddTagsSetSource(additionalTags Tags, newSource Source) {
 	s.Tags = s.Tags.Concat(additionalTags)
 	s.Source = newSource
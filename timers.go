@@ -1,6 +1,8 @@
 package gostatsd
 
 import (
+	"strconv"
+
 	"github.com/spf13/viper"
 )
 
@@ -29,6 +31,11 @@ type Timer struct {
 
 type HistogramThreshold float64
 
+// MarshalText implements encoding.TextMarshaler, which allows histograms to be encoded as JSON.
+func (ht HistogramThreshold) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(ht), 'g', -1, 64)), nil
+}
+
 // NewTimer initialises a new timer.
 func NewTimer(timestamp Nanotime, values []float64, source Source, tags Tags) Timer {
 	return Timer{Values: values, Timestamp: timestamp, Source: source, Tags: tags.Copy(), SampledCount: float64(len(values))}